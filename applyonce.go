@@ -0,0 +1,146 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// applyOnceCommand sends the current target light state to every light
+// associated with a schedule and exits. This allows running Kelvin from
+// cron or a systemd timer on devices which are too constrained to keep it
+// running. It returns the exit code for the process.
+func applyOnceCommand(configurationFile string, args []string) int {
+	flags := commandFlags("apply-once")
+	err := flags.Parse(args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+
+	if !*flagDebug {
+		setLogLevel(log.ErrorLevel)
+	}
+
+	var c Configuration
+	c.ConfigurationFile = configurationFile
+	err = c.load()
+	if err != nil {
+		fmt.Printf("Could not read configuration %s: %v\n", configurationFile, err)
+		return 1
+	}
+	c.migrateToLatestVersion()
+	configuration = &c
+	err = configureProxy(configuration.Proxy)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	// A running instance controls the lights already
+	lock, err := acquireLock(configuration.secretsPath(lockFilename))
+	if err != nil {
+		fmt.Printf("Could not apply light states: %v\n", err)
+		return 1
+	}
+	defer lock.release()
+
+	runtimeState, err = loadState(configuration.secretsPath(stateFilename))
+	if err != nil {
+		fmt.Printf("Could not read state: %v\n", err)
+	}
+	defer runtimeState.close()
+	sunTimeTable, _ = loadSunTable(configuration.secretsPath(sunTableFilename))
+
+	err = connectBridges()
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	_, err = InitializeLocation(configuration)
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Keep the discovered bridge and the pinned certificate
+	err = configuration.Write()
+	if err != nil {
+		fmt.Printf("Could not save configuration: %v\n", err)
+	}
+
+	l, err := allLights()
+	if err != nil {
+		fmt.Printf("Could not read lights: %v\n", err)
+		return 1
+	}
+	groups, err = allGroups()
+	if err != nil {
+		fmt.Printf("Could not read groups: %v\n", err)
+	}
+	configuration.resolveAssociations(l, groups)
+	for _, light := range l {
+		addLight(light)
+	}
+	now := time.Now()
+	runtimeState.restoreLightStates(lights, now)
+
+	failures := 0
+	for _, light := range lights {
+		result, err := light.applyOnce(now)
+		if err != nil {
+			fmt.Printf("%-32s failed: %v\n", light.Name, err)
+			failures++
+		} else if result != "" {
+			fmt.Printf("%-32s %s\n", light.Name, result)
+		}
+	}
+	if failures > 0 {
+		return 1
+	}
+	return 0
+}
+
+// applyOnce sends the current target light state to the light unless it
+// is off, unreachable or overridden. It returns a description of the
+// result or an empty string if the light isn't associated with a schedule.
+func (light *Light) applyOnce(now time.Time) (string, error) {
+	if !light.Scheduled {
+		return "", nil
+	}
+	if !light.On || !light.Reachable {
+		return "off or unreachable", nil
+	}
+	if light.overridden(now) {
+		return fmt.Sprintf("overridden until %v", light.activeOverride.Until.Format("15:04")), nil
+	}
+
+	state := light.TargetLightState
+	if light.HueLight.hasState(state.ColorTemperature, state.Brightness) {
+		return fmt.Sprintf("already at %vK and %v%% brightness", state.ColorTemperature, state.Brightness), nil
+	}
+	err := light.HueLight.setLightState(state.ColorTemperature, state.Brightness, light.Schedule.transitionTime)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("set to %vK and %v%% brightness", state.ColorTemperature, state.Brightness), nil
+}
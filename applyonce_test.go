@@ -0,0 +1,44 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyOnce(t *testing.T) {
+	now := time.Now()
+	unscheduled := &Light{Name: "Plug", On: true, Reachable: true}
+	if result, err := unscheduled.applyOnce(now); result != "" || err != nil {
+		t.Errorf("Lights without schedule must be ignored, got %q (%v)", result, err)
+	}
+	off := &Light{Name: "Desk", Scheduled: true, Reachable: true}
+	if result, err := off.applyOnce(now); result != "off or unreachable" || err != nil {
+		t.Errorf("Lights which are off must not be changed, got %q (%v)", result, err)
+	}
+	overridden := &Light{Name: "Couch", Scheduled: true, On: true, Reachable: true, activeOverride: Override{Until: now.Add(time.Hour)}}
+	if result, err := overridden.applyOnce(now); !strings.HasPrefix(result, "overridden until") || err != nil {
+		t.Errorf("Overridden lights must not be changed, got %q (%v)", result, err)
+	}
+}
@@ -56,7 +56,7 @@ func extractBinaryFromZipArchive(archiveFile string, binaryName string, destinat
 					continue
 				}
 
-				log.Debugf("Found candidate %s in directory %s\n", filename, dir)
+				updaterLog.Debugf("Found candidate %s in directory %s\n", filename, dir)
 				out, err := ioutil.TempFile(destinationFolder, filepath.Base(binaryName))
 				if err != nil {
 					return "", err
@@ -76,7 +76,7 @@ func extractBinaryFromZipArchive(archiveFile string, binaryName string, destinat
 					os.Remove(out.Name())
 					return "", err
 				}
-				log.Debugf("Extracted binary %v to file %v\n", filename, out.Name())
+				updaterLog.Debugf("Extracted binary %v to file %v\n", filename, out.Name())
 				return out.Name(), nil
 			}
 		}
@@ -118,7 +118,7 @@ func extractBinaryFromTarArchive(archiveFile string, binaryName string, destinat
 				continue
 			}
 
-			log.Debugf("Found candidate %s in directory %s\n", filename, dir)
+			updaterLog.Debugf("Found candidate %s in directory %s\n", filename, dir)
 			out, err := ioutil.TempFile(destinationFolder, filepath.Base(binaryName))
 			if err != nil {
 				return "", err
@@ -131,7 +131,7 @@ func extractBinaryFromTarArchive(archiveFile string, binaryName string, destinat
 				return "", err
 			}
 
-			log.Debugf("Extracted binary %v to file %v\n", filename, out.Name())
+			updaterLog.Debugf("Extracted binary %v to file %v\n", filename, out.Name())
 			return out.Name(), nil
 		}
 	}
@@ -0,0 +1,48 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"embed"
+	"html/template"
+	"io/fs"
+	"net/http"
+)
+
+// The web interface is part of the binary, so updates of the binary always
+// ship matching assets.
+//go:embed gui/static gui/template
+var embeddedAssets embed.FS
+
+// staticFiles serves the static files of the web interface.
+func staticFiles() http.Handler {
+	static, err := fs.Sub(embeddedAssets, "gui/static")
+	if err != nil {
+		panic(err)
+	}
+	return http.FileServer(http.FS(static))
+}
+
+// parseTemplate parses the template of the web interface with the given name.
+func parseTemplate(name string, funcs template.FuncMap) *template.Template {
+	return template.Must(template.New(name).Funcs(funcs).ParseFS(embeddedAssets, "gui/template/"+name))
+}
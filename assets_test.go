@@ -0,0 +1,42 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"html/template"
+	"net/http"
+	"testing"
+)
+
+func TestEmbeddedAssets(t *testing.T) {
+	for _, name := range []string{"init.html", "dashboard.html", "configuration.html", "logs.html", "schedules.html"} {
+		if _, err := embeddedAssets.ReadFile("gui/template/" + name); err != nil {
+			t.Errorf("Template %s should be embedded: %v", name, err)
+		}
+	}
+	parseTemplate("dashboard.html", template.FuncMap{"scheduleNames": scheduleNames})
+
+	recorder := serveRequest(staticFiles(), "GET", "/js/dashboard.js", nil)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Static files should be served from the binary, got %d", recorder.Code)
+	}
+}
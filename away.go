@@ -0,0 +1,117 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Away modes tell Kelvin whether the house is empty.
+const (
+	awayModeNormal     = "normal"
+	awayModeOff        = "off"
+	awayModeSimulation = "simulation"
+)
+
+var awayModes = []string{awayModeNormal, awayModeOff, awayModeSimulation}
+
+// awayStatus is the request and response of the away mode API.
+type awayStatus struct {
+	Mode string `json:"mode"`
+}
+
+// updateAway applies the away mode to all lights. While the house is
+// empty wake-ups are skipped. In mode off all scheduled lights are kept
+// off.
+func updateAway(lights []*Light, mode string, now time.Time) {
+	switch mode {
+	case awayModeOff:
+		keepLightsOff(lights)
+	case awayModeSimulation:
+	default:
+		updateWakeups(lights, configuration.Wakeups, now)
+	}
+	updateAwaySimulation(lights, awaySimulationActive(mode), now)
+}
+
+// keepLightsOff turns every scheduled light off as soon as it is turned on.
+func keepLightsOff(lights []*Light) {
+	for _, light := range lights {
+		if !light.Scheduled || !light.Reachable || !light.On {
+			continue
+		}
+		scheduleLog.Printf("💡 Light %s - Nobody is home. Turning light off...", light.Name)
+		err := light.HueLight.turnOff(light.Schedule.transitionTime)
+		if err != nil {
+			scheduleLog.Warningf("💡 Light %s - Could not turn light off: %v", light.Name, err)
+			continue
+		}
+		light.On = false
+	}
+}
+
+func parseAwayMode(mode string) (string, error) {
+	for _, candidate := range awayModes {
+		if mode == candidate {
+			return mode, nil
+		}
+	}
+	return "", fmt.Errorf("Invalid away mode %q (must be one of %v)", mode, awayModes)
+}
+
+func awayHandler(w http.ResponseWriter, r *http.Request) {
+	mode := runtimeState.awayMode()
+	if mode == "" {
+		mode = awayModeNormal
+		if awaySimulationActive(mode) {
+			mode = awayModeSimulation
+		}
+	}
+	writeJSON(w, http.StatusOK, awayStatus{mode})
+}
+
+// setAwayHandler switches the away mode. The mode survives a restart of
+// Kelvin.
+func setAwayHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var request awayStatus
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	mode, err := parseAwayMode(request.Mode)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	webLog.Printf("Switching to away mode %s as requested by %s", mode, r.RemoteAddr)
+	err = runtimeState.setAwayMode(mode, time.Now())
+	if err != nil {
+		configLog.Warningf("⚙ Could not save state: %v", err)
+	}
+	writeJSON(w, http.StatusOK, awayStatus{mode})
+}
@@ -0,0 +1,66 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAwayMode(t *testing.T) {
+	filename := useRuntimeState(t)
+	useConfiguration(t, &Configuration{})
+
+	router := newRouter()
+	recorder := serveRequest(router, "POST", "/api/away", strings.NewReader(`{"mode": "vacation"}`))
+	if recorder.Code != http.StatusBadRequest {
+		t.Errorf("Invalid away mode should be rejected, got HTTP %d", recorder.Code)
+	}
+	recorder = serveRequest(router, "POST", "/api/away", strings.NewReader(`{"mode": "off"}`))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Away returned HTTP %d: %s", recorder.Code, recorder.Body.String())
+	}
+	runtimeState.close()
+	restored, err := loadState(filename)
+	defer restored.close()
+	if err != nil || restored.awayMode() != awayModeOff {
+		t.Errorf("Away mode should survive a restart, got %q (%v)", restored.awayMode(), err)
+	}
+
+	var requests []hueStateRequest
+	bridge := recordingBridge(t, &requests, `[{"success":{"/lights/2/state/on":false}}]`)
+	hallway := &Light{Name: "Hallway", Scheduled: true, Reachable: true, On: true, HueLight: HueLight{bridge: bridge}}
+	hallway.HueLight.HueLight.Id = "2"
+	unscheduled := &Light{Name: "Garden", Reachable: true, On: true, HueLight: HueLight{bridge: bridge}}
+	updateAway([]*Light{hallway, unscheduled}, runtimeState.awayMode(), time.Now())
+	if len(requests) != 1 || requests[0].On || hallway.On {
+		t.Errorf("Scheduled lights should be turned off while nobody is home, got %+v", requests)
+	}
+
+	serveRequest(router, "POST", "/api/awaysimulation/start", nil)
+	recorder = serveRequest(router, "GET", "/api/away", nil)
+	if !strings.Contains(recorder.Body.String(), `"simulation"`) {
+		t.Errorf("Starting the simulation should switch the away mode: %s", recorder.Body.String())
+	}
+}
@@ -0,0 +1,254 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultAwaySimulationBedtime = 23 * time.Hour
+const defaultAwaySimulationRandomization = 30 * time.Minute
+
+// AwaySimulation turns lights on around sunset and off around bedtime to
+// make the house look occupied. The lights follow their schedule while
+// they are on.
+type AwaySimulation struct {
+	Enabled       bool     `json:"enabled"`
+	Lights        []string `json:"lights,omitempty"`
+	Bridge        string   `json:"bridge,omitempty"`
+	Bedtime       string   `json:"bedtime,omitempty"`
+	Randomization string   `json:"randomization,omitempty"`
+}
+
+// awaySimulation is the parsed version of a configured AwaySimulation.
+type awaySimulation struct {
+	lights        []string
+	bridge        string
+	bedtime       time.Duration
+	randomization time.Duration
+}
+
+// simulationPlan tracks the simulated evening of a single light.
+type simulationPlan struct {
+	on        time.Time
+	off       time.Time
+	state     LightState
+	turnedOn  bool
+	seenOn    bool
+	cancelled bool
+	finished  bool
+}
+
+// awaySimulationActive returns true if the simulation was started via
+// the away mode, enabled in the configuration or by a calendar event. A
+// selected away mode takes precedence over the configuration.
+func awaySimulationActive(mode string) bool {
+	if mode != "" {
+		return mode == awayModeSimulation
+	}
+	return configuration.AwaySimulation != nil && configuration.AwaySimulation.Enabled || calendarAwaySimulation(time.Now())
+}
+
+func (simulation *AwaySimulation) parse() (*awaySimulation, error) {
+	parsed := &awaySimulation{bedtime: defaultAwaySimulationBedtime, randomization: defaultAwaySimulationRandomization}
+	if simulation == nil {
+		return parsed, nil
+	}
+	parsed.lights = simulation.Lights
+	parsed.bridge = simulation.Bridge
+	if simulation.Bedtime != "" {
+		bedtime, err := parseClockTime(simulation.Bedtime)
+		if err != nil {
+			return nil, err
+		}
+		parsed.bedtime = bedtime
+	}
+	if simulation.Randomization != "" {
+		randomization, err := time.ParseDuration(simulation.Randomization)
+		if err != nil || randomization < 0 {
+			return nil, fmt.Errorf("Invalid randomization %q", simulation.Randomization)
+		}
+		if randomization > 3*time.Hour {
+			return nil, fmt.Errorf("Randomization %v exceeds three hours", randomization)
+		}
+		parsed.randomization = randomization
+	}
+	return parsed, nil
+}
+
+// includes returns true if the light takes part in the simulation. All
+// scheduled lights are used if no lights are configured.
+func (simulation *awaySimulation) includes(light *Light) bool {
+	if !light.Scheduled || light.Bridge != simulation.bridge {
+		return false
+	}
+	return len(simulation.lights) == 0 || containsName(simulation.lights, light.Name)
+}
+
+// jitter returns a random offset within the configured randomization.
+func (simulation *awaySimulation) jitter() time.Duration {
+	if simulation.randomization <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(2*simulation.randomization))) - simulation.randomization
+}
+
+// plan calculates the simulated evening of the given day. Every light
+// gets its own random times so the lights don't switch all at once.
+func (simulation *awaySimulation) plan(light *Light, now time.Time) *simulationPlan {
+	year, month, day := now.Date()
+	sunset := light.Schedule.sunset.Time
+	on := time.Date(year, month, day, sunset.Hour(), sunset.Minute(), sunset.Second(), 0, now.Location())
+	off := atClockTime(now, 0, simulation.bedtime)
+	if !off.After(on) {
+		off = atClockTime(now, 1, simulation.bedtime)
+	}
+	on = on.Add(simulation.jitter())
+	off = off.Add(simulation.jitter())
+	if !off.After(on) {
+		off = on
+	}
+	return &simulationPlan{on: on, off: off}
+}
+
+// updateAwaySimulation switches all lights of the simulation according to
+// their plan. Lights which were already on or were turned off by someone
+// else are left alone.
+func updateAwaySimulation(lights []*Light, active bool, now time.Time) {
+	simulation, err := configuration.AwaySimulation.parse()
+	if err != nil {
+		log.Debugf("🤖 Ignoring invalid away simulation: %v", err)
+		active = false
+	}
+
+	for _, light := range lights {
+		if !active || !simulation.includes(light) {
+			if light.simulation != nil {
+				light.stopSimulation(now)
+			}
+			continue
+		}
+		if light.simulation == nil || (now.After(light.simulation.off) && light.simulation.on.Format("2006-01-02") != now.Format("2006-01-02")) {
+			light.simulation = simulation.plan(light, now)
+			scheduleLog.Debugf("💡 Light %s - Simulating presence from %v to %v", light.Name, light.simulation.on.Format("15:04"), light.simulation.off.Format("15:04"))
+		}
+		light.advanceSimulation(now)
+	}
+}
+
+func (light *Light) advanceSimulation(now time.Time) {
+	plan := light.simulation
+	if plan.cancelled || plan.finished || now.Before(plan.on) {
+		return
+	}
+	if !now.Before(plan.off) {
+		if plan.turnedOn {
+			scheduleLog.Printf("💡 Light %s - Away simulation: Turning light off...", light.Name)
+			light.turnOffSimulation(now)
+		}
+		plan.finished = true
+		return
+	}
+
+	if !plan.turnedOn && light.On {
+		// Someone is using the light, don't turn it off later
+		plan.cancelled = true
+		return
+	}
+	if plan.seenOn && !light.On {
+		scheduleLog.Printf("💡 Light %s - Light was turned off during the away simulation. Leaving it alone...", light.Name)
+		plan.cancelled = true
+		light.endOverride(now)
+		return
+	}
+	if light.On {
+		plan.seenOn = true
+	}
+	if plan.turnedOn && plan.state == light.TargetLightState {
+		return
+	}
+
+	if !plan.turnedOn {
+		scheduleLog.Printf("💡 Light %s - Away simulation: Turning light on until %v...", light.Name, plan.off.Format("15:04"))
+	}
+	light.override(Override{Until: plan.off, Reason: overrideReasonSimulation})
+	err := light.HueLight.turnOn(light.TargetLightState, light.Schedule.transitionTime)
+	if err != nil {
+		scheduleLog.Warningf("💡 Light %s - Could not turn light on for the away simulation: %v", light.Name, err)
+		return
+	}
+	plan.turnedOn = true
+	plan.state = light.TargetLightState
+}
+
+// stopSimulation turns the light off if the simulation turned it on and
+// hands it back to Kelvin.
+func (light *Light) stopSimulation(now time.Time) {
+	plan := light.simulation
+	light.simulation = nil
+	if plan.turnedOn && !plan.cancelled && !plan.finished {
+		scheduleLog.Printf("💡 Light %s - Away simulation stopped. Turning light off...", light.Name)
+		light.turnOffSimulation(now)
+	}
+}
+
+func (light *Light) turnOffSimulation(now time.Time) {
+	err := light.HueLight.turnOff(light.Schedule.transitionTime)
+	if err != nil {
+		scheduleLog.Warningf("💡 Light %s - Could not turn light off: %v", light.Name, err)
+	}
+	light.endOverride(now)
+}
+
+// awaySimulationStatus is the response of the away simulation API.
+type awaySimulationStatus struct {
+	Active bool `json:"active"`
+}
+
+func awaySimulationHandler(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, awaySimulationStatus{awaySimulationActive(runtimeState.awayMode())})
+}
+
+// startAwaySimulationHandler starts the simulation regardless of the
+// configuration. It is a shortcut for the away mode simulation.
+func startAwaySimulationHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Starting away simulation as requested by %s", r.RemoteAddr)
+	err := runtimeState.setAwayMode(awayModeSimulation, time.Now())
+	if err != nil {
+		configLog.Warningf("⚙ Could not save state: %v", err)
+	}
+	writeJSON(w, http.StatusOK, awaySimulationStatus{true})
+}
+
+func stopAwaySimulationHandler(w http.ResponseWriter, r *http.Request) {
+	log.Printf("Stopping away simulation as requested by %s", r.RemoteAddr)
+	err := runtimeState.setAwayMode(awayModeNormal, time.Now())
+	if err != nil {
+		configLog.Warningf("⚙ Could not save state: %v", err)
+	}
+	writeJSON(w, http.StatusOK, awaySimulationStatus{false})
+}
@@ -0,0 +1,89 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAwaySimulation(t *testing.T) {
+	for _, invalid := range []AwaySimulation{{Bedtime: "late"}, {Randomization: "-5m"}, {Randomization: "5h"}} {
+		if _, err := invalid.parse(); err == nil {
+			t.Errorf("Away simulation %+v should be invalid", invalid)
+		}
+	}
+
+	useConfiguration(t, &Configuration{AwaySimulation: &AwaySimulation{Enabled: true, Lights: []string{"living room"}, Bedtime: "00:30", Randomization: "0s"}})
+	if !awaySimulationActive("") || awaySimulationActive(awayModeNormal) {
+		t.Errorf("Away simulation should be enabled by the configuration unless an away mode is selected")
+	}
+
+	var requests []hueStateRequest
+	bridge := recordingBridge(t, &requests, `[{"success":{"/lights/5/state/on":true}}]`)
+
+	sunset := time.Date(2024, 3, 1, 18, 20, 0, 0, time.Local)
+	livingRoom := &Light{Name: "Living room", Scheduled: true, TargetLightState: LightState{2700, 80}, HueLight: HueLight{SupportsColorTemperature: true, Dimmable: true, MinimumColorTemperature: 2000, MaximumColorTemperature: 6500, bridge: bridge}}
+	livingRoom.HueLight.HueLight.Id = "5"
+	livingRoom.Schedule.sunset.Time = sunset
+	kitchen := &Light{Name: "Kitchen", Scheduled: true, HueLight: HueLight{bridge: bridge}}
+	lights := []*Light{livingRoom, kitchen}
+
+	updateAwaySimulation(lights, true, sunset.Add(-time.Minute))
+	if len(requests) != 0 || kitchen.simulation != nil {
+		t.Fatalf("Lights should stay off before sunset, got %+v", requests)
+	}
+	if !livingRoom.simulation.off.Equal(time.Date(2024, 3, 2, 0, 30, 0, 0, time.Local)) {
+		t.Errorf("Bedtime after midnight should end the simulation on the next day, got %v", livingRoom.simulation.off)
+	}
+
+	updateAwaySimulation(lights, true, sunset)
+	if len(requests) != 1 || !requests[0].On || livingRoom.activeOverride.Reason != overrideReasonSimulation {
+		t.Fatalf("Simulation should turn the light on at sunset, got %+v", requests)
+	}
+	livingRoom.On = true
+	updateAwaySimulation(lights, true, sunset.Add(time.Minute))
+	livingRoom.TargetLightState = LightState{2400, 70}
+	updateAwaySimulation(lights, true, sunset.Add(2*time.Minute))
+	if len(requests) != 2 {
+		t.Errorf("Simulated light should follow its schedule, got %d requests", len(requests))
+	}
+
+	updateAwaySimulation(lights, true, time.Date(2024, 3, 2, 0, 30, 0, 0, time.Local))
+	if len(requests) != 3 || requests[2].On || !livingRoom.simulation.finished {
+		t.Errorf("Simulation should turn the light off at bedtime, got %+v", requests)
+	}
+	if livingRoom.overridden(time.Date(2024, 3, 2, 0, 30, 0, 0, time.Local)) {
+		t.Errorf("Light should be handed back to Kelvin after the simulation")
+	}
+
+	// Lights which are in use are left alone
+	livingRoom.simulation = nil
+	updateAwaySimulation(lights, true, sunset.Add(time.Hour))
+	if len(requests) != 3 || !livingRoom.simulation.cancelled {
+		t.Errorf("Simulation should not touch lights which are already on")
+	}
+	updateAwaySimulation(lights, false, sunset.Add(time.Hour+time.Minute))
+	if len(requests) != 3 || livingRoom.simulation != nil {
+		t.Errorf("Stopping the simulation should not turn off lights it didn't turn on")
+	}
+}
@@ -25,13 +25,11 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"sort"
 	"strconv"
 	"strings"
 	"time"
 
-	log "github.com/sirupsen/logrus"
 	hue "github.com/stefanwichmann/go.hue"
 )
 
@@ -39,10 +37,16 @@ import (
 // your system.
 // It is used to communicate with all devices.
 type HueBridge struct {
+	Name     string
 	bridge   hue.Bridge
 	BridgeIP string
 	Username string
 	Version  int
+	HTTPS    bool
+	v2       *hueV2Client
+	queue    *requestQueue
+	breaker  circuitBreaker
+	stream   entertainment
 }
 
 const hueBridgeAppName = "kelvin"
@@ -51,32 +55,51 @@ const hueBridgeAppName = "kelvin"
 // If you have a valid configuration this will be used. Otherwise a local
 // discovery will be started, followed by a user registration on your bridge.
 func (bridge *HueBridge) InitializeBridge(configuration *Configuration) error {
-	err := bridge.discover(configuration.Bridge.IP)
+	bridgeConfiguration := configuration.bridgeConfiguration(bridge.Name)
+	if bridgeConfiguration == nil {
+		return fmt.Errorf("Bridge %s not found in configuration", bridge.Name)
+	}
+	if bridge.Name != "" && bridgeConfiguration.IP == "" {
+		// Discovery would find the same bridge again
+		return fmt.Errorf("No IP configured for bridge %s", bridge.Name)
+	}
+
+	err := bridge.discover(bridgeConfiguration.IP)
 	if err != nil {
 		return err
 	}
-	configuration.Bridge.IP = bridge.BridgeIP
+	bridgeConfiguration.IP = bridge.BridgeIP
 
-	if configuration.Bridge.Username != "" {
-		log.Debugf("⌘ Found bridge username in configuration: %s", configuration.Bridge.Username)
-		bridge.Username = configuration.Bridge.Username
+	if bridgeConfiguration.Username != "" {
+		hueLog.Debugf("⌘ Found bridge username in configuration: %s", bridgeConfiguration.Username)
+		bridge.Username = bridgeConfiguration.Username
 	} else {
-		log.Debugf("⌘ No username found in bridge configuration. Starting registration...")
+		hueLog.Debugf("⌘ No username found in bridge configuration. Starting registration...")
 		err := bridge.register()
 		if err != nil {
 			return err
 		}
-		log.Debugf("⌘ Saving new username in bridge configuration: %s", bridge.Username)
-		configuration.Bridge.Username = bridge.Username
+		hueLog.Debugf("⌘ Saving new username in bridge configuration: %s", bridge.Username)
+		bridgeConfiguration.Username = bridge.Username
+	}
+
+	if !*flagDisableRateLimiting {
+		bridge.queue = newRequestQueue(bridgeConfiguration.RequestsPerSecond)
+		hueLog.Debugf("⌘ Enabled rate limiting with %s between API calls", bridge.queue.interval)
 	}
 
-	log.Debugf("⌘ Connecting to bridge %s with username %s", bridge.BridgeIP, bridge.Username)
+	hueLog.Debugf("⌘ Connecting to bridge %s with username %s", bridge.BridgeIP, bridge.Username)
 	err = bridge.connect()
 	if err != nil {
 		return err
 	}
-	log.Println("⌘ Connection to bridge established")
+	hueLog.Println("⌘ Connection to bridge established")
 	bridge.validateSofwareVersion()
+	bridge.enableV2(bridgeConfiguration)
+
+	if bridge.Name != "" {
+		return nil
+	}
 
 	err = bridge.populateSchedule(configuration)
 	return err
@@ -85,11 +108,22 @@ func (bridge *HueBridge) InitializeBridge(configuration *Configuration) error {
 // Lights return all known lights on your bridge.
 func (bridge *HueBridge) Lights() ([]*Light, error) {
 	var lights []*Light
-	hueLights, err := bridge.bridge.GetAllLights()
+	var hueLights []*hue.Light
+	err := bridge.call(nil, "GET /lights", func() error {
+		var err error
+		bridge.throttle(1)
+		hueLights, err = bridge.bridge.GetAllLights()
+		return err
+	})
 	if err != nil {
 		return lights, err
 	}
 
+	capabilities, err := bridge.lightCapabilities()
+	if err != nil {
+		hueLog.Warningf("⌘ Failed to read light capabilities: %v", err)
+	}
+
 	for _, hueLight := range hueLights {
 		var light Light
 		light.ID, err = strconv.Atoi(hueLight.Id)
@@ -97,8 +131,11 @@ func (bridge *HueBridge) Lights() ([]*Light, error) {
 			return lights, err
 		}
 
+		light.Bridge = bridge.Name
+		light.HueLight.bridge = bridge
 		light.HueLight.HueLight = *hueLight
 		light.HueLight.initialize(hueLight.Attributes)
+		light.HueLight.applyCapabilities(capabilities[hueLight.Id])
 		light.Name = light.HueLight.Name
 		light.Reachable = light.HueLight.Reachable
 		light.On = light.HueLight.On
@@ -110,10 +147,33 @@ func (bridge *HueBridge) Lights() ([]*Light, error) {
 	return lights, nil
 }
 
+// lightCapabilities returns the capabilities of all lights on the bridge
+// by their ID. They are not part of the light attributes of go.hue.
+func (bridge *HueBridge) lightCapabilities() (map[string]hueLightCapabilities, error) {
+	var result map[string]struct {
+		Capabilities hueLightCapabilities `json:"capabilities"`
+	}
+	err := bridge.apiRequest("GET", "/lights", nil, &result)
+	if err != nil {
+		return nil, err
+	}
+	capabilities := make(map[string]hueLightCapabilities)
+	for id, light := range result {
+		capabilities[id] = light.Capabilities
+	}
+	return capabilities, nil
+}
+
 // LightStates returns the current state for lights on the bridge
-func (bridge *HueBridge) LightStates() (map[int]hue.LightAttributes, error) {
+func (bridge *HueBridge) LightStates(parent *span) (map[int]hue.LightAttributes, error) {
 	var states = make(map[int]hue.LightAttributes)
-	hueLights, err := bridge.bridge.GetAllLights()
+	var hueLights []*hue.Light
+	err := bridge.call(parent, "GET /lights", func() error {
+		var err error
+		bridge.throttle(1)
+		hueLights, err = bridge.bridge.GetAllLights()
+		return err
+	})
 	if err != nil {
 		return states, err
 	}
@@ -140,7 +200,7 @@ func (bridge *HueBridge) discover(ip string) error {
 		}
 		return nil
 	}
-	log.Debugf("⌘ Starting bridge discovery")
+	hueLog.Debugf("⌘ Starting bridge discovery")
 	bridges, err := hue.DiscoverBridges(false)
 	if err != nil {
 		bridge.BridgeIP = ""
@@ -154,7 +214,7 @@ func (bridge *HueBridge) discover(ip string) error {
 		bridge.BridgeIP = candidate.IpAddr
 		err := bridge.validateBridge()
 		if err == nil {
-			log.Printf("⌘ Found bridge at %s", bridge.BridgeIP)
+			hueLog.Printf("⌘ Found bridge at %s", bridge.BridgeIP)
 			return nil
 		}
 	}
@@ -168,25 +228,32 @@ func (bridge *HueBridge) register() error {
 	}
 
 	bridge.bridge = *hue.NewBridge(bridge.BridgeIP, "")
-	log.Printf("⌘ Starting user registration.")
-	log.Warningf("⌘ PLEASE PUSH THE BLUE BUTTON ON YOUR HUE BRIDGE")
+	hueLog.Printf("⌘ Starting user registration.")
+	hueLog.Warningf("⌘ PLEASE PUSH THE BLUE BUTTON ON YOUR HUE BRIDGE")
 	for {
 		time.Sleep(5 * time.Second)
 
 		// try user creation, will fail if the button wasn't pressed.
-		err := bridge.bridge.CreateUser(hueBridgeAppName)
+		err := bridge.createUser()
 		if err != nil {
-			log.Debugf("⌘ Button wasn't pressed yet. Waiting...")
+			hueLog.Debugf("⌘ Button wasn't pressed yet. Waiting...")
 			continue
 		}
+		hueLog.Printf("⌘ User registration successful.")
+		return nil
+	}
+}
 
-		if bridge.bridge.Username != "" {
-			// registration successful
-			bridge.Username = bridge.bridge.Username
-			log.Printf("⌘ User registration successful.")
-			return nil
-		}
+func (bridge *HueBridge) createUser() error {
+	err := bridge.bridge.CreateUser(hueBridgeAppName)
+	if err != nil {
+		return err
+	}
+	if bridge.bridge.Username == "" {
+		return errors.New("Bridge didn't return a username")
 	}
+	bridge.Username = bridge.bridge.Username
+	return nil
 }
 
 func (bridge *HueBridge) connect() error {
@@ -213,15 +280,11 @@ func (bridge *HueBridge) connect() error {
 	}
 	if configuration.ModelId == "BSB002" && swversion >= 1802201122 && !*flagDisableHTTPS {
 		bridge.bridge.EnableHTTPS(true)
-		log.Debugf("⌘ Enabled HTTPS for the bridge connection")
-	}
-
-	if !*flagDisableRateLimiting {
-		bridge.bridge.EnableRateLimiting(timeBetweenHueAPICalls)
-		log.Debugf("⌘ Enabled rate limiting with %s between API calls", timeBetweenHueAPICalls)
+		bridge.HTTPS = true
+		hueLog.Debugf("⌘ Enabled HTTPS for the bridge connection")
 	}
 
-	log.Debugf("⌘ Connected to bridge \"%s\" (Model: %s, API version: %s)", configuration.Name, configuration.ModelId, configuration.APIVersion)
+	hueLog.Debugf("⌘ Connected to bridge \"%s\" (Model: %s, API version: %s)", configuration.Name, configuration.ModelId, configuration.APIVersion)
 	return nil
 }
 
@@ -232,14 +295,14 @@ func (bridge *HueBridge) populateSchedule(configuration *Configuration) error {
 
 	// Do we have associated lights?
 	for _, schedule := range configuration.Schedules {
-		if len(schedule.AssociatedDeviceIDs) > 0 {
-			log.Debugf("⌘ Configuration contains at least one schedule with associated lights.")
+		if len(schedule.AssociatedDeviceIDs) > 0 || len(schedule.AssociatedDeviceNames) > 0 || len(schedule.AssociatedGroups) > 0 || schedule.Default {
+			hueLog.Debugf("⌘ Configuration contains at least one schedule with associated lights.")
 			return nil // At least one schedule is configured
 		}
 	}
 
 	// No schedule has associated lights
-	log.Debugf("⌘ Configuration contains no schedule with associated lights. Initializing first schedule with all lights.")
+	hueLog.Debugf("⌘ Configuration contains no schedule with associated lights. Initializing first schedule with all lights.")
 	lights, err := bridge.Lights()
 	if err != nil {
 		return err
@@ -255,21 +318,21 @@ func (bridge *HueBridge) populateSchedule(configuration *Configuration) error {
 func (bridge *HueBridge) validateSofwareVersion() {
 	configuration, err := bridge.bridge.Configuration()
 	if err != nil {
-		log.Warningf("⌘ Could not validate bridge software version: %v", err)
+		hueLog.Warningf("⌘ Could not validate bridge software version: %v", err)
 		return
 	}
 
 	swversion, err := strconv.Atoi(configuration.SoftwareVersion)
 	if err != nil {
-		log.Warningf("⌘ Could not validate bridge software version: %v", err)
+		hueLog.Warningf("⌘ Could not validate bridge software version: %v", err)
 		return
 	}
-	log.Debugf("⌘ Bridge is running software version %s", configuration.SoftwareVersion)
+	hueLog.Debugf("⌘ Bridge is running software version %s", configuration.SoftwareVersion)
 
 	if (bridge.Version == 1 && swversion < 1043155) || (bridge.Version == 2 && swversion < 1949203030) {
-		log.Warningf("⌘ Your hue bridge is running an old software version. Please update using the hue app to ensure Kelvin will run smoothly.")
+		hueLog.Warningf("⌘ Your hue bridge is running an old software version. Please update using the hue app to ensure Kelvin will run smoothly.")
 	} else {
-		log.Debugf("⌘ Bridge software is up to date")
+		hueLog.Debugf("⌘ Bridge software is up to date")
 	}
 }
 
@@ -277,7 +340,7 @@ func (bridge *HueBridge) validateBridge() error {
 	if bridge.BridgeIP == "" {
 		return errors.New("No bridge configured. Could not validate")
 	}
-	resp, err := http.Get("http://" + bridge.BridgeIP + "/description.xml")
+	resp, err := localDeviceClient.Get("http://" + bridge.BridgeIP + "/description.xml")
 	if resp != nil {
 		defer resp.Body.Close()
 	}
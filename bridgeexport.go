@@ -0,0 +1,335 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// bridgeExportDescription marks all schedules created by export-to-bridge,
+// so remove-from-bridge never touches schedules of the user.
+const bridgeExportDescription = "Created by kelvin export-to-bridge"
+
+// The v1 API limits names to 32 characters and transition times to
+// 65535 * 100ms.
+const maxHueNameLength = 32
+const maxHueTransitionTime = 65535 * 100 * time.Millisecond
+
+// Schedules following the sun have no fixed times and are sampled instead.
+const bridgeExportSampleInterval = time.Hour
+
+// hueSchedule represents a schedule stored on the bridge. Exported
+// schedules repeat every day.
+type hueSchedule struct {
+	Name        string             `json:"name"`
+	Description string             `json:"description"`
+	Command     hueScheduleCommand `json:"command"`
+	LocalTime   string             `json:"localtime"`
+	Status      string             `json:"status,omitempty"`
+	Recycle     bool               `json:"recycle"`
+}
+
+type hueScheduleCommand struct {
+	Address string      `json:"address"`
+	Method  string      `json:"method"`
+	Body    interface{} `json:"body"`
+}
+
+// hueCreatedResponse is the response of the bridge to a new resource.
+type hueCreatedResponse []struct {
+	Success struct {
+		ID string `json:"id"`
+	} `json:"success"`
+}
+
+func (response hueCreatedResponse) id() (string, error) {
+	if len(response) == 0 || response[0].Success.ID == "" {
+		return "", fmt.Errorf("Bridge didn't return the ID of the new resource")
+	}
+	return response[0].Success.ID, nil
+}
+
+// exportToBridgeCommand stores the schedules of the given day on the
+// bridges. The lights keep roughly following their schedule while Kelvin
+// isn't running. It returns the exit code for the process.
+func exportToBridgeCommand(configurationFile string, args []string) int {
+	flags := commandFlags("export-to-bridge")
+	flagDate := flags.String("date", time.Now().Format("2006-01-02"), "Day whose schedule is exported (YYYY-MM-DD)")
+	err := flags.Parse(args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+	date, err := time.ParseInLocation("2006-01-02", *flagDate, time.Local)
+	if err != nil {
+		fmt.Printf("Invalid date %s: %v\n", *flagDate, err)
+		return 2
+	}
+
+	if !connectForExport(configurationFile) {
+		return 1
+	}
+	failures := 0
+	for _, b := range bridges {
+		// Exporting again replaces the previous export
+		if _, err := b.removeExport(); err != nil {
+			fmt.Printf("Could not remove previous export from bridge %s: %v\n", b.BridgeIP, err)
+			failures++
+			continue
+		}
+		for _, lightSchedule := range configuration.Schedules {
+			if lightSchedule.Bridge != b.Name {
+				continue
+			}
+			members := exportMembers(lightSchedule)
+			if len(members) == 0 {
+				continue
+			}
+			points := exportPoints(configuration.scheduleForDay(lightSchedule, date))
+			err := b.exportSchedule(lightSchedule.Name, points, members)
+			if err != nil {
+				fmt.Printf("%-32s failed: %v\n", lightSchedule.Name, err)
+				failures++
+				continue
+			}
+			fmt.Printf("%-32s exported %d times for %d lights\n", lightSchedule.Name, len(points), len(members))
+		}
+	}
+	if failures > 0 {
+		return 1
+	}
+	return 0
+}
+
+// removeFromBridgeCommand deletes everything created by export-to-bridge.
+func removeFromBridgeCommand(configurationFile string, args []string) int {
+	if err := commandFlags("remove-from-bridge").Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if !connectForExport(configurationFile) {
+		return 1
+	}
+	failures := 0
+	for _, b := range bridges {
+		removed, err := b.removeExport()
+		if err != nil {
+			fmt.Printf("Could not remove export from bridge %s: %v\n", b.BridgeIP, err)
+			failures++
+			continue
+		}
+		fmt.Printf("Removed %d schedules from bridge %s\n", removed, b.BridgeIP)
+	}
+	if failures > 0 {
+		return 1
+	}
+	return 0
+}
+
+// connectForExport loads the configuration, connects all bridges and
+// associates their lights with the schedules.
+func connectForExport(configurationFile string) bool {
+	if !*flagDebug {
+		setLogLevel(log.ErrorLevel)
+	}
+
+	var c Configuration
+	c.ConfigurationFile = configurationFile
+	err := c.load()
+	if err != nil {
+		fmt.Printf("Could not read configuration %s: %v\n", configurationFile, err)
+		return false
+	}
+	c.migrateToLatestVersion()
+	configuration = &c
+	err = configureProxy(configuration.Proxy)
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	sunTimeTable, _ = loadSunTable(configuration.secretsPath(sunTableFilename))
+
+	err = connectBridges()
+	if err != nil {
+		fmt.Println(err)
+		return false
+	}
+	_, err = InitializeLocation(configuration)
+	if err != nil {
+		fmt.Println(err)
+	}
+
+	l, err := allLights()
+	if err != nil {
+		fmt.Printf("Could not read lights: %v\n", err)
+		return false
+	}
+	groups, err = allGroups()
+	if err != nil {
+		fmt.Printf("Could not read groups: %v\n", err)
+	}
+	configuration.resolveAssociations(l, groups)
+	lights = l
+	return true
+}
+
+// exportMembers returns all lights managed by the given schedule today.
+// Lights of multiple schedules only follow the one with the highest
+// priority.
+func exportMembers(lightSchedule LightSchedule) []*Light {
+	var members []*Light
+	for _, light := range lights {
+		if light.Bridge != lightSchedule.Bridge {
+			continue
+		}
+		if winner, found := configuration.scheduleForLight(light.Bridge, light.ID); found && winner.Name == lightSchedule.Name {
+			members = append(members, light)
+		}
+	}
+	return members
+}
+
+// exportPoints returns the light states the bridge switches to during the
+// day. Configured times are used as they are, schedules following the sun
+// are sampled.
+func exportPoints(schedule Schedule) []TimeStamp {
+	var points []TimeStamp
+	if schedule.curve != nil {
+		start := schedule.endOfDay.Add(-24 * time.Hour).Truncate(time.Hour)
+		for t := start; t.Before(schedule.endOfDay); t = t.Add(bridgeExportSampleInterval) {
+			state, err := schedule.lightStateAt(t)
+			if err != nil {
+				continue
+			}
+			points = append(points, TimeStamp{Time: t, ColorTemperature: state.ColorTemperature, Brightness: state.Brightness})
+		}
+		return points
+	}
+	for _, entry := range schedule.Entries() {
+		if !entry.Active {
+			continue
+		}
+		// The bridge only knows minutes
+		if len(points) > 0 && points[len(points)-1].Time.Format("15:04") == entry.Time.Format("15:04") {
+			points = points[:len(points)-1]
+		}
+		points = append(points, TimeStamp{Time: entry.Time, ColorTemperature: entry.ColorTemperature, Brightness: entry.Brightness})
+	}
+	return points
+}
+
+// exportSchedule creates a group of the given lights and a daily schedule
+// for every point. Each schedule fades the lights to the state of its
+// point, starting at the previous point or as late as the maximum
+// transition time requires, so the lights reach every point on time.
+func (bridge *HueBridge) exportSchedule(name string, points []TimeStamp, members []*Light) error {
+	if len(points) == 0 {
+		return fmt.Errorf("Schedule %s has no light states", name)
+	}
+	var ids []string
+	for _, light := range members {
+		ids = append(ids, strconv.Itoa(light.ID))
+	}
+	var created hueCreatedResponse
+	err := bridge.apiRequest("POST", "/groups", map[string]interface{}{"name": hueName("Kelvin "+name, ""), "type": "LightGroup", "lights": ids}, &created)
+	if err != nil {
+		return err
+	}
+	group, err := created.id()
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(points, func(i, j int) bool { return points[i].Time.Before(points[j].Time) })
+	for index, point := range points {
+		// The first point of the day continues the last one of yesterday
+		previous := points[len(points)-1].Time.Add(-24 * time.Hour)
+		if index > 0 {
+			previous = points[index-1].Time
+		}
+		transition := point.Time.Sub(previous)
+		if transition > maxHueTransitionTime {
+			transition = maxHueTransitionTime
+		}
+		start := point.Time.Add(-transition)
+		state := LightState{point.ColorTemperature, point.Brightness}
+		schedule := hueSchedule{
+			Name:        hueName("Kelvin "+name, " "+point.Time.Format("15:04")),
+			Description: bridgeExportDescription,
+			Command:     hueScheduleCommand{Address: fmt.Sprintf("/api/%s/groups/%s/action", bridge.Username, group), Method: "PUT", Body: groupAction(members, state, transition)},
+			LocalTime:   "W127/T" + start.Format("15:04:05"),
+			Status:      "enabled",
+		}
+		err = bridge.apiRequest("POST", "/schedules", schedule, nil)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// removeExport deletes all schedules created by export-to-bridge and the
+// groups they control. It returns the number of deleted schedules.
+func (bridge *HueBridge) removeExport() (int, error) {
+	var schedules map[string]hueSchedule
+	err := bridge.apiRequest("GET", "/schedules", nil, &schedules)
+	if err != nil {
+		return 0, err
+	}
+	groups := make(map[string]bool)
+	removed := 0
+	for id, schedule := range schedules {
+		if schedule.Description != bridgeExportDescription {
+			continue
+		}
+		err = bridge.apiRequest("DELETE", "/schedules/"+id, nil, nil)
+		if err != nil {
+			return removed, err
+		}
+		removed++
+		// Addresses are of the form /api/<username>/groups/<id>/action
+		parts := strings.Split(schedule.Command.Address, "/")
+		if len(parts) == 6 && parts[3] == "groups" {
+			groups[parts[4]] = true
+		}
+	}
+	for group := range groups {
+		err = bridge.apiRequest("DELETE", "/groups/"+group, nil, nil)
+		if err != nil {
+			return removed, err
+		}
+	}
+	return removed, nil
+}
+
+// hueName shortens the name to fit the bridge but keeps the suffix.
+func hueName(name string, suffix string) string {
+	runes := []rune(name)
+	if limit := maxHueNameLength - len([]rune(suffix)); len(runes) > limit {
+		runes = runes[:limit]
+	}
+	return string(runes) + suffix
+}
@@ -0,0 +1,80 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBridgeExport(t *testing.T) {
+	schedules := map[string]hueSchedule{"1": {Name: "Alarm", Command: hueScheduleCommand{Address: "/api/test/groups/1/action"}}}
+	var deleted []string
+	bridge := testBridge(t, func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == "POST" && r.URL.Path == "/api/test/groups":
+			w.Write([]byte(`[{"success":{"id":"7"}}]`))
+		case r.Method == "POST" && r.URL.Path == "/api/test/schedules":
+			var schedule hueSchedule
+			json.NewDecoder(r.Body).Decode(&schedule)
+			id := strconv.Itoa(len(schedules) + 1)
+			schedules[id] = schedule
+			w.Write([]byte(`[{"success":{"id":"` + id + `"}}]`))
+		case r.Method == "GET" && r.URL.Path == "/api/test/schedules":
+			json.NewEncoder(w).Encode(schedules)
+		case r.Method == "DELETE":
+			deleted = append(deleted, strings.TrimPrefix(r.URL.Path, "/api/test"))
+			w.Write([]byte(`[{"success":"deleted"}]`))
+		}
+	})
+
+	day := time.Date(2026, 10, 14, 0, 0, 0, 0, time.Local)
+	points := []TimeStamp{{Time: day.Add(22 * time.Hour), ColorTemperature: 2000, Brightness: 20}, {Time: day.Add(6 * time.Hour), ColorTemperature: 2700, Brightness: 60}, {Time: day.Add(7 * time.Hour), ColorTemperature: 4000, Brightness: 100}}
+	members := []*Light{{ID: 3, Name: "Desk", HueLight: HueLight{SupportsColorTemperature: true, Dimmable: true}}}
+	err := bridge.exportSchedule("A schedule with a very long name", points, members)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(schedules) != 4 {
+		t.Fatalf("Expected a schedule for every point, got %+v", schedules)
+	}
+	morning := schedules["3"]
+	body, _ := json.Marshal(morning.Command.Body)
+	if morning.LocalTime != "W127/T06:00:00" || morning.Command.Address != "/api/test/groups/7/action" || !strings.Contains(string(body), `"ct":250`) || !strings.Contains(string(body), `"transitiontime":36000`) {
+		t.Errorf("The morning should fade from 6:00 to 7:00, got %+v (%s)", morning, body)
+	}
+	if first := schedules["2"]; first.LocalTime != "W127/T04:10:46" || len(first.Name) > maxHueNameLength || !strings.HasSuffix(first.Name, " 06:00") {
+		t.Errorf("Transitions should be limited to the maximum of the bridge, got %+v", first)
+	}
+
+	removed, err := bridge.removeExport()
+	if err != nil || removed != 3 {
+		t.Fatalf("Expected the three exported schedules to be removed, got %d (%v)", removed, err)
+	}
+	if len(deleted) != 4 || !containsString(deleted, "/groups/7") || containsString(deleted, "/schedules/1") {
+		t.Errorf("Only exported schedules and their group should be deleted, got %v", deleted)
+	}
+}
@@ -0,0 +1,436 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const calendarTimeout = 30 * time.Second
+const defaultCalendarUpdateInterval = time.Hour
+const minimumCalendarUpdateInterval = 5 * time.Minute
+
+// Behaviors a calendar event can trigger
+const (
+	calendarActionDisable        = "disable"
+	calendarActionSchedule       = "schedule"
+	calendarActionAwaySimulation = "awaySimulation"
+)
+
+var calendarActions = []string{calendarActionDisable, calendarActionSchedule, calendarActionAwaySimulation}
+
+var calendarClient = &http.Client{Timeout: calendarTimeout, Transport: internetTransport}
+
+// Calendar configures an iCalendar (.ics) file or URL whose events change
+// the behavior of Kelvin while they last.
+type Calendar struct {
+	URL            string         `json:"url"`
+	UpdateInterval string         `json:"updateInterval,omitempty"`
+	Rules          []CalendarRule `json:"rules"`
+}
+
+// CalendarRule maps all events whose summary contains the given text to an
+// action. Disabled schedules are paused, an alternate schedule replaces the
+// regular schedule of its lights and awaySimulation starts the away
+// simulation.
+type CalendarRule struct {
+	Summary   string   `json:"summary"`
+	Action    string   `json:"action"`
+	Schedules []string `json:"schedules,omitempty"`
+	Schedule  string   `json:"schedule,omitempty"`
+}
+
+// calendarEvent is a single event read from the calendar.
+type calendarEvent struct {
+	summary string
+	start   time.Time
+	end     time.Time
+}
+
+// activeCalendarRule is a rule matching an event at a given time. It ends
+// with the last matching event.
+type activeCalendarRule struct {
+	rule CalendarRule
+	end  time.Time
+}
+
+// calendarState holds the last events read from the calendar and the rules
+// applied to the lights.
+type calendarState struct {
+	lock    sync.Mutex
+	events  []calendarEvent
+	applied string
+}
+
+var currentCalendar = &calendarState{}
+
+func (calendar *Calendar) updateInterval() (time.Duration, error) {
+	interval, err := parsePositiveDuration(calendar.UpdateInterval, defaultCalendarUpdateInterval)
+	if err != nil {
+		return 0, err
+	}
+	if interval < minimumCalendarUpdateInterval {
+		return 0, fmt.Errorf("Update interval %v is shorter than %v", interval, minimumCalendarUpdateInterval)
+	}
+	return interval, nil
+}
+
+// startCalendarUpdates reads the calendar in the background. The rules are
+// applied by updateCalendar.
+func startCalendarUpdates(calendar *Calendar) {
+	if calendar == nil {
+		return
+	}
+	interval, err := calendar.updateInterval()
+	if err != nil {
+		configLog.Warningf("⚙ Invalid calendar update interval %q. Using %v...", calendar.UpdateInterval, defaultCalendarUpdateInterval)
+		interval = defaultCalendarUpdateInterval
+	}
+	source := calendar.URL
+	if !isCalendarURL(source) {
+		source = configuration.secretsPath(source)
+	}
+	go supervise("calendar updates", func() {
+		for {
+			events, err := readCalendar(source)
+			if err != nil {
+				log.Warningf("🤖 Could not read calendar: %v", err)
+			} else {
+				log.Debugf("🤖 Read %d events from calendar", len(events))
+				currentCalendar.update(events)
+			}
+			time.Sleep(interval)
+		}
+	})
+}
+
+func isCalendarURL(source string) bool {
+	for _, scheme := range []string{"http://", "https://", "webcal://"} {
+		if strings.HasPrefix(strings.ToLower(source), scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// readCalendar reads all events of the calendar file or URL.
+func readCalendar(source string) ([]calendarEvent, error) {
+	if !isCalendarURL(source) {
+		file, err := os.Open(source)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		return parseICalendar(file)
+	}
+	if strings.HasPrefix(strings.ToLower(source), "webcal://") {
+		source = "https://" + source[len("webcal://"):]
+	}
+	request, err := http.NewRequest("GET", source, nil)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("User-Agent", "kelvin/"+version+" github.com/stefanwichmann/kelvin")
+	response, err := calendarClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Calendar server returned HTTP %d", response.StatusCode)
+	}
+	return parseICalendar(response.Body)
+}
+
+// icalLine is a content line of an iCalendar file, e.g.
+// DTSTART;TZID=Europe/Berlin:20261224T180000.
+type icalLine struct {
+	name       string
+	parameters map[string]string
+	value      string
+}
+
+func parseICalLine(line string) (icalLine, bool) {
+	separator := strings.Index(line, ":")
+	if separator == -1 {
+		return icalLine{}, false
+	}
+	parts := strings.Split(line[:separator], ";")
+	parsed := icalLine{name: strings.ToUpper(parts[0]), parameters: make(map[string]string), value: line[separator+1:]}
+	for _, parameter := range parts[1:] {
+		if kv := strings.SplitN(parameter, "=", 2); len(kv) == 2 {
+			parsed.parameters[strings.ToUpper(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+	return parsed, true
+}
+
+// parseICalendar returns all events of the given calendar. Recurring events
+// are not supported and skipped.
+func parseICalendar(reader io.Reader) ([]calendarEvent, error) {
+	// Long lines are folded into multiple lines starting with whitespace
+	var lines []string
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if (strings.HasPrefix(line, " ") || strings.HasPrefix(line, "\t")) && len(lines) > 0 {
+			lines[len(lines)-1] += line[1:]
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var events []calendarEvent
+	var event calendarEvent
+	var duration time.Duration
+	inEvent, recurring, allDay, hasEnd := false, false, false, false
+	skipped := 0
+	for number, raw := range lines {
+		line, ok := parseICalLine(raw)
+		if !ok {
+			continue
+		}
+		var err error
+		switch {
+		case line.name == "BEGIN" && strings.EqualFold(line.value, "VEVENT"):
+			event, duration = calendarEvent{}, 0
+			inEvent, recurring, allDay, hasEnd = true, false, false, false
+		case !inEvent:
+			continue
+		case line.name == "END" && strings.EqualFold(line.value, "VEVENT"):
+			inEvent = false
+			if recurring {
+				skipped++
+				continue
+			}
+			if event.start.IsZero() {
+				return nil, fmt.Errorf("Event %q in line %d has no start", event.summary, number+1)
+			}
+			if !hasEnd {
+				event.end = event.start.Add(duration)
+				if duration == 0 && allDay {
+					event.end = event.start.AddDate(0, 0, 1)
+				}
+			}
+			events = append(events, event)
+		case line.name == "SUMMARY":
+			event.summary = unescapeICalText(line.value)
+		case line.name == "DTSTART":
+			event.start, allDay, err = parseICalTime(line)
+		case line.name == "DTEND":
+			event.end, _, err = parseICalTime(line)
+			hasEnd = true
+		case line.name == "DURATION":
+			duration, err = parseICalDuration(line.value)
+		case line.name == "RRULE" || line.name == "RDATE":
+			recurring = true
+		}
+		if err != nil {
+			return nil, fmt.Errorf("Line %d: %v", number+1, err)
+		}
+	}
+	if skipped > 0 {
+		log.Debugf("🤖 Skipped %d recurring events of the calendar", skipped)
+	}
+	return events, nil
+}
+
+func unescapeICalText(value string) string {
+	return strings.NewReplacer(`\n`, " ", `\N`, " ", `\,`, ",", `\;`, ";", `\\`, `\`).Replace(value)
+}
+
+// parseICalTime parses dates (all-day events) and times in UTC, in a
+// given time zone or in local time.
+func parseICalTime(line icalLine) (time.Time, bool, error) {
+	location := time.Local
+	if tzid := line.parameters["TZID"]; tzid != "" {
+		if zone, err := time.LoadLocation(tzid); err == nil {
+			location = zone
+		}
+	}
+	if line.parameters["VALUE"] == "DATE" || len(line.value) == len("20060102") {
+		t, err := time.ParseInLocation("20060102", line.value, location)
+		if err != nil {
+			return t, false, fmt.Errorf("Invalid date %q", line.value)
+		}
+		return t, true, nil
+	}
+	if strings.HasSuffix(line.value, "Z") {
+		location = time.UTC
+	}
+	t, err := time.ParseInLocation("20060102T150405", strings.TrimSuffix(line.value, "Z"), location)
+	if err != nil {
+		return t, false, fmt.Errorf("Invalid time %q", line.value)
+	}
+	return t, false, nil
+}
+
+var icalDurationPattern = regexp.MustCompile(`^\+?P(?:(\d+)W)?(?:(\d+)D)?(?:T(?:(\d+)H)?(?:(\d+)M)?(?:(\d+)S)?)?$`)
+
+// parseICalDuration parses durations like P1D or PT2H30M.
+func parseICalDuration(value string) (time.Duration, error) {
+	match := icalDurationPattern.FindStringSubmatch(value)
+	if match == nil {
+		return 0, fmt.Errorf("Invalid duration %q", value)
+	}
+	units := []time.Duration{7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var duration time.Duration
+	for index, unit := range units {
+		if match[index+1] == "" {
+			continue
+		}
+		count, _ := strconv.Atoi(match[index+1])
+		duration += time.Duration(count) * unit
+	}
+	return duration, nil
+}
+
+func (state *calendarState) update(events []calendarEvent) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	state.events = events
+}
+
+// activeRules returns all rules of the calendar matching an event at the
+// given time.
+func (state *calendarState) activeRules(calendar *Calendar, now time.Time) []activeCalendarRule {
+	if calendar == nil {
+		return nil
+	}
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	var active []activeCalendarRule
+	for _, rule := range calendar.Rules {
+		match := activeCalendarRule{rule: rule}
+		for _, event := range state.events {
+			if now.Before(event.start) || !now.Before(event.end) || !strings.Contains(strings.ToLower(event.summary), strings.ToLower(rule.Summary)) {
+				continue
+			}
+			if event.end.After(match.end) {
+				match.end = event.end
+			}
+		}
+		if !match.end.IsZero() {
+			active = append(active, match)
+		}
+	}
+	return active
+}
+
+// calendarAwaySimulation returns true while an event starts the away
+// simulation.
+func calendarAwaySimulation(now time.Time) bool {
+	for _, active := range currentCalendar.activeRules(configuration.Calendar, now) {
+		if active.rule.Action == calendarActionAwaySimulation {
+			return true
+		}
+	}
+	return false
+}
+
+// calendarSchedule reports whether the given schedule is an alternate
+// schedule of the calendar and whether one of its events is active.
+// Alternate schedules are only used during their events.
+func (configuration *Configuration) calendarSchedule(name string, now time.Time) (bool, bool) {
+	if configuration.Calendar == nil {
+		return false, false
+	}
+	alternate := false
+	for _, rule := range configuration.Calendar.Rules {
+		if rule.Action == calendarActionSchedule && rule.Schedule == name {
+			alternate = true
+		}
+	}
+	if !alternate {
+		return false, false
+	}
+	for _, active := range currentCalendar.activeRules(configuration.Calendar, now) {
+		if active.rule.Action == calendarActionSchedule && active.rule.Schedule == name {
+			return true, true
+		}
+	}
+	return true, false
+}
+
+// updateCalendar applies the rules of all events which started or ended
+// since the last call. Disabled schedules are paused until the end of the
+// event. If an alternate schedule starts or ends the schedules of all
+// lights are calculated again.
+func updateCalendar(lights []*Light, now time.Time) {
+	active := currentCalendar.activeRules(configuration.Calendar, now)
+	var keys []string
+	for _, a := range active {
+		keys = append(keys, fmt.Sprintf("%s/%s/%s@%v", a.rule.Summary, a.rule.Action, a.rule.Schedule, a.end.Unix()))
+	}
+	sort.Strings(keys)
+	applied := strings.Join(keys, ",")
+
+	currentCalendar.lock.Lock()
+	previous := currentCalendar.applied
+	currentCalendar.applied = applied
+	currentCalendar.lock.Unlock()
+	if applied == previous {
+		return
+	}
+
+	for _, a := range active {
+		if a.rule.Action != calendarActionDisable {
+			continue
+		}
+		schedules := a.rule.Schedules
+		if len(schedules) == 0 {
+			for _, schedule := range configuration.Schedules {
+				schedules = append(schedules, schedule.Name)
+			}
+		}
+		for _, name := range schedules {
+			if until, paused := runtimeState.pausedUntil(name, now); paused && !until.Before(a.end) {
+				continue
+			}
+			log.Printf("🤖 Pausing schedule %s until %v for calendar event %s", name, a.end.Format("Jan 2 15:04"), a.rule.Summary)
+			pauseScheduleUntil(name, a.end, now)
+		}
+	}
+
+	log.Printf("🤖 Calendar events changed. Calculating schedules...")
+	for _, light := range lights {
+		light := light
+		safely("light "+light.Name, func() { updateScheduleForLight(light) })
+	}
+	dashboardEvents.publish(dashboardEvent{Type: "schedule"})
+}
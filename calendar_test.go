@@ -0,0 +1,84 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCalendar(t *testing.T) {
+	ics := "BEGIN:VCALENDAR\r\nVERSION:2.0\r\n" +
+		"BEGIN:VEVENT\r\nSUMMARY:Summer vacation\r\nDTSTART;VALUE=DATE:20260801\r\nDTEND;VALUE=DATE:20260815\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nSUMMARY:Birthday p\r\n arty\\, garden\r\nDTSTART:20260705T160000Z\r\nDURATION:PT6H\r\nEND:VEVENT\r\n" +
+		"BEGIN:VEVENT\r\nSUMMARY:Yoga\r\nDTSTART;TZID=Europe/Berlin:20260706T180000\r\nRRULE:FREQ=WEEKLY\r\nEND:VEVENT\r\n" +
+		"END:VCALENDAR\r\n"
+	events, err := parseICalendar(strings.NewReader(ics))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 2 {
+		t.Fatalf("Expected two events without the recurring one, got %+v", events)
+	}
+	if events[1].summary != "Birthday party, garden" || !events[1].start.Equal(time.Date(2026, 7, 5, 16, 0, 0, 0, time.UTC)) || events[1].end.Sub(events[1].start) != 6*time.Hour {
+		t.Errorf("Unexpected event %+v", events[1])
+	}
+	if _, err := parseICalendar(strings.NewReader("BEGIN:VEVENT\nSUMMARY:Broken\nDTSTART:tomorrow\nEND:VEVENT\n")); err == nil {
+		t.Errorf("Invalid times should be rejected")
+	}
+
+	defer func(previous *calendarState) { currentCalendar = previous }(currentCalendar)
+	currentCalendar = &calendarState{}
+	currentCalendar.update(events)
+	useConfiguration(t, &Configuration{
+		Calendar: &Calendar{URL: "family.ics", Rules: []CalendarRule{
+			{Summary: "vacation", Action: calendarActionAwaySimulation},
+			{Summary: "Party", Action: calendarActionSchedule, Schedule: "Party"},
+		}},
+		Schedules: []LightSchedule{{Name: "Living room", AssociatedDeviceIDs: []int{1, 2}, Priority: 1}, {Name: "Party", AssociatedDeviceIDs: []int{2}}},
+	})
+	report := configuration.Validate()
+	if strings.Contains(strings.Join(report.Errors, " "), "Calendar") {
+		t.Errorf("Calendar should be valid: %v", report.Errors)
+	}
+
+	party := time.Date(2026, 7, 5, 18, 0, 0, 0, time.UTC)
+	if schedule, _ := configuration.scheduleForLightOnDay("", 2, party.Add(-time.Hour*3)); schedule.Name != "Living room" {
+		t.Errorf("Alternate schedule should only be used during its events, got %s", schedule.Name)
+	}
+	if schedule, _ := configuration.scheduleForLightOnDay("", 2, party); schedule.Name != "Party" {
+		t.Errorf("Alternate schedule should take precedence during the party, got %s", schedule.Name)
+	}
+	if schedule, _ := configuration.scheduleForLightOnDay("", 1, party); schedule.Name != "Living room" {
+		t.Errorf("Lights of other schedules should be left alone, got %s", schedule.Name)
+	}
+	if calendarAwaySimulation(party) || !calendarAwaySimulation(time.Date(2026, 8, 3, 12, 0, 0, 0, time.Local)) {
+		t.Errorf("Away simulation should only run during the vacation")
+	}
+
+	configuration.Calendar.Rules = append(configuration.Calendar.Rules, CalendarRule{Summary: "Birthday", Action: "dim"}, CalendarRule{Action: calendarActionDisable, Schedules: []string{"Kitchen"}})
+	report = configuration.Validate()
+	if messages := strings.Join(report.Errors, " "); !strings.Contains(messages, "Unknown action dim") || !strings.Contains(messages, "Unknown schedule Kitchen") || !strings.Contains(messages, "require a summary") {
+		t.Errorf("Invalid rules should be reported: %v", report.Errors)
+	}
+}
@@ -0,0 +1,123 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"time"
+)
+
+const defaultAutoMaxColorTemperature = 5500
+const defaultAutoEveningColorTemperature = 2200
+const defaultAutoBedtime = 23 * time.Hour
+const autoNightBrightness = 10
+const autoWindDownDuration = time.Hour
+const autoNightDuration = 8 * time.Hour
+
+// AutoMode tunes the curve of schedules in mode auto. All values are
+// optional.
+type AutoMode struct {
+	MaxColorTemperature     int    `json:"maxColorTemperature,omitempty"`
+	EveningColorTemperature int    `json:"eveningColorTemperature,omitempty"`
+	Bedtime                 string `json:"bedtime,omitempty"`
+}
+
+// autoCurve derives a circadian curve for a single day from the location
+// of the schedule. The lights reach the maximum color temperature when the
+// sun is at its highest, warm up in the evening and dim towards bedtime.
+type autoCurve struct {
+	daylight                *elevationCurve
+	eveningColorTemperature int
+	bedtime                 time.Duration
+}
+
+// newAutoCurve calculates the curve for the day of the given date. Invalid
+// values are replaced with the defaults and reported.
+func newAutoCurve(configured *AutoMode, date time.Time, latitude float64, longitude float64) (*autoCurve, error) {
+	if configured == nil {
+		configured = &AutoMode{}
+	}
+	maxColorTemperature := configured.MaxColorTemperature
+	if maxColorTemperature == 0 {
+		maxColorTemperature = defaultAutoMaxColorTemperature
+	}
+	evening := configured.EveningColorTemperature
+	if evening == 0 {
+		evening = defaultAutoEveningColorTemperature
+	}
+	curve := &autoCurve{eveningColorTemperature: evening, bedtime: defaultAutoBedtime}
+
+	var err error
+	if configured.Bedtime != "" {
+		var bedtime time.Duration
+		bedtime, err = parseClockTime(configured.Bedtime)
+		if err == nil {
+			curve.bedtime = bedtime
+		}
+	}
+
+	// The highest point of the sun changes with latitude and season
+	peak := maximumSolarElevation(date, latitude, longitude)
+	if peak < 1 {
+		peak = 1
+	}
+	curve.daylight = newElevationCurve([]ElevationPoint{
+		{-6, evening, 60},
+		{0, evening + (maxColorTemperature-evening)/3, 80},
+		{peak, maxColorTemperature, 100},
+	}, latitude, longitude)
+	return curve, err
+}
+
+// maximumSolarElevation returns the elevation of the sun at solar noon on
+// the day of the given date.
+func maximumSolarElevation(date time.Time, latitude float64, longitude float64) float64 {
+	start := atClockTime(date, 0, 0)
+	end := atClockTime(date, 1, 0)
+	maximum := -90.0
+	for t := start; t.Before(end); t = t.Add(10 * time.Minute) {
+		if elevation := solarElevation(t, latitude, longitude); elevation > maximum {
+			maximum = elevation
+		}
+	}
+	return maximum
+}
+
+// stateAt follows the sun during the day. During the hour before bedtime
+// the lights are dimmed and warmed progressively and they stay dim until
+// the sun rises or the night is over.
+func (curve *autoCurve) stateAt(timestamp time.Time) LightState {
+	elevation := solarElevation(timestamp, curve.daylight.latitude, curve.daylight.longitude)
+	state := curve.daylight.stateForElevation(elevation)
+	night := LightState{curve.eveningColorTemperature, autoNightBrightness}
+
+	for _, bedtime := range []time.Time{atClockTime(timestamp, -1, curve.bedtime), atClockTime(timestamp, 0, curve.bedtime)} {
+		start := bedtime.Add(-autoWindDownDuration)
+		if !timestamp.Before(start) && timestamp.Before(bedtime) {
+			w := windDown{duration: autoWindDownDuration, target: night}
+			return w.stateAt(start, state, timestamp)
+		}
+		if !timestamp.Before(bedtime) && timestamp.Before(bedtime.Add(autoNightDuration)) && elevation < 0 {
+			return night
+		}
+	}
+	return state
+}
@@ -0,0 +1,63 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestAutoMode(t *testing.T) {
+	berlin := time.FixedZone("CEST", 2*60*60)
+	date := time.Date(2021, 6, 21, 0, 0, 0, 0, berlin)
+	curve, err := newAutoCurve(&AutoMode{MaxColorTemperature: 5000, Bedtime: "22:30"}, date, 52.52, 13.405)
+	if err != nil {
+		t.Fatalf("Could not create auto curve: %v", err)
+	}
+	if peak := curve.daylight.points[2].Elevation; math.Abs(peak-60.9) > 0.5 {
+		t.Errorf("Curve should peak at the highest elevation of the day: %.2f", peak)
+	}
+	if state := curve.stateAt(time.Date(2021, 6, 21, 13, 8, 0, 0, berlin)); state.ColorTemperature < 4990 || state.Brightness != 100 {
+		t.Errorf("Unexpected state at solar noon: %+v", state)
+	}
+	if state := curve.stateAt(time.Date(2021, 6, 21, 22, 0, 0, 0, berlin)); state.Brightness <= autoNightBrightness || state.Brightness >= 60 {
+		t.Errorf("Lights should dim before bedtime: %+v", state)
+	}
+	if state := curve.stateAt(time.Date(2021, 6, 21, 23, 30, 0, 0, berlin)); state != (LightState{2200, autoNightBrightness}) {
+		t.Errorf("Lights should stay dim after bedtime: %+v", state)
+	}
+	if state := curve.stateAt(time.Date(2021, 6, 21, 3, 0, 0, 0, berlin)); state != (LightState{2200, autoNightBrightness}) {
+		t.Errorf("Lights should stay dim at night: %+v", state)
+	}
+	if state := curve.stateAt(time.Date(2021, 6, 21, 6, 0, 0, 0, berlin)); state.Brightness <= autoNightBrightness {
+		t.Errorf("Lights should brighten once the sun has risen: %+v", state)
+	}
+
+	if _, err := newAutoCurve(&AutoMode{Bedtime: "late"}, date, 52.52, 13.405); err == nil {
+		t.Errorf("Invalid bedtimes should be reported")
+	}
+	c := Configuration{Location: Location{Latitude: 52.52, Longitude: 13.405}, Schedules: []LightSchedule{{Name: "Auto", Default: true, Mode: scheduleModeAuto, Auto: &AutoMode{Bedtime: "late"}}}}
+	if report := c.Validate(); len(report.Errors) == 0 {
+		t.Errorf("Invalid bedtime should fail validation")
+	}
+}
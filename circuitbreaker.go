@@ -0,0 +1,171 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"errors"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+const retryAttempts = 3
+const retryBaseDelay = 100 * time.Millisecond
+const circuitBreakerThreshold = 5
+const circuitBreakerMinDelay = 5 * time.Second
+const circuitBreakerMaxDelay = 1 * time.Minute
+
+var errBridgeBusy = errors.New("Bridge is busy")
+var errBridgeUnavailable = errors.New("Bridge is unavailable")
+
+// circuitBreaker stops all requests to a bridge after repeated connection
+// failures. Once the delay has passed a single request may probe the
+// bridge. The breaker closes again as soon as a request succeeds.
+type circuitBreaker struct {
+	lock      sync.Mutex
+	failures  int
+	delay     time.Duration
+	openSince time.Time
+	openUntil time.Time
+	probing   bool
+	recovered bool
+}
+
+// isTransient returns true for errors which may disappear when the request
+// is repeated. Errors reported by the API itself are permanent.
+func isTransient(err error) bool {
+	var netError net.Error
+	return errors.As(err, &netError) || errors.Is(err, errBridgeBusy)
+}
+
+// retry runs the operation until it succeeds, fails permanently or the
+// given number of attempts is exhausted. The delay between attempts
+// doubles with every attempt and is jittered to spread out retries.
+func retry(attempts int, operation func() error) error {
+	delay := retryBaseDelay
+	for attempt := 1; ; attempt++ {
+		err := operation()
+		if err == nil || !isTransient(err) || attempt >= attempts {
+			return err
+		}
+		time.Sleep(delay + time.Duration(rand.Int63n(int64(delay/2)+1)))
+		delay *= 2
+	}
+}
+
+// allow returns false while the breaker is open.
+func (breaker *circuitBreaker) allow(now time.Time) bool {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+	if breaker.openSince.IsZero() {
+		return true
+	}
+	if breaker.probing || now.Before(breaker.openUntil) {
+		return false
+	}
+	breaker.probing = true
+	return true
+}
+
+// record updates the breaker with the result of a request.
+func (breaker *circuitBreaker) record(name string, err error, now time.Time) {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+	breaker.probing = false
+
+	// Errors of the API prove that the bridge is reachable
+	if err == nil || !isTransient(err) {
+		if !breaker.openSince.IsZero() {
+			hueLog.Printf("⌘ Bridge %s is reachable again after %v", name, now.Sub(breaker.openSince).Round(time.Second))
+			breaker.recovered = true
+			notifyWebhooks(webhookEvent{Event: webhookBridgeReachable, Bridge: name})
+		}
+		breaker.failures = 0
+		breaker.delay = 0
+		breaker.openSince = time.Time{}
+		return
+	}
+
+	breaker.failures++
+	if breaker.openSince.IsZero() {
+		if breaker.failures < circuitBreakerThreshold {
+			return
+		}
+		hueLog.Warningf("⌘ Bridge %s is unreachable: %v. Pausing updates...", name, err)
+		notifyWebhooks(webhookEvent{Event: webhookBridgeUnreachable, Bridge: name, Message: err.Error()})
+		breaker.openSince = now
+		breaker.delay = circuitBreakerMinDelay
+	} else if breaker.delay *= 2; breaker.delay > circuitBreakerMaxDelay {
+		breaker.delay = circuitBreakerMaxDelay
+	}
+	breaker.openUntil = now.Add(breaker.delay)
+}
+
+// unavailableSince returns the time the breaker opened or the zero time
+// if the bridge is available.
+func (breaker *circuitBreaker) unavailableSince() time.Time {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+	return breaker.openSince
+}
+
+// takeRecovered returns true once after the bridge became reachable again.
+func (breaker *circuitBreaker) takeRecovered() bool {
+	breaker.lock.Lock()
+	defer breaker.lock.Unlock()
+	recovered := breaker.recovered
+	breaker.recovered = false
+	return recovered
+}
+
+// call sends the named request to the bridge with retries. Requests fail
+// immediately while the bridge is unavailable. The request is traced as a
+// step of parent.
+func (bridge *HueBridge) call(parent *span, name string, operation func() error) error {
+	if bridge == nil {
+		return operation()
+	}
+	s := parent.child(name, spanKindClient)
+	s.setAttribute("bridge", bridge.Name)
+	defer s.finish()
+	if !bridge.breaker.allow(time.Now()) {
+		s.setError(errBridgeUnavailable)
+		return errBridgeUnavailable
+	}
+	start := time.Now()
+	err := retry(retryAttempts, operation)
+	bridge.breaker.record(bridge.Name, err, time.Now())
+	s.setError(err)
+	tag := "bridge:" + metricName(bridge.Name)
+	metrics.timing("bridge.request_time", time.Since(start), tag)
+	metrics.count("bridge.requests", 1, tag)
+	if err != nil {
+		metrics.count("bridge.errors", 1, tag)
+	}
+	return err
+}
+
+// available returns false while requests to the bridge are paused.
+func (bridge *HueBridge) available() bool {
+	return bridge.breaker.unavailableSince().IsZero()
+}
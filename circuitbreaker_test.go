@@ -0,0 +1,74 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreaker(t *testing.T) {
+	calls := 0
+	permanent := errors.New("Bridge returned error 7")
+	if err := retry(retryAttempts, func() error { calls++; return permanent }); err != permanent || calls != 1 {
+		t.Errorf("Permanent errors should not be retried (%d calls)", calls)
+	}
+	calls = 0
+	if err := retry(2, func() error { calls++; return errBridgeBusy }); err != errBridgeBusy || calls != 2 {
+		t.Errorf("Transient errors should be retried (%d calls)", calls)
+	}
+	if !isTransient(&net.DNSError{IsTimeout: true}) {
+		t.Errorf("Network errors should be transient")
+	}
+
+	var breaker circuitBreaker
+	now := time.Now()
+	for i := 0; i < circuitBreakerThreshold; i++ {
+		if !breaker.allow(now) {
+			t.Fatalf("Breaker opened after %d failures", i)
+		}
+		breaker.record("", errBridgeBusy, now)
+	}
+	if breaker.allow(now) || breaker.unavailableSince() != now {
+		t.Errorf("Breaker should be open after %d failures", circuitBreakerThreshold)
+	}
+
+	// A failed probe doubles the delay
+	probe := now.Add(circuitBreakerMinDelay)
+	if !breaker.allow(probe) || breaker.allow(probe) {
+		t.Errorf("Breaker should let exactly one probe pass after the delay")
+	}
+	breaker.record("", errBridgeBusy, probe)
+	if breaker.allow(probe.Add(circuitBreakerMinDelay)) || !breaker.allow(probe.Add(2*circuitBreakerMinDelay)) {
+		t.Errorf("Delay should double after a failed probe")
+	}
+
+	breaker.record("", nil, probe.Add(2*circuitBreakerMinDelay))
+	if !breaker.allow(probe) || !breaker.unavailableSince().IsZero() {
+		t.Errorf("Breaker should close after a successful request")
+	}
+	if !breaker.takeRecovered() || breaker.takeRecovered() {
+		t.Errorf("Recovery should be reported exactly once")
+	}
+}
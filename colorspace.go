@@ -5555,3 +5555,36 @@ var lookupTable = map[int][]float64{
 	   6500 : []float64{0.313529922,0.323632448},
 	*/
 }
+
+// colorTemperatureToRGB approximates the given color temperature for RGB
+// lights without native white channels.
+// See https://tannerhelland.com/2012/09/18/convert-temperature-rgb-algorithm-code.html
+func colorTemperatureToRGB(t int) (uint8, uint8, uint8) {
+	if t < 1000 {
+		t = 1000
+	} else if t > 40000 {
+		t = 40000
+	}
+	temperature := float64(t) / 100
+
+	var r, g, b float64
+	if temperature <= 66 {
+		r = 255
+		g = 99.4708025861*math.Log(temperature) - 161.1195681661
+	} else {
+		r = 329.698727446 * math.Pow(temperature-60, -0.1332047592)
+		g = 288.1221695283 * math.Pow(temperature-60, -0.0755148492)
+	}
+	if temperature >= 66 {
+		b = 255
+	} else if temperature <= 19 {
+		b = 0
+	} else {
+		b = 138.5177312231*math.Log(temperature-10) - 305.0447927307
+	}
+	return clampColorChannel(r), clampColorChannel(g), clampColorChannel(b)
+}
+
+func clampColorChannel(value float64) uint8 {
+	return uint8(math.Max(0, math.Min(255, math.Round(value))))
+}
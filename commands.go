@@ -0,0 +1,203 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// command is a subcommand of Kelvin like `kelvin preview`. Every command
+// parses its own flags. Global flags like -configuration are given before
+// the command.
+type command struct {
+	name        string
+	arguments   string
+	description string
+	run         func(args []string) int
+}
+
+func commands() []command {
+	return []command{
+		{"run", "", "Control your lights (default)", runCommand},
+		{"validate", "[configuration]", "Check the configuration for errors without touching your lights", func(args []string) int {
+			flags := commandFlags("validate")
+			if err := flags.Parse(args); err != nil {
+				return flagExitCode(err)
+			}
+			configurationFile := *flagConfigurationFile
+			if flags.NArg() > 0 {
+				configurationFile = absolutePath(flags.Arg(0))
+			}
+			return validateCommand(configurationFile)
+		}},
+		{"migrate", "", "Migrate the configuration to the latest version", func(args []string) int {
+			if err := commandFlags("migrate").Parse(args); err != nil {
+				return flagExitCode(err)
+			}
+			return migrateCommand(*flagConfigurationFile)
+		}},
+		{"preview", "[flags]", "Print the calculated schedule of a light for any day", func(args []string) int {
+			return previewCommand(*flagConfigurationFile, args)
+		}},
+		{"pair", "[flags]", "Register Kelvin at a bridge or Nanoleaf controller", func(args []string) int {
+			return pairCommand(*flagConfigurationFile, args)
+		}},
+		{"apply-once", "", "Set all lights to the current state of their schedule and exit", func(args []string) int {
+			return applyOnceCommand(*flagConfigurationFile, args)
+		}},
+		{"export-to-bridge", "[flags]", "Store the schedules of a day on the bridges to follow them while Kelvin isn't running", func(args []string) int {
+			return exportToBridgeCommand(*flagConfigurationFile, args)
+		}},
+		{"remove-from-bridge", "", "Remove the schedules stored by export-to-bridge", func(args []string) int {
+			return removeFromBridgeCommand(*flagConfigurationFile, args)
+		}},
+		{"doctor", "", "Check the configuration, location, file access and bridges for problems", func(args []string) int {
+			return doctorCommand(*flagConfigurationFile, args)
+		}},
+		{"health", "", "Check that Kelvin is running by requesting /healthz of the web interface", func(args []string) int {
+			return healthCommand(*flagConfigurationFile, args)
+		}},
+		{"lights", "", "List all lights of the configured bridges", func(args []string) int {
+			return lightsCommand(*flagConfigurationFile, args)
+		}},
+		{"schema", "", "Print the JSON schema of the configuration", func(args []string) int {
+			if err := commandFlags("schema").Parse(args); err != nil {
+				return flagExitCode(err)
+			}
+			return schemaCommand()
+		}},
+		{"version", "", "Print the version of Kelvin", versionCommand},
+		{"help", "[command]", "Show the help of a command", helpCommand},
+	}
+}
+
+func findCommand(name string) *command {
+	for _, c := range commands() {
+		if c.name == name {
+			c := c
+			return &c
+		}
+	}
+	return nil
+}
+
+// runSubcommand runs the command given on the command line and returns
+// the exit code for the process. Without a command Kelvin controls the
+// lights.
+func runSubcommand(args []string) int {
+	name := "run"
+	if len(args) > 0 {
+		name = args[0]
+		args = args[1:]
+	}
+	c := findCommand(name)
+	if c == nil {
+		fmt.Fprintf(flag.CommandLine.Output(), "Unknown command %s\n\n", name)
+		usage()
+		return 2
+	}
+	return c.run(args)
+}
+
+// connectBridges initializes all configured bridges once. Unlike Kelvin
+// itself commands don't wait for unreachable bridges.
+func connectBridges() error {
+	for _, additionalBridge := range configuration.Bridges {
+		bridges = append(bridges, &HueBridge{Name: additionalBridge.Name})
+	}
+	for _, b := range bridges {
+		err := b.InitializeBridge(configuration)
+		if err != nil {
+			return fmt.Errorf("Could not initialize bridge %s: %v", b.Name, err)
+		}
+	}
+	return nil
+}
+
+// commandFlags returns the flag set of the given command. Its usage
+// describes the command and all of its flags.
+func commandFlags(name string) *flag.FlagSet {
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.Usage = func() {
+		output := flags.Output()
+		if c := findCommand(name); c != nil {
+			fmt.Fprintf(output, "Usage: kelvin [global flags] %s\n\n%s.\n", strings.TrimSpace(c.name+" "+c.arguments), c.description)
+		}
+		hasFlags := false
+		flags.VisitAll(func(*flag.Flag) { hasFlags = true })
+		if hasFlags {
+			fmt.Fprintf(output, "\nFlags:\n")
+			flags.PrintDefaults()
+		}
+	}
+	return flags
+}
+
+// flagExitCode returns the exit code for a failed parsing of flags.
+// Asking for help is no error.
+func flagExitCode(err error) int {
+	if errors.Is(err, flag.ErrHelp) {
+		return 0
+	}
+	return 2
+}
+
+// usage prints all commands and global flags.
+func usage() {
+	output := flag.CommandLine.Output()
+	fmt.Fprintf(output, "Usage: kelvin [global flags] [command] [flags]\n\nCommands:\n")
+	for _, c := range commands() {
+		fmt.Fprintf(output, "  %-12s %s\n", c.name, c.description)
+	}
+	fmt.Fprintf(output, "\nRun 'kelvin help <command>' for the flags of a command.\n\nGlobal flags:\n")
+	flag.PrintDefaults()
+}
+
+func helpCommand(args []string) int {
+	flags := commandFlags("help")
+	if err := flags.Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if flags.NArg() == 0 {
+		flag.CommandLine.SetOutput(os.Stdout)
+		usage()
+		return 0
+	}
+	c := findCommand(flags.Arg(0))
+	if c == nil {
+		fmt.Printf("Unknown command %s\n", flags.Arg(0))
+		return 2
+	}
+	return c.run([]string{"-h"})
+}
+
+func versionCommand(args []string) int {
+	if err := commandFlags("version").Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	fmt.Printf("Kelvin %s (commit %s, built at %s)\n", version, commit, date)
+	return 0
+}
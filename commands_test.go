@@ -0,0 +1,51 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"io/ioutil"
+	"testing"
+)
+
+func TestCommands(t *testing.T) {
+	for _, name := range []string{"run", "validate", "migrate", "preview", "pair", "apply-once", "export-to-bridge", "remove-from-bridge", "doctor", "health", "lights", "schema", "version", "help"} {
+		if c := findCommand(name); c == nil || c.description == "" {
+			t.Errorf("Command %s should be available", name)
+		}
+	}
+	if findCommand("unknown") != nil {
+		t.Errorf("Unknown commands must not be found")
+	}
+
+	flags := commandFlags("preview")
+	flags.SetOutput(ioutil.Discard)
+	flags.Bool("json", false, "")
+	if code := flagExitCode(flags.Parse([]string{"-h"})); code != 0 {
+		t.Errorf("Expected exit code 0 for help, got %d", code)
+	}
+	if code := flagExitCode(flags.Parse([]string{"-unknown"})); code != 2 {
+		t.Errorf("Expected exit code 2 for unknown flags, got %d", code)
+	}
+	if code := runSubcommand([]string{"version"}); code != 0 {
+		t.Errorf("Expected exit code 0 for version, got %d", code)
+	}
+}
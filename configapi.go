@@ -0,0 +1,267 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+)
+
+// redactedValue replaces credentials in exported configurations. Imported
+// configurations containing it keep the current credential.
+const redactedValue = "********"
+
+// configurationImport reports the result of an imported configuration.
+type configurationImport struct {
+	ValidationReport
+	Backups         []string `json:"backups,omitempty"`
+	RestartRequired bool     `json:"restartRequired"`
+}
+
+func redact(value string) string {
+	if value == "" {
+		return ""
+	}
+	return redactedValue
+}
+
+func unredact(value string, current string) string {
+	if value == redactedValue {
+		return current
+	}
+	return value
+}
+
+// redacted returns a copy of the configuration without any credentials.
+func (configuration *Configuration) redacted() Configuration {
+	export := *configuration
+	export.Bridge.Username = redact(export.Bridge.Username)
+	export.Bridges = nil
+	for _, b := range configuration.Bridges {
+		b.Username = redact(b.Username)
+		export.Bridges = append(export.Bridges, b)
+	}
+	if configuration.NanoleafTokens != nil {
+		export.NanoleafTokens = make(map[string]string)
+		for host, token := range configuration.NanoleafTokens {
+			export.NanoleafTokens[host] = redact(token)
+		}
+	}
+	export.WebInterface.Token = redact(export.WebInterface.Token)
+	export.WebInterface.Password = redact(export.WebInterface.Password)
+	if w := configuration.Weather; w != nil {
+		weather := *w
+		weather.APIKey = redact(weather.APIKey)
+		export.Weather = &weather
+	}
+	if p := configuration.Presence; p != nil && p.MQTT != nil {
+		presence, mqtt := *p, *p.MQTT
+		mqtt.Password = redact(mqtt.Password)
+		presence.MQTT = &mqtt
+		export.Presence = &presence
+	}
+	if m := configuration.MQTT; m != nil {
+		mqtt := *m
+		mqtt.Password = redact(mqtt.Password)
+		export.MQTT = &mqtt
+	}
+	if h := configuration.HomeKit; h != nil {
+		homeKit := *h
+		homeKit.Pin = redact(homeKit.Pin)
+		export.HomeKit = &homeKit
+	}
+	if c := configuration.Calendar; c != nil && isCalendarURL(c.URL) {
+		// Shared calendar URLs usually contain a secret
+		calendar := *c
+		calendar.URL = redact(calendar.URL)
+		export.Calendar = &calendar
+	}
+	if configuration.Webhooks != nil {
+		// Webhook URLs usually contain a token
+		export.Webhooks = make([]Webhook, 0, len(configuration.Webhooks))
+		for _, webhook := range configuration.Webhooks {
+			webhook.URL = redact(webhook.URL)
+			export.Webhooks = append(export.Webhooks, webhook)
+		}
+	}
+	if t := configuration.Tracing; t != nil && t.Headers != nil {
+		tracing := *t
+		tracing.Headers = make(map[string]string)
+		for name, value := range t.Headers {
+			tracing.Headers[name] = redact(value)
+		}
+		export.Tracing = &tracing
+	}
+	if proxy, err := url.Parse(configuration.Proxy); err == nil && proxy.User != nil {
+		export.Proxy = redact(configuration.Proxy)
+	}
+	return export
+}
+
+// restoreCredentials replaces all redacted values of the given
+// configuration with the current credentials.
+func (configuration *Configuration) restoreCredentials(imported *Configuration) {
+	imported.Bridge.Username = unredact(imported.Bridge.Username, configuration.Bridge.Username)
+	for index, b := range imported.Bridges {
+		current := ""
+		if existing := configuration.bridgeConfiguration(b.Name); existing != nil {
+			current = existing.Username
+		}
+		imported.Bridges[index].Username = unredact(b.Username, current)
+	}
+	for host, token := range imported.NanoleafTokens {
+		imported.NanoleafTokens[host] = unredact(token, configuration.NanoleafTokens[host])
+	}
+	imported.WebInterface.Token = unredact(imported.WebInterface.Token, configuration.WebInterface.Token)
+	imported.WebInterface.Password = unredact(imported.WebInterface.Password, configuration.WebInterface.Password)
+	if w := imported.Weather; w != nil {
+		current := ""
+		if configuration.Weather != nil {
+			current = configuration.Weather.APIKey
+		}
+		w.APIKey = unredact(w.APIKey, current)
+	}
+	if p := imported.Presence; p != nil && p.MQTT != nil {
+		current := ""
+		if configuration.Presence != nil && configuration.Presence.MQTT != nil {
+			current = configuration.Presence.MQTT.Password
+		}
+		p.MQTT.Password = unredact(p.MQTT.Password, current)
+	}
+	if m := imported.MQTT; m != nil {
+		current := ""
+		if configuration.MQTT != nil {
+			current = configuration.MQTT.Password
+		}
+		m.Password = unredact(m.Password, current)
+	}
+	if h := imported.HomeKit; h != nil {
+		current := ""
+		if configuration.HomeKit != nil {
+			current = configuration.HomeKit.Pin
+		}
+		h.Pin = unredact(h.Pin, current)
+	}
+	if c := imported.Calendar; c != nil {
+		current := ""
+		if configuration.Calendar != nil {
+			current = configuration.Calendar.URL
+		}
+		c.URL = unredact(c.URL, current)
+	}
+	for index, webhook := range imported.Webhooks {
+		// Webhooks are identified by their position
+		current := ""
+		if index < len(configuration.Webhooks) {
+			current = configuration.Webhooks[index].URL
+		}
+		imported.Webhooks[index].URL = unredact(webhook.URL, current)
+	}
+	if t := imported.Tracing; t != nil {
+		for name, value := range t.Headers {
+			current := ""
+			if configuration.Tracing != nil {
+				current = configuration.Tracing.Headers[name]
+			}
+			t.Headers[name] = unredact(value, current)
+		}
+	}
+	imported.Proxy = unredact(imported.Proxy, configuration.Proxy)
+}
+
+// exportConfigurationHandler serves the current configuration without any
+// credentials. The configuration is encoded in the main loop, as it might
+// be changed there at any time.
+func exportConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+	webLog.Debugf("Serving configuration export to %s", r.RemoteAddr)
+	var data []byte
+	var err error
+	inMainLoop(func() {
+		data, err = json.Marshal(configuration.redacted())
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, http.StatusOK, json.RawMessage(data))
+}
+
+// importConfigurationHandler validates the uploaded configuration, backs
+// up the current one and applies the new configuration. Changes of the
+// bridges, the web interface, the presence detection, the weather or the
+// updates take effect after a restart. The configuration is replaced in the
+// main loop and the handler waits for the result.
+func importConfigurationHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var imported Configuration
+	err := json.NewDecoder(r.Body).Decode(&imported)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var result configurationImport
+	status := http.StatusOK
+	inMainLoop(func() {
+		result, status, err = importConfiguration(imported, r.RemoteAddr)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), status)
+		return
+	}
+	writeJSON(w, status, result)
+}
+
+// importConfiguration validates the given configuration and replaces the
+// current one if it is valid. It must be called in the main loop.
+func importConfiguration(imported Configuration, requester string) (configurationImport, int, error) {
+	configuration.restoreCredentials(&imported)
+	imported.ConfigurationFile = configuration.ConfigurationFile
+	imported.Hash = configuration.Hash
+	imported.overrides = configuration.overrides
+	imported.directory = configuration.directory
+	imported.migrateToLatestVersion()
+
+	result := configurationImport{ValidationReport: imported.Validate()}
+	if !result.Valid() {
+		return result, http.StatusBadRequest, nil
+	}
+
+	configLog.Printf("⚙ Importing configuration uploaded by %s", requester)
+	backups, err := configuration.copyToBackup()
+	if err != nil {
+		return result, http.StatusInternalServerError, errors.New("Could not create backup: " + err.Error())
+	}
+	result.Backups = backups
+	result.RestartRequired = configuration.requiresRestart(&imported)
+
+	*configuration = imported
+	err = configuration.Write()
+	if err != nil {
+		return result, http.StatusInternalServerError, err
+	}
+	configuration.resolveAssociations(lights, groups)
+	requestUpdate()
+	return result, http.StatusOK, nil
+}
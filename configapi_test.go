@@ -0,0 +1,70 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestConfigurationExport(t *testing.T) {
+	c := Configuration{Bridge: Bridge{IP: "192.168.1.10", Username: "user"}, Bridges: []Bridge{{Name: "upstairs", IP: "192.168.1.20", Username: "other"}}}
+	c.NanoleafTokens = map[string]string{"192.168.1.42": "leaf"}
+	c.WebInterface = WebInterface{Enabled: true, Port: 8080, Token: "secret"}
+	c.Presence = &Presence{MQTT: &PresenceMQTT{Broker: "tcp://192.168.1.2", Topic: "home", Password: "broker-secret"}}
+	c.Webhooks = []Webhook{{URL: "https://hooks.example.com/kelvin-token", Events: []string{"schedule"}}}
+
+	export := c.redacted()
+	data, err := json.Marshal(export)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"\"user\"", "\"other\"", "\"leaf\"", "\"secret\"", "\"broker-secret\"", "kelvin-token"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("Export should not contain %s: %s", secret, data)
+		}
+	}
+	if c.Bridges[0].Username != "other" || c.NanoleafTokens["192.168.1.42"] != "leaf" || c.Presence.MQTT.Password != "broker-secret" || c.Webhooks[0].URL != "https://hooks.example.com/kelvin-token" {
+		t.Errorf("Redacting should not modify the configuration")
+	}
+
+	var imported Configuration
+	if err := json.Unmarshal(data, &imported); err != nil {
+		t.Fatal(err)
+	}
+	imported.WebInterface.Password = "new"
+	c.restoreCredentials(&imported)
+	if imported.Bridge.Username != "user" || imported.Bridges[0].Username != "other" || imported.NanoleafTokens["192.168.1.42"] != "leaf" || imported.WebInterface.Token != "secret" || imported.Presence.MQTT.Password != "broker-secret" || imported.Webhooks[0].URL != c.Webhooks[0].URL {
+		t.Errorf("Redacted credentials should be restored, got %+v", imported)
+	}
+	if imported.WebInterface.Password != "new" {
+		t.Errorf("New credentials should be kept, got %s", imported.WebInterface.Password)
+	}
+
+	useConfiguration(t, &c)
+	response := serveRequest(http.HandlerFunc(exportConfigurationHandler), "GET", "/api/config", nil)
+	if response.Code != http.StatusOK || strings.Contains(response.Body.String(), "kelvin-token") || !strings.Contains(response.Body.String(), "192.168.1.20") {
+		t.Errorf("Unexpected export %d: %s", response.Code, response.Body.String())
+	}
+}
@@ -28,6 +28,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"regexp"
+	"strings"
 	"time"
 
 	"github.com/ghodss/yaml"
@@ -36,50 +38,191 @@ import (
 
 // Bridge respresents the hue bridge in your system.
 type Bridge struct {
-	IP       string `json:"ip"`
-	Username string `json:"username"`
+	Name                   string `json:"name,omitempty"`
+	IP                     string `json:"ip"`
+	Username               string `json:"username"`
+	UsernameFile           string `json:"usernameFile,omitempty"`
+	CertificateFingerprint string `json:"certificateFingerprint,omitempty"`
+	RequestsPerSecond      int    `json:"requestsPerSecond,omitempty"`
 }
 
 // Location represents the geolocation for which sunrise and sunset will be calculated.
 type Location struct {
-	Latitude  float64 `json:"latitude"`
-	Longitude float64 `json:"longitude"`
+	Latitude     float64 `json:"latitude"`
+	Longitude    float64 `json:"longitude"`
+	Calculator   string  `json:"calculator,omitempty"`
+	Refraction   bool    `json:"refraction,omitempty"`
+	Twilight     string  `json:"twilight,omitempty"`
+	Elevation    float64 `json:"elevation,omitempty"`
+	PolarSunrise string  `json:"polarSunrise,omitempty"`
+	PolarSunset  string  `json:"polarSunset,omitempty"`
 }
 
 // WebInterface respresents the webinterface of Kelvin.
 type WebInterface struct {
-	Enabled bool `json:"enabled"`
-	Port    int  `json:"port"`
+	Enabled     bool             `json:"enabled"`
+	Port        int              `json:"port"`
+	Token       string           `json:"token,omitempty"`
+	Username    string           `json:"username,omitempty"`
+	Password    string           `json:"password,omitempty"`
+	TLS         *WebInterfaceTLS `json:"tls,omitempty"`
+	CORSOrigins []string         `json:"corsOrigins,omitempty"`
 }
 
 // LightSchedule represents the schedule for any given day for the associated lights.
 type LightSchedule struct {
-	Name                    string                  `json:"name"`
-	AssociatedDeviceIDs     []int                   `json:"associatedDeviceIDs"`
-	EnableWhenLightsAppear  bool                    `json:"enableWhenLightsAppear"`
-	DefaultColorTemperature int                     `json:"defaultColorTemperature"`
-	DefaultBrightness       int                     `json:"defaultBrightness"`
-	BeforeSunrise           []TimedColorTemperature `json:"beforeSunrise"`
-	AfterSunset             []TimedColorTemperature `json:"afterSunset"`
+	Name                    string                     `json:"name"`
+	AssociatedDeviceIDs     []int                      `json:"associatedDeviceIDs"`
+	AssociatedDeviceNames   []string                   `json:"associatedDeviceNames,omitempty"`
+	AssociatedGroups        []string                   `json:"associatedGroups,omitempty"`
+	WLED                    []string                   `json:"wled,omitempty"`
+	Nanoleaf                []string                   `json:"nanoleaf,omitempty"`
+	Priority                int                        `json:"priority,omitempty"`
+	Default                 bool                       `json:"default,omitempty"`
+	Location                string                     `json:"location,omitempty"`
+	Twilight                string                     `json:"twilight,omitempty"`
+	MoonPhases              []string                   `json:"moonPhases,omitempty"`
+	Bridge                  string                     `json:"bridge,omitempty"`
+	Mode                    string                     `json:"mode,omitempty"`
+	ElevationCurve          []ElevationPoint           `json:"elevationCurve,omitempty"`
+	Auto                    *AutoMode                  `json:"auto,omitempty"`
+	EnableWhenLightsAppear  bool                       `json:"enableWhenLightsAppear"`
+	RestoreOnStop           bool                       `json:"restoreOnStop,omitempty"`
+	RequirePresence         bool                       `json:"requirePresence,omitempty"`
+	RestoreScene            string                     `json:"restoreScene,omitempty"`
+	MotionBoost             *MotionBoost               `json:"motionBoost,omitempty"`
+	SwitchOverride          *SwitchOverride            `json:"switchOverride,omitempty"`
+	ManualChange            *ManualChange              `json:"manualChange,omitempty"`
+	DeadBand                *DeadBand                  `json:"deadBand,omitempty"`
+	Nightlight              *Nightlight                `json:"nightlight,omitempty"`
+	WindDown                *WindDown                  `json:"windDown,omitempty"`
+	PowerOn                 *PowerOn                   `json:"powerOn,omitempty"`
+	LuxCompensation         *LuxCompensation           `json:"luxCompensation,omitempty"`
+	WeatherModifiers        []WeatherModifier          `json:"weatherModifiers,omitempty"`
+	TransitionTime          string                     `json:"transitionTime,omitempty"`
+	UpdateInterval          string                     `json:"updateInterval,omitempty"`
+	OnOffThreshold          int                        `json:"onOffThreshold,omitempty"`
+	MinBrightness           int                        `json:"minBrightness,omitempty"`
+	MaxBrightness           int                        `json:"maxBrightness,omitempty"`
+	BrightnessLimits        map[string]BrightnessLimit `json:"brightnessLimits,omitempty"`
+	DefaultColorTemperature int                        `json:"defaultColorTemperature"`
+	DefaultBrightness       int                        `json:"defaultBrightness"`
+	BeforeSunrise           []TimedColorTemperature    `json:"beforeSunrise"`
+	AfterSunset             []TimedColorTemperature    `json:"afterSunset"`
+	resolvedDeviceIDs       []int
+	resolvedGroups          []HueGroup
 }
 
 // TimedColorTemperature represents a light configuration which will be
 // reached at the given time.
 type TimedColorTemperature struct {
-	Time             string `json:"time"`
-	ColorTemperature int    `json:"colorTemperature"`
-	Brightness       int    `json:"brightness"`
+	Time             string   `json:"time"`
+	ColorTemperature int      `json:"colorTemperature"`
+	Brightness       int      `json:"brightness"`
+	Gradient         []int    `json:"gradient,omitempty"`
+	MoonPhases       []string `json:"moonPhases,omitempty"`
+}
+
+// MotionBoost raises the brightness of the lights of a schedule for the
+// given duration whenever the named motion sensor detects presence.
+type MotionBoost struct {
+	Sensor     string `json:"sensor"`
+	Brightness int    `json:"brightness"`
+	Duration   string `json:"duration,omitempty"`
+}
+
+// SwitchOverride hands the lights of a schedule over to the user for the
+// given duration whenever one of the named switches is used.
+type SwitchOverride struct {
+	Switches []string `json:"switches"`
+	Duration string   `json:"duration,omitempty"`
+}
+
+// ManualChange defines how large a deviation from the light state sent by
+// Kelvin has to be to count as a manual change and how long Kelvin leaves
+// the light alone afterwards.
+type ManualChange struct {
+	ColorTemperature int    `json:"colorTemperature,omitempty"`
+	Brightness       int    `json:"brightness,omitempty"`
+	Duration         string `json:"duration,omitempty"`
+}
+
+// BrightnessLimit defines the range of brightness values in percent a
+// light may be set to. Zero values leave the range open.
+type BrightnessLimit struct {
+	MinBrightness int `json:"minBrightness,omitempty"`
+	MaxBrightness int `json:"maxBrightness,omitempty"`
+}
+
+// Nightlight defines the hours during which lights which are turned on only
+// show a dim and warm light. Kelvin leaves them alone until the end.
+type Nightlight struct {
+	Start            string `json:"start"`
+	End              string `json:"end"`
+	ColorTemperature int    `json:"colorTemperature,omitempty"`
+	Brightness       int    `json:"brightness,omitempty"`
+}
+
+// DeadBand defines the smallest changes of the color temperature (in
+// Kelvin) and brightness (in percent) Kelvin sends to a light.
+type DeadBand struct {
+	ColorTemperature int `json:"colorTemperature,omitempty"`
+	Brightness       int `json:"brightness,omitempty"`
+}
+
+// PowerOn defines how Kelvin handles lights which are powered on at the
+// wall after they were unreachable.
+type PowerOn struct {
+	Reapply       bool `json:"reapply,omitempty"`
+	ConfigureBulb bool `json:"configureBulb,omitempty"`
+}
+
+// LuxCompensation scales the scheduled brightness of a schedule depending
+// on the ambient light level reported by a Hue motion sensor.
+type LuxCompensation struct {
+	Sensor string     `json:"sensor"`
+	Ranges []LuxRange `json:"ranges"`
+}
+
+// LuxRange maps a range of ambient light levels to a brightness multiplier.
+// A MaxLux of 0 leaves the range open ended.
+type LuxRange struct {
+	MinLux     float64 `json:"minLux"`
+	MaxLux     float64 `json:"maxLux,omitempty"`
+	Multiplier float64 `json:"multiplier"`
 }
 
 // Configuration encapsulates all relevant parameters for Kelvin to operate.
 type Configuration struct {
-	ConfigurationFile string          `json:"-"`
-	Hash              string          `json:"-"`
-	Version           int             `json:"version"`
-	Bridge            Bridge          `json:"bridge"`
-	Location          Location        `json:"location"`
-	WebInterface      WebInterface    `json:"webinterface"`
-	Schedules         []LightSchedule `json:"schedules"`
+	ConfigurationFile   string              `json:"-"`
+	Hash                string              `json:"-"`
+	Version             int                 `json:"version"`
+	Bridge              Bridge              `json:"bridge"`
+	Bridges             []Bridge            `json:"bridges,omitempty"`
+	Location            Location            `json:"location"`
+	Locations           map[string]Location `json:"locations,omitempty"`
+	WebInterface        WebInterface        `json:"webinterface"`
+	TransitionTime      string              `json:"transitionTime,omitempty"`
+	UpdateInterval      string              `json:"updateInterval,omitempty"`
+	IdlePollingInterval string              `json:"idlePollingInterval,omitempty"`
+	NanoleafTokens      map[string]string   `json:"nanoleafTokens,omitempty"`
+	Webhooks            []Webhook           `json:"webhooks,omitempty"`
+	Wakeups             []Wakeup            `json:"wakeups,omitempty"`
+	AwaySimulation      *AwaySimulation     `json:"awaySimulation,omitempty"`
+	Presence            *Presence           `json:"presence,omitempty"`
+	Weather             *Weather            `json:"weather,omitempty"`
+	Logging             *Logging            `json:"logging,omitempty"`
+	Tracing             *Tracing            `json:"tracing,omitempty"`
+	StatsD              *StatsD             `json:"statsd,omitempty"`
+	Shutdown            *Shutdown           `json:"shutdown,omitempty"`
+	Updates             *Updates            `json:"updates,omitempty"`
+	Proxy               string              `json:"proxy,omitempty"`
+	MQTT                *MQTT               `json:"mqtt,omitempty"`
+	HomeKit             *HomeKit            `json:"homekit,omitempty"`
+	Calendar            *Calendar           `json:"calendar,omitempty"`
+	Schedules           []LightSchedule     `json:"schedules"`
+	overrides           map[string]override
+	directory           *configurationDirectory
 }
 
 // TimeStamp represents a parsed and validated TimedColorTemperature.
@@ -87,6 +230,7 @@ type TimeStamp struct {
 	Time             time.Time
 	ColorTemperature int
 	Brightness       int
+	Gradient         []int
 }
 
 var latestConfigurationVersion = 0
@@ -123,6 +267,13 @@ func (configuration *Configuration) initializeDefaults() {
 	webinterface.Enabled = false
 	webinterface.Port = 8080
 	configuration.WebInterface = webinterface
+
+	if *flagDetectLocation {
+		err := configuration.detectLocation()
+		if err != nil {
+			log.Warningf("🌍 %v", err)
+		}
+	}
 }
 
 // InitializeConfiguration creates and returns an initialized
@@ -137,15 +288,23 @@ func InitializeConfiguration(configurationFile string, enableWebInterface bool)
 		if err != nil {
 			return configuration, err
 		}
-		log.Printf("⚙ Configuration %v loaded", configuration.ConfigurationFile)
+		configLog.Printf("⚙ Configuration %v loaded", configuration.ConfigurationFile)
 	} else {
 		// write default config to disk
 		configuration.initializeDefaults()
-		err := configuration.Write()
+		err := configuration.applyEnvironment()
+		if err != nil {
+			return configuration, err
+		}
+		err = configuration.applyFlags()
+		if err != nil {
+			return configuration, err
+		}
+		err = configuration.Write()
 		if err != nil {
 			return configuration, err
 		}
-		log.Println("⚙ Default configuration generated")
+		configLog.Println("⚙ Default configuration generated")
 	}
 
 	// Overwrite interface configuration with startup parameter
@@ -166,39 +325,106 @@ func (configuration *Configuration) Write() error {
 	}
 
 	if !configuration.HasChanged() {
-		log.Debugf("⚙ Configuration hasn't changed. Omitting write.")
+		configLog.Debugf("⚙ Configuration hasn't changed. Omitting write.")
 		return nil
 	}
-	log.Debugf("⚙ Configuration changed. Saving to %v", configuration.ConfigurationFile)
-	raw, err := json.MarshalIndent(configuration, "", "  ")
+	configLog.Debugf("⚙ Configuration changed. Saving to %v", configuration.ConfigurationFile)
+	persisted := configuration.withoutEnvironment()
+	err := persisted.writeSecrets()
+	if err != nil {
+		return err
+	}
+	if configuration.directory != nil {
+		err = persisted.writeDirectory()
+	} else {
+		err = writeConfigurationFile(configuration.ConfigurationFile, persisted)
+	}
+	if err != nil {
+		return err
+	}
+
+	configuration.Hash = configuration.HashValue()
+	configLog.Debugf("⚙ Updated configuration hash")
+	return nil
+}
+
+func writeConfigurationFile(filename string, data interface{}) error {
+	raw, err := json.MarshalIndent(data, "", "  ")
 	if err != nil {
 		return err
 	}
 
 	// Convert JSON to YAML if needed
-	if isYAMLFile(configuration.ConfigurationFile) {
+	if isYAMLFile(filename) {
 		raw, err = yaml.JSONToYAML(raw)
 		if err != nil {
 			return err
 		}
 	}
 
-	err = ioutil.WriteFile(configuration.ConfigurationFile, raw, 0644)
+	return ioutil.WriteFile(filename, raw, 0644)
+}
+
+// Read loads a configuration from disk.
+func (configuration *Configuration) Read() error {
+	err := configuration.load()
 	if err != nil {
 		return err
 	}
 
+	if len(configuration.Schedules) == 0 && configuration.directory != nil {
+		return fmt.Errorf("Configuration directory %s doesn't contain any schedules", configuration.ConfigurationFile)
+	}
+	if len(configuration.Schedules) == 0 {
+		configLog.Warningf("⚙ Your current configuration doesn't contain any schedules! Generating default schedule...")
+		err := configuration.backup()
+		if err != nil {
+			configLog.Warningf("⚙ Could not create backup: %v", err)
+		} else {
+			configLog.Printf("⚙ Configuration backup created.")
+			configuration.initializeDefaults()
+			configLog.Printf("⚙ Default schedule created.")
+			configuration.Write()
+		}
+	}
 	configuration.Hash = configuration.HashValue()
-	log.Debugf("⚙ Updated configuration hash")
+	configLog.Debugf("⚙ Updated configuration hash.")
+
+	configuration.migrateToLatestVersion()
+	configuration.Write()
 	return nil
 }
 
-// Read loads a configuration from disk.
-func (configuration *Configuration) Read() error {
+// load reads and parses the configuration file or directory without
+// modifying it.
+func (configuration *Configuration) load() error {
 	if configuration.ConfigurationFile == "" {
 		return errors.New("No configuration filename configured")
 	}
 
+	var err error
+	if isDirectory(configuration.ConfigurationFile) {
+		err = configuration.loadDirectory()
+	} else {
+		err = configuration.loadFile()
+	}
+	if err != nil {
+		return err
+	}
+
+	err = configuration.loadSecrets()
+	if err != nil {
+		return err
+	}
+
+	err = configuration.applyEnvironment()
+	if err != nil {
+		return err
+	}
+	return configuration.applyFlags()
+}
+
+func (configuration *Configuration) loadFile() error {
 	raw, err := ioutil.ReadFile(configuration.ConfigurationFile)
 	if err != nil {
 		return err
@@ -212,78 +438,428 @@ func (configuration *Configuration) Read() error {
 		}
 	}
 
-	err = json.Unmarshal(raw, configuration)
-	if err != nil {
-		return err
+	return json.Unmarshal(raw, configuration)
+}
+
+func (configuration *Configuration) lightScheduleForDay(light *Light, date time.Time) (Schedule, error) {
+	lightSchedule, found := configuration.scheduleForLightOnDay(light.Bridge, light.ID, date)
+	if !found {
+		// initialize empty schedule with end of day
+		var schedule Schedule
+		yr, mth, dy := date.Date()
+		schedule.endOfDay = time.Date(yr, mth, dy, 23, 59, 59, 59, date.Location())
+		return schedule, fmt.Errorf("Light %d is not associated with any schedule in configuration", light.ID)
 	}
 
-	if len(configuration.Schedules) == 0 {
-		log.Warningf("⚙ Your current configuration doesn't contain any schedules! Generating default schedule...")
-		err := configuration.backup()
-		if err != nil {
-			log.Warningf("⚙ Could not create backup: %v", err)
-		} else {
-			log.Printf("⚙ Configuration backup created.")
-			configuration.initializeDefaults()
-			log.Printf("⚙ Default schedule created.")
-			configuration.Write()
+	return configuration.scheduleForDay(lightSchedule, date), nil
+}
+
+// scheduleForLight returns the schedule managing the given light of the
+// given bridge today. If the light is associated with multiple schedules the
+// one with the highest priority wins. Schedules of equal priority are chosen
+// in order of appearance.
+func (configuration *Configuration) scheduleForLight(bridge string, light int) (LightSchedule, bool) {
+	return configuration.scheduleForLightOnDay(bridge, light, time.Now())
+}
+
+// scheduleForLightOnDay returns the schedule managing the given light on the
+// day of the given date. Schedules limited to other moon phases are skipped.
+// Alternate schedules of the calendar take precedence during their events
+// and are skipped otherwise.
+func (configuration *Configuration) scheduleForLightOnDay(bridge string, light int, date time.Time) (LightSchedule, bool) {
+	var lightSchedule LightSchedule
+	found, calendarEvent := false, false
+	for _, candidate := range configuration.Schedules {
+		if candidate.Bridge != bridge || !containsInt(candidate.deviceIDs(), light) || !moonPhaseMatches(candidate.MoonPhases, date) {
+			continue
+		}
+		alternate, active := configuration.calendarSchedule(candidate.Name, date)
+		if !active && (alternate || calendarEvent) {
+			continue
+		}
+		if !found || active && !calendarEvent || candidate.Priority > lightSchedule.Priority {
+			lightSchedule = candidate
+			found, calendarEvent = true, active
 		}
 	}
-	configuration.Hash = configuration.HashValue()
-	log.Debugf("⚙ Updated configuration hash.")
+	return lightSchedule, found
+}
 
-	configuration.migrateToLatestVersion()
-	configuration.Write()
+// scheduleConflicts returns a description for every light associated with
+// multiple schedules of the same priority. Lights in schedules of different
+// priority are considered intentional.
+func (configuration *Configuration) scheduleConflicts() []string {
+	type bridgeLight struct {
+		bridge string
+		id     int
+	}
+
+	var conflicts []string
+	winners := make(map[bridgeLight]LightSchedule)
+	for _, lightSchedule := range configuration.Schedules {
+		for _, id := range lightSchedule.deviceIDs() {
+			key := bridgeLight{lightSchedule.Bridge, id}
+			winner, found := winners[key]
+			if !found {
+				winners[key] = lightSchedule
+				continue
+			}
+			if winner.Priority == lightSchedule.Priority {
+				conflicts = append(conflicts, fmt.Sprintf("Light %d is associated with schedule %s and schedule %s of the same priority. Using schedule %s", id, winner.Name, lightSchedule.Name, winner.Name))
+			} else if lightSchedule.Priority > winner.Priority {
+				winners[key] = lightSchedule
+			}
+		}
+	}
+	return conflicts
+}
+
+// bridgeConfiguration returns the configuration of the bridge with the given
+// name. The bridge without a name is the default bridge.
+func (configuration *Configuration) bridgeConfiguration(name string) *Bridge {
+	if name == "" {
+		return &configuration.Bridge
+	}
+	for index := range configuration.Bridges {
+		if configuration.Bridges[index].Name == name {
+			return &configuration.Bridges[index]
+		}
+	}
 	return nil
 }
 
-func (configuration *Configuration) lightScheduleForDay(light int, date time.Time) (Schedule, error) {
+// locationForSchedule returns the location used to calculate sunrise and
+// sunset for the given schedule.
+func (configuration *Configuration) locationForSchedule(lightSchedule LightSchedule) Location {
+	location := configuration.Location
+	if lightSchedule.Location != "" {
+		named, found := configuration.Locations[lightSchedule.Location]
+		if found {
+			location = named
+		} else {
+			configLog.Warningf("⚙ Schedule %s - Unknown location \"%s\". Using default location...", lightSchedule.Name, lightSchedule.Location)
+		}
+	}
+	// The twilight of the schedule takes precedence over the location
+	if lightSchedule.Twilight != "" {
+		location.Twilight = lightSchedule.Twilight
+	}
+	return location
+}
+
+// parseTransitionTime parses the given transition time. The bridge
+// supports steps of 100ms up to 65535 steps. If the value is empty or
+// invalid the fallback is returned along with the error.
+func parseTransitionTime(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	transitionTime, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback, err
+	}
+	if transitionTime < 0 || transitionTime > 65535*100*time.Millisecond {
+		return fallback, fmt.Errorf("Transition time must be between 0s and 1h49m13.5s")
+	}
+	return transitionTime, nil
+}
+
+// parseUpdateInterval parses the given update interval. Empty values
+// result in the fallback.
+func parseUpdateInterval(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	updateInterval, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback, err
+	}
+	if updateInterval < minimumUpdateInterval {
+		return fallback, fmt.Errorf("Update interval must be at least %v", minimumUpdateInterval)
+	}
+	return updateInterval, nil
+}
+
+// updateIntervalForSchedule returns the update interval of the schedule,
+// the global update interval or the default update interval.
+func (configuration *Configuration) updateIntervalForSchedule(lightSchedule LightSchedule) time.Duration {
+	updateInterval, err := parseUpdateInterval(configuration.UpdateInterval, stateUpdateInterval)
+	if err != nil {
+		configLog.Warningf("⚙ Invalid update interval \"%s\". Using %v...", configuration.UpdateInterval, updateInterval)
+	}
+	updateInterval, err = parseUpdateInterval(lightSchedule.UpdateInterval, updateInterval)
+	if err != nil {
+		configLog.Warningf("⚙ Schedule %s - Invalid update interval \"%s\". Using %v...", lightSchedule.Name, lightSchedule.UpdateInterval, updateInterval)
+	}
+	return updateInterval
+}
+
+// transitionTimeForSchedule returns the transition time of the schedule,
+// the global transition time or the default transition time.
+func (configuration *Configuration) transitionTimeForSchedule(lightSchedule LightSchedule) time.Duration {
+	transitionTime, err := parseTransitionTime(configuration.TransitionTime, lightTransistionTime)
+	if err != nil {
+		configLog.Warningf("⚙ Invalid transition time \"%s\". Using %v...", configuration.TransitionTime, transitionTime)
+	}
+	transitionTime, err = parseTransitionTime(lightSchedule.TransitionTime, transitionTime)
+	if err != nil {
+		configLog.Warningf("⚙ Schedule %s - Invalid transition time \"%s\". Using %v...", lightSchedule.Name, lightSchedule.TransitionTime, transitionTime)
+	}
+	return transitionTime
+}
+
+func (configuration *Configuration) scheduleForDay(lightSchedule LightSchedule, date time.Time) Schedule {
 	// initialize schedule with end of day
 	var schedule Schedule
+	schedule.name = lightSchedule.Name
 	yr, mth, dy := date.Date()
 	schedule.endOfDay = time.Date(yr, mth, dy, 23, 59, 59, 59, date.Location())
 
-	var lightSchedule LightSchedule
-	found := false
-	for _, candidate := range configuration.Schedules {
-		if containsInt(candidate.AssociatedDeviceIDs, light) {
-			lightSchedule = candidate
-			found = true
-			break
-		}
+	location := configuration.locationForSchedule(lightSchedule)
+	sunrise, sunset, polar := location.sunTimes(date)
+	schedule.sunrise = TimeStamp{sunrise, lightSchedule.DefaultColorTemperature, lightSchedule.DefaultBrightness, nil}
+	schedule.sunset = TimeStamp{sunset, lightSchedule.DefaultColorTemperature, lightSchedule.DefaultBrightness, nil}
+	schedule.polar = polar
+
+	// Before sunrise candidates. Relative entries of the first candidate
+	// refer to the start of the day.
+	var errs []error
+	schedule.beforeSunrise, errs = parseTimestamps(lightSchedule.BeforeSunrise, time.Date(yr, mth, dy, 0, 0, 0, 0, date.Location()))
+	for _, err := range errs {
+		configLog.Warningf("⚙ Found invalid configuration entry before sunrise: %v", err)
 	}
 
-	if !found {
-		return schedule, fmt.Errorf("Light %d is not associated with any schedule in configuration", light)
+	// After sunset candidates. Relative entries of the first candidate
+	// refer to the sunset.
+	schedule.afterSunset, errs = parseTimestamps(lightSchedule.AfterSunset, schedule.sunset.Time)
+	for _, err := range errs {
+		configLog.Warningf("⚙ Found invalid configuration entry after sunset: %v", err)
+	}
+
+	switch lightSchedule.Mode {
+	case scheduleModeElevation:
+		schedule.curve = newElevationCurve(lightSchedule.ElevationCurve, location.Latitude, location.Longitude)
+	case scheduleModeAuto:
+		curve, err := newAutoCurve(lightSchedule.Auto, date, location.Latitude, location.Longitude)
+		if err != nil {
+			configLog.Warningf("⚙ Schedule %s - Invalid auto mode: %v. Using the default bedtime...", lightSchedule.Name, err)
+		}
+		schedule.curve = curve
 	}
 
-	schedule.sunrise = TimeStamp{CalculateSunrise(date, configuration.Location.Latitude, configuration.Location.Longitude), lightSchedule.DefaultColorTemperature, lightSchedule.DefaultBrightness}
-	schedule.sunset = TimeStamp{CalculateSunset(date, configuration.Location.Latitude, configuration.Location.Longitude), lightSchedule.DefaultColorTemperature, lightSchedule.DefaultBrightness}
+	schedule.enableWhenLightsAppear = lightSchedule.EnableWhenLightsAppear
+	schedule.restoreOnStop = lightSchedule.RestoreOnStop || lightSchedule.RestoreScene != ""
+	schedule.restoreScene = lightSchedule.RestoreScene
+	schedule.requirePresence = lightSchedule.RequirePresence
+	if boost := lightSchedule.MotionBoost; boost != nil {
+		duration, err := boost.duration()
+		if err != nil {
+			configLog.Warningf("⚙ Schedule %s - Invalid motion boost duration \"%s\". Using %v...", lightSchedule.Name, boost.Duration, defaultMotionBoostDuration)
+		}
+		schedule.motionBoost = &motionBoost{boost.Sensor, boost.Brightness, duration}
+	}
+	if override := lightSchedule.SwitchOverride; override != nil {
+		duration, err := override.duration()
+		if err != nil {
+			configLog.Warningf("⚙ Schedule %s - Invalid switch override duration \"%s\". Using %v...", lightSchedule.Name, override.Duration, defaultSwitchOverrideDuration)
+		}
+		schedule.switchOverride = &switchOverride{override.Switches, duration}
+	}
+	if change := lightSchedule.ManualChange; change != nil {
+		duration, err := change.duration()
+		if err != nil {
+			configLog.Warningf("⚙ Schedule %s - Invalid manual change duration \"%s\". Kelvin will resume when the lights are turned off...", lightSchedule.Name, change.Duration)
+		}
+		schedule.manualChange = &manualChange{change.ColorTemperature, change.Brightness, duration}
+	}
+	schedule.deadBand = lightSchedule.DeadBand
+	if configured := lightSchedule.WindDown; configured != nil {
+		parsed, err := configured.parse()
+		if err != nil {
+			configLog.Warningf("⚙ Schedule %s - Invalid wind-down: %v. Ignoring...", lightSchedule.Name, err)
+		}
+		schedule.windDown = parsed
+	}
+	if configured := lightSchedule.Nightlight; configured != nil {
+		parsed, err := configured.parse()
+		if err != nil {
+			configLog.Warningf("⚙ Schedule %s - Invalid nightlight: %v. Ignoring...", lightSchedule.Name, err)
+		}
+		schedule.nightlight = parsed
+	}
+	schedule.powerOn = lightSchedule.PowerOn
+	schedule.luxCompensation = lightSchedule.LuxCompensation
+	schedule.weatherModifiers = lightSchedule.WeatherModifiers
+	schedule.transitionTime = configuration.transitionTimeForSchedule(lightSchedule)
+	schedule.updateInterval = configuration.updateIntervalForSchedule(lightSchedule)
+	schedule.onOffThreshold = lightSchedule.OnOffThreshold
+	schedule.brightnessLimit = BrightnessLimit{lightSchedule.MinBrightness, lightSchedule.MaxBrightness}
+	schedule.lightBrightnessLimits = make(map[string]BrightnessLimit)
+	for name, limit := range lightSchedule.BrightnessLimits {
+		schedule.lightBrightnessLimits[strings.ToLower(strings.TrimSpace(name))] = limit
+	}
+	return schedule
+}
 
-	// Before sunrise candidates
-	schedule.beforeSunrise = []TimeStamp{}
-	for _, candidate := range lightSchedule.BeforeSunrise {
-		timestamp, err := candidate.AsTimestamp(date)
+// parseTimestamps converts the given entries into timestamps. Relative
+// entries refer to the previous valid entry or the given start time.
+// Invalid entries are skipped and reported in the returned error list.
+func parseTimestamps(entries []TimedColorTemperature, start time.Time) ([]TimeStamp, []error) {
+	timestamps := []TimeStamp{}
+	var errs []error
+	previous := start
+	for _, entry := range entries {
+		timestamp, err := entry.AsTimestamp(previous)
 		if err != nil {
-			log.Warningf("⚙ Found invalid configuration entry before sunrise: %+v (Error: %v)", candidate, err)
+			errs = append(errs, fmt.Errorf("%+v (Error: %v)", entry, err))
+			continue
+		}
+		// Skipped entries still serve as reference for relative times
+		previous = timestamp.Time
+		if !moonPhaseMatches(entry.MoonPhases, start) {
 			continue
 		}
-		schedule.beforeSunrise = append(schedule.beforeSunrise, timestamp)
+		timestamps = append(timestamps, timestamp)
+	}
+	return timestamps, errs
+}
+
+// deviceIDs returns the IDs of all lights associated with the schedule,
+// either directly or by name.
+func (lightSchedule *LightSchedule) deviceIDs() []int {
+	ids := append([]int{}, lightSchedule.AssociatedDeviceIDs...)
+	for _, id := range lightSchedule.resolvedDeviceIDs {
+		if !containsInt(ids, id) {
+			ids = append(ids, id)
+		}
 	}
+	return ids
+}
+
+// namedID represents a light or group which can be referenced by name.
+type namedID struct {
+	ID   int
+	Name string
+}
+
+// resolveAssociations maps the associated device names and groups of all
+// schedules to the IDs of the given lights. Unknown and ambiguous names are
+// reported and ignored, as are conflicting associations.
+func (configuration *Configuration) resolveAssociations(lights []*Light, groups []HueGroup) {
+	for index := range configuration.Schedules {
+		lightSchedule := &configuration.Schedules[index]
+
+		// Names are only unique per bridge
+		var lightNames, groupNames []namedID
+		for _, light := range lights {
+			if light.Bridge == lightSchedule.Bridge {
+				lightNames = append(lightNames, namedID{light.ID, light.Name})
+			}
+		}
+		for _, group := range groups {
+			if group.Bridge == lightSchedule.Bridge {
+				groupNames = append(groupNames, namedID{group.ID, group.Name})
+			}
+		}
+
+		lightSchedule.resolvedDeviceIDs = resolveNames(lightSchedule.Name, "light", lightSchedule.AssociatedDeviceNames, lightNames)
+
+		lightSchedule.resolvedGroups = []HueGroup{}
+		for _, id := range resolveNames(lightSchedule.Name, "group", lightSchedule.AssociatedGroups, groupNames) {
+			for _, group := range groups {
+				if group.Bridge == lightSchedule.Bridge && group.ID == id {
+					configLog.Debugf("⚙ Schedule %s - Expanded group \"%s\" to lights %v", lightSchedule.Name, group.Name, group.Lights)
+					lightSchedule.resolvedGroups = append(lightSchedule.resolvedGroups, group)
+					lightSchedule.resolvedDeviceIDs = append(lightSchedule.resolvedDeviceIDs, group.Lights...)
+				}
+			}
+		}
+	}
+
+	configuration.resolveDefaultSchedule(lights)
+
+	for _, conflict := range configuration.scheduleConflicts() {
+		configLog.Warningf("⚙ %s", conflict)
+	}
+}
 
-	// After sunset candidates
-	schedule.afterSunset = []TimeStamp{}
-	for _, candidate := range lightSchedule.AfterSunset {
-		timestamp, err := candidate.AsTimestamp(date)
+// resolveDefaultSchedule associates all lights which are not part of any
+// other schedule with the first schedule of their bridge marked as default.
+func (configuration *Configuration) resolveDefaultSchedule(lights []*Light) {
+	defaultSchedules := make(map[string]*LightSchedule)
+	assigned := make(map[string][]int)
+	for index := range configuration.Schedules {
+		lightSchedule := &configuration.Schedules[index]
+		if _, found := defaultSchedules[lightSchedule.Bridge]; lightSchedule.Default && !found {
+			defaultSchedules[lightSchedule.Bridge] = lightSchedule
+			continue
+		}
+		assigned[lightSchedule.Bridge] = append(assigned[lightSchedule.Bridge], lightSchedule.deviceIDs()...)
+	}
+
+	for _, light := range lights {
+		defaultSchedule, found := defaultSchedules[light.Bridge]
+		if !found || containsInt(assigned[light.Bridge], light.ID) || containsInt(defaultSchedule.deviceIDs(), light.ID) {
+			continue
+		}
+		configLog.Debugf("⚙ Schedule %s - Light %s is not associated with any other schedule. Adding it to the default schedule", defaultSchedule.Name, light.Name)
+		defaultSchedule.resolvedDeviceIDs = append(defaultSchedule.resolvedDeviceIDs, light.ID)
+	}
+}
+
+// resolveNames returns the IDs of all candidates matching the given names
+// or patterns.
+func resolveNames(schedule string, kind string, names []string, candidates []namedID) []int {
+	resolved := []int{}
+	for _, name := range names {
+		pattern, err := deviceNamePattern(name)
 		if err != nil {
-			log.Warningf("⚙ Found invalid configuration entry after sunset: %+v (Error: %v)", candidate, err)
+			configLog.Errorf("⚙ Schedule %s - Invalid %s name pattern \"%s\": %v. Ignoring...", schedule, kind, name, err)
+			continue
+		}
+
+		var matches []int
+		for _, candidate := range candidates {
+			if pattern != nil && pattern.MatchString(candidate.Name) || pattern == nil && strings.EqualFold(strings.TrimSpace(candidate.Name), strings.TrimSpace(name)) {
+				matches = append(matches, candidate.ID)
+			}
+		}
+
+		// Patterns may match any number of candidates
+		if pattern != nil {
+			configLog.Debugf("⚙ Schedule %s - Resolved %s pattern \"%s\" to IDs %v", schedule, kind, name, matches)
+			resolved = append(resolved, matches...)
 			continue
 		}
-		schedule.afterSunset = append(schedule.afterSunset, timestamp)
+
+		switch len(matches) {
+		case 0:
+			configLog.Warningf("⚙ Schedule %s - No %s named \"%s\" found on the bridge. Ignoring...", schedule, kind, name)
+		case 1:
+			configLog.Debugf("⚙ Schedule %s - Resolved %s \"%s\" to ID %d", schedule, kind, name, matches[0])
+			resolved = append(resolved, matches[0])
+		default:
+			configLog.Errorf("⚙ Schedule %s - The %s name \"%s\" is ambiguous (IDs %v). Please rename them on the bridge or use IDs. Ignoring...", schedule, kind, name, matches)
+		}
 	}
+	return resolved
+}
 
-	schedule.enableWhenLightsAppear = lightSchedule.EnableWhenLightsAppear
-	return schedule, nil
+// deviceNamePattern returns the compiled pattern for associated device
+// names in the form of "/regex/" or wildcards ("Living room *"). Plain
+// names return nil. All patterns are case insensitive.
+func deviceNamePattern(name string) (*regexp.Regexp, error) {
+	name = strings.TrimSpace(name)
+	if len(name) > 1 && strings.HasPrefix(name, "/") && strings.HasSuffix(name, "/") {
+		return regexp.Compile("(?i)" + name[1:len(name)-1])
+	}
+	if strings.ContainsAny(name, "*?") {
+		expression := regexp.QuoteMeta(name)
+		expression = strings.ReplaceAll(expression, `\*`, ".*")
+		expression = strings.ReplaceAll(expression, `\?`, ".")
+		return regexp.Compile("(?i)^" + expression + "$")
+	}
+	return nil, nil
 }
 
 // Exists return true if a configuration file is found on disk.
@@ -315,20 +891,37 @@ func (configuration *Configuration) HashValue() string {
 
 // AsTimestamp parses and validates a TimedColorTemperature and returns
 // a corresponding TimeStamp.
+// Absolute times in the format hh:mm are placed on the day of the given
+// reference time. Relative times like +45m or +1h30m are added to the
+// reference time, which should be the time of the previous point.
 func (color *TimedColorTemperature) AsTimestamp(referenceTime time.Time) (TimeStamp, error) {
+	if strings.HasPrefix(color.Time, "+") {
+		offset, err := time.ParseDuration(strings.TrimPrefix(color.Time, "+"))
+		if err != nil {
+			return TimeStamp{time.Now(), color.ColorTemperature, color.Brightness, color.Gradient}, err
+		}
+		if offset < 0 {
+			return TimeStamp{time.Now(), color.ColorTemperature, color.Brightness, color.Gradient}, fmt.Errorf("Negative relative time %s", color.Time)
+		}
+		targetTime := referenceTime.Add(offset)
+		if targetTime.Day() != referenceTime.Day() {
+			return TimeStamp{time.Now(), color.ColorTemperature, color.Brightness, color.Gradient}, fmt.Errorf("Relative time %s exceeds the end of the day", color.Time)
+		}
+		return TimeStamp{targetTime, color.ColorTemperature, color.Brightness, color.Gradient}, nil
+	}
+
 	layout := "15:04"
 	t, err := time.Parse(layout, color.Time)
 	if err != nil {
-		return TimeStamp{time.Now(), color.ColorTemperature, color.Brightness}, err
+		return TimeStamp{time.Now(), color.ColorTemperature, color.Brightness, color.Gradient}, err
 	}
-	yr, mth, day := referenceTime.Date()
-	targetTime := time.Date(yr, mth, day, t.Hour(), t.Minute(), t.Second(), 0, referenceTime.Location())
+	targetTime := atClockTime(referenceTime, 0, time.Duration(t.Hour())*time.Hour+time.Duration(t.Minute())*time.Minute)
 
-	return TimeStamp{targetTime, color.ColorTemperature, color.Brightness}, nil
+	return TimeStamp{targetTime, color.ColorTemperature, color.Brightness, color.Gradient}, nil
 }
 
 func (configuration *Configuration) backup() error {
 	backupFilename := configuration.ConfigurationFile + "_" + time.Now().Format("01022006")
-	log.Debugf("⚙ Moving configuration to %s.", backupFilename)
+	configLog.Debugf("⚙ Moving configuration to %s.", backupFilename)
 	return os.Rename(configuration.ConfigurationFile, backupFilename)
 }
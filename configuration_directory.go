@@ -0,0 +1,219 @@
+// MIT License
+//
+// Copyright (c) 2018 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// configurationDirectory tracks the origin of all values of a
+// configuration which is split into multiple files.
+// The global settings (bridge, location, etc.) may be defined in one file
+// only. Every file can contribute schedules.
+type configurationDirectory struct {
+	files           []string
+	settingsFile    string
+	scheduleSources map[string]string
+}
+
+// scheduleFile represents a configuration file which only contributes
+// schedules.
+type scheduleFile struct {
+	Schedules []LightSchedule `json:"schedules"`
+}
+
+// configurationFiles returns all configuration files in the given
+// directory in lexical order.
+func configurationFiles(directory string) ([]string, error) {
+	entries, err := ioutil.ReadDir(directory)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if filepath.Ext(entry.Name()) != ".json" && !isYAMLFile(entry.Name()) {
+			continue
+		}
+		files = append(files, filepath.Join(directory, entry.Name()))
+	}
+	sort.Strings(files)
+	return files, nil
+}
+
+func (configuration *Configuration) loadDirectory() error {
+	files, err := configurationFiles(configuration.ConfigurationFile)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return fmt.Errorf("No configuration files found in directory %s", configuration.ConfigurationFile)
+	}
+
+	directory := configurationDirectory{files: files, scheduleSources: make(map[string]string)}
+	devices := make(map[string]LightSchedule)
+	deviceNames := make(map[string]LightSchedule)
+	configuration.Schedules = []LightSchedule{}
+	for _, file := range files {
+		var part Configuration
+		part.ConfigurationFile = file
+		err := part.loadFile()
+		if err != nil {
+			return fmt.Errorf("Could not read configuration %s: %v", file, err)
+		}
+
+		if part.Version != 0 || part.Bridge != (Bridge{}) || len(part.Bridges) > 0 || part.Location != (Location{}) || len(part.Locations) > 0 || !reflect.DeepEqual(part.WebInterface, WebInterface{}) || part.TransitionTime != "" || part.UpdateInterval != "" || part.IdlePollingInterval != "" || len(part.NanoleafTokens) > 0 || len(part.Webhooks) > 0 || len(part.Wakeups) > 0 || part.AwaySimulation != nil || part.Presence != nil || part.Weather != nil || part.Logging != nil || part.Tracing != nil || part.StatsD != nil || part.Shutdown != nil || part.Updates != nil || part.Proxy != "" || part.MQTT != nil || part.HomeKit != nil || part.Calendar != nil {
+			if directory.settingsFile != "" {
+				return fmt.Errorf("Global settings are defined in %s and %s. Please define them in one file only", directory.settingsFile, file)
+			}
+			directory.settingsFile = file
+			configuration.Version = part.Version
+			configuration.Bridge = part.Bridge
+			configuration.Bridges = part.Bridges
+			configuration.Location = part.Location
+			configuration.Locations = part.Locations
+			configuration.WebInterface = part.WebInterface
+			configuration.TransitionTime = part.TransitionTime
+			configuration.UpdateInterval = part.UpdateInterval
+			configuration.IdlePollingInterval = part.IdlePollingInterval
+			configuration.NanoleafTokens = part.NanoleafTokens
+			configuration.Webhooks = part.Webhooks
+			configuration.Wakeups = part.Wakeups
+			configuration.AwaySimulation = part.AwaySimulation
+			configuration.Presence = part.Presence
+			configuration.Weather = part.Weather
+			configuration.Logging = part.Logging
+			configuration.Tracing = part.Tracing
+			configuration.StatsD = part.StatsD
+			configuration.Shutdown = part.Shutdown
+			configuration.Updates = part.Updates
+			configuration.Proxy = part.Proxy
+			configuration.MQTT = part.MQTT
+			configuration.HomeKit = part.HomeKit
+			configuration.Calendar = part.Calendar
+		}
+
+		for _, schedule := range part.Schedules {
+			if source, found := directory.scheduleSources[schedule.Name]; found {
+				return fmt.Errorf("Schedule %s is defined in %s and %s", schedule.Name, source, file)
+			}
+			// The order of files must not decide which schedule is used
+			for _, id := range schedule.AssociatedDeviceIDs {
+				key := fmt.Sprintf("%s/%d", schedule.Bridge, id)
+				if other, found := devices[key]; found && other.Priority == schedule.Priority {
+					return fmt.Errorf("Device %d is associated with schedule %s and schedule %s (%s) of the same priority", id, other.Name, schedule.Name, file)
+				}
+				devices[key] = schedule
+			}
+			for _, name := range schedule.AssociatedDeviceNames {
+				key := schedule.Bridge + "/" + strings.ToLower(strings.TrimSpace(name))
+				if other, found := deviceNames[key]; found && other.Priority == schedule.Priority {
+					return fmt.Errorf("Device \"%s\" is associated with schedule %s and schedule %s (%s) of the same priority", name, other.Name, schedule.Name, file)
+				}
+				deviceNames[key] = schedule
+			}
+			directory.scheduleSources[schedule.Name] = file
+			configuration.Schedules = append(configuration.Schedules, schedule)
+		}
+		configLog.Debugf("⚙ Loaded %d schedules from %s", len(part.Schedules), file)
+	}
+
+	if directory.settingsFile == "" {
+		directory.settingsFile = files[0]
+	}
+	configuration.directory = &directory
+	return nil
+}
+
+// writeDirectory saves every schedule back to the file it was read from.
+// New schedules and the global settings are written to the settings file.
+func (configuration *Configuration) writeDirectory() error {
+	directory := configuration.directory
+	schedules := make(map[string][]LightSchedule)
+	for _, schedule := range configuration.Schedules {
+		file, found := directory.scheduleSources[schedule.Name]
+		if !found {
+			file = directory.settingsFile
+			directory.scheduleSources[schedule.Name] = file
+		}
+		schedules[file] = append(schedules[file], schedule)
+	}
+
+	for _, file := range directory.files {
+		var err error
+		if file == directory.settingsFile {
+			settings := *configuration
+			settings.Schedules = schedules[file]
+			if settings.Schedules == nil {
+				settings.Schedules = []LightSchedule{}
+			}
+			err = writeConfigurationFileIfChanged(file, settings)
+		} else {
+			part := scheduleFile{schedules[file]}
+			if part.Schedules == nil {
+				part.Schedules = []LightSchedule{}
+			}
+			err = writeConfigurationFileIfChanged(file, part)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeConfigurationFileIfChanged leaves files untouched if their content
+// didn't change to preserve the formatting of generated files.
+func writeConfigurationFileIfChanged(filename string, data interface{}) error {
+	var existing Configuration
+	existing.ConfigurationFile = filename
+	if existing.loadFile() == nil {
+		if existing.Schedules == nil {
+			existing.Schedules = []LightSchedule{}
+		}
+		current, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		var before []byte
+		if _, ok := data.(scheduleFile); ok {
+			before, err = json.Marshal(scheduleFile{existing.Schedules})
+		} else {
+			before, err = json.Marshal(existing)
+		}
+		if err == nil && bytes.Equal(current, before) {
+			return nil
+		}
+	}
+	configLog.Debugf("⚙ Saving configuration file %s", filename)
+	return writeConfigurationFile(filename, data)
+}
@@ -0,0 +1,80 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestReadDirectory(t *testing.T) {
+	directory := t.TempDir()
+	files := map[string]string{
+		"00-kelvin.yaml":     "bridge:\n  ip: 192.168.10.37\n  username: user\nversion: 1\nwebinterface:\n  enabled: false\n  port: 8080\n",
+		"10-livingroom.yaml": "schedules:\n- name: livingroom\n  associatedDeviceIDs: [1, 2]\n  defaultColorTemperature: 2750\n  defaultBrightness: 100\n",
+		"20-bedroom.json":    `{"schedules": [{"name": "bedroom", "associatedDeviceIDs": [3], "defaultColorTemperature": 2500, "defaultBrightness": 80}]}`,
+	}
+	for name, content := range files {
+		err := ioutil.WriteFile(filepath.Join(directory, name), []byte(content), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := Configuration{}
+	c.ConfigurationFile = directory
+	err := c.Read()
+	if err != nil {
+		t.Fatalf("Could not read configuration directory: %v", err)
+	}
+	if len(c.Schedules) != 2 || c.Schedules[0].Name != "livingroom" || c.Schedules[1].Name != "bedroom" {
+		t.Errorf("Unexpected schedules after merge: %+v", c.Schedules)
+	}
+	if c.Bridge.IP != "192.168.10.37" {
+		t.Errorf("Bridge settings not loaded: %+v", c.Bridge)
+	}
+
+	// Changes must be written back to the originating file
+	c.Schedules[1].DefaultBrightness = 50
+	err = c.Write()
+	if err != nil {
+		t.Fatalf("Could not write configuration directory: %v", err)
+	}
+	part := Configuration{ConfigurationFile: filepath.Join(directory, "20-bedroom.json")}
+	err = part.loadFile()
+	if err != nil || len(part.Schedules) != 1 || part.Schedules[0].DefaultBrightness != 50 {
+		t.Errorf("Schedule not written back to its file: %+v (%v)", part.Schedules, err)
+	}
+
+	// Duplicate devices must be detected
+	err = ioutil.WriteFile(filepath.Join(directory, "30-duplicate.yaml"), []byte("schedules:\n- name: duplicate\n  associatedDeviceIDs: [2]\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c = Configuration{}
+	c.ConfigurationFile = directory
+	err = c.Read()
+	if err == nil {
+		t.Errorf("Device associated in multiple files should return an error")
+	}
+}
@@ -0,0 +1,171 @@
+// MIT License
+//
+// Copyright (c) 2018 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// environmentVariable maps an environment variable and the corresponding
+// command line flag to the configuration value it overrides.
+type environmentVariable struct {
+	name  string
+	flag  string
+	value interface{}
+}
+
+// override stores the original value of an overridden configuration value
+// so it can be restored before the configuration is written to disk.
+type override struct {
+	original interface{}
+	value    interface{}
+}
+
+func (configuration *Configuration) environmentVariables() []environmentVariable {
+	return []environmentVariable{
+		{"KELVIN_BRIDGE_IP", "bridge-ip", &configuration.Bridge.IP},
+		{"KELVIN_BRIDGE_USERNAME", "bridge-username", &configuration.Bridge.Username},
+		{"KELVIN_LATITUDE", "latitude", &configuration.Location.Latitude},
+		{"KELVIN_LONGITUDE", "longitude", &configuration.Location.Longitude},
+		{"KELVIN_WEBINTERFACE_ENABLED", "", &configuration.WebInterface.Enabled},
+		{"KELVIN_WEBINTERFACE_PORT", "", &configuration.WebInterface.Port},
+		{"KELVIN_WEBINTERFACE_TOKEN", "", &configuration.WebInterface.Token},
+		{"KELVIN_WEBINTERFACE_PASSWORD", "", &configuration.WebInterface.Password},
+	}
+}
+
+// applyEnvironment overrides configuration values with the values of
+// the corresponding KELVIN_* environment variables.
+func (configuration *Configuration) applyEnvironment() error {
+	for _, variable := range configuration.environmentVariables() {
+		raw, found := os.LookupEnv(variable.name)
+		if !found {
+			continue
+		}
+		err := configuration.applyOverride(variable, raw)
+		if err != nil {
+			return fmt.Errorf("Invalid value for environment variable %s: %v", variable.name, err)
+		}
+		configLog.Printf("⚙ Configuration value overridden by environment variable %s", variable.name)
+	}
+	return nil
+}
+
+// applyFlags overrides configuration values with the values given on the
+// command line. Flags take precedence over environment variables.
+func (configuration *Configuration) applyFlags() error {
+	flags := make(map[string]string)
+	flag.Visit(func(f *flag.Flag) {
+		flags[f.Name] = f.Value.String()
+	})
+
+	for _, variable := range configuration.environmentVariables() {
+		raw, found := flags[variable.flag]
+		if variable.flag == "" || !found {
+			continue
+		}
+		err := configuration.applyOverride(variable, raw)
+		if err != nil {
+			return fmt.Errorf("Invalid value for flag -%s: %v", variable.flag, err)
+		}
+		configLog.Printf("⚙ Configuration value overridden by flag -%s", variable.flag)
+	}
+	return nil
+}
+
+func (configuration *Configuration) applyOverride(variable environmentVariable, raw string) error {
+	var original, value interface{}
+	switch target := variable.value.(type) {
+	case *string:
+		original = *target
+		*target = raw
+		value = *target
+	case *float64:
+		parsed, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return err
+		}
+		original = *target
+		*target = parsed
+		value = *target
+	case *int:
+		parsed, err := strconv.Atoi(raw)
+		if err != nil {
+			return err
+		}
+		original = *target
+		*target = parsed
+		value = *target
+	case *bool:
+		parsed, err := strconv.ParseBool(raw)
+		if err != nil {
+			return err
+		}
+		original = *target
+		*target = parsed
+		value = *target
+	}
+
+	if configuration.overrides == nil {
+		configuration.overrides = make(map[string]override)
+	}
+	if previous, found := configuration.overrides[variable.name]; found {
+		original = previous.original
+	}
+	configuration.overrides[variable.name] = override{original, value}
+	return nil
+}
+
+// withoutEnvironment returns a copy of the configuration with all values
+// overridden by environment variables reset to their original values.
+// Values changed at runtime will be kept.
+func (configuration *Configuration) withoutEnvironment() Configuration {
+	persisted := *configuration
+	for _, variable := range persisted.environmentVariables() {
+		o, found := configuration.overrides[variable.name]
+		if !found {
+			continue
+		}
+		switch target := variable.value.(type) {
+		case *string:
+			if *target == o.value.(string) {
+				*target = o.original.(string)
+			}
+		case *float64:
+			if *target == o.value.(float64) {
+				*target = o.original.(float64)
+			}
+		case *int:
+			if *target == o.value.(int) {
+				*target = o.original.(int)
+			}
+		case *bool:
+			if *target == o.value.(bool) {
+				*target = o.original.(bool)
+			}
+		}
+	}
+	return persisted
+}
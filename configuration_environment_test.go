@@ -0,0 +1,65 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEnvironmentOverrides(t *testing.T) {
+	t.Setenv("KELVIN_BRIDGE_USERNAME", "secret-from-environment")
+	t.Setenv("KELVIN_LATITUDE", "48.1")
+
+	c := Configuration{}
+	c.ConfigurationFile = "testdata/config-example.json"
+	err := c.load()
+	if err != nil {
+		t.Fatalf("Could not load configuration: %v", err)
+	}
+	if c.Bridge.Username != "secret-from-environment" || c.Location.Latitude != 48.1 {
+		t.Errorf("Environment overrides not applied: %+v %+v", c.Bridge, c.Location)
+	}
+
+	c.ConfigurationFile = filepath.Join(t.TempDir(), "config.json")
+	err = c.Write()
+	if err != nil {
+		t.Fatalf("Could not write configuration: %v", err)
+	}
+	raw, err := ioutil.ReadFile(c.ConfigurationFile)
+	if err != nil {
+		t.Fatalf("Could not read written configuration: %v", err)
+	}
+	if strings.Contains(string(raw), "secret-from-environment") || strings.Contains(string(raw), "48.1") {
+		t.Errorf("Environment overrides were written to disk: %s", raw)
+	}
+
+	t.Setenv("KELVIN_WEBINTERFACE_PORT", "abc")
+	c = Configuration{}
+	c.ConfigurationFile = "testdata/config-example.json"
+	err = c.load()
+	if err == nil {
+		t.Errorf("Invalid environment variable should return an error")
+	}
+}
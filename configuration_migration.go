@@ -26,15 +26,15 @@ import "fmt"
 import log "github.com/sirupsen/logrus"
 
 func (configuration *Configuration) migrateToLatestVersion() {
-	log.Debugf("⚙ Migrating configuration to latest version...")
+	configLog.Debugf("⚙ Migrating configuration to latest version...")
 	if configuration.Version == 0 {
 		configuration.migrateVersion0()
 	}
-	log.Debugf("⚙ Migration of configuration complete")
+	configLog.Debugf("⚙ Migration of configuration complete")
 }
 
 func (configuration *Configuration) migrateVersion0() {
-	log.Debugf("⚙ Migrating configuration version 0 to version 1...")
+	configLog.Debugf("⚙ Migrating configuration version 0 to version 1...")
 
 	// Migrate to new timestamp format
 	for scheduleIndex := range configuration.Schedules {
@@ -58,7 +58,7 @@ func (configuration *Configuration) migrateVersion0() {
 
 	// Migration: Disable webinterface
 	if configuration.WebInterface.Port == 0 {
-		log.Debugf("⚙ Migrating webinterface settings...")
+		configLog.Debugf("⚙ Migrating webinterface settings...")
 		configuration.WebInterface.Enabled = false
 		configuration.WebInterface.Port = 8080
 	}
@@ -69,7 +69,7 @@ func (configuration *Configuration) migrateVersion0() {
 	}
 
 	configuration.Version = 1
-	log.Debugf("⚙ Migration to version 1 complete")
+	configLog.Debugf("⚙ Migration to version 1 complete")
 }
 
 func migrateTimestampFormat(timestamp string) (string, error) {
@@ -77,7 +77,7 @@ func migrateTimestampFormat(timestamp string) (string, error) {
 	layout := "3:04PM"
 	t, err := time.Parse(layout, timestamp)
 	if err == nil {
-		log.Debugf("⚙ Migrating old timestamp %s to %s", timestamp, t.Format("15:04"))
+		configLog.Debugf("⚙ Migrating old timestamp %s to %s", timestamp, t.Format("15:04"))
 		return t.Format("15:04"), nil
 	}
 
@@ -0,0 +1,86 @@
+// MIT License
+//
+// Copyright (c) 2018 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// secretsPath resolves the given filename relative to the directory of
+// the configuration.
+func (configuration *Configuration) secretsPath(filename string) string {
+	if filepath.IsAbs(filename) {
+		return filename
+	}
+	directory := filepath.Dir(configuration.ConfigurationFile)
+	if isDirectory(configuration.ConfigurationFile) {
+		directory = configuration.ConfigurationFile
+	}
+	return filepath.Join(directory, filename)
+}
+
+// loadSecrets reads the bridge username from the configured secrets file.
+// A missing file is not an error as the username will be obtained by
+// registering at the bridge.
+func (configuration *Configuration) loadSecrets() error {
+	if configuration.Bridge.UsernameFile == "" {
+		return nil
+	}
+	if configuration.Bridge.Username != "" {
+		configLog.Warningf("⚙ Bridge username is configured inline and in %s. Using inline value...", configuration.Bridge.UsernameFile)
+		return nil
+	}
+
+	raw, err := ioutil.ReadFile(configuration.secretsPath(configuration.Bridge.UsernameFile))
+	if os.IsNotExist(err) {
+		configLog.Debugf("⚙ Bridge username file %s doesn't exist yet", configuration.Bridge.UsernameFile)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	configuration.Bridge.Username = strings.TrimSpace(string(raw))
+	return nil
+}
+
+// writeSecrets saves the bridge username to the configured secrets file
+// and removes it from the configuration which will be written to disk.
+func (configuration *Configuration) writeSecrets() error {
+	if configuration.Bridge.UsernameFile == "" {
+		return nil
+	}
+
+	filename := configuration.secretsPath(configuration.Bridge.UsernameFile)
+	raw, err := ioutil.ReadFile(filename)
+	if (err != nil || strings.TrimSpace(string(raw)) != configuration.Bridge.Username) && configuration.Bridge.Username != "" {
+		configLog.Debugf("⚙ Saving bridge username to %s", filename)
+		err = ioutil.WriteFile(filename, []byte(configuration.Bridge.Username+"\n"), 0600)
+		if err != nil {
+			return err
+		}
+	}
+	configuration.Bridge.Username = ""
+	return nil
+}
@@ -0,0 +1,66 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUsernameFile(t *testing.T) {
+	directory := t.TempDir()
+	c := Configuration{}
+	c.ConfigurationFile = filepath.Join(directory, "config.json")
+	c.initializeDefaults()
+	c.Bridge.UsernameFile = "secrets/username"
+	err := os.Mkdir(filepath.Join(directory, "secrets"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Simulate registration at the bridge
+	c.Bridge.Username = "registered-user"
+	err = c.Write()
+	if err != nil {
+		t.Fatalf("Could not write configuration: %v", err)
+	}
+
+	raw, err := ioutil.ReadFile(c.ConfigurationFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(raw), "registered-user") {
+		t.Errorf("Username was written to the configuration: %s", raw)
+	}
+
+	loaded := Configuration{ConfigurationFile: c.ConfigurationFile}
+	err = loaded.load()
+	if err != nil {
+		t.Fatalf("Could not load configuration: %v", err)
+	}
+	if loaded.Bridge.Username != "registered-user" {
+		t.Errorf("Username not loaded from secrets file: %+v", loaded.Bridge)
+	}
+}
@@ -1,7 +1,10 @@
 package main
 
 import (
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestReadOK(t *testing.T) {
@@ -22,7 +25,7 @@ func TestReadOK(t *testing.T) {
 func TestReadError(t *testing.T) {
 	wrongfiles := []string{
 		"",          // no file passed
-		"testdata/", // not a regular file
+		"testdata/", // directory containing invalid files
 		"testdata/config-bad-wrongFormat.json",
 		"testdata/config-bad-wrongFormat.yaml",
 	}
@@ -52,3 +55,209 @@ func TestWriteOK(t *testing.T) {
 		}
 	}
 }
+
+func TestAsTimestampRelative(t *testing.T) {
+	reference := time.Date(2024, 3, 1, 20, 15, 0, 0, time.UTC)
+
+	entry := TimedColorTemperature{Time: "+45m", ColorTemperature: 2300, Brightness: 80}
+	timestamp, err := entry.AsTimestamp(reference)
+	if err != nil {
+		t.Fatalf("AsTimestamp(%q) returned error: %v", entry.Time, err)
+	}
+	if want := time.Date(2024, 3, 1, 21, 0, 0, 0, time.UTC); !timestamp.Time.Equal(want) {
+		t.Errorf("AsTimestamp(%q) = %v; want %v", entry.Time, timestamp.Time, want)
+	}
+
+	entry.Time = "22:30"
+	timestamp, err = entry.AsTimestamp(reference)
+	if err != nil {
+		t.Fatalf("AsTimestamp(%q) returned error: %v", entry.Time, err)
+	}
+	if want := time.Date(2024, 3, 1, 22, 30, 0, 0, time.UTC); !timestamp.Time.Equal(want) {
+		t.Errorf("AsTimestamp(%q) = %v; want %v", entry.Time, timestamp.Time, want)
+	}
+
+	invalid := []string{"+4h", "+-5m", "+abc"}
+	for _, value := range invalid {
+		entry.Time = value
+		_, err = entry.AsTimestamp(reference)
+		if err == nil {
+			t.Errorf("AsTimestamp(%q) should return an error", value)
+		}
+	}
+}
+
+func TestResolveDeviceNames(t *testing.T) {
+	lights := []*Light{{ID: 1, Name: "Couch"}, {ID: 2, Name: "Desk"}, {ID: 3, Name: "Hallway"}, {ID: 4, Name: "Hallway"}}
+	c := Configuration{}
+	c.Schedules = []LightSchedule{
+		{Name: "livingroom", AssociatedDeviceIDs: []int{5}, AssociatedDeviceNames: []string{"couch", "Desk", "Unknown"}},
+		{Name: "hallway", AssociatedDeviceNames: []string{"Hallway"}},
+	}
+	c.resolveAssociations(lights, nil)
+
+	if ids := c.Schedules[0].deviceIDs(); !reflect.DeepEqual(ids, []int{5, 1, 2}) {
+		t.Errorf("deviceIDs() = %v; want [5 1 2]", ids)
+	}
+	if ids := c.Schedules[1].deviceIDs(); len(ids) != 0 {
+		t.Errorf("Ambiguous names should not be resolved: %v", ids)
+	}
+	if _, err := c.lightScheduleForDay(&Light{ID: 2}, time.Now()); err != nil {
+		t.Errorf("Light resolved by name should be associated: %v", err)
+	}
+}
+
+func TestResolveDeviceNamePatterns(t *testing.T) {
+	lights := []*Light{{ID: 1, Name: "Living room 1"}, {ID: 2, Name: "Living room 2"}, {ID: 3, Name: "Hallway 1"}, {ID: 4, Name: "Hallway lamp"}}
+	c := Configuration{}
+	c.Schedules = []LightSchedule{
+		{Name: "livingroom", AssociatedDeviceNames: []string{"living room *"}},
+		{Name: "hallway", AssociatedDeviceNames: []string{`/^Hallway \d+$/`}},
+		{Name: "invalid", AssociatedDeviceNames: []string{"/(/"}},
+	}
+	c.resolveAssociations(lights, nil)
+
+	if ids := c.Schedules[0].deviceIDs(); !reflect.DeepEqual(ids, []int{1, 2}) {
+		t.Errorf("Wildcard resolved to %v; want [1 2]", ids)
+	}
+	if ids := c.Schedules[1].deviceIDs(); !reflect.DeepEqual(ids, []int{3}) {
+		t.Errorf("Regular expression resolved to %v; want [3]", ids)
+	}
+	if ids := c.Schedules[2].deviceIDs(); len(ids) != 0 {
+		t.Errorf("Invalid pattern resolved to %v; want none", ids)
+	}
+}
+
+func TestResolveGroups(t *testing.T) {
+	lights := []*Light{{ID: 1, Name: "Couch"}, {ID: 2, Name: "Desk"}, {ID: 3, Name: "Bed"}}
+	groups := []HueGroup{{ID: 1, Name: "Living room", Type: "Room", Lights: []int{1, 2}}, {ID: 2, Name: "Bedroom", Type: "Room", Lights: []int{3}}}
+	c := Configuration{}
+	c.Schedules = []LightSchedule{
+		{Name: "livingroom", AssociatedGroups: []string{"living room"}},
+		{Name: "bedroom", AssociatedDeviceIDs: []int{3}, AssociatedGroups: []string{"Bed*"}},
+		{Name: "unknown", AssociatedGroups: []string{"Kitchen"}},
+	}
+	c.resolveAssociations(lights, groups)
+
+	if ids := c.Schedules[0].deviceIDs(); !reflect.DeepEqual(ids, []int{1, 2}) {
+		t.Errorf("Group resolved to %v; want [1 2]", ids)
+	}
+	if ids := c.Schedules[1].deviceIDs(); !reflect.DeepEqual(ids, []int{3}) {
+		t.Errorf("Group pattern resolved to %v; want [3]", ids)
+	}
+	if ids := c.Schedules[2].deviceIDs(); len(ids) != 0 {
+		t.Errorf("Unknown group resolved to %v; want none", ids)
+	}
+}
+
+func TestSchedulePriority(t *testing.T) {
+	c := Configuration{}
+	c.Schedules = []LightSchedule{
+		{Name: "livingroom", AssociatedDeviceIDs: []int{1, 2, 3}},
+		{Name: "reading", AssociatedDeviceIDs: []int{2}, Priority: 1},
+		{Name: "duplicate", AssociatedDeviceIDs: []int{3}},
+	}
+
+	if schedule, _ := c.scheduleForLight("", 1); schedule.Name != "livingroom" {
+		t.Errorf("Light 1 uses schedule %s; want livingroom", schedule.Name)
+	}
+	if schedule, _ := c.scheduleForLight("", 2); schedule.Name != "reading" {
+		t.Errorf("Light 2 uses schedule %s; want reading", schedule.Name)
+	}
+	if schedule, _ := c.scheduleForLight("", 3); schedule.Name != "livingroom" {
+		t.Errorf("Light 3 uses schedule %s; want livingroom", schedule.Name)
+	}
+	if _, found := c.scheduleForLight("", 4); found {
+		t.Errorf("Light 4 should not be associated with any schedule")
+	}
+
+	conflicts := c.scheduleConflicts()
+	if len(conflicts) != 1 || !strings.Contains(conflicts[0], "Light 3") {
+		t.Errorf("scheduleConflicts() = %v; want a single conflict for light 3", conflicts)
+	}
+}
+
+func TestDefaultSchedule(t *testing.T) {
+	lights := []*Light{{ID: 1, Name: "Couch"}, {ID: 2, Name: "Desk"}, {ID: 3, Name: "New bulb"}}
+	c := Configuration{}
+	c.Schedules = []LightSchedule{
+		{Name: "livingroom", AssociatedDeviceIDs: []int{1}, AssociatedDeviceNames: []string{"Desk"}},
+		{Name: "other", AssociatedDeviceIDs: []int{1}, Default: true},
+	}
+	c.resolveAssociations(lights, nil)
+
+	if ids := c.Schedules[1].deviceIDs(); !reflect.DeepEqual(ids, []int{1, 3}) {
+		t.Errorf("Default schedule resolved to %v; want [1 3]", ids)
+	}
+	if schedule, _ := c.scheduleForLight("", 3); schedule.Name != "other" {
+		t.Errorf("Light 3 uses schedule %s; want other", schedule.Name)
+	}
+}
+
+func TestScheduleLocation(t *testing.T) {
+	c := Configuration{Location: Location{Latitude: 53.5, Longitude: 10.0}}
+	c.Locations = map[string]Location{"cabin": {Latitude: 69.6, Longitude: 18.9}}
+	home := LightSchedule{Name: "home", DefaultColorTemperature: 2750, DefaultBrightness: 100}
+	cabin := LightSchedule{Name: "cabin", Location: "cabin", DefaultColorTemperature: 2750, DefaultBrightness: 100}
+
+	if location := c.locationForSchedule(home); location != c.Location {
+		t.Errorf("Schedule home uses location %v; want %v", location, c.Location)
+	}
+	if location := c.locationForSchedule(cabin); location != c.Locations["cabin"] {
+		t.Errorf("Schedule cabin uses location %v; want %v", location, c.Locations["cabin"])
+	}
+
+	date := time.Date(2019, time.March, 1, 12, 0, 0, 0, time.UTC)
+	if c.scheduleForDay(home, date).sunrise.Time.Equal(c.scheduleForDay(cabin, date).sunrise.Time) {
+		t.Errorf("Schedules at different locations should have different sunrise times")
+	}
+}
+
+func TestMultipleBridges(t *testing.T) {
+	lights := []*Light{{ID: 1, Name: "Couch"}, {ID: 1, Name: "Desk", Bridge: "upstairs"}, {ID: 2, Name: "Bed", Bridge: "upstairs"}}
+	c := Configuration{}
+	c.Bridges = []Bridge{{Name: "upstairs", IP: "192.168.1.20"}}
+	c.Schedules = []LightSchedule{
+		{Name: "livingroom", AssociatedDeviceIDs: []int{1}},
+		{Name: "office", Bridge: "upstairs", AssociatedDeviceNames: []string{"Desk", "Couch"}},
+		{Name: "bedroom", Bridge: "upstairs", Default: true},
+	}
+	c.resolveAssociations(lights, nil)
+
+	if schedule, _ := c.scheduleForLight("", 1); schedule.Name != "livingroom" {
+		t.Errorf("Light 1 of the default bridge uses schedule %s; want livingroom", schedule.Name)
+	}
+	if schedule, _ := c.scheduleForLight("upstairs", 1); schedule.Name != "office" {
+		t.Errorf("Light 1 of bridge upstairs uses schedule %s; want office", schedule.Name)
+	}
+	if schedule, _ := c.scheduleForLight("upstairs", 2); schedule.Name != "bedroom" {
+		t.Errorf("Light 2 of bridge upstairs uses schedule %s; want bedroom", schedule.Name)
+	}
+	if conflicts := c.scheduleConflicts(); len(conflicts) != 0 {
+		t.Errorf("Lights of different bridges should not conflict: %v", conflicts)
+	}
+	if c.bridgeConfiguration("upstairs") == nil || c.bridgeConfiguration("cellar") != nil {
+		t.Errorf("bridgeConfiguration returned unexpected results")
+	}
+}
+
+func TestTransitionTime(t *testing.T) {
+	c := Configuration{}
+	lightSchedule := LightSchedule{Name: "bedroom"}
+	if transitionTime := c.transitionTimeForSchedule(lightSchedule); transitionTime != lightTransistionTime {
+		t.Errorf("Expected default transition time %v, got %v", lightTransistionTime, transitionTime)
+	}
+	c.TransitionTime = "10s"
+	if transitionTime := c.transitionTimeForSchedule(lightSchedule); transitionTime != 10*time.Second {
+		t.Errorf("Expected global transition time 10s, got %v", transitionTime)
+	}
+	lightSchedule.TransitionTime = "0s"
+	if transitionTime := c.scheduleForDay(lightSchedule, time.Now()).transitionTime; transitionTime != 0 {
+		t.Errorf("Expected instant updates for the schedule, got %v", transitionTime)
+	}
+	for _, invalid := range []string{"-1s", "2h", "soon"} {
+		if _, err := parseTransitionTime(invalid, lightTransistionTime); err == nil {
+			t.Errorf("Transition time %s should be invalid", invalid)
+		}
+	}
+}
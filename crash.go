@@ -0,0 +1,136 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	workerRestartDelay    = 5 * time.Second
+	maxWorkerRestartDelay = 5 * time.Minute
+)
+
+// crashReportInterval limits the stack traces and crash reports of a worker
+// which panics on every update to one per interval.
+const crashReportInterval = time.Hour
+
+var crashes = struct {
+	lock     sync.Mutex
+	reported map[string]time.Time
+}{reported: make(map[string]time.Time)}
+
+// safely runs the given function and recovers from a panic, so a bug in a
+// single light or worker can't take down Kelvin. It returns false if the
+// function panicked.
+func safely(worker string, run func()) (completed bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			reportPanic(worker, r, debug.Stack(), time.Now())
+			completed = false
+		}
+	}()
+	run()
+	return true
+}
+
+// supervise runs a long-running worker and restarts it after a panic. The
+// delay between two restarts doubles while the worker keeps crashing. A
+// worker which returns normally is not restarted.
+func supervise(worker string, run func()) {
+	delay := workerRestartDelay
+	for {
+		started := time.Now()
+		if safely(worker, run) {
+			return
+		}
+		if time.Since(started) > maxWorkerRestartDelay {
+			delay = workerRestartDelay
+		}
+		log.Warningf("🤖 Restarting %s in %v...", worker, delay)
+		time.Sleep(delay)
+		delay *= 2
+		if delay > maxWorkerRestartDelay {
+			delay = maxWorkerRestartDelay
+		}
+	}
+}
+
+// reportPanic logs the recovered panic of the given worker with its stack
+// trace and writes a crash report if configured.
+func reportPanic(worker string, r interface{}, stack []byte, now time.Time) {
+	crashes.lock.Lock()
+	last, found := crashes.reported[worker]
+	repeated := found && now.Sub(last) < crashReportInterval
+	if !repeated {
+		crashes.reported[worker] = now
+	}
+	crashes.lock.Unlock()
+	if repeated {
+		log.Errorf("🤖 %s crashed again: %v", worker, r)
+		return
+	}
+
+	log.Errorf("🤖 %s crashed: %v\n%s", worker, r, stack)
+	filename, err := writeCrashReport(crashReportDirectory(), worker, r, stack, now)
+	if err != nil {
+		log.Warningf("🤖 Could not write crash report: %v", err)
+	} else if filename != "" {
+		log.Printf("🤖 Crash report written to %s. Please attach it to an issue.", filename)
+	}
+}
+
+func crashReportDirectory() string {
+	if configuration == nil || configuration.Logging == nil || configuration.Logging.CrashReports == "" {
+		return ""
+	}
+	return configuration.secretsPath(configuration.Logging.CrashReports)
+}
+
+// writeCrashReport saves the panic to a new file in the given directory
+// and returns its name. Without a directory no report is written.
+func writeCrashReport(directory string, worker string, r interface{}, stack []byte, now time.Time) (string, error) {
+	if directory == "" {
+		return "", nil
+	}
+	err := os.MkdirAll(directory, 0755)
+	if err != nil {
+		return "", err
+	}
+
+	var report strings.Builder
+	fmt.Fprintf(&report, "Kelvin %s (commit %s, built at %s)\n", version, commit, date)
+	fmt.Fprintf(&report, "Time:   %s\n", now.Format(time.RFC3339))
+	fmt.Fprintf(&report, "Worker: %s\n", worker)
+	fmt.Fprintf(&report, "Panic:  %v\n\n%s", r, stack)
+	filename := filepath.Join(directory, fmt.Sprintf("kelvin-crash-%s.txt", now.Format("20060102-150405.000")))
+	return filename, ioutil.WriteFile(filename, []byte(report.String()), 0644)
+}
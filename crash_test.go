@@ -0,0 +1,69 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPanicRecovery(t *testing.T) {
+	directory := t.TempDir()
+	useConfiguration(t, &Configuration{ConfigurationFile: filepath.Join(directory, "config.json"), Logging: &Logging{CrashReports: "crashes"}})
+
+	worker := "test worker " + strconv.FormatInt(time.Now().UnixNano(), 10)
+	if safely(worker, func() { panic("broken light") }) {
+		t.Errorf("A panic should be reported as failure")
+	}
+	if !safely(worker, func() {}) {
+		t.Errorf("A regular return should be reported as success")
+	}
+	reports, err := filepath.Glob(filepath.Join(directory, "crashes", "kelvin-crash-*.txt"))
+	if err != nil || len(reports) != 1 {
+		t.Fatalf("Expected one crash report, got %v (%v)", reports, err)
+	}
+	report, err := ioutil.ReadFile(reports[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{"Worker: " + worker, "Panic:  broken light", "TestPanicRecovery"} {
+		if !strings.Contains(string(report), expected) {
+			t.Errorf("Crash report should contain %q:\n%s", expected, report)
+		}
+	}
+
+	// A worker crashing on every update must not flood the directory
+	safely(worker, func() { panic("broken light") })
+	if reports, _ := filepath.Glob(filepath.Join(directory, "crashes", "*")); len(reports) != 1 {
+		t.Errorf("Repeated crashes should not be reported again, got %v", reports)
+	}
+
+	runs := 0
+	supervise(worker, func() { runs++ })
+	if runs != 1 {
+		t.Errorf("Workers which return should not be restarted, got %d runs", runs)
+	}
+}
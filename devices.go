@@ -0,0 +1,77 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// lightsCommand prints all lights of the configured bridges with their
+// capabilities and returns the exit code for the process.
+func lightsCommand(configurationFile string, args []string) int {
+	flags := commandFlags("lights")
+	err := flags.Parse(args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+
+	if !*flagDebug {
+		setLogLevel(log.ErrorLevel)
+	}
+
+	var c Configuration
+	c.ConfigurationFile = configurationFile
+	err = c.load()
+	if err != nil {
+		fmt.Printf("Could not read configuration %s: %v\n", configurationFile, err)
+		return 1
+	}
+	c.migrateToLatestVersion()
+	configuration = &c
+
+	err = connectBridges()
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	for i, b := range bridges {
+		l, err := b.Lights()
+		if err != nil {
+			fmt.Printf("Could not read lights of bridge %s: %v\n", b.Name, err)
+			return 1
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		if b.Name != "" {
+			fmt.Printf("Bridge %s (%s):\n", b.Name, b.BridgeIP)
+		} else {
+			fmt.Printf("Bridge %s:\n", b.BridgeIP)
+		}
+		for _, line := range deviceTable(l) {
+			fmt.Println(line)
+		}
+	}
+	return 0
+}
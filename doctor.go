@@ -0,0 +1,265 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// maxSolarNoonOffset is the largest expected difference between the solar
+// noon and 12:00 local time. Time zones, daylight saving time and the width
+// of a time zone add up to about two and a half hours.
+const maxSolarNoonOffset = 3 * time.Hour
+
+const (
+	doctorOK      = "OK"
+	doctorWarning = "WARNING"
+	doctorError   = "ERROR"
+)
+
+// doctorFinding is a single result of `kelvin doctor`.
+type doctorFinding struct {
+	level   string
+	check   string
+	message string
+}
+
+// doctorReport collects the results of all checks of `kelvin doctor`.
+type doctorReport struct {
+	findings []doctorFinding
+}
+
+func (report *doctorReport) add(level string, check string, format string, a ...interface{}) {
+	report.findings = append(report.findings, doctorFinding{level, check, fmt.Sprintf(format, a...)})
+}
+
+func (report *doctorReport) count(level string) int {
+	count := 0
+	for _, finding := range report.findings {
+		if finding.level == level {
+			count++
+		}
+	}
+	return count
+}
+
+func (report *doctorReport) print(output io.Writer) {
+	for _, finding := range report.findings {
+		fmt.Fprintf(output, "%-8s %-14s %s\n", finding.level, finding.check, finding.message)
+	}
+	fmt.Fprintf(output, "\n%d error(s), %d warning(s)\n", report.count(doctorError), report.count(doctorWarning))
+}
+
+// doctorCommand checks the configuration, the location, the file system
+// and all bridges and prints a report of everything which might keep
+// Kelvin from working. It returns the exit code for the process.
+func doctorCommand(configurationFile string, args []string) int {
+	flags := commandFlags("doctor")
+	err := flags.Parse(args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+
+	if !*flagDebug {
+		// Findings are part of the report, skip the regular log output
+		setLogLevel(log.ErrorLevel)
+	}
+
+	var report doctorReport
+	var c Configuration
+	c.ConfigurationFile = configurationFile
+	err = c.load()
+	if err != nil {
+		report.add(doctorError, "configuration", "Could not read %s: %v", configurationFile, err)
+		report.print(os.Stdout)
+		return 1
+	}
+	c.migrateToLatestVersion()
+	configuration = &c
+	err = configureProxy(configuration.Proxy)
+	if err != nil {
+		report.add(doctorError, "proxy", "%v", err)
+	}
+
+	now := time.Now()
+	configuration.checkConfiguration(&report)
+	configuration.checkSchedules(&report, now)
+	configuration.checkSunTimes(&report, now)
+	configuration.checkWriteAccess(&report)
+	configuration.checkBridges(&report)
+
+	report.print(os.Stdout)
+	if report.count(doctorError) > 0 {
+		return 1
+	}
+	return 0
+}
+
+func (configuration *Configuration) checkConfiguration(report *doctorReport) {
+	validation := configuration.Validate()
+	for _, message := range validation.Errors {
+		report.add(doctorError, "configuration", "%s", message)
+	}
+	for _, message := range validation.Warnings {
+		report.add(doctorWarning, "configuration", "%s", message)
+	}
+	if len(validation.Errors) == 0 && len(validation.Warnings) == 0 {
+		report.add(doctorOK, "configuration", "%s contains %d schedule(s) without problems", configuration.ConfigurationFile, len(configuration.Schedules))
+	}
+}
+
+// checkSchedules calculates every schedule for today. The configuration
+// check covers the solstices and equinoxes already, this reports the
+// times users will actually see.
+func (configuration *Configuration) checkSchedules(report *doctorReport, now time.Time) {
+	// Don't repeat invalid entries found by the configuration check
+	reported := make(map[string]bool)
+	invalid := make(map[string]bool)
+	for _, finding := range report.findings {
+		reported[finding.message] = true
+		if finding.level == doctorError {
+			invalid[strings.SplitN(finding.message, ":", 2)[0]] = true
+		}
+	}
+	for _, lightSchedule := range configuration.Schedules {
+		var validation ValidationReport
+		validateScheduleForDay(&validation, configuration, lightSchedule, now, reported)
+		for _, message := range validation.Errors {
+			report.add(doctorError, "schedule", "%s", message)
+		}
+		for _, message := range validation.Warnings {
+			report.add(doctorWarning, "schedule", "%s", message)
+		}
+		if len(validation.Errors) > 0 || invalid["Schedule "+lightSchedule.Name] {
+			continue
+		}
+		schedule := configuration.scheduleForDay(lightSchedule, now)
+		report.add(doctorOK, "schedule", "Schedule %s: Sunrise %s, sunset %s and %d entries today", lightSchedule.Name, schedule.sunrise.Time.Format("15:04"), schedule.sunset.Time.Format("15:04"), len(schedule.beforeSunrise)+len(schedule.afterSunset))
+	}
+}
+
+// checkSunTimes verifies that every location produces plausible sun times
+// for today. A solar noon far from 12:00 points to swapped coordinates or
+// a wrong time zone.
+func (configuration *Configuration) checkSunTimes(report *doctorReport, now time.Time) {
+	for _, location := range configuration.sunLocations() {
+		name := fmt.Sprintf("%v, %v", location.Latitude, location.Longitude)
+		if location.Latitude == 0 || location.Longitude == 0 {
+			if *flagDetectLocation {
+				report.add(doctorWarning, "location", "Location %s not configured. Kelvin will detect it by IP address", name)
+			} else {
+				report.add(doctorError, "location", "Location %s not configured. Sunrise and sunset will be wrong until you configure your location or start Kelvin with -detectLocation", name)
+			}
+			continue
+		}
+
+		sunrise, sunset, polar := location.calculateSunTimes(now)
+		if !sunrise.Before(sunset) {
+			report.add(doctorError, "location", "Location %s: Sunrise (%s) is not before sunset (%s)", name, sunrise.Format("15:04"), sunset.Format("15:04"))
+			continue
+		}
+		if polar != "" {
+			report.add(doctorWarning, "location", "Location %s: %s", name, polar)
+			continue
+		}
+		solarNoon := sunrise.Add(sunset.Sub(sunrise) / 2)
+		offset := solarNoon.Sub(atClockTime(now, 0, 12*time.Hour))
+		if math.Abs(float64(offset)) > float64(maxSolarNoonOffset) {
+			report.add(doctorWarning, "location", "Location %s: Solar noon at %s is far from 12:00. Check the coordinates and the time zone %s of this system", name, solarNoon.Format("15:04"), now.Location())
+			continue
+		}
+		report.add(doctorOK, "location", "Location %s: Sunrise %s, sunset %s (time zone %s)", name, sunrise.Format("15:04"), sunset.Format("15:04"), now.Location())
+	}
+}
+
+// checkWriteAccess tests if Kelvin can save its configuration, state and
+// backups and replace its binary for automatic updates.
+func (configuration *Configuration) checkWriteAccess(report *doctorReport) {
+	directories := []string{filepath.Dir(configuration.secretsPath(stateFilename))}
+	purposes := []string{"configuration, state and backups"}
+	if !*flagNoUpdate && configuration.Updates.enabled() {
+		directories = append(directories, filepath.Dir(absolutePath(os.Args[0])))
+		purposes = append(purposes, "automatic updates")
+	}
+
+	for i, directory := range directories {
+		err := checkWritable(directory)
+		if err != nil {
+			report.add(doctorError, "write access", "Directory %s for %s is not writable: %v", directory, purposes[i], err)
+			continue
+		}
+		report.add(doctorOK, "write access", "Directory %s for %s is writable", directory, purposes[i])
+	}
+}
+
+func checkWritable(directory string) error {
+	file, err := ioutil.TempFile(directory, ".kelvin-doctor-")
+	if err != nil {
+		return err
+	}
+	file.Close()
+	return os.Remove(file.Name())
+}
+
+// checkBridges tests if every configured bridge is reachable and accepts
+// the configured username. Unlike Kelvin itself, the doctor never starts
+// a registration.
+func (configuration *Configuration) checkBridges(report *doctorReport) {
+	configurations := []Bridge{configuration.Bridge}
+	configurations = append(configurations, configuration.Bridges...)
+	for _, bridgeConfiguration := range configurations {
+		name := "bridge"
+		if bridgeConfiguration.Name != "" {
+			name = "bridge " + bridgeConfiguration.Name
+		}
+
+		bridge := &HueBridge{Name: bridgeConfiguration.Name}
+		err := bridge.discover(bridgeConfiguration.IP)
+		if err != nil {
+			report.add(doctorError, name, "Not reachable: %v", err)
+			continue
+		}
+		if bridgeConfiguration.Username == "" {
+			report.add(doctorError, name, "Found at %s but no username configured. Run `kelvin pair` and push the button on the bridge", bridge.BridgeIP)
+			continue
+		}
+
+		bridge.Username = bridgeConfiguration.Username
+		var lights map[string]json.RawMessage
+		err = bridge.sendAPIRequest("GET", "/lights", nil, &lights)
+		if err != nil {
+			report.add(doctorError, name, "Could not read lights from bridge at %s: %v", bridge.BridgeIP, err)
+			continue
+		}
+		report.add(doctorOK, name, "Connected to bridge at %s with %d light(s)", bridge.BridgeIP, len(lights))
+	}
+}
@@ -0,0 +1,94 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDoctor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/description.xml":
+			w.Write([]byte("<root><device><modelNumber>BSB002</modelNumber></device></root>"))
+		case "/api/kelvin/lights":
+			w.Write([]byte(`{"1": {"name": "Desk"}, "2": {"name": "Couch"}}`))
+		default:
+			w.Write([]byte(`[{"error": {"type": 1, "address": "/lights", "description": "unauthorized user"}}]`))
+		}
+	}))
+	defer server.Close()
+	address := strings.TrimPrefix(server.URL, "http://")
+
+	findings := func(report doctorReport, level string, check string) []string {
+		var messages []string
+		for _, finding := range report.findings {
+			if finding.level == level && finding.check == check {
+				messages = append(messages, finding.message)
+			}
+		}
+		return messages
+	}
+
+	var report doctorReport
+	c := Configuration{
+		Bridge:  Bridge{IP: address, Username: "kelvin"},
+		Bridges: []Bridge{{Name: "upstairs", IP: address, Username: "unknown"}, {Name: "garage", IP: address}},
+	}
+	c.checkBridges(&report)
+	if ok := findings(report, doctorOK, "bridge"); len(ok) != 1 || !strings.Contains(ok[0], "2 light(s)") {
+		t.Errorf("Expected the bridge to be reachable with 2 lights, got %v", report.findings)
+	}
+	if errs := findings(report, doctorError, "bridge upstairs"); len(errs) != 1 || !strings.Contains(errs[0], "unauthorized user") {
+		t.Errorf("Expected the username to be rejected, got %v", report.findings)
+	}
+	if errs := findings(report, doctorError, "bridge garage"); len(errs) != 1 || !strings.Contains(errs[0], "no username") {
+		t.Errorf("Expected a missing username to be reported, got %v", report.findings)
+	}
+
+	zone := time.FixedZone("CET", 3600)
+	now := time.Date(2024, time.March, 20, 12, 0, 0, 0, zone)
+	report = doctorReport{}
+	c = Configuration{Location: Location{Latitude: 52.52, Longitude: 13.40}}
+	c.checkSunTimes(&report, now)
+	if len(findings(report, doctorOK, "location")) != 1 {
+		t.Errorf("Expected plausible sun times for Berlin, got %v", report.findings)
+	}
+	report = doctorReport{}
+	c = Configuration{Location: Location{Latitude: 13.40, Longitude: -122.42}}
+	c.checkSunTimes(&report, now)
+	if warnings := findings(report, doctorWarning, "location"); len(warnings) != 1 || !strings.Contains(warnings[0], "Solar noon") {
+		t.Errorf("Expected a warning for a location outside of the time zone, got %v", report.findings)
+	}
+
+	if err := checkWritable(t.TempDir()); err != nil {
+		t.Errorf("Temporary directory should be writable: %v", err)
+	}
+	if err := checkWritable(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Errorf("Missing directory must not be writable")
+	}
+}
@@ -24,53 +24,95 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
 	"runtime"
 	"strings"
+
+	"github.com/Masterminds/semver"
 )
 
-func downloadLatestReleaseInfo(url string) (releaseName string, assetURL string, err error) {
-	resp, err := http.Get(url)
+// releaseInfo represents a release of the GitHub API.
+type releaseInfo struct {
+	TagName    string                   `json:"tag_name"`
+	Name       string                   `json:"name"`
+	Draft      bool                     `json:"draft"`
+	Prerelease bool                     `json:"prerelease"`
+	Assets     []map[string]interface{} `json:"assets"`
+}
+
+// downloadReleases returns the most recent releases of the repository with
+// the given API URL.
+func downloadReleases(url string) ([]releaseInfo, error) {
+	resp, err := internetClient.Get(url + "/releases")
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
 	defer resp.Body.Close()
 
 	b, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
-		return "", "", err
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub returned HTTP %d", resp.StatusCode)
 	}
 
-	var data interface{}
-	err = json.Unmarshal(b, &data)
+	var releases []releaseInfo
+	err = json.Unmarshal(b, &releases)
 	if err != nil {
-		return "", "", err
+		return nil, err
 	}
-
-	releaseInfo := data.(map[string]interface{})
-	var name string
-	if releaseInfo["tag_name"] != nil {
-		name = releaseInfo["tag_name"].(string)
-	} else if releaseInfo["name"] != nil {
-		name = releaseInfo["name"].(string)
-	} else {
-		return "", "", errors.New("No releases available")
+	if len(releases) == 0 {
+		return nil, errors.New("No releases available")
 	}
+	return releases, nil
+}
 
-	releaseAssets := releaseInfo["assets"].([]interface{})
-	for _, asset := range releaseAssets {
-		jsonAsset := asset.(map[string]interface{})
+// version returns the version of the release, preferably from its tag.
+func (release releaseInfo) version() (*semver.Version, error) {
+	if release.TagName != "" {
+		return semver.NewVersion(release.TagName)
+	}
+	return semver.NewVersion(release.Name)
+}
 
-		match, url := assetMatchesPlattform(jsonAsset)
+// archive returns the name and the URL of the archive for this platform.
+func (release releaseInfo) archive() (string, string, bool) {
+	for _, asset := range release.Assets {
+		match, url := assetMatchesPlattform(asset)
 		if match {
-			return name, url, nil
+			return asset["name"].(string), url, true
 		}
 	}
+	return "", "", false
+}
 
-	return "", "", errors.New("No matching release found")
+// asset returns the URL of the asset with the given name.
+func (release releaseInfo) asset(name string) (string, bool) {
+	for _, asset := range release.Assets {
+		if assetName, ok := asset["name"].(string); ok && assetName == name {
+			url, ok := asset["browser_download_url"].(string)
+			return url, ok
+		}
+	}
+	return "", false
+}
+
+// downloadAsset returns the content of a small asset like a checksum file.
+func downloadAsset(url string) ([]byte, error) {
+	resp, err := internetClient.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GitHub returned HTTP %d for %s", resp.StatusCode, url)
+	}
+	return ioutil.ReadAll(io.LimitReader(resp.Body, maxAssetSize))
 }
 
 func assetMatchesPlattform(asset map[string]interface{}) (bool, string) {
@@ -111,7 +153,7 @@ func downloadReleaseArchive(url string) (archive string, err error) {
 	defer out.Close()
 
 	// Get the data
-	resp, err := http.Get(url)
+	resp, err := internetClient.Get(url)
 	if err != nil {
 		os.Remove(out.Name())
 		return "", err
@@ -0,0 +1,57 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+)
+
+func TestReleaseChannel(t *testing.T) {
+	asset := func(tag string, prerelease bool) releaseInfo {
+		name := "kelvin-" + runtime.GOOS + "-" + runtime.GOARCH + "-" + tag + ".tar.gz"
+		return releaseInfo{TagName: tag, Prerelease: prerelease, Assets: []map[string]interface{}{
+			{"name": name, "content_type": "application/gzip", "browser_download_url": "https://example.com/" + name},
+		}}
+	}
+	releases := []releaseInfo{
+		asset("v1.5.0-beta.2", false),
+		asset("v1.4.1", false),
+		asset("v1.5.0", true),
+		{TagName: "v1.6.0", Draft: true},
+		{TagName: "v1.4.2"}, // no archive for this platform
+	}
+
+	if version, _ := latestRelease(releases, updateChannelStable); version == nil || version.String() != "1.4.1" {
+		t.Errorf("Expected stable release 1.4.1, got %v", version)
+	}
+	version, release := latestRelease(releases, updateChannelBeta)
+	if version == nil || version.String() != "1.5.0" || release.TagName != "v1.5.0" {
+		t.Errorf("Expected pre-release 1.5.0, got %v", version)
+	}
+
+	c := Configuration{Updates: &Updates{Channel: "nightly"}}
+	if !strings.Contains(strings.Join(c.Validate().Errors, "\n"), "Unknown update channel") {
+		t.Errorf("Unknown update channel should fail validation")
+	}
+}
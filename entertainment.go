@@ -0,0 +1,123 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"strconv"
+	"time"
+)
+
+// The stream state of entertainment groups is only available via the
+// groups of the bridge. Don't read them on every light update.
+const entertainmentUpdateInterval = 3 * time.Second
+
+// entertainment tracks the lights of a bridge which are controlled by an
+// active entertainment stream (e.g. Hue Sync or games).
+type entertainment struct {
+	streaming   map[int]bool
+	lastChecked time.Time
+}
+
+type hueEntertainmentGroup struct {
+	Type   string   `json:"type"`
+	Lights []string `json:"lights"`
+	Stream *struct {
+		Active bool   `json:"active"`
+		Owner  string `json:"owner"`
+	} `json:"stream,omitempty"`
+}
+
+// hasEntertainmentGroups returns true if any entertainment area is
+// configured on the bridge.
+func (bridge *HueBridge) hasEntertainmentGroups() bool {
+	for _, group := range groups {
+		if group.Bridge == bridge.Name && group.Type == "Entertainment" {
+			return true
+		}
+	}
+	return false
+}
+
+// streamingLights returns the IDs of all lights in an entertainment area
+// with an active stream.
+func (bridge *HueBridge) streamingLights() (map[int]bool, error) {
+	var attributes map[string]hueEntertainmentGroup
+	err := bridge.apiRequest("GET", "/groups", nil, &attributes)
+	if err != nil {
+		return nil, err
+	}
+	streaming := make(map[int]bool)
+	for _, group := range attributes {
+		if group.Type != "Entertainment" || group.Stream == nil || !group.Stream.Active {
+			continue
+		}
+		for _, light := range group.Lights {
+			id, err := strconv.Atoi(light)
+			if err == nil {
+				streaming[id] = true
+			}
+		}
+	}
+	return streaming, nil
+}
+
+// updateStreaming refreshes the streaming lights of the bridge and returns
+// the IDs of all lights whose stream has ended.
+func (bridge *HueBridge) updateStreaming(now time.Time) []int {
+	if !bridge.hasEntertainmentGroups() {
+		return bridge.setStreaming(nil)
+	}
+	if now.Sub(bridge.stream.lastChecked) < entertainmentUpdateInterval {
+		return nil
+	}
+	bridge.stream.lastChecked = now
+
+	streaming, err := bridge.streamingLights()
+	if err != nil {
+		hueLog.Debugf("⌘ Could not read the state of the entertainment areas: %v", err)
+		return nil
+	}
+	return bridge.setStreaming(streaming)
+}
+
+func (bridge *HueBridge) setStreaming(streaming map[int]bool) []int {
+	if len(streaming) > 0 && len(bridge.stream.streaming) == 0 {
+		hueLog.Printf("⌘ Entertainment streaming started. Pausing updates for %d lights...", len(streaming))
+	}
+	var ended []int
+	for id := range bridge.stream.streaming {
+		if !streaming[id] {
+			ended = append(ended, id)
+		}
+	}
+	if len(ended) > 0 && len(streaming) == 0 {
+		hueLog.Printf("⌘ Entertainment streaming ended. Resuming updates...")
+	}
+	bridge.stream.streaming = streaming
+	return ended
+}
+
+// streaming returns true while the light is part of an active
+// entertainment stream.
+func (light *Light) streaming() bool {
+	return light.HueLight.bridge != nil && light.HueLight.bridge.stream.streaming[light.ID]
+}
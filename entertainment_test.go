@@ -0,0 +1,52 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEntertainmentStreaming(t *testing.T) {
+	bridge := &HueBridge{Name: "upstairs"}
+	light := &Light{ID: 4, Name: "TV", Bridge: "upstairs", HueLight: HueLight{bridge: bridge}}
+
+	if ended := bridge.setStreaming(map[int]bool{4: true, 5: true}); len(ended) != 0 {
+		t.Errorf("No stream should have ended, got %v", ended)
+	}
+	if !light.streaming() {
+		t.Errorf("Light should be paused while streaming")
+	}
+	if ended := bridge.setStreaming(map[int]bool{5: true}); !reflect.DeepEqual(ended, []int{4}) {
+		t.Errorf("Stream of light 4 should have ended, got %v", ended)
+	}
+	if light.streaming() {
+		t.Errorf("Light should be resumed after the stream")
+	}
+
+	// Without entertainment areas the bridge is not asked for the stream state
+	groups = nil
+	if ended := bridge.updateStreaming(time.Now()); !reflect.DeepEqual(ended, []int{5}) {
+		t.Errorf("Removed entertainment areas should end all streams, got %v", ended)
+	}
+}
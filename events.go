@@ -0,0 +1,163 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+	log "github.com/sirupsen/logrus"
+)
+
+const eventPingInterval = 30 * time.Second
+const eventWriteTimeout = 10 * time.Second
+const eventBufferSize = 64
+
+// dashboardEvent is pushed to all connected browsers. Its type is either
+// "light" (changed light state), "schedule" (recalculated schedules) or
+// "warning" (logged warning or error).
+type dashboardEvent struct {
+	Type      string `json:"type"`
+	Light     *Light `json:"light,omitempty"`
+	CanEnable bool   `json:"canEnable,omitempty"`
+	Message   string `json:"message,omitempty"`
+}
+
+// eventHub distributes dashboard events to all WebSocket clients. Slow
+// clients lose events instead of blocking the main loop.
+type eventHub struct {
+	clients map[chan []byte]bool
+	lights  map[string][]byte
+	lock    sync.Mutex
+}
+
+var dashboardEvents = &eventHub{clients: make(map[chan []byte]bool), lights: make(map[string][]byte)}
+
+var eventUpgrader = websocket.Upgrader{ReadBufferSize: 1024, WriteBufferSize: 1024}
+
+func (hub *eventHub) subscribe() chan []byte {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	client := make(chan []byte, eventBufferSize)
+	hub.clients[client] = true
+	return client
+}
+
+func (hub *eventHub) unsubscribe(client chan []byte) {
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	delete(hub.clients, client)
+}
+
+func (hub *eventHub) publish(event dashboardEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+	hub.lock.Lock()
+	defer hub.lock.Unlock()
+	for client := range hub.clients {
+		select {
+		case client <- data:
+		default:
+			// The client is too slow, drop the event
+		}
+	}
+}
+
+// publishLights pushes the state of all lights which changed since the
+// last call.
+func (hub *eventHub) publishLights(lights []*Light) {
+	for _, light := range lights {
+		data, err := json.Marshal(light)
+		if err != nil {
+			continue
+		}
+		key := fmt.Sprintf("%s/%d", light.Bridge, light.ID)
+		hub.lock.Lock()
+		changed := string(hub.lights[key]) != string(data)
+		hub.lights[key] = data
+		hub.lock.Unlock()
+		if changed {
+			hub.publish(dashboardEvent{Type: "light", Light: light, CanEnable: !light.Automatic && light.Tracking})
+		}
+	}
+}
+
+// Levels implements logrus.Hook to forward warnings to the dashboard.
+func (hub *eventHub) Levels() []log.Level {
+	return []log.Level{log.PanicLevel, log.FatalLevel, log.ErrorLevel, log.WarnLevel}
+}
+
+// Fire implements logrus.Hook.
+func (hub *eventHub) Fire(entry *log.Entry) error {
+	hub.publish(dashboardEvent{Type: "warning", Message: entry.Message})
+	return nil
+}
+
+func eventsHandler(w http.ResponseWriter, r *http.Request) {
+	connection, err := eventUpgrader.Upgrade(w, r, nil)
+	if err != nil {
+		webLog.Debugf("Failed to open event stream for %s: %v", r.RemoteAddr, err)
+		return
+	}
+	defer connection.Close()
+	webLog.Debugf("Streaming events to %s", r.RemoteAddr)
+
+	client := dashboardEvents.subscribe()
+	defer dashboardEvents.unsubscribe(client)
+
+	// Browsers don't send messages, but reading is required to notice
+	// closed connections
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := connection.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(eventPingInterval)
+	defer ping.Stop()
+	for {
+		select {
+		case data := <-client:
+			connection.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+			if err := connection.WriteMessage(websocket.TextMessage, data); err != nil {
+				return
+			}
+		case <-ping.C:
+			connection.SetWriteDeadline(time.Now().Add(eventWriteTimeout))
+			if err := connection.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
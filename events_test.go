@@ -0,0 +1,54 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDashboardEvents(t *testing.T) {
+	hub := &eventHub{clients: make(map[chan []byte]bool), lights: make(map[string][]byte)}
+	client := hub.subscribe()
+	light := &Light{ID: 1, Name: "Desk", On: true, Tracking: true}
+
+	hub.publishLights([]*Light{light})
+	var event dashboardEvent
+	if err := json.Unmarshal(<-client, &event); err != nil || event.Type != "light" || !event.CanEnable {
+		t.Fatalf("New light should be published, got %+v (%v)", event, err)
+	}
+	hub.publishLights([]*Light{light})
+	if len(client) != 0 {
+		t.Errorf("Unchanged light should not be published again")
+	}
+	light.On = false
+	hub.publishLights([]*Light{light})
+	if len(client) != 1 {
+		t.Errorf("Changed light should be published")
+	}
+
+	hub.unsubscribe(client)
+	hub.publish(dashboardEvent{Type: "schedule"})
+	if len(client) != 1 {
+		t.Errorf("Unsubscribed client should not receive events")
+	}
+}
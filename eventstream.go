@@ -0,0 +1,116 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const eventStreamReconnectDelay = 10 * time.Second
+
+// hueV2Event represents a single message of the v2 event stream.
+type hueV2Event struct {
+	Type string       `json:"type"`
+	Data []hueV2Light `json:"data"`
+}
+
+// streamEvents subscribes to the event stream of the bridge and sends the
+// ID of every changed light to the given channel. Lost connections will be
+// reestablished.
+func (v2 *hueV2Client) streamEvents(events chan<- int) {
+	// The stream stays open, don't apply the request timeout
+	client := &http.Client{Transport: v2.client.Transport}
+	for {
+		err := v2.readEventStream(client, events)
+		hueLog.Warningf("⌘ Event stream disconnected: %v. Reconnecting in %v...", err, eventStreamReconnectDelay)
+		time.Sleep(eventStreamReconnectDelay)
+	}
+}
+
+func (v2 *hueV2Client) readEventStream(client *http.Client, events chan<- int) error {
+	request, err := http.NewRequest("GET", fmt.Sprintf("https://%s/eventstream/clip/v2", v2.address), nil)
+	if err != nil {
+		return err
+	}
+	request.Header.Set("hue-application-key", v2.applicationKey)
+	request.Header.Set("Accept", "text/event-stream")
+
+	response, err := client.Do(request)
+	if response != nil {
+		defer response.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("Bridge returned HTTP %d", response.StatusCode)
+	}
+
+	hueLog.Debugf("⌘ Subscribed to event stream of the bridge")
+	return parseEventStream(response.Body, events)
+}
+
+// parseEventStream reads server-sent events and reports all changed lights.
+func parseEventStream(stream io.Reader, events chan<- int) error {
+	scanner := bufio.NewScanner(stream)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data:") {
+			continue // ignore ids, comments and keep-alives
+		}
+
+		var messages []hueV2Event
+		err := json.Unmarshal([]byte(strings.TrimSpace(strings.TrimPrefix(line, "data:"))), &messages)
+		if err != nil {
+			hueLog.Debugf("⌘ Ignoring invalid event: %v", err)
+			continue
+		}
+		for _, message := range messages {
+			for _, resource := range message.Data {
+				if !strings.HasPrefix(resource.IDv1, "/lights/") {
+					continue
+				}
+				id, err := strconv.Atoi(strings.TrimPrefix(resource.IDv1, "/lights/"))
+				if err != nil {
+					continue
+				}
+				select {
+				case events <- id:
+				default:
+					// A refresh is already pending
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	return io.EOF
+}
@@ -0,0 +1,43 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseEventStream(t *testing.T) {
+	stream := ": hi\n\nid: 1:0\ndata: [{\"type\":\"update\",\"data\":[{\"id\":\"abc\",\"id_v1\":\"/lights/3\",\"type\":\"light\"},{\"id\":\"def\",\"id_v1\":\"/groups/1\",\"type\":\"grouped_light\"}]}]\n\n"
+	events := make(chan int, 10)
+	parseEventStream(strings.NewReader(stream), events)
+	close(events)
+
+	var ids []int
+	for id := range events {
+		ids = append(ids, id)
+	}
+	if !reflect.DeepEqual(ids, []int{3}) {
+		t.Errorf("parseEventStream reported lights %v; want [3]", ids)
+	}
+}
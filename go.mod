@@ -4,21 +4,34 @@ go 1.17
 
 require (
 	github.com/Masterminds/semver v1.5.0
+	github.com/brutella/hap v0.0.32
 	github.com/bt51/ntpclient v0.0.0-20140310165113-3045f71e2530
 	github.com/btittelbach/astrotime v0.0.0-20160515101311-7ddba43aa26e
 	github.com/ghodss/yaml v1.0.0
 	github.com/gorilla/handlers v1.5.1
 	github.com/gorilla/mux v1.8.0
+	github.com/gorilla/websocket v1.5.0
 	github.com/sirupsen/logrus v1.8.1
 	github.com/stefanwichmann/go.hue v0.0.0-20220211143011-271e555b8b04
+	go.etcd.io/bbolt v1.3.6
+	golang.org/x/sys v0.8.0
 )
 
 require (
+	github.com/brutella/dnssd v1.2.10 // indirect
 	github.com/felixge/httpsnoop v1.0.2 // indirect
+	github.com/go-chi/chi v1.5.4 // indirect
+	github.com/miekg/dns v1.1.54 // indirect
 	github.com/onsi/ginkgo v1.16.5 // indirect
 	github.com/onsi/gomega v1.18.1 // indirect
 	github.com/stefanwichmann/lanscan v0.0.0-20190324154315-2a77f896f93a // indirect
-	github.com/stretchr/testify v1.5.1 // indirect
-	golang.org/x/sys v0.0.0-20220209214540-3681064d5158 // indirect
+	github.com/tadglines/go-pkgs v0.0.0-20210623144937-b983b20f54f9 // indirect
+	github.com/xiam/to v0.0.0-20200126224905-d60d31e03561 // indirect
+	golang.org/x/crypto v0.0.0-20220131195533-30dcbda58838 // indirect
+	golang.org/x/mod v0.10.0 // indirect
+	golang.org/x/net v0.10.0 // indirect
+	golang.org/x/text v0.9.0 // indirect
+	golang.org/x/tools v0.9.1 // indirect
+	gopkg.in/Regis24GmbH/go-diacritics.v2 v2.0.3 // indirect
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 )
@@ -0,0 +1,134 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// hueV2GradientPoint represents a single color of a gradient light.
+type hueV2GradientPoint struct {
+	Color hueV2Color `json:"color"`
+}
+
+// hueV2Gradient represents the colors of the segments of a gradient light.
+type hueV2Gradient struct {
+	Points []hueV2GradientPoint `json:"points"`
+}
+
+// resampleGradient returns the color temperatures of n points evenly
+// distributed along the given gradient.
+func resampleGradient(gradient []int, n int) []int {
+	if len(gradient) == 0 || n <= 0 {
+		return nil
+	}
+	points := make([]int, n)
+	for i := range points {
+		if len(gradient) == 1 || n == 1 {
+			points[i] = gradient[0]
+			continue
+		}
+		position := float64(i) * float64(len(gradient)-1) / float64(n-1)
+		lower := int(math.Floor(position))
+		if lower >= len(gradient)-1 {
+			points[i] = gradient[len(gradient)-1]
+			continue
+		}
+		fraction := position - float64(lower)
+		points[i] = gradient[lower] + int(math.Round(float64(gradient[lower+1]-gradient[lower])*fraction))
+	}
+	return points
+}
+
+// gradientOf returns the gradient of the timestamp. Timestamps without a
+// gradient are uniform.
+func (timestamp TimeStamp) gradientOf(n int) []int {
+	if len(timestamp.Gradient) > 0 {
+		return resampleGradient(timestamp.Gradient, n)
+	}
+	if timestamp.ColorTemperature == -1 {
+		return nil
+	}
+	return resampleGradient([]int{timestamp.ColorTemperature}, n)
+}
+
+// calculateGradientInInterval interpolates the gradients of the start and
+// end of the interval. It returns nil if neither defines a gradient.
+func (interval *Interval) calculateGradientInInterval(timestamp time.Time) []int {
+	if len(interval.Start.Gradient) == 0 && len(interval.End.Gradient) == 0 {
+		return nil
+	}
+	n := len(interval.Start.Gradient)
+	if len(interval.End.Gradient) > n {
+		n = len(interval.End.Gradient)
+	}
+	start := interval.Start.gradientOf(n)
+	end := interval.End.gradientOf(n)
+
+	if timestamp.Before(interval.Start.Time) || end == nil {
+		return start
+	}
+	if timestamp.After(interval.End.Time) || start == nil {
+		return end
+	}
+
+	progress := timestamp.Sub(interval.Start.Time).Minutes() / interval.End.Time.Sub(interval.Start.Time).Minutes()
+	gradient := make([]int, n)
+	for i := range gradient {
+		gradient[i] = start[i] + int(float64(end[i]-start[i])*progress)
+	}
+	return gradient
+}
+
+// gradientPoints returns the number of gradient points the light supports
+// or 0 if it isn't a gradient light. Gradients require the v2 API.
+func (light *HueLight) gradientPoints() int {
+	v2 := light.bridge.v2Client()
+	if v2 == nil {
+		return 0
+	}
+	return v2.lightGradientPoints(light.HueLight.Id)
+}
+
+// gradientActive returns true if Kelvin drives the segments of the light.
+func (light *HueLight) gradientActive() bool {
+	return len(light.TargetGradient) > 0 && light.gradientPoints() > 0
+}
+
+// toV2Gradient converts the given color temperatures for a light with the
+// given number of gradient points.
+func (light *HueLight) toV2Gradient(gradient []int) *hueV2Gradient {
+	points := light.gradientPoints()
+	if len(gradient) < points {
+		points = len(gradient)
+	}
+	if points < 2 {
+		points = 2
+	}
+	var result hueV2Gradient
+	for _, ct := range resampleGradient(gradient, points) {
+		xy := colorTemperatureToXYColor(light.clampColorTemperature(ct))
+		result.Points = append(result.Points, hueV2GradientPoint{hueV2Color{hueV2XY{xy[0], xy[1]}}})
+	}
+	return &result
+}
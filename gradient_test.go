@@ -0,0 +1,60 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestGradient(t *testing.T) {
+	if points := resampleGradient([]int{2000, 4000}, 5); !reflect.DeepEqual(points, []int{2000, 2500, 3000, 3500, 4000}) {
+		t.Errorf("Unexpected resampled gradient %v", points)
+	}
+	if points := resampleGradient([]int{2000, 3000, 6000}, 2); !reflect.DeepEqual(points, []int{2000, 6000}) {
+		t.Errorf("Resampling should keep both ends, got %v", points)
+	}
+
+	now := time.Now()
+	interval := Interval{TimeStamp{now, 2700, 60, []int{2200, 3200}}, TimeStamp{now.Add(time.Hour), 4000, 80, nil}}
+	if gradient := interval.calculateGradientInInterval(now.Add(30 * time.Minute)); !reflect.DeepEqual(gradient, []int{3100, 3600}) {
+		t.Errorf("Gradient should fade to the uniform end state, got %v", gradient)
+	}
+	plain := Interval{TimeStamp{now, 2700, 60, nil}, TimeStamp{now.Add(time.Hour), 4000, 80, nil}}
+	if gradient := plain.calculateGradientInInterval(now); gradient != nil {
+		t.Errorf("Interval without gradients should not define one, got %v", gradient)
+	}
+
+	light := HueLight{Name: "Strip", SupportsXYColor: true, MinimumColorTemperature: 1000, MaximumColorTemperature: 6500, bridge: &HueBridge{v2: &hueV2Client{gradientPoints: map[string]int{"7": 3}}}}
+	light.HueLight.Id = "7"
+	light.TargetGradient = []int{2000, 2500, 3000, 3500, 4000}
+	if !light.gradientActive() {
+		t.Fatalf("Gradient should be active")
+	}
+	if gradient := light.toV2Gradient(light.TargetGradient); len(gradient.Points) != 3 {
+		t.Errorf("Gradient should be reduced to the supported points, got %+v", gradient)
+	}
+	if light.hasColorTemperature(3000) {
+		t.Errorf("Gradient which wasn't sent yet should require an update")
+	}
+}
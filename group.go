@@ -0,0 +1,151 @@
+// MIT License
+//
+// Copyright (c) 2018 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// HueGroup represents a room, zone or group of lights on the bridge.
+type HueGroup struct {
+	Bridge string `json:"bridge,omitempty"`
+	ID     int    `json:"id"`
+	Name   string `json:"name"`
+	Type   string `json:"type"`
+	Lights []int  `json:"lights"`
+}
+
+type hueGroupAttributes struct {
+	Name   string   `json:"name"`
+	Type   string   `json:"type"`
+	Lights []string `json:"lights"`
+}
+
+// hueGroupAction represents the body of a group update.
+type hueGroupAction struct {
+	On             *bool     `json:"on,omitempty"`
+	Brightness     int       `json:"bri,omitempty"`
+	Ct             int       `json:"ct,omitempty"`
+	Xy             []float32 `json:"xy,omitempty"`
+	TransitionTime int       `json:"transitiontime"`
+}
+
+// Groups returns all groups configured on the bridge ordered by ID.
+func (bridge *HueBridge) Groups() ([]HueGroup, error) {
+	var attributes map[string]hueGroupAttributes
+	err := bridge.apiRequest("GET", "/groups", nil, &attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []HueGroup
+	for id, attr := range attributes {
+		groupID, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, err
+		}
+		group := HueGroup{Bridge: bridge.Name, ID: groupID, Name: attr.Name, Type: attr.Type, Lights: []int{}}
+		for _, light := range attr.Lights {
+			lightID, err := strconv.Atoi(light)
+			if err != nil {
+				return nil, err
+			}
+			group.Lights = append(group.Lights, lightID)
+		}
+		sort.Ints(group.Lights)
+		groups = append(groups, group)
+	}
+
+	sort.Slice(groups, func(i, j int) bool { return groups[i].ID < groups[j].ID })
+	return groups, nil
+}
+
+// groupAction converts the given light state into a group update for the
+// given lights. Just like for single lights the bridge prefers xy colors
+// for lights supporting both color modes.
+func groupAction(members []*Light, state LightState, transitionTime time.Duration) hueGroupAction {
+	action := hueGroupAction{TransitionTime: int(transitionTime / time.Millisecond / 100)}
+	for _, light := range members {
+		if state.ColorTemperature != -1 {
+			if light.HueLight.SupportsXYColor {
+				action.Xy = colorTemperatureToXYColor(state.ColorTemperature)
+			}
+			if light.HueLight.SupportsColorTemperature {
+				action.Ct = mapColorTemperature(state.ColorTemperature)
+			}
+		}
+		if state.Brightness > 0 && light.HueLight.Dimmable {
+			action.Brightness = mapBrightness(state.Brightness)
+		}
+	}
+	if state.Brightness == 0 {
+		// Target brightness zero should turn the lights off.
+		off := false
+		action.On = &off
+	}
+	return action
+}
+
+// setGroupState sends the given state to all lights of the group with a
+// single request.
+func (bridge *HueBridge) setGroupState(parent *span, group HueGroup, members []*Light, state LightState, transitionTime time.Duration) error {
+	path := fmt.Sprintf("/groups/%d/action", group.ID)
+	err := bridge.call(parent, "PUT "+path, func() error {
+		return bridge.sendAPIRequest("PUT", path, groupAction(members, state, transitionTime), nil)
+	})
+	if err != nil {
+		return err
+	}
+	for _, light := range members {
+		light.HueLight.setTargetState(state.ColorTemperature, state.Brightness)
+	}
+	return nil
+}
+
+// groupMembers returns the lights of the group if all of them are managed
+// by Kelvin, need an update and share the same target light state and
+// transition time.
+// Otherwise nil is returned.
+func groupMembers(group HueGroup, skip map[*Light]bool) []*Light {
+	var members []*Light
+	for _, id := range group.Lights {
+		light := findLight(group.Bridge, id)
+		if light == nil || skip[light] || light.streaming() || !light.needsUpdate() {
+			return nil
+		}
+		if len(members) > 0 && (!light.TargetLightState.equals(members[0].TargetLightState) || light.Schedule.transitionTime != members[0].Schedule.transitionTime) {
+			return nil
+		}
+		// Lights adjusting the color temperature to their capabilities need a separate update
+		if ct := light.TargetLightState.ColorTemperature; light.HueLight.clampColorTemperature(ct) != ct {
+			return nil
+		}
+		if light.HueLight.gradientActive() {
+			return nil
+		}
+		members = append(members, light)
+	}
+	return members
+}
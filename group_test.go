@@ -0,0 +1,60 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGroupMembers(t *testing.T) {
+	newLight := func(id int, brightness int) *Light {
+		hueLight := HueLight{Name: "Light", SupportsColorTemperature: true, Dimmable: true, CurrentColorMode: "ct", MinimumColorTemperature: 2000}
+		hueLight.setTargetState(2700, 50)
+		hueLight.CurrentColorTemperature = hueLight.TargetColorTemperature
+		hueLight.CurrentBrightness = hueLight.TargetBrightness
+		return &Light{ID: id, Scheduled: true, Reachable: true, On: true, Tracking: true, Automatic: true, HueLight: hueLight, TargetLightState: LightState{2700, brightness}}
+	}
+	useLights(t, newLight(1, 80), newLight(2, 80), newLight(3, 60))
+
+	members := groupMembers(HueGroup{ID: 1, Lights: []int{1, 2}}, nil)
+	if len(members) != 2 {
+		t.Fatalf("Lights 1 and 2 should be updated together, got %d members", len(members))
+	}
+	if groupMembers(HueGroup{ID: 2, Lights: []int{1, 2, 3}}, nil) != nil {
+		t.Errorf("Lights with different target states must not be updated together")
+	}
+	if groupMembers(HueGroup{ID: 3, Lights: []int{1, 2, 4}}, nil) != nil {
+		t.Errorf("Groups containing unmanaged lights must not be updated together")
+	}
+	if groupMembers(HueGroup{ID: 1, Lights: []int{1, 2}}, map[*Light]bool{lights[0]: true}) != nil {
+		t.Errorf("Lights already updated must be skipped")
+	}
+
+	action := groupAction(members, LightState{2700, 80}, 400*time.Millisecond)
+	if action.Ct != mapColorTemperature(2700) || action.Brightness != mapBrightness(80) || action.Xy != nil || action.On != nil || action.TransitionTime != 4 {
+		t.Errorf("Unexpected group action %+v", action)
+	}
+	if action := groupAction(members, LightState{-1, 0}, 0); action.On == nil || *action.On || action.Ct != 0 {
+		t.Errorf("Brightness zero should turn the group off, got %+v", action)
+	}
+}
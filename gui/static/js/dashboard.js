@@ -6,12 +6,55 @@ $(document).ready(function(){
     console.log("Restart kelvin button clicked");
     restartKelvin();
   });
+  $('#timeline').on('change', 'select, input', function(){
+    loadTimeline();
+  });
+  $('#scenes').on('click', '.activateSceneButton', function(){
+    activateScene();
+  });
+  $('#timeline .timelineDate').val(new Date().toISOString().substring(0, 10));
+  loadTimeline();
+  loadScenes();
+  connectEvents();
 });
 
+// connectEvents subscribes to the live updates of Kelvin and reconnects
+// if the connection is lost.
+function connectEvents() {
+  var protocol = window.location.protocol == "https:" ? "wss://" : "ws://";
+  var socket = new WebSocket(protocol + window.location.host + "/api/events");
+  socket.onmessage = function(message) {
+    var event = JSON.parse(message.data);
+    if (event.type == "light") {
+      updateLight(event.light, event.canEnable);
+    } else if (event.type == "schedule") {
+      loadTimeline();
+    } else if (event.type == "warning") {
+      $("#message").append($('<div class="alert alert-warning alert-dismissable"><a href="#" class="close" data-dismiss="alert" aria-label="close">&times;</a></div>').append(document.createTextNode(event.message)));
+    }
+  };
+  socket.onclose = function() {
+    window.setTimeout(connectEvents, 5000);
+  };
+}
+
+function setCheckbox(target, checked) {
+  $(target).find("i").toggleClass("fa-check-square text-success", checked).toggleClass("fa-square text-danger", !checked);
+}
+
+function updateLight(light, canEnable) {
+  var entry = $(".light").filter(function() {
+    return $(this).attr("id") == light.id && ($(this).data("bridge") || "") == (light.bridge || "");
+  });
+  setCheckbox($(entry).find(".lightOn"), light.on);
+  setCheckbox($(entry).find(".lightAutomatic"), light.automatic);
+  $(entry).find(".enableKelvinButton").toggleClass("disabled", !canEnable).prop("disabled", !canEnable);
+}
+
 function activateKelvin(entry) {
   console.log("Activating kelvin for light " + $(entry).attr("id"));
   $.ajax({
-    url: "/lights/"+ $(entry).attr("id") +"/automatic",
+    url: "/lights/"+ $(entry).attr("id") +"/automatic?bridge=" + encodeURIComponent($(entry).data("bridge") || ""),
     type: 'PUT'
   });
   $(entry).find(".enableKelvinButton").prop("disabled",true);
@@ -27,3 +70,93 @@ function restartKelvin() {
   $("#message").append('<div class="alert alert-success alert-dismissable"><a href="#" class="close" data-dismiss="alert" aria-label="close">&times;</a><strong>Restarting... Please wait</div>');
   window.setTimeout(function(){location.reload(true);}, 5000);
 }
+
+function loadScenes() {
+  $.getJSON("/api/scenes", function(scenes) {
+    if (scenes.length == 0) {
+      $('#scenes').hide();
+      return;
+    }
+    var select = $('#scenes .sceneName').empty();
+    $.each(scenes, function(index, scene) {
+      var label = scene.bridge ? scene.name + " (" + scene.bridge + ")" : scene.name;
+      select.append($('<option>').text(label).val(index).data("scene", scene));
+    });
+  });
+}
+
+// activateScene activates the selected scene for the given number of
+// minutes. Kelvin takes over again afterwards.
+function activateScene() {
+  var scene = $('#scenes .sceneName option:selected').data("scene");
+  if (!scene) {
+    return;
+  }
+  $.ajax({
+    url: "/api/scenes/" + encodeURIComponent(scene.name) + "/activate?" + $.param({bridge: scene.bridge || "", duration: $('#scenes .sceneDuration').val() + "m"}),
+    type: 'POST',
+    success: function(result) {
+      $.each(result.lights, function(index, light) {
+        updateLight(light, true);
+      });
+    },
+    error: function(xhr) {
+      $("#message").append($('<div class="alert alert-danger alert-dismissable"><a href="#" class="close" data-dismiss="alert" aria-label="close">&times;</a></div>').append(document.createTextNode(xhr.responseText)));
+    }
+  });
+}
+
+var timelineWidth = 1000;
+var timelineHeight = 280;
+var timelineColors = {"sunrise": "#d9534f", "sunset": "#d9534f", "adjustedSunrise": "#5cb85c", "adjustedSunset": "#5cb85c"};
+
+function loadTimeline() {
+  var schedule = $('#timeline .timelineSchedule').val();
+  if (!schedule) {
+    $('#timeline').hide();
+    return;
+  }
+  $.getJSON("/api/timeline", {schedule: schedule, date: $('#timeline .timelineDate').val()}, drawTimeline);
+}
+
+// minuteOfDay returns the position of a timestamp on the day of the
+// timeline. The offset of the timestamp is kept to show the local time of
+// the schedule.
+function minuteOfDay(timestamp) {
+  var time = timestamp.match(/T(\d\d):(\d\d)/);
+  return parseInt(time[1], 10) * 60 + parseInt(time[2], 10);
+}
+
+function timelineX(timestamp) {
+  return minuteOfDay(timestamp) / (24 * 60) * timelineWidth;
+}
+
+function timelinePath(points, value, min, max) {
+  var path = "";
+  $.each(points, function(index, point) {
+    var v = value(point);
+    if (v === -1) {
+      return;
+    }
+    var y = timelineHeight - (v - min) / (max - min) * timelineHeight;
+    path += (path === "" ? "M" : "L") + timelineX(point.time).toFixed(1) + "," + y.toFixed(1);
+  });
+  return path;
+}
+
+function drawTimeline(timeline) {
+  var svg = "";
+  for (var hour = 0; hour <= 24; hour += 3) {
+    var x = hour / 24 * timelineWidth;
+    svg += '<line x1="' + x + '" y1="0" x2="' + x + '" y2="' + timelineHeight + '" stroke="#eee"/>';
+    svg += '<text x="' + Math.min(x, timelineWidth - 30) + '" y="' + (timelineHeight + 15) + '" font-size="12" fill="#777">' + ("0" + hour).slice(-2) + ':00</text>';
+  }
+  $.each(timeline.markers, function(index, marker) {
+    var x = timelineX(marker.time);
+    var color = timelineColors[marker.type] || "#999";
+    svg += '<line x1="' + x + '" y1="0" x2="' + x + '" y2="' + timelineHeight + '" stroke="' + color + '" stroke-dasharray="4,4"><title>' + marker.type + ' ' + marker.time.substring(11, 16) + '</title></line>';
+  });
+  svg += '<path d="' + timelinePath(timeline.points, function(p) { return p.colorTemperature; }, 1000, 6500) + '" fill="none" stroke="#f0ad4e" stroke-width="2"/>';
+  svg += '<path d="' + timelinePath(timeline.points, function(p) { return p.brightness; }, 0, 100) + '" fill="none" stroke="#337ab7" stroke-width="2"/>';
+  $('#timeline .timelineGraph').html(svg);
+}
@@ -0,0 +1,25 @@
+$(document).ready(function(){
+  $("#refresh").click(function(){
+    loadLogs();
+  });
+  $("#level").change(function(){
+    loadLogs();
+  });
+  loadLogs();
+});
+
+var levelClasses = {"warning": "warning", "error": "danger", "fatal": "danger", "panic": "danger"};
+
+function loadLogs() {
+  $.getJSON("/api/logs", {level: $("#level").val()}, function(entries) {
+    var rows = $("#entries").empty();
+    // Show the latest entries first
+    $.each(entries.reverse(), function(index, entry) {
+      var row = $('<tr>').addClass(levelClasses[entry.level] || "");
+      row.append($('<td class="text-nowrap">').text(new Date(entry.time).toLocaleString()));
+      row.append($('<td>').text(entry.level));
+      row.append($('<td>').text(entry.message));
+      rows.append(row);
+    });
+  });
+}
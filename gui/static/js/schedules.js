@@ -40,6 +40,12 @@ function uploadSchedules(schedules) {
       if (result == "success") {
         $("#message").append('<div class="alert alert-success alert-dismissable"><a href="#" class="close" data-dismiss="alert" aria-label="close">&times;</a><strong>Saved</strong> schedules.</div>');
       }
+    },
+    error: function(xhr) {
+      var report = xhr.responseJSON || {errors: [xhr.responseText]};
+      $.each(report.errors || [], function(index, error) {
+        $("#message").append($('<div class="alert alert-danger alert-dismissable"><a href="#" class="close" data-dismiss="alert" aria-label="close">&times;</a><strong>Not saved:</strong> </div>').append(document.createTextNode(error)));
+      });
     }
   });
 }
@@ -53,7 +59,90 @@ function readSchedule(target){
   schedule.name = $(target).find(".name").val().trim();
   console.log($(target).find(".lights").val())
   schedule.associatedDeviceIDs = parseIDs($(target).find(".lights").val().trim());
+  schedule.associatedDeviceNames = parseNames($(target).find(".lightNames").val());
+  schedule.associatedGroups = parseNames($(target).find(".groups").val());
+  schedule.moonPhases = parseNames($(target).find(".moonPhases").val());
+  schedule.wled = parseNames($(target).find(".wled").val());
+  schedule.nanoleaf = parseNames($(target).find(".nanoleaf").val());
+  schedule.priority = parseInt($(target).find(".priority").val().trim()) || 0;
   schedule.enableWhenLightsAppear = $(target).find(".appearBehavior").is(":checked");
+  schedule.restoreOnStop = $(target).find(".restoreOnStop").is(":checked");
+  schedule.restoreScene = $(target).find(".restoreScene").val().trim();
+  schedule.requirePresence = $(target).find(".requirePresence").is(":checked");
+  var motionSensor = $(target).find(".motionSensor").val().trim();
+  if (motionSensor != "") {
+    schedule.motionBoost = {sensor: motionSensor, brightness: parseInt($(target).find(".motionBrightness").val().trim()) || 100, duration: $(target).find(".motionDuration").val().trim()};
+  }
+  var switches = parseNames($(target).find(".switches").val());
+  if (switches.length > 0) {
+    schedule.switchOverride = {switches: switches, duration: $(target).find(".switchDuration").val().trim()};
+  }
+  var manualChange = {
+    colorTemperature: parseInt($(target).find(".manualChangeColorTemperature").val().trim()) || 0,
+    brightness: parseInt($(target).find(".manualChangeBrightness").val().trim()) || 0,
+    duration: $(target).find(".manualChangeDuration").val().trim()
+  };
+  if (manualChange.colorTemperature > 0 || manualChange.brightness > 0 || manualChange.duration != "") {
+    schedule.manualChange = manualChange;
+  }
+  var windDownTime = $(target).find(".windDownTime").val().trim();
+  if (windDownTime != "") {
+    schedule.windDown = {
+      days: parseNames($(target).find(".windDownDays").val()),
+      time: windDownTime,
+      duration: $(target).find(".windDownDuration").val().trim(),
+      colorTemperature: parseInt($(target).find(".windDownColorTemperature").val().trim()) || 0,
+      brightness: parseInt($(target).find(".windDownBrightness").val().trim()) || 0,
+      turnOff: $(target).find(".windDownTurnOff").is(":checked")
+    };
+  }
+  var nightlightStart = $(target).find(".nightlightStart").val().trim();
+  var nightlightEnd = $(target).find(".nightlightEnd").val().trim();
+  if (nightlightStart != "" || nightlightEnd != "") {
+    schedule.nightlight = {
+      start: nightlightStart,
+      end: nightlightEnd,
+      colorTemperature: parseInt($(target).find(".nightlightColorTemperature").val().trim()) || 0,
+      brightness: parseInt($(target).find(".nightlightBrightness").val().trim()) || 0
+    };
+  }
+  var deadBand = {
+    colorTemperature: parseInt($(target).find(".deadBandColorTemperature").val().trim()) || 0,
+    brightness: parseInt($(target).find(".deadBandBrightness").val().trim()) || 0
+  };
+  if (deadBand.colorTemperature > 0 || deadBand.brightness > 0) {
+    schedule.deadBand = deadBand;
+  }
+  var reapply = $(target).find(".powerOnReapply").is(":checked");
+  var configureBulb = $(target).find(".powerOnConfigureBulb").is(":checked");
+  if (reapply || configureBulb) {
+    schedule.powerOn = {reapply: reapply, configureBulb: configureBulb};
+  }
+  var luxSensor = $(target).find(".luxSensor").val().trim();
+  if (luxSensor != "") {
+    schedule.luxCompensation = {sensor: luxSensor, ranges: parseLuxRanges($(target).find(".luxRanges").val())};
+  }
+  schedule.weatherModifiers = parseWeatherModifiers($(target).find(".weatherModifiers").val());
+  schedule.mode = $(target).find(".mode").val().trim();
+  schedule.elevationCurve = parseElevationCurve($(target).find(".elevationCurve").val());
+  var auto = {
+    maxColorTemperature: parseInt($(target).find(".autoMaxColorTemperature").val().trim()) || 0,
+    eveningColorTemperature: parseInt($(target).find(".autoEveningColorTemperature").val().trim()) || 0,
+    bedtime: $(target).find(".autoBedtime").val().trim()
+  };
+  if (auto.maxColorTemperature > 0 || auto.eveningColorTemperature > 0 || auto.bedtime != "") {
+    schedule.auto = auto;
+  }
+  schedule.transitionTime = $(target).find(".transitionTime").val().trim();
+  schedule.updateInterval = $(target).find(".updateInterval").val().trim();
+  schedule.onOffThreshold = parseInt($(target).find(".onOffThreshold").val().trim()) || 0;
+  schedule.minBrightness = parseInt($(target).find(".minBrightness").val().trim()) || 0;
+  schedule.maxBrightness = parseInt($(target).find(".maxBrightness").val().trim()) || 0;
+  schedule.brightnessLimits = parseBrightnessLimits($(target).find(".brightnessLimits").val());
+  schedule.default = $(target).find(".defaultSchedule").is(":checked");
+  schedule.location = $(target).find(".location").val().trim();
+  schedule.twilight = $(target).find(".twilight").val().trim();
+  schedule.bridge = $(target).find(".bridge").val().trim();
   console.log(schedule);
   return schedule;
 }
@@ -65,6 +154,14 @@ function readScheduleEntry(target) {
     schedule.time = $(this).find(".time").val().trim();
     schedule.colorTemperature = parseInt($(this).find(".colorTemperature").val().trim());
     schedule.brightness = parseInt($(this).find(".brightness").val().trim());
+    var gradient = $(this).attr("data-gradient");
+    if (gradient) {
+      schedule.gradient = parseIDs(gradient);
+    }
+    var moonPhases = $(this).attr("data-moon-phases");
+    if (moonPhases) {
+      schedule.moonPhases = parseNames(moonPhases);
+    }
     console.log(schedule);
     list.push(schedule);
   });
@@ -73,7 +170,7 @@ function readScheduleEntry(target) {
 
 function addScheduleEntry(target) {
   var entry = $('<tr class="entry">');
-  entry.append('<td><input type="time" name="time" class="time form-control" value="10:00" autocomplete="off"></td>');
+  entry.append('<td><input type="text" name="time" class="time form-control" value="10:00" placeholder="hh:mm or +45m" autocomplete="off"></td>');
   entry.append('<td><input type="number" name="colorTemperature" class="colorTemperature form-control" value="2750" min="0" max="6500" autocomplete="off"></td>');
   entry.append('<td><input type="range" name="brightness" class="brightness form-control" value="100" min="0" max="100" autocomplete="off"></td>');
   entry.append('<td><div class="btn-group"><button type="button" class="deleteEntryButton btn btn-primary">Delete</button><button type="button" class="testEntryButton btn btn-primary">Test</button></div></td>');
@@ -86,7 +183,56 @@ function addSchedule(target) {
   var basic = $('<form class="form-horizontal">');
   basic.append('<div class="form-group"><label>Name:</label><input type="text" class="name form-control" placeholder="Livingroom" autocomplete="off"></div>');
   basic.append('<div class="form-group"><label>Lights:</label><input type="text" class="lights form-control" placeholder="1,2,3" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Light names:</label><input type="text" class="lightNames form-control" placeholder="Couch, Desk" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Rooms and groups:</label><input type="text" class="groups form-control" placeholder="Living room" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Moon phases:</label><input type="text" class="moonPhases form-control" placeholder="Every phase" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>WLED controllers:</label><input type="text" class="wled form-control" placeholder="wled-kitchen.local" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Nanoleaf controllers:</label><input type="text" class="nanoleaf form-control" placeholder="192.168.1.42" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Bridge:</label><input type="text" class="bridge form-control" placeholder="Default bridge" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Location:</label><input type="text" class="location form-control" placeholder="Default location" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Twilight (golden, official, civil or degrees):</label><input type="text" class="twilight form-control" placeholder="Twilight of the location" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Priority:</label><input type="number" class="priority form-control" value="0" autocomplete="off"></div>');
   basic.append('<div class="form-group"><label class="form-check-label">Enable when lights appear?</label><input type="checkbox" class="appearBehavior form-check-input" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label class="form-check-label">Restore previous state on stop?</label><input type="checkbox" class="restoreOnStop form-check-input" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label class="form-check-label">Only while someone is home?</label><input type="checkbox" class="requirePresence form-check-input" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Restore scene:</label><input type="text" class="restoreScene form-control" placeholder="Previous light state" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Transition time:</label><input type="text" class="transitionTime form-control" placeholder="Global transition time" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Update interval:</label><input type="text" class="updateInterval form-control" placeholder="Global update interval" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Turn plugs off at brightness:</label><input type="number" class="onOffThreshold form-control" value="0" min="0" max="100" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Minimum brightness:</label><input type="number" class="minBrightness form-control" min="0" max="100" placeholder="Unlimited" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Maximum brightness:</label><input type="number" class="maxBrightness form-control" min="0" max="100" placeholder="Unlimited" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Brightness limits per light:</label><input type="text" class="brightnessLimits form-control" placeholder="Stairway:40-, Bedroom:10-80" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Motion sensor:</label><input type="text" class="motionSensor form-control" placeholder="Hallway sensor" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Motion brightness:</label><input type="number" class="motionBrightness form-control" value="100" min="1" max="100" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Motion duration:</label><input type="text" class="motionDuration form-control" placeholder="5m" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Switches:</label><input type="text" class="switches form-control" placeholder="Living room dimmer" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Switch override duration:</label><input type="text" class="switchDuration form-control" placeholder="1h" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Manual change tolerance (Kelvin):</label><input type="number" class="manualChangeColorTemperature form-control" min="0" max="5500" placeholder="Bridge rounding" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Manual change tolerance (brightness %):</label><input type="number" class="manualChangeBrightness form-control" min="0" max="100" placeholder="Bridge rounding" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Wind-down time:</label><input type="text" class="windDownTime form-control" placeholder="22:00" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Wind-down days:</label><input type="text" class="windDownDays form-control" placeholder="Every day" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Wind-down duration:</label><input type="text" class="windDownDuration form-control" placeholder="30m" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Wind-down color temperature:</label><input type="number" class="windDownColorTemperature form-control" min="1000" max="6500" placeholder="2000" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Wind-down brightness:</label><input type="number" class="windDownBrightness form-control" min="0" max="100" placeholder="10" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label class="form-check-label">Turn off after wind-down?</label><input type="checkbox" class="windDownTurnOff form-check-input" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Nightlight start:</label><input type="text" class="nightlightStart form-control" placeholder="23:00" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Nightlight end:</label><input type="text" class="nightlightEnd form-control" placeholder="06:00" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Nightlight color temperature:</label><input type="number" class="nightlightColorTemperature form-control" min="1000" max="6500" placeholder="2000" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Nightlight brightness:</label><input type="number" class="nightlightBrightness form-control" min="0" max="100" placeholder="5" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Dead band (Kelvin):</label><input type="number" class="deadBandColorTemperature form-control" min="0" max="5500" placeholder="Send every change" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Dead band (brightness %):</label><input type="number" class="deadBandBrightness form-control" min="0" max="100" placeholder="Send every change" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label class="form-check-label">Reapply schedule on power on?</label><input type="checkbox" class="powerOnReapply form-check-input" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label class="form-check-label">Configure power on behavior of bulbs?</label><input type="checkbox" class="powerOnConfigureBulb form-check-input" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Manual change duration:</label><input type="text" class="manualChangeDuration form-control" placeholder="Until turned off" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Light level sensor:</label><input type="text" class="luxSensor form-control" placeholder="Hallway sensor" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Lux compensation:</label><input type="text" class="luxRanges form-control" placeholder="0-50:1.15, 500-:0.8" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Weather modifiers (cloud cover:K:%):</label><input type="text" class="weatherModifiers form-control" placeholder="80:300:10" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Mode (times, elevation or auto):</label><input type="text" class="mode form-control" placeholder="times" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Elevation curve (degrees:K:%):</label><input type="text" class="elevationCurve form-control" placeholder="-6:2000:60, 0:2700:80, 15:4000:100" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Auto mode maximum color temperature:</label><input type="number" class="autoMaxColorTemperature form-control" placeholder="5500" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Auto mode evening color temperature:</label><input type="number" class="autoEveningColorTemperature form-control" placeholder="2200" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label>Auto mode bedtime:</label><input type="text" class="autoBedtime form-control" placeholder="23:00" autocomplete="off"></div>');
+  basic.append('<div class="form-group"><label class="form-check-label">Use for all other lights?</label><input type="checkbox" class="defaultSchedule form-check-input" autocomplete="off"></div>');
   collumn.append(basic)
 
   <!-- Schedule before sunrise -->
@@ -160,3 +306,62 @@ function parseIDs(text) {
   }
   return ids;
 }
+
+function parseLuxRanges(text) {
+  var ranges = Array();
+  var tokens = text.split(",");
+  for (index in tokens) {
+    var match = tokens[index].trim().match(/^([\d.]+)-([\d.]*):([\d.]+)$/);
+    if (match) {
+      ranges.push({minLux: parseFloat(match[1]), maxLux: parseFloat(match[2]) || 0, multiplier: parseFloat(match[3])});
+    }
+  }
+  return ranges;
+}
+
+function parseWeatherModifiers(text) {
+  var modifiers = Array();
+  var tokens = text.split(",");
+  for (index in tokens) {
+    var match = tokens[index].trim().match(/^(\d+):([+-]?\d+):([+-]?\d+)$/);
+    if (match) {
+      modifiers.push({cloudCover: parseInt(match[1]), colorTemperature: parseInt(match[2]), brightness: parseInt(match[3])});
+    }
+  }
+  return modifiers;
+}
+
+function parseElevationCurve(text) {
+  var points = Array();
+  var tokens = text.split(",");
+  for (index in tokens) {
+    var match = tokens[index].trim().match(/^([+-]?\d+(?:\.\d+)?):(-?\d+):(-?\d+)$/);
+    if (match) {
+      points.push({elevation: parseFloat(match[1]), colorTemperature: parseInt(match[2]), brightness: parseInt(match[3])});
+    }
+  }
+  return points;
+}
+
+function parseBrightnessLimits(text) {
+  var limits = {};
+  var tokens = text.split(",");
+  for (index in tokens) {
+    var match = tokens[index].trim().match(/^(.+):(\d*)-(\d*)$/);
+    if (match) {
+      limits[match[1].trim()] = {minBrightness: parseInt(match[2]) || 0, maxBrightness: parseInt(match[3]) || 0};
+    }
+  }
+  return limits;
+}
+
+function parseNames(text) {
+  var names = Array();
+  var tokens = text.split(",");
+  for (index in tokens) {
+    if (tokens[index].trim() != "") {
+      names.push(tokens[index].trim());
+    }
+  }
+  return names;
+}
@@ -0,0 +1,137 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// healthCheckTimeout limits how long `kelvin health` waits for an answer.
+const healthCheckTimeout = 5 * time.Second
+
+// schedulesComputed is set once the schedules of all lights have been
+// calculated and the cyclic update is running.
+var schedulesComputed int32
+
+func markSchedulesComputed() {
+	atomic.StoreInt32(&schedulesComputed, 1)
+}
+
+// readinessProblems returns the reasons why Kelvin can't control the
+// lights right now.
+func readinessProblems() []string {
+	var problems []string
+	if configuration == nil || len(configuration.Schedules) == 0 {
+		problems = append(problems, "Configuration not loaded")
+	}
+	for _, b := range bridges {
+		if b.BridgeIP == "" {
+			problems = append(problems, fmt.Sprintf("Bridge %s not connected", b.Name))
+		} else if since := b.breaker.unavailableSince(); !since.IsZero() {
+			problems = append(problems, fmt.Sprintf("Bridge %s unreachable since %s", b.Name, since.Format("15:04:05")))
+		}
+	}
+	if atomic.LoadInt32(&schedulesComputed) == 0 {
+		problems = append(problems, "Schedules not computed yet")
+	}
+	return problems
+}
+
+// healthHandler reports that the process is alive.
+func healthHandler(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("ok"))
+}
+
+// healthURL returns the address of the health endpoint of the local web
+// interface.
+func (configuration *Configuration) healthURL() string {
+	scheme := "http"
+	if configuration.WebInterface.TLS != nil {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://localhost:%d/healthz", scheme, configuration.WebInterface.Port)
+}
+
+// checkHealth requests the health endpoint at the given URL. The local
+// certificate is usually self-signed and is therefore not verified.
+func checkHealth(url string) error {
+	client := &http.Client{
+		Timeout:   healthCheckTimeout,
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+	}
+	response, err := client.Get(url)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("Health check returned HTTP %d", response.StatusCode)
+	}
+	return nil
+}
+
+// healthCommand checks whether Kelvin is running on the port and with the
+// scheme of the web interface in the given configuration. It is used as
+// HEALTHCHECK of the docker image and returns the exit code for the process.
+func healthCommand(configurationFile string, args []string) int {
+	if err := commandFlags("health").Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+	if !*flagDebug {
+		setLogLevel(log.ErrorLevel)
+	}
+
+	var c Configuration
+	c.ConfigurationFile = configurationFile
+	err := c.load()
+	if err != nil {
+		fmt.Printf("Could not read configuration %s: %v\n", configurationFile, err)
+		return 1
+	}
+	url := c.healthURL()
+	err = checkHealth(url)
+	if err != nil {
+		fmt.Printf("Kelvin is not healthy at %s: %v\n", url, err)
+		return 1
+	}
+	fmt.Printf("Kelvin is healthy at %s\n", url)
+	return 0
+}
+
+// readyHandler reports whether Kelvin is able to control the lights.
+func readyHandler(w http.ResponseWriter, r *http.Request) {
+	problems := readinessProblems()
+	if len(problems) > 0 {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		for _, problem := range problems {
+			fmt.Fprintln(w, problem)
+		}
+		return
+	}
+	w.Write([]byte("ok"))
+}
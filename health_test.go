@@ -0,0 +1,71 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestReadiness(t *testing.T) {
+	useConfiguration(t, &Configuration{Schedules: []LightSchedule{{Name: "office"}}})
+	connected := &HueBridge{Name: "upstairs", BridgeIP: "192.168.1.20"}
+	useBridges(t, &HueBridge{Name: "downstairs"})
+	if problems := readinessProblems(); len(problems) == 0 {
+		t.Errorf("Kelvin should not be ready without connected bridge")
+	}
+	bridges = []*HueBridge{connected}
+	markSchedulesComputed()
+	if problems := readinessProblems(); len(problems) != 0 {
+		t.Errorf("Kelvin should be ready, got %v", problems)
+	}
+
+	request := httptest.NewRequest("GET", "/readyz", nil)
+	recorder := httptest.NewRecorder()
+	newAuthenticator(WebInterface{Token: "secret"}).handler(http.HandlerFunc(readyHandler)).ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK {
+		t.Errorf("Readiness should be reported without credentials, got %d", recorder.Code)
+	}
+}
+
+func TestHealthCheck(t *testing.T) {
+	c := Configuration{WebInterface: WebInterface{Port: 8081}}
+	if url := c.healthURL(); url != "http://localhost:8081/healthz" {
+		t.Errorf("Unexpected health URL: %s", url)
+	}
+	c.WebInterface.TLS = &WebInterfaceTLS{}
+	if url := c.healthURL(); url != "https://localhost:8081/healthz" {
+		t.Errorf("Health check should use HTTPS with TLS: %s", url)
+	}
+
+	server := httptest.NewTLSServer(http.HandlerFunc(healthHandler))
+	defer server.Close()
+	if err := checkHealth(server.URL); err != nil {
+		t.Errorf("Self-signed certificates should be accepted: %v", err)
+	}
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusInternalServerError) }))
+	defer failing.Close()
+	if err := checkHealth(failing.URL); err == nil {
+		t.Errorf("Failed health checks should be reported")
+	}
+}
@@ -0,0 +1,95 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useConfiguration replaces the global configuration until the test finishes.
+func useConfiguration(t *testing.T, c *Configuration) {
+	previous := configuration
+	configuration = c
+	t.Cleanup(func() { configuration = previous })
+}
+
+// useLights replaces the global lights until the test finishes.
+func useLights(t *testing.T, managed ...*Light) {
+	previous := lights
+	lights = managed
+	t.Cleanup(func() { lights = previous })
+}
+
+// useBridges replaces the global bridges until the test finishes.
+func useBridges(t *testing.T, connected ...*HueBridge) {
+	previous := bridges
+	bridges = connected
+	t.Cleanup(func() { bridges = previous })
+}
+
+// useRuntimeState replaces the runtime state with an empty one in a
+// temporary directory and returns the name of its file.
+func useRuntimeState(t *testing.T) string {
+	filename := filepath.Join(t.TempDir(), stateFilename)
+	state, err := loadState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := runtimeState
+	runtimeState = state
+	t.Cleanup(func() {
+		runtimeState.close()
+		runtimeState = previous
+	})
+	return filename
+}
+
+// serveRequest passes a request to the handler and returns the recorded response.
+func serveRequest(handler http.Handler, method string, target string, body io.Reader) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(method, target, body))
+	return recorder
+}
+
+// testBridge returns a bridge whose requests are answered by the handler.
+func testBridge(t *testing.T, handler http.HandlerFunc) *HueBridge {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return &HueBridge{BridgeIP: strings.TrimPrefix(server.URL, "http://"), Username: "test"}
+}
+
+// recordingBridge returns a bridge which appends every state request to
+// requests and answers with the given response.
+func recordingBridge(t *testing.T, requests *[]hueStateRequest, response string) *HueBridge {
+	return testBridge(t, func(w http.ResponseWriter, r *http.Request) {
+		var request hueStateRequest
+		json.NewDecoder(r.Body).Decode(&request)
+		*requests = append(*requests, request)
+		w.Write([]byte(response))
+	})
+}
@@ -0,0 +1,156 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	defaultHomeKitName          = "Kelvin"
+	defaultHomeKitPin           = "00102003"
+	defaultHomeKitPauseDuration = 12 * time.Hour
+	homeKitDirectory            = "homekit"
+	homeKitIndicatorName        = "Adaptive Lighting"
+	homeKitReservedAccessoryIDs = 1 // the bridge itself
+)
+
+var homeKitPinPattern = regexp.MustCompile(`^\d{8}$`)
+
+// HomeKit configures the accessory Kelvin exposes to the Home app. Every
+// schedule becomes a switch which pauses it while turned off, a contact
+// sensor shows if Kelvin currently controls any light.
+type HomeKit struct {
+	Name          string `json:"name,omitempty"`
+	Pin           string `json:"pin,omitempty"`
+	Port          int    `json:"port,omitempty"`
+	PauseDuration string `json:"pauseDuration,omitempty"`
+}
+
+func (homeKit *HomeKit) name() string {
+	if homeKit.Name == "" {
+		return defaultHomeKitName
+	}
+	return homeKit.Name
+}
+
+func (homeKit *HomeKit) pin() string {
+	if homeKit.Pin == "" {
+		return defaultHomeKitPin
+	}
+	return homeKit.Pin
+}
+
+func (homeKit *HomeKit) pauseDuration() (time.Duration, error) {
+	return parsePositiveDuration(homeKit.PauseDuration, defaultHomeKitPauseDuration)
+}
+
+// homeKitStatus is the state of all accessories shown in the Home app.
+type homeKitStatus struct {
+	Schedules map[string]bool // enabled by name
+	Active    bool
+}
+
+// homeKitServer publishes the accessories. It is implemented by
+// homekit_hap.go if Kelvin is built with the homekit tag.
+type homeKitServer interface {
+	run()
+	update(status homeKitStatus)
+}
+
+// homeKit is nil unless the accessory is running.
+var homeKit homeKitServer
+
+func startHomeKit(configuration *HomeKit) {
+	if configuration == nil {
+		return
+	}
+	server, err := newHomeKitServer(configuration, currentHomeKitStatus(time.Now()))
+	if err != nil {
+		log.Warningf("🤖 Could not start HomeKit accessory: %v", err)
+		return
+	}
+	homeKit = server
+	log.Printf("🤖 HomeKit accessory %s is ready. Add it in the Home app with PIN %s", configuration.name(), configuration.pin())
+	go supervise("HomeKit accessory", server.run)
+}
+
+// publishHomeKitStatus updates the accessories after the lights or
+// schedules changed.
+func publishHomeKitStatus(now time.Time) {
+	if homeKit == nil {
+		return
+	}
+	homeKit.update(currentHomeKitStatus(now))
+}
+
+func currentHomeKitStatus(now time.Time) homeKitStatus {
+	status := homeKitStatus{Schedules: make(map[string]bool)}
+	for _, schedule := range configuration.Schedules {
+		_, paused := runtimeState.pausedUntil(schedule.Name, now)
+		status.Schedules[schedule.Name] = !paused
+	}
+	for _, light := range lights {
+		if light.Scheduled && light.Reachable && light.On && !light.overridden(now) {
+			status.Active = true
+		}
+	}
+	return status
+}
+
+// setSchedule is called in the main loop when a switch is toggled in the
+// Home app.
+func (homeKit *HomeKit) setSchedule(name string, enabled bool, now time.Time) error {
+	if scheduleIndex(name) == -1 {
+		return fmt.Errorf("Schedule %s not found", name)
+	}
+	if enabled {
+		log.Printf("🤖 Resuming schedule %s as requested via HomeKit", name)
+		resumePausedSchedule(name, now)
+		return nil
+	}
+	duration, err := homeKit.pauseDuration()
+	if err != nil {
+		return err
+	}
+	log.Printf("🤖 Pausing schedule %s for %v as requested via HomeKit", name, duration)
+	pauseScheduleUntil(name, now.Add(duration), now)
+	return nil
+}
+
+// homeKitAccessoryID derives the ID of an accessory from its name. The
+// Home app identifies accessories by ID, so reordering the schedules must
+// not mix up the switches and their rooms.
+func homeKitAccessoryID(name string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(name))
+	id := hash.Sum64()
+	if id <= homeKitReservedAccessoryIDs {
+		id += homeKitReservedAccessoryIDs + 1
+	}
+	return id
+}
@@ -0,0 +1,121 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+
+//go:build homekit
+// +build homekit
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/brutella/hap"
+	"github.com/brutella/hap/accessory"
+	"github.com/brutella/hap/characteristic"
+	"github.com/brutella/hap/service"
+	log "github.com/sirupsen/logrus"
+)
+
+// hapServer exposes Kelvin as a bridge with one switch per schedule and a
+// contact sensor which is closed while Kelvin controls any light.
+type hapServer struct {
+	server    *hap.Server
+	switches  map[string]*accessory.Switch
+	indicator *service.ContactSensor
+	last      homeKitStatus
+	lock      sync.Mutex
+}
+
+func newHomeKitServer(homeKit *HomeKit, status homeKitStatus) (homeKitServer, error) {
+	s := &hapServer{switches: make(map[string]*accessory.Switch)}
+	bridge := accessory.NewBridge(accessory.Info{Name: homeKit.name(), Manufacturer: "Kelvin", Firmware: version})
+
+	indicator := accessory.New(accessory.Info{Name: homeKitIndicatorName, Manufacturer: "Kelvin"}, accessory.TypeSensor)
+	indicator.Id = homeKitAccessoryID(homeKitIndicatorName)
+	s.indicator = service.NewContactSensor()
+	indicator.AddS(s.indicator.S)
+	accessories := []*accessory.A{indicator}
+
+	for _, schedule := range configuration.Schedules {
+		name := schedule.Name
+		sw := accessory.NewSwitch(accessory.Info{Name: name, Manufacturer: "Kelvin"})
+		sw.Id = homeKitAccessoryID(name)
+		sw.Switch.On.OnValueRemoteUpdate(func(on bool) {
+			inMainLoop(func() {
+				safely("HomeKit switch "+name, func() {
+					err := homeKit.setSchedule(name, on, time.Now())
+					if err != nil {
+						log.Warningf("🤖 Ignoring HomeKit switch %s: %v", name, err)
+					}
+				})
+			})
+		})
+		s.switches[name] = sw
+		accessories = append(accessories, sw.A)
+	}
+	s.update(status)
+
+	server, err := hap.NewServer(hap.NewFsStore(configuration.secretsPath(homeKitDirectory)), bridge.A, accessories...)
+	if err != nil {
+		return nil, err
+	}
+	server.Pin = homeKit.pin()
+	if homeKit.Port != 0 {
+		server.Addr = fmt.Sprintf(":%d", homeKit.Port)
+	}
+	s.server = server
+	return s, nil
+}
+
+func (s *hapServer) run() {
+	err := s.server.ListenAndServe(context.Background())
+	if err != nil {
+		log.Warningf("🤖 HomeKit accessory stopped: %v", err)
+	}
+}
+
+// update only touches characteristics which changed, every change is
+// pushed to all connected controllers.
+func (s *hapServer) update(status homeKitStatus) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	for name, enabled := range status.Schedules {
+		sw, found := s.switches[name]
+		if !found {
+			continue // added after the start, requires a restart
+		}
+		if previous, known := s.last.Schedules[name]; !known || previous != enabled {
+			sw.Switch.On.SetValue(enabled)
+		}
+	}
+	if s.last.Schedules == nil || s.last.Active != status.Active {
+		state := characteristic.ContactSensorStateContactNotDetected
+		if status.Active {
+			state = characteristic.ContactSensorStateContactDetected
+		}
+		s.indicator.ContactSensorState.SetValue(state)
+	}
+	s.last = status
+}
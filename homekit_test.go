@@ -0,0 +1,73 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestHomeKit(t *testing.T) {
+	useRuntimeState(t)
+	useConfiguration(t, &Configuration{Schedules: []LightSchedule{{Name: "Living room"}, {Name: "Bedroom"}}})
+	light := &Light{ID: 1, Name: "Couch", Reachable: true, On: true, Scheduled: true}
+	light.Schedule.name = "Living room"
+	useLights(t, light)
+
+	now := time.Now()
+	status := currentHomeKitStatus(now)
+	if !status.Active || !status.Schedules["Living room"] || !status.Schedules["Bedroom"] {
+		t.Errorf("All schedules should be enabled and active, got %+v", status)
+	}
+	homeKit := &HomeKit{PauseDuration: "2h"}
+	if err := homeKit.setSchedule("Kitchen", false, now); err == nil {
+		t.Errorf("Unknown schedules should be rejected")
+	}
+	if err := homeKit.setSchedule("Living room", false, now); err != nil {
+		t.Fatal(err)
+	}
+	status = currentHomeKitStatus(now)
+	if status.Active || status.Schedules["Living room"] || !status.Schedules["Bedroom"] {
+		t.Errorf("Switching off should pause the schedule, got %+v", status)
+	}
+	if until, paused := runtimeState.pausedUntil("Living room", now); !paused || !until.Equal(now.Add(2*time.Hour)) {
+		t.Errorf("Schedule should be paused for the configured duration, got %v", until)
+	}
+	if err := homeKit.setSchedule("Living room", true, now); err != nil {
+		t.Fatal(err)
+	}
+	if status = currentHomeKitStatus(now); !status.Active || !status.Schedules["Living room"] {
+		t.Errorf("Switching on should resume the schedule, got %+v", status)
+	}
+
+	if homeKitAccessoryID("Bedroom") != homeKitAccessoryID("Bedroom") || homeKitAccessoryID("Bedroom") == homeKitAccessoryID("Living room") || homeKitAccessoryID("Bedroom") <= homeKitReservedAccessoryIDs {
+		t.Errorf("Accessory IDs should be stable and unique")
+	}
+	for pin, valid := range map[string]bool{"": true, "12312312": true, "123-45-678": false, "1234": false} {
+		c := Configuration{HomeKit: &HomeKit{Pin: pin}, Schedules: configuration.Schedules}
+		report := c.Validate()
+		if valid == strings.Contains(strings.Join(report.Errors, " "), "HomeKit PIN") {
+			t.Errorf("Validation of PIN %q should be %v: %v", pin, valid, report.Errors)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// MIT License
+//
+// Copyright (c) 2018 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The go.hue library only covers lights, scenes and the bridge configuration.
+// All other endpoints of the v1 API are accessed with the following helpers.
+
+const hueAPITimeout = 2 * time.Second
+
+var hueAPIClient = &http.Client{
+	Timeout: hueAPITimeout,
+	Transport: &http.Transport{
+		// The hue bridge uses a self-signed certificate
+		TLSClientConfig:       &tls.Config{InsecureSkipVerify: true},
+		TLSHandshakeTimeout:   hueAPITimeout,
+		ResponseHeaderTimeout: hueAPITimeout,
+		MaxIdleConns:          10,
+		MaxConnsPerHost:       10,
+	},
+}
+
+// hueAPIError represents an error returned by the bridge.
+type hueAPIError struct {
+	Type        int    `json:"type"`
+	Address     string `json:"address"`
+	Description string `json:"description"`
+}
+
+func (bridge *HueBridge) apiURL(path string) string {
+	scheme := "http"
+	if bridge.HTTPS {
+		scheme = "https"
+	}
+	return fmt.Sprintf("%s://%s/api/%s%s", scheme, bridge.BridgeIP, bridge.Username, path)
+}
+
+// apiRequest sends a request to the given path of the v1 API and decodes
+// the response into result.
+func (bridge *HueBridge) apiRequest(method string, path string, request interface{}, result interface{}) error {
+	return bridge.call(nil, method+" "+path, func() error {
+		return bridge.sendAPIRequest(method, path, request, result)
+	})
+}
+
+func (bridge *HueBridge) sendAPIRequest(method string, path string, request interface{}, result interface{}) error {
+	if bridge.BridgeIP == "" || bridge.Username == "" {
+		return errors.New("Bridge connection not initialized")
+	}
+
+	var body io.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	httpRequest, err := http.NewRequest(method, bridge.apiURL(path), body)
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	if strings.HasPrefix(path, "/groups/") && strings.HasSuffix(path, "/action") {
+		bridge.throttle(groupRequestCost)
+	} else {
+		bridge.throttle(1)
+	}
+	response, err := hueAPIClient.Do(httpRequest)
+	if response != nil {
+		defer response.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusServiceUnavailable {
+		return errBridgeBusy
+	}
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	// Errors are reported as a list of error objects
+	var errs []map[string]hueAPIError
+	if json.Unmarshal(data, &errs) == nil {
+		for _, entry := range errs {
+			if e, found := entry["error"]; found {
+				return fmt.Errorf("Bridge returned error %d for %s: %s", e.Type, e.Address, e.Description)
+			}
+		}
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(data, result)
+}
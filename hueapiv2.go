@@ -0,0 +1,305 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// hueV2Client talks to the CLIP v2 API of the bridge. It is only available
+// via HTTPS and authenticates with the application key (the v1 username).
+// The certificate of the bridge is pinned on first use.
+type hueV2Client struct {
+	address        string
+	applicationKey string
+	fingerprint    string
+	client         *http.Client
+	lightIDs       map[string]string // v1 ID -> v2 ID
+	gradientPoints map[string]int    // v1 ID -> supported gradient points
+	queue          *requestQueue
+	lock           sync.Mutex // guards fingerprint, lightIDs and gradientPoints
+}
+
+// hueV2Response represents the envelope of all responses of the v2 API.
+type hueV2Response struct {
+	Errors []struct {
+		Description string `json:"description"`
+	} `json:"errors"`
+	Data json.RawMessage `json:"data"`
+}
+
+type hueV2Light struct {
+	ID       string `json:"id"`
+	IDv1     string `json:"id_v1"`
+	Gradient *struct {
+		PointsCapable int `json:"points_capable"`
+	} `json:"gradient,omitempty"`
+}
+
+type hueV2On struct {
+	On bool `json:"on"`
+}
+
+type hueV2Dimming struct {
+	Brightness float64 `json:"brightness"`
+}
+
+type hueV2ColorTemperature struct {
+	Mirek int `json:"mirek"`
+}
+
+type hueV2XY struct {
+	X float32 `json:"x"`
+	Y float32 `json:"y"`
+}
+
+type hueV2Color struct {
+	XY hueV2XY `json:"xy"`
+}
+
+type hueV2Dynamics struct {
+	Duration int `json:"duration"`
+}
+
+// hueV2LightState represents the body of a light update.
+type hueV2LightState struct {
+	On               *hueV2On               `json:"on,omitempty"`
+	Dimming          *hueV2Dimming          `json:"dimming,omitempty"`
+	ColorTemperature *hueV2ColorTemperature `json:"color_temperature,omitempty"`
+	Color            *hueV2Color            `json:"color,omitempty"`
+	Dynamics         *hueV2Dynamics         `json:"dynamics,omitempty"`
+	Gradient         *hueV2Gradient         `json:"gradient,omitempty"`
+}
+
+func newHueV2Client(address string, applicationKey string, fingerprint string) *hueV2Client {
+	v2 := &hueV2Client{address: address, applicationKey: applicationKey, fingerprint: fingerprint}
+	v2.client = &http.Client{
+		Timeout: hueAPITimeout,
+		Transport: &http.Transport{
+			TLSClientConfig: &tls.Config{
+				// The bridge certificate is self-signed or signed by the
+				// Signify CA. Verify it against the pinned fingerprint instead.
+				InsecureSkipVerify:    true,
+				VerifyPeerCertificate: v2.verifyCertificate,
+			},
+			TLSHandshakeTimeout:   hueAPITimeout,
+			ResponseHeaderTimeout: hueAPITimeout,
+			MaxIdleConns:          10,
+			MaxConnsPerHost:       10,
+		},
+	}
+	return v2
+}
+
+func certificateFingerprint(certificate []byte) string {
+	sum := sha256.Sum256(certificate)
+	return hex.EncodeToString(sum[:])
+}
+
+func (v2 *hueV2Client) verifyCertificate(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+	if len(rawCerts) == 0 {
+		return fmt.Errorf("Bridge didn't present a certificate")
+	}
+	fingerprint := certificateFingerprint(rawCerts[0])
+
+	v2.lock.Lock()
+	defer v2.lock.Unlock()
+	if v2.fingerprint == "" {
+		hueLog.Printf("⌘ Pinning bridge certificate with fingerprint %s", fingerprint)
+		v2.fingerprint = fingerprint
+		return nil
+	}
+	if !strings.EqualFold(v2.fingerprint, fingerprint) {
+		return fmt.Errorf("Bridge certificate changed (expected fingerprint %s, got %s). Remove certificateFingerprint from the configuration if this is intended", v2.fingerprint, fingerprint)
+	}
+	return nil
+}
+
+// request sends a request to the given resource of the v2 API and decodes
+// the data of the response into result.
+func (v2 *hueV2Client) request(method string, resource string, request interface{}, result interface{}) error {
+	var body io.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	httpRequest, err := http.NewRequest(method, fmt.Sprintf("https://%s/clip/v2/resource/%s", v2.address, resource), body)
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("hue-application-key", v2.applicationKey)
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	v2.queue.wait(1)
+	response, err := v2.client.Do(httpRequest)
+	if response != nil {
+		defer response.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if response.StatusCode == http.StatusTooManyRequests || response.StatusCode == http.StatusServiceUnavailable {
+		return errBridgeBusy
+	}
+
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+
+	var envelope hueV2Response
+	err = json.Unmarshal(data, &envelope)
+	if err != nil {
+		return fmt.Errorf("Invalid response from bridge (HTTP %d): %v", response.StatusCode, err)
+	}
+	if len(envelope.Errors) > 0 {
+		return fmt.Errorf("Bridge returned error: %s", envelope.Errors[0].Description)
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("Bridge returned HTTP %d", response.StatusCode)
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(envelope.Data, result)
+}
+
+// updateLights reads all lights from the bridge and maps their v1 IDs to
+// the IDs used by the v2 API.
+func (v2 *hueV2Client) updateLights() error {
+	var lights []hueV2Light
+	err := v2.request("GET", "light", nil, &lights)
+	if err != nil {
+		return err
+	}
+
+	ids := make(map[string]string)
+	gradientPoints := make(map[string]int)
+	for _, light := range lights {
+		// id_v1 is of the form /lights/<id>
+		if strings.HasPrefix(light.IDv1, "/lights/") {
+			id := strings.TrimPrefix(light.IDv1, "/lights/")
+			ids[id] = light.ID
+			if light.Gradient != nil {
+				gradientPoints[id] = light.Gradient.PointsCapable
+			}
+		}
+	}
+	v2.lock.Lock()
+	v2.lightIDs = ids
+	v2.gradientPoints = gradientPoints
+	v2.lock.Unlock()
+	return nil
+}
+
+func (v2 *hueV2Client) supportsLight(id string) bool {
+	v2.lock.Lock()
+	defer v2.lock.Unlock()
+	_, found := v2.lightIDs[id]
+	return found
+}
+
+// lightGradientPoints returns the number of gradient points of the light
+// with the given v1 ID.
+func (v2 *hueV2Client) lightGradientPoints(id string) int {
+	v2.lock.Lock()
+	defer v2.lock.Unlock()
+	return v2.gradientPoints[id]
+}
+
+// setLightState sends the given state to the light with the given v1 ID.
+func (v2 *hueV2Client) setLightState(id string, state hueV2LightState) error {
+	v2.lock.Lock()
+	v2ID, found := v2.lightIDs[id]
+	v2.lock.Unlock()
+	if !found {
+		return fmt.Errorf("Light %s not found in v2 API", id)
+	}
+	return v2.request("PUT", "light/"+v2ID, state, nil)
+}
+
+// toV2LightState converts a light state of the v1 API. The color
+// temperature is given in mirek, the brightness in percent. Color takes
+// precedence over the color temperature, just like in the v1 API.
+func toV2LightState(colorTemperature int, color []float32, brightness int, transitionTime time.Duration) hueV2LightState {
+	state := hueV2LightState{Dynamics: &hueV2Dynamics{int(transitionTime / time.Millisecond)}}
+	if len(color) == 2 {
+		state.Color = &hueV2Color{hueV2XY{color[0], color[1]}}
+	} else if colorTemperature != -1 {
+		state.ColorTemperature = &hueV2ColorTemperature{colorTemperature}
+	}
+	if brightness == 0 {
+		// Target brightness zero turns the light off, just like in the v1 API
+		state.On = &hueV2On{false}
+	} else if brightness != -1 {
+		state.Dimming = &hueV2Dimming{float64(brightness)}
+	}
+	return state
+}
+
+// v2Client returns the client for the v2 API or nil if the bridge doesn't
+// support it.
+func (bridge *HueBridge) v2Client() *hueV2Client {
+	if bridge == nil {
+		return nil
+	}
+	return bridge.v2
+}
+
+// enableV2 switches light updates to the v2 API if the bridge supports it.
+// The v1 API will still be used for all other requests.
+func (bridge *HueBridge) enableV2(bridgeConfiguration *Bridge) {
+	if !bridge.HTTPS {
+		hueLog.Debugf("⌘ HTTPS is disabled. Using v1 API only")
+		return
+	}
+
+	v2 := newHueV2Client(bridge.BridgeIP, bridge.Username, bridgeConfiguration.CertificateFingerprint)
+	// Share the queue with the v1 API, the bridge handles both
+	v2.queue = bridge.queue
+	err := v2.updateLights()
+	if err != nil {
+		hueLog.Warningf("⌘ Bridge doesn't support the v2 API (%v). Falling back to v1 API", err)
+		return
+	}
+
+	bridge.v2 = v2
+	bridgeConfiguration.CertificateFingerprint = v2.fingerprint
+	hueLog.Printf("⌘ Using v2 API for %d lights", len(v2.lightIDs))
+}
@@ -0,0 +1,38 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestV2LightState(t *testing.T) {
+	state := toV2LightState(366, []float32{0.5, 0.4}, 80, 400*time.Millisecond)
+	if state.Color == nil || state.ColorTemperature != nil || state.Dimming == nil || state.On != nil || state.Dynamics.Duration != 400 {
+		t.Errorf("Unexpected v2 light state %+v", state)
+	}
+	state = toV2LightState(366, nil, 0, 0)
+	if state.ColorTemperature == nil || state.ColorTemperature.Mirek != 366 || state.On == nil || state.On.On || state.Dimming != nil {
+		t.Errorf("Unexpected v2 light state %+v", state)
+	}
+}
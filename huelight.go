@@ -23,26 +23,32 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"math"
+	"reflect"
 	"strconv"
 	"time"
 
-	log "github.com/sirupsen/logrus"
 	hue "github.com/stefanwichmann/go.hue"
 )
 
 var lightsSupportingDimming = []string{"Dimmable light", "Color temperature light", "Color light", "Extended color light"}
 var lightsSupportingColorTemperature = []string{"Color temperature light", "Extended color light"}
 var lightsSupportingXYColor = []string{"Color light", "Extended color light"}
+var lightsSupportingOnOffOnly = []string{"On/Off plug-in unit", "On/Off light"}
 
 // HueLight represents a physical hue light.
 type HueLight struct {
 	Name                     string
 	HueLight                 hue.Light
+	bridge                   *HueBridge
 	SetColorTemperature      int
 	SetBrightness            int
 	TargetColorTemperature   int
 	TargetColor              []float32
 	TargetBrightness         int
+	TargetGradient           []int
+	sentGradient             []int
 	CurrentColorTemperature  int
 	CurrentColor             []float32
 	CurrentBrightness        int
@@ -50,9 +56,25 @@ type HueLight struct {
 	SupportsColorTemperature bool
 	SupportsXYColor          bool
 	Dimmable                 bool
+	OnOffOnly                bool
 	Reachable                bool
 	On                       bool
 	MinimumColorTemperature  int
+	MaximumColorTemperature  int
+	clampReported            bool
+	changeTolerance          *manualChange
+	trace                    *span // traces the requests of the current update
+}
+
+// hueLightCapabilities represents the capabilities of a light reported by
+// the bridge. The color temperature range is given in mirek.
+type hueLightCapabilities struct {
+	Control struct {
+		CT *struct {
+			Min int `json:"min"`
+			Max int `json:"max"`
+		} `json:"ct"`
+	} `json:"control"`
 }
 
 func (light *HueLight) initialize(attr hue.LightAttributes) {
@@ -61,6 +83,7 @@ func (light *HueLight) initialize(attr hue.LightAttributes) {
 	light.Dimmable = containsString(lightsSupportingDimming, attr.Type)
 	light.SupportsColorTemperature = containsString(lightsSupportingColorTemperature, attr.Type)
 	light.SupportsXYColor = containsString(lightsSupportingXYColor, attr.Type)
+	light.OnOffOnly = containsString(lightsSupportingOnOffOnly, attr.Type)
 
 	// set minimum color temperature depending on type
 	if attr.Type == "Color temperature light" {
@@ -72,12 +95,90 @@ func (light *HueLight) initialize(attr hue.LightAttributes) {
 	} else {
 		light.MinimumColorTemperature = 0
 	}
+	light.MaximumColorTemperature = 6500
 
-	log.Debugf("💡 Light %s - Initialization complete. Identified as %s (ModelID: %s, Version: %s)", light.Name, attr.Type, attr.ModelId, attr.SoftwareVersion)
+	scheduleLog.Debugf("💡 Light %s - Initialization complete. Identified as %s (ModelID: %s, Version: %s)", light.Name, attr.Type, attr.ModelId, attr.SoftwareVersion)
 
 	light.updateCurrentLightState(attr)
 }
 
+// applyCapabilities limits the color temperature to the range reported by
+// the bridge for this light model. Lights supporting xy colors can still
+// show lower color temperatures.
+func (light *HueLight) applyCapabilities(capabilities hueLightCapabilities) {
+	ct := capabilities.Control.CT
+	if ct == nil || ct.Min <= 0 || ct.Max < ct.Min {
+		return
+	}
+	if !light.SupportsXYColor {
+		light.MinimumColorTemperature = int(math.Ceil(1000000 / float64(ct.Max)))
+	}
+	light.MaximumColorTemperature = int(math.Floor(1000000 / float64(ct.Min)))
+	if light.MaximumColorTemperature > 6500 {
+		light.MaximumColorTemperature = 6500
+	}
+	scheduleLog.Debugf("💡 Light %s - Supports color temperatures from %dK to %dK", light.Name, light.MinimumColorTemperature, light.MaximumColorTemperature)
+}
+
+// clampColorTemperature limits the given color temperature to the range
+// supported by the light.
+func (light *HueLight) clampColorTemperature(colorTemperature int) int {
+	if colorTemperature == -1 {
+		return -1
+	}
+	if colorTemperature < light.MinimumColorTemperature {
+		return light.MinimumColorTemperature
+	}
+	if light.MaximumColorTemperature > 0 && colorTemperature > light.MaximumColorTemperature {
+		return light.MaximumColorTemperature
+	}
+	return colorTemperature
+}
+
+// lightSnapshot stores the state of a light before Kelvin took control.
+type lightSnapshot struct {
+	ColorMode        string
+	ColorTemperature int
+	Color            []float32
+	Brightness       int
+}
+
+func (light *HueLight) snapshot() *lightSnapshot {
+	return &lightSnapshot{light.CurrentColorMode, light.CurrentColorTemperature, light.CurrentColor, light.CurrentBrightness}
+}
+
+// restoreSnapshot sends the captured state back to the light.
+func (light *HueLight) restoreSnapshot(snapshot *lightSnapshot) error {
+	var hueLightState hue.SetLightState
+	if light.SupportsXYColor && snapshot.ColorMode == "xy" && len(snapshot.Color) == 2 {
+		hueLightState.Xy = snapshot.Color
+	} else if light.SupportsColorTemperature && snapshot.ColorTemperature != 0 {
+		hueLightState.Ct = strconv.Itoa(snapshot.ColorTemperature)
+	}
+	if light.Dimmable && snapshot.Brightness != 0 {
+		hueLightState.Bri = strconv.Itoa(snapshot.Brightness)
+	}
+
+	result, err := light.sendState(hueLightState)
+	if err != nil {
+		scheduleLog.Warningf("💡 HueLight %s - Restoring light state failed: %v (Result: %v)", light.Name, err, result)
+		return err
+	}
+	return nil
+}
+
+// sendState sends the given state to the light via the v1 API.
+func (light *HueLight) sendState(state hue.SetLightState) ([]hue.Result, error) {
+	var result []hue.Result
+	err := light.bridge.call(light.trace, "PUT /lights/"+light.HueLight.Id+"/state", func() error {
+		var err error
+		light.bridge.throttle(1)
+		result, err = light.HueLight.SetState(state)
+		return err
+	})
+	return result, err
+}
+
 func (light *HueLight) supportsColorTemperature() bool {
 	if light.SupportsXYColor || light.SupportsColorTemperature {
 		return true
@@ -92,6 +193,12 @@ func (light *HueLight) supportsBrightness() bool {
 	return false
 }
 
+// supportsAnyFunctionality returns true if Kelvin can control the light.
+// Plugs and on/off lights can only be turned off.
+func (light *HueLight) supportsAnyFunctionality() bool {
+	return light.supportsColorTemperature() || light.supportsBrightness() || light.OnOffOnly
+}
+
 func (light *HueLight) updateCurrentLightState(attr hue.LightAttributes) {
 	light.CurrentColorTemperature = attr.State.Ct
 
@@ -112,17 +219,23 @@ func (light *HueLight) updateCurrentLightState(attr hue.LightAttributes) {
 	}
 }
 
-func (light *HueLight) setLightState(colorTemperature int, brightness int, transitionTime time.Duration) error {
+// setTargetState records the given state as the state Kelvin expects the
+// light to be in. It returns the color temperature adjusted to the
+// capabilities of the light.
+func (light *HueLight) setTargetState(colorTemperature int, brightness int) int {
 	if colorTemperature != -1 && (colorTemperature < 1000 || colorTemperature > 6500) {
-		log.Warningf("💡 Light %s - Invalid color temperature %d", light.Name, colorTemperature)
+		scheduleLog.Warningf("💡 Light %s - Invalid color temperature %d", light.Name, colorTemperature)
 	}
 	if brightness < -1 || brightness > 100 {
-		log.Warningf("💡 Light %s - Invalid brightness %d", light.Name, brightness)
+		scheduleLog.Warningf("💡 Light %s - Invalid brightness %d", light.Name, brightness)
 	}
 
-	if colorTemperature != -1 && colorTemperature < light.MinimumColorTemperature {
-		colorTemperature = light.MinimumColorTemperature
-		log.Debugf("💡 Light %s - Adjusted color temperature to light capability of %dK", light.Name, colorTemperature)
+	if clamped := light.clampColorTemperature(colorTemperature); clamped != colorTemperature {
+		if !light.clampReported {
+			scheduleLog.Printf("💡 Light %s - Color temperature %dK is outside of the supported range %dK - %dK. Using %dK instead.", light.Name, colorTemperature, light.MinimumColorTemperature, light.MaximumColorTemperature, clamped)
+			light.clampReported = true
+		}
+		colorTemperature = clamped
 	}
 
 	light.SetColorTemperature = colorTemperature
@@ -132,6 +245,11 @@ func (light *HueLight) setLightState(colorTemperature int, brightness int, trans
 	light.TargetColorTemperature = mapColorTemperature(colorTemperature)
 	light.TargetColor = colorTemperatureToXYColor(colorTemperature)
 	light.TargetBrightness = mapBrightness(brightness)
+	return colorTemperature
+}
+
+func (light *HueLight) setLightState(colorTemperature int, brightness int, transitionTime time.Duration) error {
+	colorTemperature = light.setTargetState(colorTemperature, brightness)
 
 	// Send new state to light bulb
 	var hueLightState hue.SetLightState
@@ -157,38 +275,137 @@ func (light *HueLight) setLightState(colorTemperature int, brightness int, trans
 	}
 
 	// Send new state to the light
-	log.Debugf("💡 HueLight %s - Setting light state to %dK and %d%% brightness (TargetColorTemperature: %d, CurrentColorTemperature: %d, TargetColor: %v, CurrentColor: %v, TargetBrightness: %d, CurrentBrightness: %d, TransitionTime: %s)", light.Name, colorTemperature, brightness, light.TargetColorTemperature, light.CurrentColorTemperature, light.TargetColor, light.CurrentColor, light.TargetBrightness, light.CurrentBrightness, hueLightState.TransitionTime)
-	result, err := light.HueLight.SetState(hueLightState)
-	if err != nil {
-		log.Warningf("💡 HueLight %s - Setting light state failed: %v (Result: %v)", light.Name, err, result)
-		return err
+	scheduleLog.Debugf("💡 HueLight %s - Setting light state to %dK and %d%% brightness (TargetColorTemperature: %d, CurrentColorTemperature: %d, TargetColor: %v, CurrentColor: %v, TargetBrightness: %d, CurrentBrightness: %d, TransitionTime: %s)", light.Name, colorTemperature, brightness, light.TargetColorTemperature, light.CurrentColorTemperature, light.TargetColor, light.CurrentColor, light.TargetBrightness, light.CurrentBrightness, hueLightState.TransitionTime)
+	if v2 := light.bridge.v2Client(); v2 != nil && v2.supportsLight(light.HueLight.Id) {
+		var color []float32
+		if colorTemperature != -1 && light.SupportsXYColor {
+			color = light.TargetColor
+		}
+		colorTemperature := light.TargetColorTemperature
+		if !light.SupportsColorTemperature {
+			colorTemperature = -1
+		}
+		state := toV2LightState(colorTemperature, color, brightness, transitionTime)
+		var gradient []int
+		if light.gradientActive() && light.TargetColorTemperature != -1 {
+			gradient = light.TargetGradient
+			state.Color = nil
+			state.ColorTemperature = nil
+			state.Gradient = light.toV2Gradient(gradient)
+		}
+		err := light.bridge.call(light.trace, "PUT /clip/v2/resource/light", func() error {
+			return v2.setLightState(light.HueLight.Id, state)
+		})
+		if err != nil {
+			scheduleLog.Warningf("💡 HueLight %s - Setting light state via v2 API failed: %v", light.Name, err)
+			return err
+		}
+		light.sentGradient = gradient
+	} else {
+		result, err := light.sendState(hueLightState)
+		if err != nil {
+			scheduleLog.Warningf("💡 HueLight %s - Setting light state failed: %v (Result: %v)", light.Name, err, result)
+			return err
+		}
 	}
 
-	log.Debugf("💡 HueLight %s - Light was successfully updated (TargetColorTemperature: %d, CurrentColorTemperature: %d, TargetColor: %v, CurrentColor: %v, TargetBrightness: %d, CurrentBrightness: %d, TransitionTime: %s)", light.Name, light.TargetColorTemperature, light.CurrentColorTemperature, light.TargetColor, light.CurrentColor, light.TargetBrightness, light.CurrentBrightness, hueLightState.TransitionTime)
+	scheduleLog.Debugf("💡 HueLight %s - Light was successfully updated (TargetColorTemperature: %d, CurrentColorTemperature: %d, TargetColor: %v, CurrentColor: %v, TargetBrightness: %d, CurrentBrightness: %d, TransitionTime: %s)", light.Name, light.TargetColorTemperature, light.CurrentColorTemperature, light.TargetColor, light.CurrentColor, light.TargetBrightness, light.CurrentBrightness, hueLightState.TransitionTime)
 	return nil
 }
 
 func (light *HueLight) hasChanged() bool {
-	if light.SupportsXYColor && light.CurrentColorMode == "xy" {
-		if !equalsFloat(light.TargetColor, []float32{-1, -1}, 0) && !equalsFloat(light.TargetColor, light.CurrentColor, 0.001) {
-			log.Debugf("💡 HueLight %s - Color has changed! CurrentColor: %v, TargetColor: %v (%dK)", light.Name, light.CurrentColor, light.TargetColor, light.SetColorTemperature)
+	// The v1 API doesn't report the colors of the segments of gradient lights
+	checkColor := !light.gradientActive()
+	if checkColor && light.SupportsXYColor && light.CurrentColorMode == "xy" {
+		if !equalsFloat(light.TargetColor, []float32{-1, -1}, 0) && !equalsFloat(light.TargetColor, light.CurrentColor, light.colorTolerance()) {
+			scheduleLog.Debugf("💡 HueLight %s - Color has changed! CurrentColor: %v, TargetColor: %v (%dK)", light.Name, light.CurrentColor, light.TargetColor, light.SetColorTemperature)
 			return true
 		}
-	} else if light.SupportsColorTemperature && light.CurrentColorMode == "ct" {
-		if light.TargetColorTemperature != -1 && !equalsInt(light.TargetColorTemperature, light.CurrentColorTemperature, 2) {
-			log.Debugf("💡 HueLight %s - Color temperature has changed! CurrentColorTemperature: %d, TargetColorTemperatur: %d (%dK)", light.Name, light.CurrentColorTemperature, light.TargetColorTemperature, light.SetColorTemperature)
+	} else if checkColor && light.SupportsColorTemperature && light.CurrentColorMode == "ct" {
+		if light.TargetColorTemperature != -1 && light.colorTemperatureChanged() {
+			scheduleLog.Debugf("💡 HueLight %s - Color temperature has changed! CurrentColorTemperature: %d, TargetColorTemperatur: %d (%dK)", light.Name, light.CurrentColorTemperature, light.TargetColorTemperature, light.SetColorTemperature)
 			return true
 		}
 	}
 
-	if light.Dimmable && light.TargetBrightness != -1 && !equalsInt(light.TargetBrightness, light.CurrentBrightness, 2) {
-		log.Debugf("💡 HueLight %s - Brightness has changed! CurrentBrightness: %d, TargetBrightness: %d (%d%%)", light.Name, light.CurrentBrightness, light.TargetBrightness, light.SetBrightness)
+	if light.Dimmable && light.TargetBrightness != -1 && !equalsInt(light.TargetBrightness, light.CurrentBrightness, light.brightnessTolerance()) {
+		scheduleLog.Debugf("💡 HueLight %s - Brightness has changed! CurrentBrightness: %d, TargetBrightness: %d (%d%%)", light.Name, light.CurrentBrightness, light.TargetBrightness, light.SetBrightness)
 		return true
 	}
 
 	return false
 }
 
+// colorTemperatureChanged compares the color temperature reported by the
+// bridge with the one sent last. Small deviations caused by rounding of
+// the bridge are ignored unless the schedule defines a tolerance in Kelvin.
+func (light *HueLight) colorTemperatureChanged() bool {
+	if light.changeTolerance == nil || light.changeTolerance.colorTemperature == 0 {
+		return !equalsInt(light.TargetColorTemperature, light.CurrentColorTemperature, 2)
+	}
+	if light.TargetColorTemperature <= 0 || light.CurrentColorTemperature <= 0 {
+		return light.TargetColorTemperature != light.CurrentColorTemperature
+	}
+	target := 1000000 / light.TargetColorTemperature
+	current := 1000000 / light.CurrentColorTemperature
+	return !equalsInt(target, current, light.changeTolerance.colorTemperature)
+}
+
+// colorTolerance returns the tolerated deviation of xy colors. A tolerance
+// in Kelvin is converted at the color temperature sent last.
+func (light *HueLight) colorTolerance() float32 {
+	tolerance := float32(0.001)
+	if light.changeTolerance == nil || light.changeTolerance.colorTemperature == 0 || light.SetColorTemperature <= 0 {
+		return tolerance
+	}
+	target := colorTemperatureToXYColor(light.SetColorTemperature)
+	for _, deviation := range []int{-light.changeTolerance.colorTemperature, light.changeTolerance.colorTemperature} {
+		color := colorTemperatureToXYColor(light.clampColorTemperature(light.SetColorTemperature + deviation))
+		for index := range color {
+			if diff := float32(math.Abs(float64(color[index] - target[index]))); diff > tolerance {
+				tolerance = diff
+			}
+		}
+	}
+	return tolerance
+}
+
+// brightnessTolerance returns the tolerated deviation of the brightness
+// in the units of the bridge.
+func (light *HueLight) brightnessTolerance() int {
+	if light.changeTolerance == nil || mapBrightness(light.changeTolerance.brightness) < 2 {
+		return 2
+	}
+	return mapBrightness(light.changeTolerance.brightness)
+}
+
+// withinDeadBand returns true if the given light state differs from the
+// state sent last by less than the dead band of the schedule. Turning a
+// light off or on is never considered insignificant.
+func (light *HueLight) withinDeadBand(colorTemperature int, brightness int, band *DeadBand) bool {
+	if band == nil || (light.SetColorTemperature == 0 && light.SetBrightness == 0) {
+		return false
+	}
+	if (brightness == 0) != (light.SetBrightness == 0) || (brightness == -1) != (light.SetBrightness == -1) {
+		return false
+	}
+	if (colorTemperature == -1) != (light.SetColorTemperature == -1) {
+		return false
+	}
+	colorTemperature = light.clampColorTemperature(colorTemperature)
+	return differsLess(colorTemperature, light.SetColorTemperature, band.ColorTemperature) && differsLess(brightness, light.SetBrightness, band.Brightness)
+}
+
+// differsLess returns true if a and b are equal or differ by less than the
+// given threshold.
+func differsLess(a int, b int, threshold int) bool {
+	diff := a - b
+	if diff < 0 {
+		diff = -diff
+	}
+	return diff == 0 || diff < threshold
+}
+
 func (light *HueLight) hasState(colorTemperature int, brightness int) bool {
 	return light.hasColorTemperature(colorTemperature) && light.hasBrightness(brightness)
 }
@@ -200,12 +417,12 @@ func (light *HueLight) hasColorTemperature(colorTemperature int) bool {
 	if !light.SupportsXYColor && !light.SupportsColorTemperature {
 		return true
 	}
-
-	if colorTemperature < light.MinimumColorTemperature {
-		colorTemperature = light.MinimumColorTemperature
-		log.Debugf("💡 Light %s - Adjusted color temperature to light capability of %dK", light.Name, colorTemperature)
+	if light.gradientActive() {
+		return reflect.DeepEqual(light.sentGradient, light.TargetGradient)
 	}
 
+	colorTemperature = light.clampColorTemperature(colorTemperature)
+
 	if light.SupportsXYColor && light.CurrentColorMode == "xy" {
 		if equalsFloat(colorTemperatureToXYColor(colorTemperature), light.CurrentColor, 0.001) {
 			return true
@@ -219,7 +436,7 @@ func (light *HueLight) hasColorTemperature(colorTemperature int) bool {
 	}
 
 	// Missmatch in color modes? Log warning for debug purposes and assume unchanged
-	log.Warningf("💡 HueLight %s - Unknown color mode in HasColorTemperature method! Current light state: %+v", light.Name, light)
+	scheduleLog.Warningf("💡 HueLight %s - Unknown color mode in HasColorTemperature method! Current light state: %+v", light.Name, light)
 
 	return true
 }
@@ -228,6 +445,9 @@ func (light *HueLight) hasBrightness(brightness int) bool {
 	if brightness == -1 || light.TargetBrightness == -1 {
 		return true
 	}
+	if brightness == 0 {
+		return !light.On
+	}
 	if !light.Dimmable {
 		return true
 	}
@@ -261,6 +481,45 @@ func (light *HueLight) getCurrentBrightness() (int, error) {
 	return 0, errors.New("Could not determine current brightness")
 }
 
+// hueStateRequest represents a light state update of the v1 API which
+// turns the light on or off.
+type hueStateRequest struct {
+	On               bool      `json:"on"`
+	Brightness       int       `json:"bri,omitempty"`
+	ColorTemperature int       `json:"ct,omitempty"`
+	Color            []float32 `json:"xy,omitempty"`
+	TransitionTime   int       `json:"transitiontime"`
+}
+
+// turnOn switches the light on with the given state. Kelvin usually only
+// adjusts lights which are already on.
+func (light *HueLight) turnOn(state LightState, transitionTime time.Duration) error {
+	if light.bridge == nil {
+		return errors.New("Light is not connected to a bridge")
+	}
+	request := hueStateRequest{On: true, TransitionTime: int(transitionTime / time.Millisecond / 100)}
+	if settings := light.startupSettings(state); settings != nil {
+		request.Brightness = settings.Brightness
+		request.ColorTemperature = settings.ColorTemperature
+		request.Color = settings.Color
+	}
+	err := light.bridge.apiRequest("PUT", fmt.Sprintf("/lights/%s/state", light.HueLight.Id), request, nil)
+	if err != nil {
+		return err
+	}
+	light.setTargetState(state.ColorTemperature, state.Brightness)
+	return nil
+}
+
+// turnOff switches the light off, no matter if Kelvin tracks it or not.
+func (light *HueLight) turnOff(transitionTime time.Duration) error {
+	if light.bridge == nil {
+		return errors.New("Light is not connected to a bridge")
+	}
+	request := hueStateRequest{On: false, TransitionTime: int(transitionTime / time.Millisecond / 100)}
+	return light.bridge.apiRequest("PUT", fmt.Sprintf("/lights/%s/state", light.HueLight.Id), request, nil)
+}
+
 func mapColorTemperature(colorTemperature int) int {
 	if colorTemperature == -1 {
 		return -1
@@ -0,0 +1,137 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestColorTemperatureCapabilities(t *testing.T) {
+	var capabilities hueLightCapabilities
+	err := json.Unmarshal([]byte(`{"control": {"mindimlevel": 1000, "ct": {"min": 153, "max": 454}}}`), &capabilities)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	light := HueLight{Name: "Ambiance", SupportsColorTemperature: true, Dimmable: true, MinimumColorTemperature: 2000, MaximumColorTemperature: 6500}
+	light.applyCapabilities(capabilities)
+	if light.MinimumColorTemperature != 2203 || light.MaximumColorTemperature != 6500 {
+		t.Errorf("Expected range 2203K - 6500K, got %dK - %dK", light.MinimumColorTemperature, light.MaximumColorTemperature)
+	}
+	if ct := light.setTargetState(2000, 50); ct != 2203 || !light.clampReported {
+		t.Errorf("Color temperature should be clamped to 2203K, got %dK", ct)
+	}
+
+	color := HueLight{Name: "Color", SupportsColorTemperature: true, SupportsXYColor: true, MinimumColorTemperature: 1000, MaximumColorTemperature: 6500}
+	capabilities.Control.CT.Min = 200
+	color.applyCapabilities(capabilities)
+	if color.MinimumColorTemperature != 1000 || color.MaximumColorTemperature != 5000 {
+		t.Errorf("Color lights should keep their minimum, got %dK - %dK", color.MinimumColorTemperature, color.MaximumColorTemperature)
+	}
+	if ct := color.clampColorTemperature(6000); ct != 5000 {
+		t.Errorf("Color temperature should be clamped to 5000K, got %dK", ct)
+	}
+}
+
+func TestManualChangeDetection(t *testing.T) {
+	hueLight := HueLight{SupportsColorTemperature: true, Dimmable: true, CurrentColorMode: "ct", SetColorTemperature: 2700, TargetColorTemperature: 370, CurrentColorTemperature: 364, SetBrightness: 50, TargetBrightness: 127, CurrentBrightness: 127}
+	if !hueLight.hasChanged() {
+		t.Errorf("A deviation of 50K should count as manual change by default")
+	}
+	hueLight.changeTolerance = &manualChange{colorTemperature: 100, brightness: 5}
+	if hueLight.hasChanged() {
+		t.Errorf("A deviation of 50K should be tolerated with a tolerance of 100K")
+	}
+	hueLight.CurrentColorTemperature = 333 // 3000K
+	if !hueLight.hasChanged() {
+		t.Errorf("A deviation of 300K should count as manual change")
+	}
+	hueLight.CurrentColorTemperature = 370
+	hueLight.CurrentBrightness = 137
+	if hueLight.hasChanged() {
+		t.Errorf("A deviation of 4%% brightness should be tolerated with a tolerance of 5%%")
+	}
+	hueLight.CurrentBrightness = 152
+	if !hueLight.hasChanged() {
+		t.Errorf("A deviation of 10%% brightness should count as manual change")
+	}
+
+	xyLight := HueLight{SupportsXYColor: true, CurrentColorMode: "xy", SetColorTemperature: 2700, TargetColor: colorTemperatureToXYColor(2700), CurrentColor: colorTemperatureToXYColor(2750), MinimumColorTemperature: 1000, MaximumColorTemperature: 6500}
+	if !xyLight.hasChanged() {
+		t.Errorf("Color deviation should count as manual change by default")
+	}
+	xyLight.changeTolerance = &manualChange{colorTemperature: 100}
+	if xyLight.hasChanged() {
+		t.Errorf("Color deviation of 50K should be tolerated with a tolerance of 100K")
+	}
+
+	// Kelvin resumes after the configured duration
+	light := &Light{Name: "Desk", Scheduled: true, Tracking: true, Reachable: true, On: true, Automatic: true, TargetLightState: LightState{2700, 50}, Schedule: Schedule{manualChange: &manualChange{duration: 2 * time.Hour}}}
+	light.HueLight = hueLight
+	light.HueLight.changeTolerance = nil
+	light.update(0)
+	if light.Automatic || light.activeOverride.Reason != overrideReasonManual || !light.overridden(time.Now().Add(119*time.Minute)) {
+		t.Fatalf("Manual change should pause Kelvin for 2h: %+v", light.activeOverride)
+	}
+	if !light.expireOverride(time.Now().Add(121*time.Minute)) || !light.Automatic {
+		t.Errorf("Kelvin should resume after the manual change duration")
+	}
+}
+
+func TestDeadBand(t *testing.T) {
+	light := HueLight{Name: "Desk", SupportsColorTemperature: true, Dimmable: true, MinimumColorTemperature: 2000, MaximumColorTemperature: 6500}
+	band := &DeadBand{ColorTemperature: 20, Brightness: 2}
+	if light.withinDeadBand(2700, 60, band) {
+		t.Errorf("The first update should never be skipped")
+	}
+
+	light.setTargetState(2700, 60)
+	tests := []struct {
+		colorTemperature int
+		brightness       int
+		band             *DeadBand
+		expected         bool
+	}{
+		{2710, 61, band, true},
+		{2690, 60, band, true},
+		{2720, 60, band, false},
+		{2700, 62, band, false},
+		{2710, 60, nil, false},
+		{2710, 60, &DeadBand{ColorTemperature: 20}, true},
+		{2700, 61, &DeadBand{ColorTemperature: 20}, false},
+		{2700, 0, &DeadBand{ColorTemperature: 20, Brightness: 100}, false},
+		{-1, 60, band, false},
+	}
+	for _, test := range tests {
+		if skipped := light.withinDeadBand(test.colorTemperature, test.brightness, test.band); skipped != test.expected {
+			t.Errorf("Update to %dK at %d%% with dead band %+v: expected %v, got %v", test.colorTemperature, test.brightness, test.band, test.expected, skipped)
+		}
+	}
+
+	// Clamped color temperatures are compared with the value that was sent
+	light.setTargetState(1800, 60)
+	if !light.withinDeadBand(1900, 60, band) {
+		t.Errorf("Color temperatures below the supported range should be compared after clamping")
+	}
+}
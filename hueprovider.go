@@ -0,0 +1,99 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+func init() {
+	registerLightProvider("hue", &hueProvider{})
+}
+
+// hueProvider exposes the lights of all bridges. They are scheduled by the
+// dedicated update loop which also takes care of scenes, groups and
+// sensors, so Discover doesn't report them to the generic one.
+type hueProvider struct{}
+
+func hueLightID(bridge string, id int) string {
+	return fmt.Sprintf("%s/%d", bridge, id)
+}
+
+func (provider *hueProvider) find(id string) (*Light, error) {
+	for _, light := range lights {
+		if hueLightID(light.Bridge, light.ID) == id {
+			return light, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown Hue light %s", id)
+}
+
+// Discover returns no lights as the bridges are handled separately.
+func (provider *hueProvider) Discover(configuration *Configuration) ([]ProviderLight, error) {
+	return nil, nil
+}
+
+func (provider *hueProvider) GetState(light ProviderLight) (ProviderState, error) {
+	l, err := provider.find(light.ID)
+	if err != nil {
+		return ProviderState{}, err
+	}
+	return ProviderState{Reachable: l.Reachable, On: l.On, Changed: l.HueLight.hasChanged()}, nil
+}
+
+func (provider *hueProvider) SetState(light ProviderLight, state LightState, transitionTime time.Duration) (bool, error) {
+	l, err := provider.find(light.ID)
+	if err != nil {
+		return false, err
+	}
+	if l.HueLight.hasState(state.ColorTemperature, state.Brightness) {
+		return false, nil
+	}
+	err = l.HueLight.setLightState(state.ColorTemperature, state.Brightness, transitionTime)
+	return err == nil, err
+}
+
+// Subscribe forwards the event streams of all bridges supporting the v2
+// API. It returns false if at least one bridge has to be polled.
+func (provider *hueProvider) Subscribe(events chan<- ProviderLight) bool {
+	subscribed := true
+	for _, b := range bridges {
+		if b.v2 == nil {
+			subscribed = false
+			continue
+		}
+		ids := make(chan int, 1)
+		v2 := b.v2
+		go supervise("event stream of bridge "+b.BridgeIP, func() { v2.streamEvents(ids) })
+		go func(bridge string) {
+			for id := range ids {
+				select {
+				case events <- ProviderLight{Provider: "hue", ID: hueLightID(bridge, id)}:
+				default:
+					// A refresh is already pending
+				}
+			}
+		}(b.Name)
+	}
+	return subscribed
+}
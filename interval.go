@@ -67,3 +67,23 @@ func (interval *Interval) calculateLightStateInInterval(timestamp time.Time) Lig
 	}
 	return lightstate
 }
+
+// nextStep returns the next point in time after the given timestamp which
+// lies a multiple of step after the start of the interval. The end of the
+// interval is never skipped so every schedule entry is reached exactly.
+func (interval *Interval) nextStep(timestamp time.Time, step time.Duration) time.Time {
+	if step <= 0 {
+		step = stateUpdateInterval
+	}
+	if timestamp.Before(interval.Start.Time) {
+		return interval.Start.Time
+	}
+	if !timestamp.Before(interval.End.Time) {
+		return timestamp.Add(step)
+	}
+	next := interval.Start.Time.Add((timestamp.Sub(interval.Start.Time)/step + 1) * step)
+	if next.After(interval.End.Time) {
+		return interval.End.Time
+	}
+	return next
+}
@@ -0,0 +1,76 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestUpdateInterval(t *testing.T) {
+	start := time.Date(2024, 3, 1, 20, 0, 0, 0, time.UTC)
+	interval := Interval{TimeStamp{Time: start, ColorTemperature: 4000, Brightness: 100}, TimeStamp{Time: start.Add(25 * time.Minute), ColorTemperature: 2700, Brightness: 60}}
+	tests := []struct {
+		timestamp time.Time
+		step      time.Duration
+		expected  time.Time
+	}{
+		{start.Add(-time.Minute), 10 * time.Minute, start},
+		{start, 10 * time.Minute, start.Add(10 * time.Minute)},
+		{start.Add(3 * time.Minute), 10 * time.Minute, start.Add(10 * time.Minute)},
+		{start.Add(10 * time.Minute), 10 * time.Minute, start.Add(20 * time.Minute)},
+		// The end of the interval is never skipped
+		{start.Add(21 * time.Minute), 10 * time.Minute, start.Add(25 * time.Minute)},
+		{start.Add(90 * time.Second), time.Minute, start.Add(2 * time.Minute)},
+		{start.Add(25 * time.Minute), 10 * time.Minute, start.Add(35 * time.Minute)},
+	}
+	for _, test := range tests {
+		if next := interval.nextStep(test.timestamp, test.step); !next.Equal(test.expected) {
+			t.Errorf("Next step after %v with step %v should be %v, got %v", test.timestamp.Format("15:04:05"), test.step, test.expected.Format("15:04:05"), next.Format("15:04:05"))
+		}
+	}
+
+	configuration := Configuration{UpdateInterval: "5m"}
+	if updateInterval := configuration.updateIntervalForSchedule(LightSchedule{UpdateInterval: "10m"}); updateInterval != 10*time.Minute {
+		t.Errorf("Schedule update interval should take precedence, got %v", updateInterval)
+	}
+	if updateInterval := configuration.updateIntervalForSchedule(LightSchedule{}); updateInterval != 5*time.Minute {
+		t.Errorf("Global update interval should be used, got %v", updateInterval)
+	}
+	if updateInterval := (&Configuration{}).updateIntervalForSchedule(LightSchedule{UpdateInterval: "10ms"}); updateInterval != stateUpdateInterval {
+		t.Errorf("Invalid update interval should fall back to %v, got %v", stateUpdateInterval, updateInterval)
+	}
+
+	now := time.Now()
+	lights := []*Light{{Scheduled: true, nextUpdate: now.Add(20 * time.Second)}, {Scheduled: false, nextUpdate: now.Add(time.Second)}}
+	if duration := durationUntilNextUpdate(lights, now); duration != 20*time.Second {
+		t.Errorf("Next update should be due in 20s, got %v", duration)
+	}
+	lights[0].nextUpdate = now.Add(time.Hour)
+	if duration := durationUntilNextUpdate(lights, now); duration != stateUpdateInterval {
+		t.Errorf("Lights should be checked at least every %v, got %v", stateUpdateInterval, duration)
+	}
+	lights[0].nextUpdate = now.Add(-time.Second)
+	if duration := durationUntilNextUpdate(lights, now); duration != minimumUpdateInterval {
+		t.Errorf("Overdue updates should be run after %v, got %v", minimumUpdateInterval, duration)
+	}
+}
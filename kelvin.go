@@ -22,10 +22,13 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
 	"os/signal"
+	"reflect"
+	"sync/atomic"
 	"syscall"
 	"time"
 
@@ -40,31 +43,72 @@ var flagDebug = flag.Bool("debug", false, "Enable debug logging")
 var flagLogfile = flag.String("log", "", "Redirect log output to specified file")
 var flagConfigurationFile = flag.String("configuration", absolutePath("config.json"), "Specify the filename of the configuration to load")
 var flagForceUpdate = flag.Bool("forceUpdate", false, "Update to new major version")
+var flagNoUpdate = flag.Bool("no-update", false, "Never look for updates or replace the binary")
 var flagEnableWebInterface = flag.Bool("enableWebInterface", false, "Enable the web interface at startup")
 var flagDisableRateLimiting = flag.Bool("disableRateLimiting", false, "Disable the limiting of requests to the hue bridge")
 var flagDisableHTTPS = flag.Bool("disableHTTPS", false, "Disable HTTPS for the connection to the hue bridge")
+var flagLatitude = flag.String("latitude", "", "Override the configured latitude for this run")
+var flagLongitude = flag.String("longitude", "", "Override the configured longitude for this run")
+var flagBridgeIP = flag.String("bridge-ip", "", "Override the configured bridge IP for this run")
+var flagBridgeUsername = flag.String("bridge-username", "", "Override the configured bridge username for this run")
+var flagService = flag.String("service", "", "Install or uninstall Kelvin as Windows service (install, uninstall)")
+var flagDetectLocation = flag.Bool("detectLocation", false, "Detect the location by IP (using ipinfo.io) if none is configured")
 
 var configuration *Configuration
 var bridge = &HueBridge{}
+var bridges = []*HueBridge{bridge}
 var lights []*Light
+var groups []HueGroup
+
+// updateRequests asks the main loop to resynchronize all lights.
+var updateRequests = make(chan bool, 1)
+
+// mainLoopRequests hands work to the main loop, which owns the lights and
+// the configuration.
+var mainLoopRequests = make(chan mainLoopRequest)
+
+type mainLoopRequest struct {
+	run  func()
+	done chan bool
+}
 
 const lightUpdateInterval = 1 * time.Second
+const lightUpdateIntervalWithEvents = 10 * time.Second
 const stateUpdateInterval = 1 * time.Minute
+const minimumUpdateInterval = 1 * time.Second
 
-const timeBetweenHueAPICalls = 100 * time.Millisecond // see https://developers.meethue.com/develop/application-design-guidance/hue-system-performance/
 const lightTransistionTime = 400 * time.Millisecond
 
 func main() {
+	flag.Usage = usage
 	flag.Parse()
 	configureLogging()
 
+	if *flagService != "" {
+		os.Exit(serviceCommand(*flagService))
+	}
+	os.Exit(runSubcommand(flag.Args()))
+}
+
+// runCommand starts Kelvin and controls the lights until it is stopped.
+func runCommand(args []string) int {
+	if err := commandFlags("run").Parse(args); err != nil {
+		return flagExitCode(err)
+	}
+
 	log.Printf("🤖 Kelvin %s starting up... 🚀", version)
+	if runningAsService() {
+		go runService()
+	}
 	log.Debugf("🤖 Built at %s based on commit %s", date, commit)
 	log.Debugf("🤖 Current working directory: %v", workingDirectory())
 
-	go CheckForUpdate(version, *flagForceUpdate)
+	// Two instances would fight over the same lights
+	lockInstance((&Configuration{ConfigurationFile: *flagConfigurationFile}).secretsPath(lockFilename), "configuration "+*flagConfigurationFile)
+
 	go validateSystemTime()
 	go handleSIGHUP()
+	go handleShutdown()
 
 	// Load configuration or create a new one
 	conf, err := InitializeConfiguration(*flagConfigurationFile, *flagEnableWebInterface)
@@ -72,20 +116,54 @@ func main() {
 		log.Fatal(err)
 	}
 	configuration = &conf
+	err = configureProxy(configuration.Proxy)
+	if err != nil {
+		log.Warningf("🤖 Could not configure proxy: %v", err)
+	}
+	if *flagNoUpdate || !configuration.Updates.enabled() {
+		updaterLog.Printf("Automatic updates are disabled")
+	} else {
+		go supervise("updater", func() { CheckForUpdate(version, *flagForceUpdate, configuration.Updates) })
+	}
+	err = configureLogSink(configuration.Logging)
+	if err != nil {
+		log.Warningf("🤖 Could not configure log output: %v", err)
+	}
+	err = applyLogLevels(configuration.Logging)
+	if err != nil {
+		log.Warningf("🤖 Could not configure log levels: %v", err)
+	}
+	startTracing(configuration.Tracing)
+	err = startStatsD(configuration.StatsD)
+	if err != nil {
+		log.Warningf("🤖 Could not send metrics: %v", err)
+	}
+
+	// Load paused schedules and other runtime data
+	runtimeState, err = loadState(configuration.secretsPath(stateFilename))
+	if err != nil {
+		configLog.Warningf("⚙ Could not read state: %v", err)
+	}
 
 	// Start web interface
 	go startInterface()
 
-	// Find Hue bridge
-	log.Printf("🤖 Initializing bridge connection...")
-	for {
-		err = bridge.InitializeBridge(configuration)
-		if err != nil {
-			log.Errorf("Could not initialize bridge: %v - Retrying...", err)
-			time.Sleep(10 * time.Second)
-		} else {
-			break
+	// Find Hue bridges
+	for _, additionalBridge := range configuration.Bridges {
+		bridges = append(bridges, &HueBridge{Name: additionalBridge.Name})
+	}
+	for _, b := range bridges {
+		log.Printf("🤖 Initializing bridge connection %s...", b.Name)
+		for {
+			err = b.InitializeBridge(configuration)
+			if err != nil {
+				log.Errorf("Could not initialize bridge %s: %v - Retrying...", b.Name, err)
+				time.Sleep(10 * time.Second)
+			} else {
+				break
+			}
 		}
+		lockInstance(bridgeLockFile(b.BridgeIP), "bridge "+b.BridgeIP)
 	}
 
 	// Find geo location
@@ -93,6 +171,11 @@ func main() {
 	if err != nil {
 		log.Warning(err)
 	}
+	sunTimeTable, err = loadSunTable(configuration.secretsPath(sunTableFilename))
+	if err != nil {
+		log.Warningf("🌍 Could not read sun times: %v", err)
+	}
+	updateSunTable()
 
 	// Save configuration
 	err = configuration.Write()
@@ -101,88 +184,452 @@ func main() {
 	}
 
 	// Initialize lights
-	l, err := bridge.Lights()
+	atomic.StoreInt32(&lightsInitialized, 1)
+	l, err := allLights()
 	if err != nil {
 		log.Warning(err)
 	}
 	printDevices(l)
+	groups, err = allGroups()
+	if err != nil {
+		log.Warningf("🤖 Failed to read groups: %v", err)
+	}
+	configuration.resolveAssociations(l, groups)
 	for _, light := range l {
 		light := light
-
-		// Filter devices we can't control
-		if !light.HueLight.supportsColorTemperature() && !light.HueLight.supportsBrightness() {
-			log.Printf("🤖 Light %s - This device doesn't support any functionality Kelvin uses. Ignoring...", light.Name)
-		} else {
-			lights = append(lights, light)
-			updateScheduleForLight(light)
-		}
+		addLight(light)
 	}
+	runtimeState.restoreLightStates(lights, time.Now())
+	runtimeState.reportMissingLights(lights)
 
 	// Initialize scenes
 	updateScenes()
+	startPresenceDetection(configuration.Presence)
+	startWeatherUpdates(configuration.Weather, configuration.Location)
+	startMQTT(configuration.MQTT)
+	startHomeKit(configuration.HomeKit)
+	startCalendarUpdates(configuration.Calendar)
 
 	// Start cyclic update for all lights and scenes
 	log.Debugf("🤖 Starting cyclic update...")
-	lightUpdateTimer := time.NewTimer(lightUpdateInterval)
+	pollingInterval := lightUpdateIntervalWithEvents
+	lightEvents := make(chan ProviderLight, 1)
+	// Bridges reporting their changes instantly are polled less frequently
+	subscribed := subscribeLightProviders(lightEvents)
+	if !subscribed["hue"] {
+		pollingInterval = lightUpdateInterval
+	}
+	idlePollingInterval := configuration.idlePollingInterval()
+	lightUpdateTimer := time.NewTimer(pollingInterval)
+	providerUpdateTick := time.Tick(providerUpdateInterval)
 	stateUpdateTick := time.Tick(stateUpdateInterval)
+	targetUpdateTimer := time.NewTimer(durationUntilNextUpdate(lights, time.Now()))
+	sensorUpdateTick := time.Tick(sensorUpdateInterval)
+	wakeupTick := time.Tick(wakeupUpdateInterval)
 	newDayTimer := time.After(durationUntilNextDay())
+	watchdogTick := watchdogTicker()
+	markSchedulesComputed()
+	if stoppedDuringStartup() {
+		select {} // stop exits Kelvin
+	}
+	// The bridges are connected and all lights follow their schedules
+	notifySystemd("READY=1")
+	atomic.StoreInt32(&mainLoopRunning, 1)
+	scenesChanged := false
 	for {
-		select {
-		case <-newDayTimer:
-			// A new day has begun, calculate new schedule
-			log.Printf("🤖 Calculating schedule for %v", time.Now().Format("Jan 2 2006"))
-			for _, light := range lights {
-				light := light
-				updateScheduleForLight(light)
-			}
-			updateScenes()
-			newDayTimer = time.After(durationUntilNextDay())
-		case <-stateUpdateTick:
-			// update interval and color every minute
-			updated := false
-			for _, light := range lights {
-				light := light
-				light.updateInterval()
-				if light.updateTargetLightState() {
-					updated = true
+		// A bug must not stop the cyclic update. Panics are reported and the
+		// loop continues with the next event.
+		safely("cyclic update", func() {
+			select {
+			case <-newDayTimer:
+				defer func() { newDayTimer = time.After(durationUntilNextDay()) }()
+				// A new day has begun, calculate new schedule
+				log.Printf("🤖 Calculating schedule for %v", time.Now().Format("Jan 2 2006"))
+				trace := startTrace("calculate schedules")
+				updateSunTable()
+				for _, light := range lights {
+					light := light
+					safely("light "+light.Name, func() { traceScheduleForLight(trace, light) })
 				}
-			}
-			// update scenes
-			if updated {
 				updateScenes()
+				trace.finish()
+				dashboardEvents.publish(dashboardEvent{Type: "schedule"})
+			case <-stateUpdateTick:
+				// update scenes and expire overrides every minute
+				if updateLightList() {
+					scenesChanged = true
+				}
+				for _, light := range lights {
+					light.expireOverride(time.Now())
+				}
+				updateCalendar(lights, time.Now())
+				persistState()
+				metrics.reportLights(lights)
+				if scenesChanged {
+					updateScenes()
+					scenesChanged = false
+				}
+			case <-targetUpdateTimer.C:
+				defer func() { targetUpdateTimer.Reset(durationUntilNextUpdate(lights, time.Now())) }()
+				// update interval and color of every light whose update
+				// interval has passed
+				now := time.Now()
+				trace := startTrace("update target light states")
+				for _, light := range lights {
+					light := light
+					if !light.updateDue(now) {
+						continue
+					}
+					safely("light "+light.Name, func() {
+						s := trace.child("calculate light state", spanKindInternal)
+						defer s.finish()
+						s.setAttribute("light", light.Name)
+						light.updateInterval()
+						changed := light.updateTargetLightState()
+						if changed {
+							scenesChanged = true
+						}
+						s.setAttribute("changed", changed)
+						light.updatePowerOnState(now)
+					})
+				}
+				trace.finish()
+			case <-sensorUpdateTick:
+				updateSensors()
+			case <-watchdogTick:
+				// Only the main loop notifies the watchdog, so systemd restarts
+				// Kelvin if the loop hangs
+				notifySystemd("WATCHDOG=1")
+			case <-wakeupTick:
+				updateAway(lights, runtimeState.awayMode(), time.Now())
+			case event := <-lightEvents:
+				log.Debugf("🤖 Light %s - Received change event from %s", event.ID, event.Provider)
+				if event.Provider == "hue" {
+					updateLights(nil)
+				} else {
+					updateProviderDevices()
+				}
+			case <-lightUpdateTimer.C:
+				defer func() {
+					lightUpdateTimer.Reset(adaptivePollingInterval(lights, time.Now(), pollingInterval, idlePollingInterval))
+				}()
+				updateLights(nil)
+			case <-providerUpdateTick:
+				updateProviderDevices()
+			case <-updateRequests:
+				forceUpdate()
+			case <-reloadRequests:
+				reloadConfiguration()
+			case request := <-mainLoopRequests:
+				defer close(request.done)
+				request.run()
+			case done := <-stopRequests:
+				shutdown()
+				close(done)
+				// Kelvin exits once the caller of stop returns
+				select {}
 			}
-		case <-lightUpdateTimer.C:
-			states, err := bridge.LightStates()
+		})
+	}
+}
+
+// durationUntilNextUpdate returns the time until the target light state
+// of the next light has to be recalculated. Lights are checked at least
+// once per stateUpdateInterval.
+func durationUntilNextUpdate(lights []*Light, now time.Time) time.Duration {
+	next := now.Add(stateUpdateInterval)
+	for _, light := range lights {
+		if light.Scheduled && light.nextUpdate.Before(next) {
+			next = light.nextUpdate
+		}
+	}
+	duration := next.Sub(now)
+	if duration < minimumUpdateInterval {
+		return minimumUpdateInterval
+	}
+	return duration
+}
+
+// requestUpdate schedules an immediate update of all lights. Requests
+// arriving while an update is pending are merged.
+func requestUpdate() {
+	select {
+	case updateRequests <- true:
+	default:
+	}
+}
+
+// inMainLoop runs the given function in the main loop and returns once it
+// finished. Until the main loop runs nothing else touches the lights, so the
+// function is called right away. It must not be called from the main loop.
+func inMainLoop(run func()) {
+	if atomic.LoadInt32(&mainLoopRunning) == 0 {
+		run()
+		return
+	}
+	done := make(chan bool)
+	mainLoopRequests <- mainLoopRequest{run: run, done: done}
+	<-done
+}
+
+// forceUpdate recalculates all schedules and applies the current target
+// light states right away. Every light is treated as if it just appeared,
+// just like after a restart of Kelvin.
+func forceUpdate() {
+	log.Printf("🤖 Recalculating schedules and updating all lights...")
+	trace := startTrace("force update")
+	defer trace.finish()
+	updateLightList()
+	for _, light := range lights {
+		light.Tracking = false
+		traceScheduleForLight(trace, light)
+	}
+	updateScenes()
+	updateLights(trace)
+	updateProviderDevices()
+	dashboardEvents.publish(dashboardEvent{Type: "schedule"})
+}
+
+// updateLights applies the target light states of all bridges. The updates
+// are traced as a part of parent, or as a cycle of their own without it.
+func updateLights(parent *span) {
+	for _, b := range bridges {
+		updateLightsOfBridge(parent, b)
+	}
+	dashboardEvents.publishLights(lights)
+	statePublisher.publishLights(lights)
+	publishHomeKitStatus(time.Now())
+}
+
+func updateLightsOfBridge(parent *span, b *HueBridge) {
+	trace := continueTrace(parent, "update lights")
+	trace.setAttribute("bridge", b.Name)
+	defer trace.finish()
+	start := time.Now()
+	defer func() {
+		metrics.timing("update_time", time.Since(start), "bridge:"+metricName(b.Name))
+	}()
+	states, err := b.LightStates(trace)
+	if errors.Is(err, errBridgeUnavailable) {
+		return // Updates are paused until the bridge is reachable again
+	}
+	if err != nil {
+		log.Warningf("🤖 Failed to update light states: %v", err)
+	}
+	if b.breaker.takeRecovered() {
+		resyncBridge(b)
+	}
+
+	for _, light := range lights {
+		if currentLightState, found := states[light.ID]; found && light.Bridge == b.Name {
+			light := light
+			safely("light "+light.Name, func() { light.updateCurrentLightState(currentLightState) })
+		}
+	}
+	for _, id := range b.updateStreaming(time.Now()) {
+		if light := findLight(b.Name, id); light != nil {
+			// Treat the light like it just appeared
+			log.Printf("🤖 Light %s - Entertainment stream ended. Resynchronizing...", light.Name)
+			light.Tracking = false
+		}
+	}
+	batched := updateGroupsOfBridge(trace, b)
+
+	for _, light := range lights {
+		light := light
+		if light.Bridge != b.Name || batched[light] || light.streaming() {
+			continue
+		}
+		_, found := states[light.ID]
+		if found {
+			s := trace.child("update light", spanKindInternal)
+			s.setAttribute("light", light.Name)
+			light.HueLight.trace = s
+			updated, err := light.update(light.Schedule.transitionTime)
+			light.HueLight.trace = nil
+			s.setAttribute("updated", updated)
+			s.setError(err)
+			s.finish()
 			if err != nil {
-				log.Warningf("🤖 Failed to update light states: %v", err)
+				log.Warningf("🤖 Light %s - Failed to update light: %v", light.Name, err)
+			}
+			if updated {
+				metrics.count("light.updates", 1, "light:"+metricName(light.Name), "bridge:"+metricName(b.Name))
+				log.Debugf("🤖 Light %s - Updated light state. Awaiting transition...", light.Name)
 			}
+		} else {
+			log.Warningf("🤖 Light %s - No current light state found", light.Name)
+		}
+	}
+}
 
-			for _, light := range lights {
-				light := light
-				currentLightState, found := states[light.ID]
-				if found {
-					light.updateCurrentLightState(currentLightState)
-					updated, err := light.update(lightTransistionTime)
-					if err != nil {
-						log.Warningf("🤖 Light %s - Failed to update light: %v", light.Name, err)
-					}
-					if updated {
-						log.Debugf("🤖 Light %s - Updated light state. Awaiting transition...", light.Name)
-					}
-				} else {
-					log.Warningf("🤖 Light %s - No current light state found", light.Name)
-				}
+// resyncBridge refreshes the lights, groups and scenes of a bridge which was
+// unreachable. All lights are treated like after a restart of Kelvin.
+func resyncBridge(b *HueBridge) {
+	log.Printf("🤖 Resynchronizing lights of bridge %s...", b.Name)
+	updateLightList()
+	for _, light := range lights {
+		if light.Bridge != b.Name {
+			continue
+		}
+		light.Tracking = false
+		updateScheduleForLight(light)
+	}
+	updateScenesOfBridge(b)
+}
+
+// updateGroupsOfBridge updates all lights of a group sharing the same
+// target light state with a single request. It returns the updated lights.
+func updateGroupsOfBridge(parent *span, b *HueBridge) map[*Light]bool {
+	batched := make(map[*Light]bool)
+	for _, group := range groups {
+		if group.Bridge != b.Name || len(group.Lights) < 2 {
+			continue
+		}
+		members := groupMembers(group, batched)
+		if members == nil {
+			continue
+		}
+		state := members[0].TargetLightState
+		err := b.setGroupState(parent, group, members, state, members[0].Schedule.transitionTime)
+		if err != nil {
+			log.Warningf("🤖 Group %s - Failed to update group: %v", group.Name, err)
+			continue
+		}
+		log.Printf("🤖 Group %s - Updated %d lights to %vK at %v%% brightness", group.Name, len(members), state.ColorTemperature, state.Brightness)
+		for _, light := range members {
+			batched[light] = true
+		}
+	}
+	return batched
+}
+
+func addLight(light *Light) {
+	// Filter devices we can't control
+	if !light.HueLight.supportsAnyFunctionality() {
+		log.Printf("🤖 Light %s - This device doesn't support any functionality Kelvin uses. Ignoring...", light.Name)
+		return
+	}
+	lights = append(lights, light)
+	updateScheduleForLight(light)
+}
+
+func findLight(bridge string, id int) *Light {
+	for _, light := range lights {
+		if light.Bridge == bridge && light.ID == id {
+			return light
+		}
+	}
+	return nil
+}
+
+// allLights returns the lights of all bridges.
+func allLights() ([]*Light, error) {
+	var l []*Light
+	for _, b := range bridges {
+		bridgeLights, err := b.Lights()
+		if err != nil {
+			return l, err
+		}
+		l = append(l, bridgeLights...)
+	}
+	return l, nil
+}
+
+// allGroups returns the groups of all bridges.
+func allGroups() ([]HueGroup, error) {
+	var g []HueGroup
+	for _, b := range bridges {
+		bridgeGroups, err := b.Groups()
+		if err != nil {
+			return g, err
+		}
+		g = append(g, bridgeGroups...)
+	}
+	return g, nil
+}
+
+// updateLightList detects new and renamed lights as well as changed groups
+// on the bridge and updates the associations of all schedules accordingly.
+func updateLightList() bool {
+	l, err := allLights()
+	if err != nil {
+		log.Warningf("🤖 Failed to update light list: %v", err)
+		return false
+	}
+
+	changed := false
+	for _, candidate := range l {
+		known := findLight(candidate.Bridge, candidate.ID)
+		if known == nil {
+			if candidate.HueLight.supportsAnyFunctionality() {
+				log.Printf("🤖 Light %s - Found new light on the bridge.", candidate.Name)
+				changed = true
 			}
+			continue
+		}
+		if known.Name != candidate.Name {
+			log.Printf("🤖 Light %s - Light was renamed to %s.", known.Name, candidate.Name)
+			known.Name = candidate.Name
+			known.HueLight.Name = candidate.Name
+			changed = true
+		}
+	}
 
-			lightUpdateTimer.Reset(lightUpdateInterval)
+	g, err := allGroups()
+	if err != nil {
+		log.Warningf("🤖 Failed to update groups: %v", err)
+		g = groups
+	}
+	if !reflect.DeepEqual(g, groups) {
+		log.Printf("🤖 Groups on the bridge have changed.")
+		groups = g
+		changed = true
+	}
+	if !changed {
+		return false
+	}
+
+	for _, b := range bridges {
+		if b.v2 == nil {
+			continue
+		}
+		err := b.v2.updateLights()
+		if err != nil {
+			log.Warningf("🤖 Failed to update light list of v2 API: %v", err)
+		}
+	}
+	configuration.resolveAssociations(l, groups)
+	for _, candidate := range l {
+		if findLight(candidate.Bridge, candidate.ID) == nil {
+			addLight(candidate)
 		}
 	}
+	for _, light := range lights {
+		updateScheduleForLight(light)
+	}
+	return true
+}
+
+// traceScheduleForLight updates the schedule of the light as a step of the
+// given update cycle.
+func traceScheduleForLight(parent *span, light *Light) {
+	s := parent.child("calculate schedule", spanKindInternal)
+	s.setAttribute("light", light.Name)
+	defer s.finish()
+	updateScheduleForLight(light)
+	if light.Scheduled {
+		s.setAttribute("schedule", light.Schedule.name)
+	}
 }
 
 func updateScheduleForLight(light *Light) {
-	schedule, err := configuration.lightScheduleForDay(light.ID, time.Now())
+	schedule, err := configuration.lightScheduleForDay(light, time.Now())
 	if err != nil {
 		log.Printf("🤖 Light %s - Light is not associated to any schedule. Ignoring...", light.Name)
+		if light.Scheduled {
+			light.restore(make(map[string]bool))
+		}
 		light.Schedule = schedule // Assign empty schedule
 		light.Scheduled = false
 	} else {
@@ -193,36 +640,47 @@ func updateScheduleForLight(light *Light) {
 
 func printDevices(l []*Light) {
 	log.Printf("🤖 Devices found on current bridge:")
-	log.Printf("| %-32s | %3v | %-5v | %-8v | %-11v | %-5v | %17v |", "Name", "ID", "On", "Dimmable", "Temperature", "Color", "Temperature range")
+	for _, line := range deviceTable(l) {
+		log.Print(line)
+	}
+}
+
+// deviceTable formats the capabilities of the given lights as table.
+func deviceTable(l []*Light) []string {
+	lines := []string{fmt.Sprintf("| %-32s | %3v | %-5v | %-8v | %-11v | %-5v | %17v |", "Name", "ID", "On", "Dimmable", "Temperature", "Color", "Temperature range")}
 	for _, light := range l {
 		ctRange := ""
 		if light.HueLight.supportsColorTemperature() {
-			ctRange = fmt.Sprintf("%dK - %dK", light.HueLight.MinimumColorTemperature, 6500)
+			ctRange = fmt.Sprintf("%dK - %dK", light.HueLight.MinimumColorTemperature, light.HueLight.MaximumColorTemperature)
 		}
-		log.Printf("| %-32s | %3v | %-5v | %-8v | %-11v | %-5v | %17v |", light.Name, light.ID, light.On, light.HueLight.Dimmable, light.HueLight.SupportsColorTemperature, light.HueLight.SupportsXYColor, ctRange)
+		lines = append(lines, fmt.Sprintf("| %-32s | %3v | %-5v | %-8v | %-11v | %-5v | %17v |", light.Name, light.ID, light.On, light.HueLight.Dimmable, light.HueLight.SupportsColorTemperature, light.HueLight.SupportsXYColor, ctRange))
 	}
+	return lines
 }
 
-func handleSIGHUP() {
-	sighup := make(chan os.Signal, 1)
-	signal.Notify(sighup, syscall.SIGHUP)
-	<-sighup // wait for signal
-	log.Printf("🤖 Received signal SIGHUP. Restarting...")
-	Restart()
+func handleShutdown() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	sig := <-signals // wait for signal
+	log.Printf("🤖 Received signal %v. Shutting down...", sig)
+	stop()
+	releaseLocks()
+	os.Exit(0)
 }
 
 func configureLogging() {
 	formatter := new(log.TextFormatter)
 	formatter.FullTimestamp = true
 	formatter.TimestampFormat = "2006/02/01 15:04:05"
-	log.SetFormatter(formatter)
+	setLogFormatter(formatter)
+	addLogHook(logBuffer)
 	if *flagDebug {
-		log.SetLevel(log.DebugLevel)
+		setLogLevel(log.DebugLevel)
 	}
 	if flagLogfile != nil && *flagLogfile != "" {
 		file, err := os.OpenFile(*flagLogfile, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0666)
 		if err == nil {
-			log.SetOutput(file)
+			setLogOutput(file)
 		} else {
 			log.Info("🤖 Failed to log to file, using default stderr")
 		}
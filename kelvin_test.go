@@ -0,0 +1,66 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+)
+
+func TestRequestUpdate(t *testing.T) {
+	requestUpdate()
+	requestUpdate()
+	if len(updateRequests) != 1 {
+		t.Errorf("Pending update requests should be merged, got %d", len(updateRequests))
+	}
+	<-updateRequests
+}
+
+func TestInMainLoop(t *testing.T) {
+	// Before the main loop runs the function is called right away
+	called := false
+	inMainLoop(func() { called = true })
+	if !called {
+		t.Fatalf("Function not called before the main loop runs")
+	}
+
+	atomic.StoreInt32(&mainLoopRunning, 1)
+	defer atomic.StoreInt32(&mainLoopRunning, 0)
+	loop := make(chan bool)
+	go func() {
+		request := <-mainLoopRequests
+		request.run()
+		close(request.done)
+		close(loop)
+	}()
+
+	called = false
+	inMainLoop(func() { called = true })
+	select {
+	case <-loop:
+	default:
+		t.Fatalf("Function returned before the main loop finished")
+	}
+	if !called {
+		t.Fatalf("Function not called by the main loop")
+	}
+}
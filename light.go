@@ -22,6 +22,9 @@
 package main
 
 import (
+	"math"
+	"reflect"
+	"strings"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -32,19 +35,34 @@ const initializationDuration = 3 * time.Second
 
 // Light represents a light kelvin can automate in your system.
 type Light struct {
-	ID               int        `json:"id"`
-	Name             string     `json:"name"`
-	HueLight         HueLight   `json:"-"`
-	TargetLightState LightState `json:"targetLightState,omitempty"`
-	Scheduled        bool       `json:"scheduled"`
-	Reachable        bool       `json:"reachable"`
-	On               bool       `json:"on"`
-	Tracking         bool       `json:"-"`
-	Automatic        bool       `json:"automatic"`
-	Initializing     bool       `json:"-"`
-	Schedule         Schedule   `json:"-"`
-	Interval         Interval   `json:"interval"`
-	Appearance       time.Time  `json:"-"`
+	ID                     int        `json:"id"`
+	Name                   string     `json:"name"`
+	Bridge                 string     `json:"bridge,omitempty"`
+	HueLight               HueLight   `json:"-"`
+	TargetLightState       LightState `json:"targetLightState,omitempty"`
+	TargetGradient         []int      `json:"targetGradient,omitempty"`
+	Scheduled              bool       `json:"scheduled"`
+	Reachable              bool       `json:"reachable"`
+	On                     bool       `json:"on"`
+	Tracking               bool       `json:"-"`
+	Automatic              bool       `json:"automatic"`
+	Initializing           bool       `json:"-"`
+	Schedule               Schedule   `json:"-"`
+	Interval               Interval   `json:"interval"`
+	Appearance             time.Time  `json:"-"`
+	snapshot               *lightSnapshot
+	boostUntil             time.Time
+	activeOverride         Override
+	nextUpdate             time.Time
+	restored               *savedLight
+	luxMultiplier          float64
+	unreachable            bool
+	powerOnState           *LightState
+	powerOnConfigured      time.Time
+	powerOnFailureReported bool
+	wakeup                 *wakeupProgress
+	windDownOff            time.Time
+	simulation             *simulationPlan
 }
 
 func (light *Light) updateCurrentLightState(attr hue.LightAttributes) error {
@@ -60,13 +78,21 @@ func (light *Light) update(transistionTime time.Duration) (bool, error) {
 		return false, nil
 	}
 
+	// The state saved before a restart is only relevant if the light
+	// stayed on
+	if !light.Reachable || !light.On {
+		light.restored = nil
+	}
+
 	// If the light is not reachable anymore clean up
 	if !light.Reachable {
+		light.unreachable = true
 		if light.Tracking {
-			log.Printf("💡 Light %s - Light is no longer reachable. Clearing state...", light.Name)
+			scheduleLog.Printf("💡 Light %s - Light is no longer reachable. Clearing state...", light.Name)
 			light.Tracking = false
 			light.Automatic = false
 			light.Initializing = false
+			light.snapshot = nil
 			return false, nil
 		}
 
@@ -74,13 +100,18 @@ func (light *Light) update(transistionTime time.Duration) (bool, error) {
 		return false, nil
 	}
 
+	// A light becoming reachable again was most likely powered on at the wall
+	reappeared := light.unreachable
+	light.unreachable = false
+
 	// If the light was turned off clean up
 	if !light.On {
 		if light.Tracking {
-			log.Printf("💡 Light %s - Light was turned off. Clearing state...", light.Name)
+			scheduleLog.Printf("💡 Light %s - Light was turned off. Clearing state...", light.Name)
 			light.Tracking = false
 			light.Automatic = false
 			light.Initializing = false
+			light.snapshot = nil
 			return false, nil
 		}
 
@@ -88,25 +119,61 @@ func (light *Light) update(transistionTime time.Duration) (bool, error) {
 		return false, nil
 	}
 
+	// Leave the lights alone while nobody is home
+	if light.Schedule.requirePresence && !presence.someoneHome(time.Now()) {
+		return false, nil
+	}
+
 	// Did the light just appear?
 	if !light.Tracking {
-		log.Printf("💡 Light %s - Light just appeared.", light.Name)
+		scheduleLog.Printf("💡 Light %s - Light just appeared.", light.Name)
+		notifyWebhooks(webhookEvent{Event: webhookLightAppeared, Light: light.Name, Bridge: light.Bridge, Schedule: light.Schedule.name})
 		light.Tracking = true
 		light.Appearance = time.Now()
 
+		// Did Kelvin control the light before a restart?
+		resume := false
+		if restored := light.restored; restored != nil {
+			light.restored = nil
+			if !restored.Automatic && !light.overridden(time.Now()) {
+				scheduleLog.Printf("💡 Light %s - Light was changed manually before Kelvin restarted. Leaving it alone...", light.Name)
+				return false, nil
+			}
+			if last := restored.LastApplied; restored.Automatic && last != nil && light.HueLight.hasState(last.ColorTemperature, last.Brightness) {
+				scheduleLog.Printf("💡 Light %s - Light still shows the state applied before Kelvin restarted. Resuming Kelvin...", light.Name)
+				resume = true
+			}
+		}
+
+		// The target light state may be up to one update interval old
+		light.updateInterval()
+		light.updateTargetLightState()
+
+		// Lights turned on at night only show the nightlight
+		if applied, err := light.applyNightlight(time.Now(), transistionTime); applied {
+			return true, err
+		}
+
+		// Should we take over lights powered on at the wall?
+		reapply := reappeared && light.Schedule.powerOn != nil && light.Schedule.powerOn.Reapply
+		if reapply && !light.overridden(time.Now()) {
+			scheduleLog.Printf("💡 Light %s - Light was powered on again. Reapplying schedule...", light.Name)
+		}
+
 		// Should we auto-enable Kelvin?
-		if light.Schedule.enableWhenLightsAppear {
-			log.Printf("💡 Light %s - Initializing state to %vK at %v%% brightness.", light.Name, light.TargetLightState.ColorTemperature, light.TargetLightState.Brightness)
+		if (light.Schedule.enableWhenLightsAppear || resume || reapply) && !light.overridden(time.Now()) {
+			scheduleLog.Printf("💡 Light %s - Initializing state to %vK at %v%% brightness.", light.Name, light.TargetLightState.ColorTemperature, light.TargetLightState.Brightness)
+			light.snapshot = light.HueLight.snapshot()
 
 			err := light.HueLight.setLightState(light.TargetLightState.ColorTemperature, light.TargetLightState.Brightness, transistionTime)
 			if err != nil {
-				log.Debugf("💡 Light %s - Could not initialize light after %v", light.Name, time.Since(light.Appearance))
+				scheduleLog.Debugf("💡 Light %s - Could not initialize light after %v", light.Name, time.Since(light.Appearance))
 				return true, err
 			}
 
 			light.Automatic = true
 			light.Initializing = true
-			log.Debugf("💡 Light %s - Light was initialized to %vK at %v%% brightness", light.Name, light.TargetLightState.ColorTemperature, light.TargetLightState.Brightness)
+			scheduleLog.Debugf("💡 Light %s - Light was initialized to %vK at %v%% brightness", light.Name, light.TargetLightState.ColorTemperature, light.TargetLightState.Brightness)
 			return true, nil
 		}
 	}
@@ -118,9 +185,15 @@ func (light *Light) update(transistionTime time.Duration) (bool, error) {
 			return false, nil
 		}
 
+		// Leave the light alone while a switch override is active
+		if light.overridden(time.Now()) {
+			return false, nil
+		}
+
 		// if status == scene state --> Activate Kelvin
 		if light.HueLight.hasState(light.TargetLightState.ColorTemperature, light.TargetLightState.Brightness) {
-			log.Printf("💡 Light %s - Detected matching target state. Activating Kelvin...", light.Name)
+			scheduleLog.Printf("💡 Light %s - Detected matching target state. Activating Kelvin...", light.Name)
+			light.snapshot = light.HueLight.snapshot()
 			light.Automatic = true
 			light.Initializing = true
 
@@ -129,7 +202,7 @@ func (light *Light) update(transistionTime time.Duration) (bool, error) {
 			if err != nil {
 				return true, err
 			}
-			log.Debugf("💡 Light %s - Updated light state to %vK at %v%% brightness (Scene detection)", light.Name, light.TargetLightState.ColorTemperature, light.TargetLightState.Brightness)
+			scheduleLog.Debugf("💡 Light %s - Updated light state to %vK at %v%% brightness (Scene detection)", light.Name, light.TargetLightState.ColorTemperature, light.TargetLightState.Brightness)
 			return true, nil
 		}
 
@@ -139,12 +212,12 @@ func (light *Light) update(transistionTime time.Duration) (bool, error) {
 
 	// Keep adjusting the light state for 10 seconds after the light appeared
 	if light.Initializing {
-		log.Debugf("💡 Light %s - Light in initialization for %v (TargetColorTemperature: %d, CurrentColorTemperature: %d, TargetColor: %v, CurrentColor: %v, TargetBrightness: %d, CurrentBrightness: %d)", light.Name, time.Since(light.Appearance), light.HueLight.TargetColorTemperature, light.HueLight.CurrentColorTemperature, light.HueLight.TargetColor, light.HueLight.CurrentColor, light.HueLight.TargetBrightness, light.HueLight.CurrentBrightness)
+		scheduleLog.Debugf("💡 Light %s - Light in initialization for %v (TargetColorTemperature: %d, CurrentColorTemperature: %d, TargetColor: %v, CurrentColor: %v, TargetBrightness: %d, CurrentBrightness: %d)", light.Name, time.Since(light.Appearance), light.HueLight.TargetColorTemperature, light.HueLight.CurrentColorTemperature, light.HueLight.TargetColor, light.HueLight.CurrentColor, light.HueLight.TargetBrightness, light.HueLight.CurrentBrightness)
 		hasChanged := light.HueLight.hasChanged()
 
 		// Disable initialization phase if 10 seconds have passed and the light state has been adopted
 		if time.Now().After(light.Appearance.Add(initializationDuration)) && !hasChanged {
-			log.Debugf("💡 Light %s - Ending initialization phase after %v", light.Name, time.Since(light.Appearance))
+			scheduleLog.Debugf("💡 Light %s - Ending initialization phase after %v", light.Name, time.Since(light.Appearance))
 			light.Initializing = false
 		}
 
@@ -153,7 +226,7 @@ func (light *Light) update(transistionTime time.Duration) (bool, error) {
 			if err != nil {
 				return true, err
 			}
-			log.Debugf("💡 Light %s - Adjusting light state to %vK at %v%% brightness (Initialization)", light.Name, light.TargetLightState.ColorTemperature, light.TargetLightState.Brightness)
+			scheduleLog.Debugf("💡 Light %s - Adjusting light state to %vK at %v%% brightness (Initialization)", light.Name, light.TargetLightState.ColorTemperature, light.TargetLightState.Brightness)
 			return true, nil
 		}
 
@@ -162,12 +235,18 @@ func (light *Light) update(transistionTime time.Duration) (bool, error) {
 
 	// Did the user manually change the light state?
 	if light.HueLight.hasChanged() {
-		if log.GetLevel() == log.DebugLevel {
-			log.Debugf("💡 Light %s - Light state has been changed manually after %v (TargetColorTemperature: %d, CurrentColorTemperature: %d, TargetColor: %v, CurrentColor: %v, TargetBrightness: %d, CurrentBrightness: %d)", light.Name, time.Since(light.Appearance), light.HueLight.TargetColorTemperature, light.HueLight.CurrentColorTemperature, light.HueLight.TargetColor, light.HueLight.CurrentColor, light.HueLight.TargetBrightness, light.HueLight.CurrentBrightness)
+		if scheduleLog.IsLevelEnabled(log.DebugLevel) {
+			scheduleLog.Debugf("💡 Light %s - Light state has been changed manually after %v (TargetColorTemperature: %d, CurrentColorTemperature: %d, TargetColor: %v, CurrentColor: %v, TargetBrightness: %d, CurrentBrightness: %d)", light.Name, time.Since(light.Appearance), light.HueLight.TargetColorTemperature, light.HueLight.CurrentColorTemperature, light.HueLight.TargetColor, light.HueLight.CurrentColor, light.HueLight.TargetBrightness, light.HueLight.CurrentBrightness)
 		} else {
-			log.Printf("💡 Light %s - Light state has been changed manually. Disabling Kelvin...", light.Name)
+			scheduleLog.Printf("💡 Light %s - Light state has been changed manually. Disabling Kelvin...", light.Name)
 		}
+		notifyWebhooks(webhookEvent{Event: webhookManualChange, Light: light.Name, Bridge: light.Bridge, Schedule: light.Schedule.name})
 		light.Automatic = false
+		light.snapshot = nil
+		if change := light.Schedule.manualChange; change != nil && change.duration > 0 {
+			scheduleLog.Printf("💡 Light %s - Resuming Kelvin in %v...", light.Name, change.duration)
+			light.override(Override{Until: time.Now().Add(change.duration), Reason: overrideReasonManual})
+		}
 		return false, nil
 	}
 
@@ -176,61 +255,397 @@ func (light *Light) update(transistionTime time.Duration) (bool, error) {
 		return false, nil
 	}
 
+	// Skip insignificant changes, some bulbs flicker on every update
+	if light.HueLight.withinDeadBand(light.TargetLightState.ColorTemperature, light.TargetLightState.Brightness, light.Schedule.deadBand) {
+		return false, nil
+	}
+
 	// Light is turned on and in automatic state. Set target lightstate.
 	err := light.HueLight.setLightState(light.TargetLightState.ColorTemperature, light.TargetLightState.Brightness, transistionTime)
 	if err != nil {
 		return true, err
 	}
 
-	log.Printf("💡 Light %s - Updated light state to %vK at %v%% brightness", light.Name, light.TargetLightState.ColorTemperature, light.TargetLightState.Brightness)
+	scheduleLog.Printf("💡 Light %s - Updated light state to %vK at %v%% brightness", light.Name, light.TargetLightState.ColorTemperature, light.TargetLightState.Brightness)
 	return true, nil
 }
 
+// needsUpdate returns true if Kelvin is in control of the light and the
+// light doesn't show the target light state yet.
+func (light *Light) needsUpdate() bool {
+	if !light.Scheduled || !light.Reachable || !light.On || !light.Tracking || !light.Automatic || light.Initializing {
+		return false
+	}
+	if light.HueLight.hasChanged() {
+		return false
+	}
+	if light.HueLight.hasState(light.TargetLightState.ColorTemperature, light.TargetLightState.Brightness) {
+		return false
+	}
+	return !light.HueLight.withinDeadBand(light.TargetLightState.ColorTemperature, light.TargetLightState.Brightness, light.Schedule.deadBand)
+}
+
 func (light *Light) updateSchedule(schedule Schedule) {
 	light.Schedule = schedule
 	light.Scheduled = true
-	log.Printf("💡 Light %s - Activating schedule for %v (Sunrise: %v, Sunset: %v)", light.Name, light.Schedule.endOfDay.Format("Jan 2 2006"), light.Schedule.sunrise.Time.Format("15:04"), light.Schedule.sunset.Time.Format("15:04"))
+	light.HueLight.changeTolerance = schedule.manualChange
+	scheduleLog.Printf("💡 Light %s - Activating schedule for %v (Sunrise: %v, Sunset: %v)", light.Name, light.Schedule.endOfDay.Format("Jan 2 2006"), light.Schedule.sunrise.Time.Format("15:04"), light.Schedule.sunset.Time.Format("15:04"))
+	if schedule.polar != "" {
+		scheduleLog.Printf("💡 Light %s - No regular sunrise or sunset on %v (%s)", light.Name, light.Schedule.endOfDay.Format("Jan 2 2006"), schedule.polar)
+	}
+	notifyWebhooks(webhookEvent{Event: webhookScheduleActivated, Light: light.Name, Bridge: light.Bridge, Schedule: light.Schedule.name})
+	if until, paused := runtimeState.pausedUntil(schedule.name, time.Now()); paused && until.After(light.activeOverride.Until) {
+		scheduleLog.Printf("💡 Light %s - Schedule %s is paused until %v", light.Name, schedule.name, until.Format("15:04"))
+		light.override(Override{Until: until, Reason: overrideReasonPause})
+	}
 	light.updateInterval()
 }
 
 func (light *Light) updateInterval() {
 	if !light.Scheduled {
-		log.Debugf("💡 Light %s - Light is not associated to any schedule. No interval to update...", light.Name)
+		scheduleLog.Debugf("💡 Light %s - Light is not associated to any schedule. No interval to update...", light.Name)
 		return
 	}
 
 	newInterval, err := light.Schedule.currentInterval(time.Now())
 	if err != nil {
-		log.Warningf("💡 Light %s - Could not determine interval for current schedule: %v", light.Name, err)
+		scheduleLog.Warningf("💡 Light %s - Could not determine interval for current schedule: %v", light.Name, err)
 		return
 	}
-	if newInterval != light.Interval {
+	if !reflect.DeepEqual(newInterval, light.Interval) {
 		light.Interval = newInterval
-		log.Printf("💡 Light %s - Activating interval %v - %v", light.Name, light.Interval.Start.Time.Format("15:04"), light.Interval.End.Time.Format("15:04"))
+		scheduleLog.Printf("💡 Light %s - Activating interval %v - %v", light.Name, light.Interval.Start.Time.Format("15:04"), light.Interval.End.Time.Format("15:04"))
 	}
 }
 
+// updateDue returns true once the update interval of the schedule has
+// passed since the last calculation of the target light state.
+func (light *Light) updateDue(now time.Time) bool {
+	return light.Scheduled && !now.Before(light.nextUpdate)
+}
+
 func (light *Light) updateTargetLightState() bool {
 	if !light.Scheduled {
-		log.Debugf("💡 Light %s - Light is not associated to any schedule. No target light state to update...", light.Name)
+		scheduleLog.Debugf("💡 Light %s - Light is not associated to any schedule. No target light state to update...", light.Name)
 		return false
 	}
 
-	// Calculate the target lightstate from the interval
-	newLightState := light.Interval.calculateLightStateInInterval(time.Now())
+	// Calculate the target lightstate from the interval or the sun
+	now := time.Now()
+	light.nextUpdate = light.Interval.nextStep(now, light.Schedule.updateInterval)
+	newLightState := light.Interval.calculateLightStateInInterval(now)
+	if curve := light.Schedule.curve; curve != nil {
+		newLightState = curve.stateAt(now)
+	}
+	newLightState = light.windDownState(newLightState, now)
+
+	// Compensate the ambient light level
+	if light.luxMultiplier > 0 && newLightState.Brightness > 0 {
+		newLightState.Brightness = int(math.Round(float64(newLightState.Brightness) * light.luxMultiplier))
+		if newLightState.Brightness < 1 {
+			newLightState.Brightness = 1
+		} else if newLightState.Brightness > 100 {
+			newLightState.Brightness = 100
+		}
+	}
+
+	// Dark and cloudy days need brighter lights
+	newLightState = light.weatherState(newLightState, now)
+
+	// Raise the brightness while motion is detected
+	if boost := light.Schedule.motionBoost; boost != nil && now.Before(light.boostUntil) && newLightState.Brightness != -1 && newLightState.Brightness < boost.brightness {
+		newLightState.Brightness = boost.brightness
+	}
+
+	newLightState = light.adaptToCapabilities(newLightState)
+	newLightState.Brightness = light.brightnessLimit().apply(newLightState.Brightness)
+
+	// Gradient lights show the gradient of the schedule on their segments
+	gradientChanged := false
+	if light.HueLight.gradientPoints() > 0 {
+		gradient := light.Interval.calculateGradientInInterval(now)
+		gradientChanged = !reflect.DeepEqual(gradient, light.TargetGradient)
+		light.TargetGradient = gradient
+		light.HueLight.TargetGradient = gradient
+	}
 
 	// Did the target light state change?
-	if newLightState.equals(light.TargetLightState) {
+	if newLightState.equals(light.TargetLightState) && !gradientChanged {
 		return false
 	}
 
 	// First initialization of the TargetLightState?
 	if light.TargetLightState.ColorTemperature == 0 && light.TargetLightState.Brightness == 0 {
-		log.Debugf("💡 Light %s - Initialized target light state for the interval %v - %v to %+v", light.Name, light.Interval.Start.Time.Format("15:04"), light.Interval.End.Time.Format("15:04"), newLightState)
+		scheduleLog.Debugf("💡 Light %s - Initialized target light state for the interval %v - %v to %+v", light.Name, light.Interval.Start.Time.Format("15:04"), light.Interval.End.Time.Format("15:04"), newLightState)
 	} else {
-		log.Debugf("💡 Light %s - Updated target light state for the interval %v - %v from %+v to %+v", light.Name, light.Interval.Start.Time.Format("15:04"), light.Interval.End.Time.Format("15:04"), light.TargetLightState, newLightState)
+		scheduleLog.Debugf("💡 Light %s - Updated target light state for the interval %v - %v from %+v to %+v", light.Name, light.Interval.Start.Time.Format("15:04"), light.Interval.End.Time.Format("15:04"), light.TargetLightState, newLightState)
 	}
 
 	light.TargetLightState = newLightState
 	return true
 }
+
+// brightnessLimit returns the brightness range of the light. Limits of the
+// light take precedence over the limits of its schedule.
+func (light *Light) brightnessLimit() BrightnessLimit {
+	limit := light.Schedule.brightnessLimit
+	if own, found := light.Schedule.lightBrightnessLimits[strings.ToLower(strings.TrimSpace(light.Name))]; found {
+		if own.MinBrightness != 0 {
+			limit.MinBrightness = own.MinBrightness
+		}
+		if own.MaxBrightness != 0 {
+			limit.MaxBrightness = own.MaxBrightness
+		}
+	}
+	return limit
+}
+
+// apply keeps the given brightness within the limit. Lights which are
+// turned off or whose brightness is ignored are left alone.
+func (limit BrightnessLimit) apply(brightness int) int {
+	if brightness <= 0 {
+		return brightness
+	}
+	if limit.MinBrightness > 0 && brightness < limit.MinBrightness {
+		brightness = limit.MinBrightness
+	}
+	if limit.MaxBrightness > 0 && brightness > limit.MaxBrightness {
+		brightness = limit.MaxBrightness
+	}
+	return brightness
+}
+
+// adaptToCapabilities removes the parts of the given state the light
+// doesn't support. Plugs and on/off lights are only turned off if the
+// brightness reaches the threshold of the schedule.
+func (light *Light) adaptToCapabilities(state LightState) LightState {
+	if !light.HueLight.supportsColorTemperature() {
+		state.ColorTemperature = -1
+	}
+	if light.HueLight.OnOffOnly && state.Brightness != -1 {
+		if state.Brightness <= light.Schedule.onOffThreshold {
+			state.Brightness = 0
+		} else {
+			state.Brightness = -1
+		}
+	}
+	return state
+}
+
+// updateMotionBoost starts or extends the motion boost of the light while
+// the configured sensor detects presence and ends it once the duration
+// has passed. It returns true if the boost started or ended.
+func (light *Light) updateMotionBoost(sensors []HueSensor, now time.Time) bool {
+	boost := light.Schedule.motionBoost
+	if !light.Scheduled || boost == nil {
+		if light.boostUntil.IsZero() {
+			return false
+		}
+		light.boostUntil = time.Time{}
+		return true
+	}
+
+	active := now.Before(light.boostUntil)
+	sensor, found := findPresenceSensor(sensors, light.Bridge, boost.sensor)
+	if found && sensor.Presence {
+		if !active {
+			scheduleLog.Printf("💡 Light %s - Motion detected by %s. Raising brightness to %d%% for %v", light.Name, sensor.Name, boost.brightness, boost.duration)
+		}
+		light.boostUntil = now.Add(boost.duration)
+		return !active
+	}
+
+	if !active && !light.boostUntil.IsZero() {
+		scheduleLog.Printf("💡 Light %s - No motion detected for %v. Returning to schedule...", light.Name, boost.duration)
+		light.boostUntil = time.Time{}
+		return true
+	}
+	return false
+}
+
+// updateLuxCompensation determines the brightness multiplier for the
+// ambient light level reported by the configured sensor. It returns true
+// if the multiplier changed.
+func (light *Light) updateLuxCompensation(sensors []HueSensor) bool {
+	multiplier := 0.0
+	if compensation := light.Schedule.luxCompensation; light.Scheduled && compensation != nil {
+		sensor, found := findLightLevelSensor(sensors, light.Bridge, compensation.Sensor)
+		if found {
+			multiplier = compensation.multiplier(sensor.lux())
+		}
+	}
+	if multiplier == light.luxMultiplier {
+		return false
+	}
+	scheduleLog.Debugf("💡 Light %s - Changed brightness multiplier for the ambient light level from %v to %v", light.Name, light.luxMultiplier, multiplier)
+	light.luxMultiplier = multiplier
+	return true
+}
+
+func (light *Light) overridden(now time.Time) bool {
+	return now.Before(light.activeOverride.Until)
+}
+
+// updateSwitchOverride hands the light over to the user whenever one of
+// the configured switches was pressed and resumes automatic control once
+// the override duration has passed. It returns true if the override
+// started or ended.
+func (light *Light) updateSwitchOverride(pressed []HueSensor, now time.Time) bool {
+	override := light.Schedule.switchOverride
+	if light.Scheduled && override != nil {
+		for _, sensor := range pressed {
+			if sensor.Bridge != light.Bridge || !containsName(override.switches, sensor.Name) {
+				continue
+			}
+			if !light.overridden(now) {
+				scheduleLog.Printf("💡 Light %s - Switch %s was used. Pausing Kelvin for %v...", light.Name, sensor.Name, override.duration)
+			}
+			light.override(Override{Until: now.Add(override.duration), Reason: overrideReasonSwitch})
+			return true
+		}
+	}
+	return light.expireOverride(now)
+}
+
+// override hands the light over to the user or a scene until the
+// override expires.
+func (light *Light) override(override Override) {
+	light.activeOverride = override
+	light.Automatic = false
+	light.Initializing = false
+	light.snapshot = nil
+}
+
+// expireOverride resumes automatic control once an override has passed.
+// It returns true if the override ended.
+func (light *Light) expireOverride(now time.Time) bool {
+	if light.activeOverride.Until.IsZero() || light.overridden(now) {
+		return false
+	}
+	light.activeOverride = Override{}
+	if light.Scheduled && light.Tracking && light.On && light.Reachable {
+		scheduleLog.Printf("💡 Light %s - Override expired. Resuming Kelvin...", light.Name)
+		light.snapshot = light.HueLight.snapshot()
+		light.Automatic = true
+		light.Initializing = true
+		light.Appearance = now
+	}
+	return true
+}
+
+// endOverride hands the light back to Kelvin right away.
+func (light *Light) endOverride(now time.Time) {
+	if light.overridden(now) {
+		light.activeOverride.Until = now
+	}
+	light.expireOverride(now)
+}
+
+func containsName(names []string, name string) bool {
+	for _, candidate := range names {
+		if strings.EqualFold(strings.TrimSpace(candidate), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// restore resets the light to the state captured before Kelvin took
+// control or activates the configured scene. Scenes which have already
+// been activated for other lights are skipped.
+func (light *Light) restore(activatedScenes map[string]bool) {
+	if !light.Automatic || !light.On || !light.Schedule.restoreOnStop {
+		return
+	}
+	defer func() {
+		light.Automatic = false
+		light.snapshot = nil
+	}()
+
+	if light.Schedule.restoreScene != "" {
+		light.activateScene(light.Schedule.restoreScene, activatedScenes)
+		return
+	}
+	light.restoreSnapshot()
+}
+
+// activateScene activates the scene with the given name on the bridge of
+// the light. Every scene is only activated once per bridge.
+func (light *Light) activateScene(name string, activatedScenes map[string]bool) {
+	key := light.Bridge + "/" + name
+	if activatedScenes[key] || light.HueLight.bridge == nil {
+		return
+	}
+	activatedScenes[key] = true
+	light.HueLight.bridge.throttle(1)
+	scene, err := light.HueLight.bridge.bridge.SceneByName(name)
+	if err != nil {
+		scheduleLog.Warningf("💡 Light %s - Could not find scene %s: %v", light.Name, name, err)
+		return
+	}
+	scheduleLog.Printf("💡 Light %s - Activating scene %s", light.Name, scene.Name)
+	light.HueLight.bridge.throttle(groupRequestCost)
+	_, err = scene.Activate()
+	if err != nil {
+		scheduleLog.Warningf("💡 Light %s - Could not activate scene %s: %v", light.Name, scene.Name, err)
+	}
+}
+
+func (light *Light) restoreSnapshot() {
+	if light.snapshot == nil {
+		return
+	}
+	scheduleLog.Printf("💡 Light %s - Restoring light state from before Kelvin took control", light.Name)
+	light.HueLight.restoreSnapshot(light.snapshot)
+}
+
+// finishTransition sends the target light state without a transition
+// so the light doesn't keep an intermediate state once Kelvin is gone.
+func (light *Light) finishTransition() {
+	if !light.needsUpdate() {
+		return
+	}
+	scheduleLog.Printf("💡 Light %s - Setting final state %vK at %v%% brightness", light.Name, light.TargetLightState.ColorTemperature, light.TargetLightState.Brightness)
+	err := light.HueLight.setLightState(light.TargetLightState.ColorTemperature, light.TargetLightState.Brightness, 0)
+	if err != nil {
+		scheduleLog.Warningf("💡 Light %s - Could not set final state: %v", light.Name, err)
+	}
+}
+
+// shutdownAction describes what happens to the light when Kelvin stops.
+// The settings of the schedule take precedence over the shutdown settings.
+func (light *Light) shutdownAction(settings *Shutdown) string {
+	switch {
+	case !light.Automatic || !light.On:
+		return ""
+	case light.Schedule.restoreOnStop:
+		return "schedule"
+	case settings != nil && settings.Scene != "":
+		return "scene"
+	case settings != nil && settings.Restore:
+		return "snapshot"
+	default:
+		return "finish"
+	}
+}
+
+// restoreLights restores all lights managed by Kelvin according to the
+// given shutdown settings.
+func restoreLights(settings *Shutdown) {
+	activatedScenes := make(map[string]bool)
+	for _, light := range lights {
+		switch light.shutdownAction(settings) {
+		case "schedule":
+			light.restore(activatedScenes)
+		case "scene":
+			light.activateScene(settings.Scene, activatedScenes)
+			light.Automatic = false
+		case "snapshot":
+			light.restoreSnapshot()
+			light.Automatic = false
+			light.snapshot = nil
+		case "finish":
+			light.finishTransition()
+		}
+	}
+}
@@ -0,0 +1,151 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMotionBoost(t *testing.T) {
+	c := Configuration{}
+	lightSchedule := LightSchedule{Name: "hallway", DefaultColorTemperature: 2700, DefaultBrightness: 40, MotionBoost: &MotionBoost{Sensor: "Hallway sensor", Brightness: 100, Duration: "2m"}}
+	light := &Light{Name: "Hallway", Scheduled: true, Schedule: c.scheduleForDay(lightSchedule, time.Now())}
+	if light.Schedule.motionBoost == nil || light.Schedule.motionBoost.duration != 2*time.Minute {
+		t.Fatalf("Motion boost was not parsed: %+v", light.Schedule.motionBoost)
+	}
+
+	now := time.Now()
+	sensors := []HueSensor{{ID: 5, Name: "hallway sensor", Type: "ZLLPresence", Presence: true}}
+	if !light.updateMotionBoost(sensors, now) || !light.boostUntil.Equal(now.Add(2*time.Minute)) {
+		t.Errorf("Motion should start the boost until %v, got %v", now.Add(2*time.Minute), light.boostUntil)
+	}
+	if light.updateMotionBoost(sensors, now.Add(time.Minute)) {
+		t.Errorf("Ongoing motion should only extend the boost")
+	}
+
+	sensors[0].Presence = false
+	if light.updateMotionBoost(sensors, now.Add(2*time.Minute)) {
+		t.Errorf("Boost should last for the configured duration after the last motion")
+	}
+	if !light.updateMotionBoost(sensors, now.Add(4*time.Minute)) || !light.boostUntil.IsZero() {
+		t.Errorf("Boost should end after the configured duration")
+	}
+
+	if _, err := (&MotionBoost{Duration: "soon"}).duration(); err == nil {
+		t.Errorf("Invalid duration should be reported")
+	}
+}
+
+func TestSwitchOverride(t *testing.T) {
+	c := Configuration{}
+	lightSchedule := LightSchedule{Name: "livingroom", DefaultColorTemperature: 2700, DefaultBrightness: 80, SwitchOverride: &SwitchOverride{Switches: []string{"Living room dimmer"}, Duration: "30m"}}
+	light := &Light{Name: "Couch", Scheduled: true, Tracking: true, On: true, Reachable: true, Automatic: true, Schedule: c.scheduleForDay(lightSchedule, time.Now())}
+
+	now := time.Now()
+	before := []HueSensor{{ID: 2, Name: "Living room dimmer", Type: "ZLLSwitch", ButtonEvent: 1002, LastUpdated: now.Add(-time.Hour)}, {ID: 3, Name: "Kitchen dimmer", Type: "ZLLSwitch", ButtonEvent: 1002}}
+	after := []HueSensor{{ID: 2, Name: "Living room dimmer", Type: "ZLLSwitch", ButtonEvent: 2002, LastUpdated: now}, {ID: 3, Name: "Kitchen dimmer", Type: "ZLLSwitch", ButtonEvent: 1002}}
+	pressed := pressedSwitches(before, after)
+	if len(pressed) != 1 || pressed[0].ID != 2 {
+		t.Fatalf("Expected switch 2 to be pressed, got %+v", pressed)
+	}
+
+	if !light.updateSwitchOverride(pressed, now) || light.Automatic || !light.overridden(now.Add(29*time.Minute)) {
+		t.Errorf("Button press should pause Kelvin for 30 minutes")
+	}
+	if light.updateSwitchOverride(nil, now.Add(29*time.Minute)) {
+		t.Errorf("Override should still be active")
+	}
+	if !light.updateSwitchOverride(nil, now.Add(31*time.Minute)) || !light.Automatic || light.overridden(now.Add(31*time.Minute)) {
+		t.Errorf("Kelvin should resume after the override duration")
+	}
+	if len(pressedSwitches(nil, after)) != 0 {
+		t.Errorf("Switches without a previous state should not count as pressed")
+	}
+}
+
+func TestDimmableAndOnOffLights(t *testing.T) {
+	state := LightState{ColorTemperature: 2700, Brightness: 30}
+
+	dimmable := &Light{Name: "Dimmable", HueLight: HueLight{Dimmable: true}}
+	if adapted := dimmable.adaptToCapabilities(state); adapted.ColorTemperature != -1 || adapted.Brightness != 30 {
+		t.Errorf("Dimmable lights should only use the brightness, got %+v", adapted)
+	}
+
+	plug := &Light{Name: "Plug", HueLight: HueLight{OnOffOnly: true, On: true}}
+	plug.Schedule.onOffThreshold = 20
+	if !plug.HueLight.supportsAnyFunctionality() {
+		t.Errorf("Plugs should be managed")
+	}
+	if adapted := plug.adaptToCapabilities(state); adapted.ColorTemperature != -1 || adapted.Brightness != -1 {
+		t.Errorf("Plugs should be left alone above the threshold, got %+v", adapted)
+	}
+	if adapted := plug.adaptToCapabilities(LightState{ColorTemperature: 2000, Brightness: 20}); adapted.Brightness != 0 {
+		t.Errorf("Plugs should be turned off at the threshold, got %+v", adapted)
+	}
+	if plug.HueLight.hasBrightness(0) {
+		t.Errorf("Plug which is on doesn't have brightness 0")
+	}
+}
+
+func TestBrightnessLimits(t *testing.T) {
+	lightSchedule := LightSchedule{Name: "shared", MinBrightness: 20, MaxBrightness: 90, BrightnessLimits: map[string]BrightnessLimit{" Stairway": {MinBrightness: 40}, "Bedroom": {MinBrightness: 10, MaxBrightness: 80}}}
+	schedule := (&Configuration{}).scheduleForDay(lightSchedule, time.Now())
+
+	tests := []struct {
+		light      string
+		brightness int
+		expected   int
+	}{
+		{"Kitchen", 10, 20},
+		{"Kitchen", 95, 90},
+		{"stairway", 30, 40},
+		{"Stairway", 95, 90},
+		{"Bedroom", 10, 10},
+		{"Bedroom", 85, 80},
+		{"Bedroom", 0, 0},
+		{"Bedroom", -1, -1},
+	}
+	for _, test := range tests {
+		light := &Light{Name: test.light, Schedule: schedule}
+		if brightness := light.brightnessLimit().apply(test.brightness); brightness != test.expected {
+			t.Errorf("Light %s: Brightness %d should be limited to %d, got %d", test.light, test.brightness, test.expected, brightness)
+		}
+	}
+
+	if formatted := brightnessLimitsToString(lightSchedule.BrightnessLimits); formatted != " Stairway:40-, Bedroom:10-80" {
+		t.Errorf("Unexpected formatting of brightness limits: %q", formatted)
+	}
+
+	c := Configuration{}
+	c.ConfigurationFile = "testdata/config-example.json"
+	err := c.load()
+	if err != nil {
+		t.Fatalf("Could not load configuration: %v", err)
+	}
+	c.Schedules[0].MinBrightness = 60
+	c.Schedules[0].MaxBrightness = 40
+	c.Schedules[0].BrightnessLimits = map[string]BrightnessLimit{"Stairway": {MinBrightness: 120}}
+	if report := c.Validate(); len(report.Errors) != 2 {
+		t.Errorf("Validate() reported %d errors; want 2 (%v)", len(report.Errors), report.Errors)
+	}
+}
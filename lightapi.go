@@ -0,0 +1,162 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const defaultManualOverrideDuration = 1 * time.Hour
+
+// lightStatus describes what Kelvin wants a light to show and what it
+// actually shows. Unknown values are reported as -1.
+type lightStatus struct {
+	ID            int        `json:"id"`
+	Name          string     `json:"name"`
+	Bridge        string     `json:"bridge,omitempty"`
+	Schedule      string     `json:"schedule,omitempty"`
+	Reachable     bool       `json:"reachable"`
+	On            bool       `json:"on"`
+	Automatic     bool       `json:"automatic"`
+	Target        LightState `json:"target"`
+	Current       LightState `json:"current"`
+	OverrideUntil *time.Time `json:"overrideUntil,omitempty"`
+	Override      *Override  `json:"override,omitempty"`
+}
+
+// lightOverride is a temporary light state requested via the API.
+type lightOverride struct {
+	ColorTemperature int    `json:"colorTemperature"`
+	Brightness       int    `json:"brightness"`
+	Duration         string `json:"duration,omitempty"`
+}
+
+func (light *Light) status(now time.Time) lightStatus {
+	status := lightStatus{ID: light.ID, Name: light.Name, Bridge: light.Bridge, Reachable: light.Reachable, On: light.On, Automatic: light.Automatic, Target: light.TargetLightState, Current: LightState{-1, -1}}
+	if lightSchedule, found := configuration.scheduleForLight(light.Bridge, light.ID); found {
+		status.Schedule = lightSchedule.Name
+	}
+	if colorTemperature, err := light.HueLight.getCurrentColorTemperature(); err == nil {
+		status.Current.ColorTemperature = colorTemperature
+	}
+	if brightness, err := light.HueLight.getCurrentBrightness(); err == nil {
+		status.Current.Brightness = brightness
+	}
+	if light.overridden(now) {
+		override := light.activeOverride
+		status.OverrideUntil = &override.Until
+		status.Override = &override
+	}
+	return status
+}
+
+func lightFromRequest(r *http.Request) (*Light, int) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		return nil, http.StatusBadRequest
+	}
+	light := findLight(r.URL.Query().Get("bridge"), id)
+	if light == nil {
+		return nil, http.StatusNotFound
+	}
+	return light, http.StatusOK
+}
+
+func lightStatusHandler(w http.ResponseWriter, r *http.Request) {
+	webLog.Debugf("Serving light status to %s", r.RemoteAddr)
+	now := time.Now()
+	statuses := []lightStatus{}
+	for _, light := range lights {
+		statuses = append(statuses, light.status(now))
+	}
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+// overrideLightHandler sets the given light state and pauses Kelvin for
+// the light until the duration has passed.
+func overrideLightHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	light, status := lightFromRequest(r)
+	if light == nil {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	var override lightOverride
+	err := json.NewDecoder(r.Body).Decode(&override)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	state := LightState{override.ColorTemperature, override.Brightness}
+	if !state.isValid() {
+		http.Error(w, "Invalid light state", http.StatusBadRequest)
+		return
+	}
+	duration, err := parsePositiveDuration(override.Duration, defaultManualOverrideDuration)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	scheduleLog.Printf("💡 Light %s - Activating light state %+v for %v as requested by %s", light.Name, state, duration, r.RemoteAddr)
+	now := time.Now()
+	var result lightStatus
+	inMainLoop(func() {
+		err = light.overrideState(state, now.Add(duration))
+		result = light.status(now)
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+// overrideState hands the light over to the API until the given time and
+// sends the requested state immediately. It must be called in the main loop.
+func (light *Light) overrideState(state LightState, until time.Time) error {
+	light.override(Override{Until: until, Reason: overrideReasonAPI})
+	light.HueLight.TargetGradient = nil
+	return light.HueLight.setLightState(state.ColorTemperature, state.Brightness, 0)
+}
+
+// endOverrideHandler hands the light back to Kelvin immediately.
+func endOverrideHandler(w http.ResponseWriter, r *http.Request) {
+	light, status := lightFromRequest(r)
+	if light == nil {
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	scheduleLog.Printf("💡 Light %s - Ending override as requested by %s", light.Name, r.RemoteAddr)
+	now := time.Now()
+	var result lightStatus
+	inMainLoop(func() {
+		light.endOverride(now)
+		result = light.status(now)
+	})
+	writeJSON(w, http.StatusOK, result)
+}
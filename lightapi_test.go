@@ -0,0 +1,49 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestManualOverride(t *testing.T) {
+	useConfiguration(t, &Configuration{Schedules: []LightSchedule{{Name: "office", AssociatedDeviceIDs: []int{3}}}})
+	now := time.Now()
+	light := &Light{ID: 3, Name: "Desk", Scheduled: true, Tracking: true, On: true, Reachable: true, Automatic: true}
+	light.override(Override{Until: now.Add(time.Hour), Reason: overrideReasonAPI})
+	if light.Automatic || !light.overridden(now) {
+		t.Fatalf("Light should be overridden and not automatic")
+	}
+	if status := light.status(now); status.Schedule != "office" || status.OverrideUntil == nil || !status.OverrideUntil.Equal(now.Add(time.Hour)) {
+		t.Errorf("Status should report the end of the override, got %+v", status)
+	}
+	if light.expireOverride(now.Add(30 * time.Minute)) {
+		t.Errorf("Override should still be active")
+	}
+	if !light.expireOverride(now.Add(2*time.Hour)) || !light.Automatic {
+		t.Errorf("Kelvin should resume after the override")
+	}
+	if status := light.status(now.Add(2 * time.Hour)); status.OverrideUntil != nil {
+		t.Errorf("Status should not report an expired override, got %v", status.OverrideUntil)
+	}
+}
@@ -23,14 +23,14 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io/ioutil"
-	"net/http"
 	"strconv"
 	"strings"
 
 	"time"
 
-	"github.com/btittelbach/astrotime"
 	log "github.com/sirupsen/logrus"
 )
 
@@ -51,16 +51,19 @@ type GeoAPIResponse struct {
 const geolocationAPIURL = "https://ipinfo.io/json"
 
 // InitializeLocation creates and return a geolocation for the current system.
+// The location is only detected by IP if the user opted in via -detectLocation.
 func InitializeLocation(configuration *Configuration) (Geolocation, error) {
 	var location Geolocation
 	if configuration.Location.Latitude == 0 || configuration.Location.Longitude == 0 {
-		log.Println("🌍 Location not configured. Detecting by IP")
-		err := location.updateByIP()
+		if !*flagDetectLocation {
+			return location, errors.New("Location not configured. Sunrise and sunset will be wrong until you configure your location or start Kelvin with -detectLocation")
+		}
+		err := configuration.detectLocation()
 		if err != nil {
 			return location, err
 		}
-		configuration.Location.Latitude = location.Latitude
-		configuration.Location.Longitude = location.Longitude
+		location.Latitude = configuration.Location.Latitude
+		location.Longitude = configuration.Location.Longitude
 	} else {
 		location.Latitude = configuration.Location.Latitude
 		location.Longitude = configuration.Location.Longitude
@@ -69,8 +72,21 @@ func InitializeLocation(configuration *Configuration) (Geolocation, error) {
 	return location, nil
 }
 
+// detectLocation updates the configured location by a geo IP lookup.
+func (configuration *Configuration) detectLocation() error {
+	log.Println("🌍 Location not configured. Detecting by IP")
+	var location Geolocation
+	err := location.updateByIP()
+	if err != nil {
+		return err
+	}
+	configuration.Location.Latitude = location.Latitude
+	configuration.Location.Longitude = location.Longitude
+	return nil
+}
+
 func (location *Geolocation) updateByIP() error {
-	response, err := http.Get(geolocationAPIURL)
+	response, err := internetClient.Get(geolocationAPIURL)
 	if response != nil {
 		defer response.Body.Close()
 	}
@@ -91,8 +107,7 @@ func (location *Geolocation) updateByIP() error {
 
 	tokens := strings.Split(data.Location, ",")
 	if len(data.Location) == 0 || len(tokens) != 2 {
-		log.Warningf("🌍 Detection of geolocation seems to have failed... Please configure manually")
-		return nil
+		return errors.New("Detection of geolocation seems to have failed... Please configure manually")
 	}
 
 	location.Latitude, _ = strconv.ParseFloat(tokens[0], 32)
@@ -102,22 +117,68 @@ func (location *Geolocation) updateByIP() error {
 	return nil
 }
 
-// CalculateSunset calculates the sunset for the given day based on
-// the configured position on earth.
-func CalculateSunset(date time.Time, latitude float64, longitude float64) time.Time {
-	// calculate start of day
-	yr, mth, day := date.Date()
-	startOfDay := time.Date(yr, mth, day, 0, 0, 0, 0, date.Location())
+// maxPolarSearchDays limits the search for the last day with a regular
+// sunrise and sunset. The polar night lasts half a year at the poles.
+const maxPolarSearchDays = 190
+
+const defaultPolarSunrise = 8 * time.Hour
+const defaultPolarSunset = 20 * time.Hour
 
-	return astrotime.CalcDusk(startOfDay, latitude, longitude, astrotime.GOLDEN_HOUR)
+// regularSunTime returns false for the invalid times the calculators return
+// on days the sun doesn't cross the horizon.
+func regularSunTime(t time.Time, date time.Time) bool {
+	yr, mth, day := date.Date()
+	noon := time.Date(yr, mth, day, 12, 0, 0, 0, date.Location())
+	return t.After(noon.Add(-36*time.Hour)) && t.Before(noon.Add(36*time.Hour))
 }
 
-// CalculateSunrise calculates the sunrise for the given day based on
-// the configured position on earth.
-func CalculateSunrise(date time.Time, latitude float64, longitude float64) time.Time {
-	// calculate start of day
+func sameDay(t time.Time, date time.Time) bool {
 	yr, mth, day := date.Date()
-	startOfDay := time.Date(yr, mth, day, 0, 0, 0, 0, date.Location())
+	tyr, tmth, tday := t.In(date.Location()).Date()
+	return yr == tyr && mth == tmth && day == tday
+}
+
+// sunTimes returns the sunrise and sunset of the given day from the sun
+// time table. See calculateSunTimes for days without sunrise or sunset.
+func (location Location) sunTimes(date time.Time) (time.Time, time.Time, string) {
+	entry := sunTimeTable.sunTimes(location, date)
+	return entry.Sunrise, entry.Sunset, entry.Polar
+}
+
+// calculateSunTimes calculates the sunrise and sunset of the given day. On
+// days without sunrise or sunset (polar day or polar night) the configured
+// polar times of the location are used. Without them the times of the last
+// regular day are used. The returned note explains the fallback.
+func (location Location) calculateSunTimes(date time.Time) (time.Time, time.Time, string) {
+	sunrise := location.sunrise(date)
+	sunset := location.sunset(date)
+	if regularSunTime(sunrise, date) && regularSunTime(sunset, date) {
+		return sunrise, sunset, ""
+	}
 
-	return astrotime.CalcDawn(startOfDay, latitude, longitude, astrotime.GOLDEN_HOUR)
+	situation := "polar night"
+	if maximumSolarElevation(date, location.Latitude, location.Longitude) > location.twilightElevation() {
+		situation = "polar day"
+	}
+	if location.PolarSunrise != "" && location.PolarSunset != "" {
+		polarSunrise, err := parseClockTime(location.PolarSunrise)
+		if err == nil {
+			polarSunset, err := parseClockTime(location.PolarSunset)
+			if err == nil {
+				return atClockTime(date, 0, polarSunrise), atClockTime(date, 0, polarSunset), fmt.Sprintf("%s, using the configured polar sunrise and sunset", situation)
+			}
+		}
+	}
+
+	// Days close to the polar day have a sunrise around midnight. Skip them
+	// so the fallback times lie on the same day.
+	for days := 1; days <= maxPolarSearchDays; days++ {
+		previous := date.AddDate(0, 0, -days)
+		sunrise := location.sunrise(previous)
+		sunset := location.sunset(previous)
+		if sameDay(sunrise, previous) && sameDay(sunset, previous) && sunrise.Before(sunset) {
+			return sunrise.AddDate(0, 0, days), sunset.AddDate(0, 0, days), fmt.Sprintf("%s, using the sunrise and sunset of %s", situation, previous.Format("Jan 2"))
+		}
+	}
+	return atClockTime(date, 0, defaultPolarSunrise), atClockTime(date, 0, defaultPolarSunset), fmt.Sprintf("%s, using the default sunrise and sunset", situation)
 }
@@ -0,0 +1,61 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolarSunTimes(t *testing.T) {
+	tromso := Location{Latitude: 69.65, Longitude: 18.96}
+	regular := time.Date(2021, 3, 21, 0, 0, 0, 0, time.UTC)
+	if _, _, polar := tromso.sunTimes(regular); polar != "" {
+		t.Errorf("Regular days should not use a fallback: %s", polar)
+	}
+
+	night := time.Date(2021, 12, 21, 0, 0, 0, 0, time.UTC)
+	sunrise, sunset, polar := tromso.sunTimes(night)
+	if !strings.HasPrefix(polar, "polar night") || !regularSunTime(sunrise, night) || !sunrise.Before(sunset) {
+		t.Errorf("Unexpected fallback during polar night: %v - %v (%s)", sunrise, sunset, polar)
+	}
+	day := time.Date(2021, 6, 21, 0, 0, 0, 0, time.UTC)
+	svalbard := Location{Latitude: 78.22, Longitude: 15.65}
+	if sunrise, sunset, polar := svalbard.sunTimes(day); !strings.HasPrefix(polar, "polar day") || sunrise.Day() != 21 || !sunrise.Before(sunset) {
+		t.Errorf("Unexpected fallback during polar day: %v - %v (%s)", sunrise, sunset, polar)
+	}
+
+	tromso.PolarSunrise, tromso.PolarSunset = "09:00", "15:00"
+	if sunrise, sunset, _ := tromso.sunTimes(night); sunrise != night.Add(9*time.Hour) || sunset != night.Add(15*time.Hour) {
+		t.Errorf("Configured polar times should be used: %v - %v", sunrise, sunset)
+	}
+
+	c := Configuration{Location: tromso, Schedules: []LightSchedule{{Name: "North", Default: true, DefaultColorTemperature: 2750, DefaultBrightness: 100, BeforeSunrise: []TimedColorTemperature{}, AfterSunset: []TimedColorTemperature{}}}}
+	if report := c.Validate(); len(report.Errors) != 0 {
+		t.Errorf("Polar days should validate: %v", report.Errors)
+	}
+	c.Location.PolarSunset = "08:00"
+	if report := c.Validate(); len(report.Errors) == 0 {
+		t.Errorf("Polar sunset before the polar sunrise should fail validation")
+	}
+}
@@ -0,0 +1,120 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const lockFilename = "kelvin.lock"
+
+// instanceLock is a file containing the PID of the Kelvin instance which
+// owns a configuration or bridge. It prevents two instances from fighting
+// over the same lights.
+type instanceLock struct {
+	filename string
+}
+
+var instanceLocks []*instanceLock
+
+// acquireLock creates the given lock file. Locks of instances which aren't
+// running anymore are taken over.
+func acquireLock(filename string) (*instanceLock, error) {
+	for attempt := 0; attempt < 2; attempt++ {
+		file, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if err == nil {
+			_, err = fmt.Fprintf(file, "%d\n", os.Getpid())
+			file.Close()
+			if err != nil {
+				os.Remove(filename)
+				return nil, err
+			}
+			return &instanceLock{filename}, nil
+		}
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		// In containers the PID of a previous run may be our own
+		pid, err := lockOwner(filename)
+		if err == nil && pid != os.Getpid() && processRunning(pid) {
+			return nil, fmt.Errorf("Kelvin is already running as PID %d. Stop it first or remove %s if it isn't running anymore", pid, filename)
+		}
+		log.Debugf("🤖 Removing stale lock file %s", filename)
+		err = os.Remove(filename)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("Could not create lock file %s", filename)
+}
+
+func lockOwner(filename string) (int, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(strings.TrimSpace(string(data)))
+}
+
+// release removes the lock file unless another instance took it over.
+func (lock *instanceLock) release() {
+	if pid, err := lockOwner(lock.filename); err != nil || pid != os.Getpid() {
+		return
+	}
+	err := os.Remove(lock.filename)
+	if err != nil {
+		log.Debugf("🤖 Could not remove lock file %s: %v", lock.filename, err)
+	}
+}
+
+// lockInstance acquires the given lock for the lifetime of Kelvin or exits
+// if another instance holds it.
+func lockInstance(filename string, owner string) {
+	lock, err := acquireLock(filename)
+	if err != nil {
+		log.Fatalf("🤖 Could not lock %s: %v", owner, err)
+	}
+	instanceLocks = append(instanceLocks, lock)
+}
+
+// bridgeLockFile returns the lock file of the bridge with the given
+// address. It is shared by all configurations on this machine.
+func bridgeLockFile(address string) string {
+	name := strings.NewReplacer(":", "_", "/", "_", "[", "", "]", "").Replace(address)
+	return filepath.Join(os.TempDir(), "kelvin-bridge-"+name+".lock")
+}
+
+// releaseLocks removes all lock files of this instance.
+func releaseLocks() {
+	for _, lock := range instanceLocks {
+		lock.release()
+	}
+	instanceLocks = nil
+}
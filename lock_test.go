@@ -0,0 +1,67 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestInstanceLock(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), lockFilename)
+	lock, err := acquireLock(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pid, err := lockOwner(filename); err != nil || pid != os.Getpid() {
+		t.Errorf("Expected lock to be owned by %d, got %d (%v)", os.Getpid(), pid, err)
+	}
+
+	// Another running instance
+	ioutil.WriteFile(filename, []byte(strconv.Itoa(os.Getppid())), 0644)
+	if _, err := acquireLock(filename); err == nil || !strings.Contains(err.Error(), "already running") {
+		t.Errorf("Lock of a running instance must not be taken over: %v", err)
+	}
+	lock.release()
+	if _, err := os.Stat(filename); err != nil {
+		t.Errorf("Lock of another instance must not be released: %v", err)
+	}
+
+	// A crashed instance
+	ioutil.WriteFile(filename, []byte("999999999\n"), 0644)
+	lock, err = acquireLock(filename)
+	if err != nil {
+		t.Fatalf("Stale lock should be taken over: %v", err)
+	}
+	lock.release()
+	if _, err := os.Stat(filename); !os.IsNotExist(err) {
+		t.Errorf("Expected lock file to be removed: %v", err)
+	}
+
+	if name := filepath.Base(bridgeLockFile("[fe80::1]:8080")); name != "kelvin-bridge-fe80__1_8080.lock" {
+		t.Errorf("Unexpected bridge lock file %s", name)
+	}
+}
@@ -0,0 +1,123 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const logBufferSize = 1000
+
+// LogEntry represents a single logged message.
+type LogEntry struct {
+	Time    time.Time `json:"time"`
+	Level   string    `json:"level"`
+	Message string    `json:"message"`
+}
+
+// ringBuffer keeps the latest log entries in memory so they can be
+// inspected via the web interface.
+type ringBuffer struct {
+	entries []LogEntry
+	next    int
+	full    bool
+	lock    sync.Mutex
+}
+
+var logBuffer = newRingBuffer(logBufferSize)
+
+func newRingBuffer(size int) *ringBuffer {
+	return &ringBuffer{entries: make([]LogEntry, size)}
+}
+
+// Levels implements logrus.Hook.
+func (buffer *ringBuffer) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements logrus.Hook.
+func (buffer *ringBuffer) Fire(entry *log.Entry) error {
+	buffer.add(LogEntry{entry.Time, entry.Level.String(), entry.Message})
+	return nil
+}
+
+func (buffer *ringBuffer) add(entry LogEntry) {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	buffer.entries[buffer.next] = entry
+	buffer.next = (buffer.next + 1) % len(buffer.entries)
+	if buffer.next == 0 {
+		buffer.full = true
+	}
+}
+
+// Entries returns the latest entries of at least the given level, oldest
+// first. A limit of 0 returns all matching entries.
+func (buffer *ringBuffer) Entries(level log.Level, limit int) []LogEntry {
+	buffer.lock.Lock()
+	defer buffer.lock.Unlock()
+	ordered := buffer.entries[:buffer.next]
+	if buffer.full {
+		ordered = append(append([]LogEntry{}, buffer.entries[buffer.next:]...), buffer.entries[:buffer.next]...)
+	}
+
+	entries := []LogEntry{}
+	for _, entry := range ordered {
+		entryLevel, err := log.ParseLevel(entry.Level)
+		if err == nil && entryLevel <= level {
+			entries = append(entries, entry)
+		}
+	}
+	if limit > 0 && len(entries) > limit {
+		entries = entries[len(entries)-limit:]
+	}
+	return entries
+}
+
+// logsHandler serves the buffered log entries. The optional parameters
+// level (e.g. warning) and limit restrict the returned entries.
+func logsHandler(w http.ResponseWriter, r *http.Request) {
+	level := log.TraceLevel
+	if value := r.URL.Query().Get("level"); value != "" {
+		var err error
+		level, err = log.ParseLevel(value)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	limit := 0
+	if value := r.URL.Query().Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			http.Error(w, "Invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+	writeJSON(w, http.StatusOK, logBuffer.Entries(level, limit))
+}
@@ -0,0 +1,55 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestLogBuffer(t *testing.T) {
+	buffer := newRingBuffer(3)
+	buffer.add(LogEntry{time.Now(), "info", "first"})
+	buffer.add(LogEntry{time.Now(), "warning", "second"})
+	buffer.add(LogEntry{time.Now(), "debug", "third"})
+	buffer.add(LogEntry{time.Now(), "error", "fourth"})
+
+	messages := func(entries []LogEntry) []string {
+		result := []string{}
+		for _, entry := range entries {
+			result = append(result, entry.Message)
+		}
+		return result
+	}
+	if all := messages(buffer.Entries(log.TraceLevel, 0)); !reflect.DeepEqual(all, []string{"second", "third", "fourth"}) {
+		t.Errorf("Buffer should keep the latest entries in order, got %v", all)
+	}
+	if warnings := messages(buffer.Entries(log.WarnLevel, 0)); !reflect.DeepEqual(warnings, []string{"second", "fourth"}) {
+		t.Errorf("Buffer should filter by level, got %v", warnings)
+	}
+	if latest := messages(buffer.Entries(log.TraceLevel, 1)); !reflect.DeepEqual(latest, []string{"fourth"}) {
+		t.Errorf("Buffer should limit the entries, got %v", latest)
+	}
+}
@@ -0,0 +1,132 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"io"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Modules with an individually configurable log level. Messages of all
+// other parts of Kelvin use the default level.
+const (
+	logModuleConfig   = "config"
+	logModuleSchedule = "schedule"
+	logModuleHue      = "hue"
+	logModuleWeb      = "web"
+	logModuleUpdater  = "updater"
+)
+
+var logModules = []string{logModuleConfig, logModuleSchedule, logModuleHue, logModuleWeb, logModuleUpdater}
+
+// logLevels are the levels which can be configured.
+var logLevels = []string{"trace", "debug", "info", "warning", "error"}
+
+var moduleLoggers = make(map[string]*log.Logger)
+
+var (
+	configLog   = newModuleLogger(logModuleConfig)
+	scheduleLog = newModuleLogger(logModuleSchedule)
+	hueLog      = newModuleLogger(logModuleHue)
+	webLog      = newModuleLogger(logModuleWeb)
+	updaterLog  = newModuleLogger(logModuleUpdater)
+)
+
+// newModuleLogger creates the logger of the given module. It has to be
+// configured along with the standard logger.
+func newModuleLogger(module string) *log.Logger {
+	logger := log.New()
+	moduleLoggers[module] = logger
+	return logger
+}
+
+// allLoggers returns the standard logger and the loggers of all modules.
+func allLoggers() []*log.Logger {
+	loggers := []*log.Logger{log.StandardLogger()}
+	for _, module := range logModules {
+		loggers = append(loggers, moduleLoggers[module])
+	}
+	return loggers
+}
+
+func setLogFormatter(formatter log.Formatter) {
+	for _, logger := range allLoggers() {
+		logger.SetFormatter(formatter)
+	}
+}
+
+func setLogOutput(output io.Writer) {
+	for _, logger := range allLoggers() {
+		logger.SetOutput(output)
+	}
+}
+
+func addLogHook(hook log.Hook) {
+	for _, logger := range allLoggers() {
+		logger.AddHook(hook)
+	}
+}
+
+func setLogLevel(level log.Level) {
+	for _, logger := range allLoggers() {
+		logger.SetLevel(level)
+	}
+}
+
+// parseLogLevel parses one of the configurable levels. Empty values
+// result in the fallback.
+func parseLogLevel(value string, fallback log.Level) (log.Level, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	if !containsString(logLevels, value) {
+		return fallback, fmt.Errorf("Invalid log level %s (must be one of %v)", value, logLevels)
+	}
+	return log.ParseLevel(value)
+}
+
+// applyLogLevels sets the configured default level and the levels of all
+// modules. The flag -debug enables debug logging for everything.
+func applyLogLevels(logging *Logging) error {
+	if *flagDebug || logging == nil {
+		return nil
+	}
+	level, err := parseLogLevel(logging.Level, log.InfoLevel)
+	if err != nil {
+		return err
+	}
+	setLogLevel(level)
+	for module, value := range logging.Levels {
+		logger, found := moduleLoggers[module]
+		if !found {
+			return fmt.Errorf("Unknown log module %s (must be one of %v)", module, logModules)
+		}
+		moduleLevel, err := parseLogLevel(value, level)
+		if err != nil {
+			return fmt.Errorf("Module %s: %v", module, err)
+		}
+		logger.SetLevel(moduleLevel)
+	}
+	return nil
+}
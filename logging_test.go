@@ -0,0 +1,48 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"strings"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestLogLevels(t *testing.T) {
+	defer setLogLevel(log.InfoLevel)
+	err := applyLogLevels(&Logging{Level: "warning", Levels: map[string]string{logModuleSchedule: "debug"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if log.GetLevel() != log.WarnLevel || hueLog.GetLevel() != log.WarnLevel || scheduleLog.GetLevel() != log.DebugLevel {
+		t.Errorf("Unexpected levels: default %v, hue %v, schedule %v", log.GetLevel(), hueLog.GetLevel(), scheduleLog.GetLevel())
+	}
+	if err := applyLogLevels(&Logging{Levels: map[string]string{"bridge": "debug"}}); err == nil {
+		t.Errorf("Unknown modules should be rejected")
+	}
+
+	c := Configuration{Logging: &Logging{Level: "verbose", Levels: map[string]string{"hue": "quiet"}}}
+	if messages := strings.Join(c.Validate().Errors, "\n"); !strings.Contains(messages, "verbose") || !strings.Contains(messages, "quiet") {
+		t.Errorf("Invalid log levels should fail validation: %v", messages)
+	}
+}
@@ -0,0 +1,277 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Supported log outputs
+const (
+	logOutputStdout   = "stdout"
+	logOutputSyslog   = "syslog"
+	logOutputJournald = "journald"
+)
+
+var logOutputs = []string{logOutputStdout, logOutputSyslog, logOutputJournald}
+
+const defaultLogTag = "kelvin"
+
+// syslogFacilityDaemon is the facility of all messages sent to syslog.
+const syslogFacilityDaemon = 3
+
+var journaldSocket = "/run/systemd/journal/socket"
+
+// localSyslogSockets are the usual sockets of the local syslog daemon on
+// Linux, macOS and BSD.
+var localSyslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// Logging configures where Kelvin sends its log messages.
+type Logging struct {
+	Output       string            `json:"output,omitempty"`
+	Address      string            `json:"address,omitempty"`
+	Tag          string            `json:"tag,omitempty"`
+	Level        string            `json:"level,omitempty"`
+	Levels       map[string]string `json:"levels,omitempty"`
+	CrashReports string            `json:"crashReports,omitempty"`
+}
+
+func (logging *Logging) output() string {
+	if logging == nil || logging.Output == "" {
+		return logOutputStdout
+	}
+	return logging.Output
+}
+
+func (logging *Logging) tag() string {
+	if logging == nil || logging.Tag == "" {
+		return defaultLogTag
+	}
+	return logging.Tag
+}
+
+// syslogSeverity maps the levels of logrus to the severities of syslog,
+// which are used by journald as well.
+func syslogSeverity(level log.Level) int {
+	switch level {
+	case log.PanicLevel, log.FatalLevel:
+		return 2 // critical
+	case log.ErrorLevel:
+		return 3 // error
+	case log.WarnLevel:
+		return 4 // warning
+	case log.InfoLevel:
+		return 6 // informational
+	default:
+		return 7 // debug
+	}
+}
+
+// parseSyslogAddress splits addresses like udp://host:514 into network and
+// address. Addresses without a network use UDP.
+func parseSyslogAddress(address string) (string, string, error) {
+	network := "udp"
+	if index := strings.Index(address, "://"); index != -1 {
+		network, address = address[:index], address[index+3:]
+	}
+	switch network {
+	case "udp", "tcp":
+		if _, _, err := net.SplitHostPort(address); err != nil {
+			return "", "", fmt.Errorf("Invalid syslog address %s: %v", address, err)
+		}
+	case "unix", "unixgram":
+		if address == "" {
+			return "", "", fmt.Errorf("Missing path of the syslog socket")
+		}
+	default:
+		return "", "", fmt.Errorf("Unsupported syslog network %s (must be udp, tcp, unix or unixgram)", network)
+	}
+	return network, address, nil
+}
+
+// logSink is a logrus hook sending every entry to syslog or journald. The
+// connection is reestablished if a message can't be sent.
+type logSink struct {
+	dial       func() (net.Conn, error)
+	format     func(entry *log.Entry) []byte
+	connection net.Conn
+	lock       sync.Mutex
+}
+
+// Levels implements logrus.Hook.
+func (sink *logSink) Levels() []log.Level {
+	return log.AllLevels
+}
+
+// Fire implements logrus.Hook.
+func (sink *logSink) Fire(entry *log.Entry) error {
+	sink.lock.Lock()
+	defer sink.lock.Unlock()
+	message := sink.format(entry)
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if sink.connection == nil {
+			sink.connection, err = sink.dial()
+			if err != nil {
+				continue
+			}
+		}
+		_, err = sink.connection.Write(message)
+		if err == nil {
+			return nil
+		}
+		sink.connection.Close()
+		sink.connection = nil
+	}
+	return err
+}
+
+// newSyslogSink connects to the given syslog server or, without an
+// address, to the local syslog daemon.
+func newSyslogSink(address string, tag string) (*logSink, error) {
+	if address == "" {
+		return &logSink{dial: dialLocalSyslog, format: func(entry *log.Entry) []byte {
+			return formatLocalSyslog(entry, tag)
+		}}, nil
+	}
+
+	network, address, err := parseSyslogAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	hostname, _ := os.Hostname()
+	return &logSink{
+		dial: func() (net.Conn, error) {
+			return net.DialTimeout(network, address, 5*time.Second)
+		},
+		format: func(entry *log.Entry) []byte {
+			message := formatRemoteSyslog(entry, hostname, tag)
+			if network == "tcp" {
+				// Messages are separated by newlines on stream connections
+				message = append(message, '\n')
+			}
+			return message
+		},
+	}, nil
+}
+
+func dialLocalSyslog() (net.Conn, error) {
+	for _, socket := range localSyslogSockets {
+		for _, network := range []string{"unixgram", "unix"} {
+			connection, err := net.Dial(network, socket)
+			if err == nil {
+				return connection, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("Local syslog daemon not found")
+}
+
+// formatLocalSyslog formats the entry for the local syslog daemon which adds
+// the hostname itself.
+func formatLocalSyslog(entry *log.Entry, tag string) []byte {
+	priority := syslogFacilityDaemon*8 + syslogSeverity(entry.Level)
+	return []byte(fmt.Sprintf("<%d>%s %s[%d]: %s", priority, entry.Time.Format(time.Stamp), tag, os.Getpid(), entry.Message))
+}
+
+// formatRemoteSyslog formats the entry according to RFC 5424.
+func formatRemoteSyslog(entry *log.Entry, hostname string, tag string) []byte {
+	if hostname == "" {
+		hostname = "-"
+	}
+	priority := syslogFacilityDaemon*8 + syslogSeverity(entry.Level)
+	return []byte(fmt.Sprintf("<%d>1 %s %s %s %d - - %s", priority, entry.Time.Format(time.RFC3339), hostname, tag, os.Getpid(), entry.Message))
+}
+
+func newJournaldSink(tag string) *logSink {
+	return &logSink{
+		dial: func() (net.Conn, error) {
+			return net.Dial("unixgram", journaldSocket)
+		},
+		format: func(entry *log.Entry) []byte {
+			return formatJournald(entry, tag)
+		},
+	}
+}
+
+// formatJournald encodes the entry in the native protocol of journald.
+// Values containing newlines are prefixed with their length.
+func formatJournald(entry *log.Entry, tag string) []byte {
+	var buffer bytes.Buffer
+	field := func(name string, value string) {
+		if !strings.Contains(value, "\n") {
+			fmt.Fprintf(&buffer, "%s=%s\n", name, value)
+			return
+		}
+		buffer.WriteString(name + "\n")
+		binary.Write(&buffer, binary.LittleEndian, uint64(len(value)))
+		buffer.WriteString(value + "\n")
+	}
+	field("PRIORITY", fmt.Sprint(syslogSeverity(entry.Level)))
+	field("SYSLOG_IDENTIFIER", tag)
+	field("MESSAGE", entry.Message)
+	return buffer.Bytes()
+}
+
+// configureLogSink sends all log messages to the configured output.
+// Messages are no longer written to stdout unless they are redirected to
+// a file with -log.
+func configureLogSink(logging *Logging) error {
+	var sink *logSink
+	switch logging.output() {
+	case logOutputStdout:
+		return nil
+	case logOutputSyslog:
+		var err error
+		sink, err = newSyslogSink(logging.Address, logging.tag())
+		if err != nil {
+			return err
+		}
+	case logOutputJournald:
+		sink = newJournaldSink(logging.tag())
+	default:
+		return fmt.Errorf("Unknown log output %s (must be one of %v)", logging.Output, logOutputs)
+	}
+
+	// Fail early if the sink isn't reachable
+	connection, err := sink.dial()
+	if err != nil {
+		return err
+	}
+	sink.connection = connection
+	addLogHook(sink)
+	if flagLogfile == nil || *flagLogfile == "" {
+		setLogOutput(ioutil.Discard)
+	}
+	log.Printf("🤖 Sending log messages to %s", logging.output())
+	return nil
+}
@@ -0,0 +1,80 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+func TestLogSink(t *testing.T) {
+	for level, expected := range map[log.Level]int{log.FatalLevel: 2, log.ErrorLevel: 3, log.WarnLevel: 4, log.InfoLevel: 6, log.DebugLevel: 7} {
+		if severity := syslogSeverity(level); severity != expected {
+			t.Errorf("Unexpected severity for level %v: %d", level, severity)
+		}
+	}
+	for address, expected := range map[string]string{"192.168.1.5:514": "udp", "tcp://logs.local:514": "tcp", "unix:///dev/log": "unix"} {
+		if network, _, err := parseSyslogAddress(address); err != nil || network != expected {
+			t.Errorf("Unexpected network for %s: %s (%v)", address, network, err)
+		}
+	}
+	for _, address := range []string{"http://logs.local", "logs.local"} {
+		if _, _, err := parseSyslogAddress(address); err == nil {
+			t.Errorf("Address %s should be rejected", address)
+		}
+	}
+
+	entry := &log.Entry{Time: time.Date(2021, 3, 1, 12, 0, 0, 0, time.UTC), Level: log.WarnLevel, Message: "first\nsecond"}
+	journal := formatJournald(entry, "kelvin")
+	if !strings.HasPrefix(string(journal), "PRIORITY=4\nSYSLOG_IDENTIFIER=kelvin\nMESSAGE\n") || !strings.HasSuffix(string(journal), "first\nsecond\n") {
+		t.Errorf("Unexpected journald message: %q", journal)
+	}
+
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer server.Close()
+	sink, err := newSyslogSink("udp://"+server.LocalAddr().String(), "kelvin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = sink.Fire(entry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	buffer := make([]byte, 1024)
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := server.ReadFrom(buffer)
+	if err != nil || !strings.HasPrefix(string(buffer[:n]), "<28>1 2021-03-01T12:00:00Z ") {
+		t.Errorf("Unexpected syslog message: %q (%v)", buffer[:n], err)
+	}
+
+	c := Configuration{Logging: &Logging{Output: "file"}}
+	if report := c.Validate(); len(report.Errors) == 0 {
+		t.Errorf("Unknown log output should fail validation")
+	}
+}
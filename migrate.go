@@ -0,0 +1,106 @@
+// MIT License
+//
+// Copyright (c) 2018 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// migrateCommand migrates the given configuration to the latest version.
+// A copy of the original configuration is kept as backup and the result
+// is validated before it is written. It returns the exit code for the
+// process.
+func migrateCommand(configurationFile string) int {
+	if !*flagDebug {
+		setLogLevel(log.ErrorLevel)
+	}
+
+	var configuration Configuration
+	configuration.ConfigurationFile = configurationFile
+	err := configuration.load()
+	if err != nil {
+		fmt.Printf("Could not read configuration %s: %v\n", configurationFile, err)
+		return 1
+	}
+
+	previousVersion := configuration.Version
+	previousHash := configuration.HashValue()
+	configuration.migrateToLatestVersion()
+	if configuration.HashValue() == previousHash {
+		fmt.Printf("Configuration %s is already at the latest version %d. Nothing to migrate.\n", configurationFile, configuration.Version)
+		return 0
+	}
+
+	report := configuration.Validate()
+	for _, message := range report.Errors {
+		fmt.Printf("ERROR:   %s\n", message)
+	}
+	if !report.Valid() {
+		fmt.Printf("Migrated configuration is invalid. Configuration %s was not changed.\n", configurationFile)
+		return 1
+	}
+
+	backups, err := configuration.copyToBackup()
+	if err != nil {
+		fmt.Printf("Could not create backup: %v\n", err)
+		return 1
+	}
+	for _, backup := range backups {
+		fmt.Printf("Backup created: %s\n", backup)
+	}
+
+	err = configuration.Write()
+	if err != nil {
+		fmt.Printf("Could not write configuration %s: %v\n", configurationFile, err)
+		return 1
+	}
+	fmt.Printf("Configuration %s migrated from version %d to version %d.\n", configurationFile, previousVersion, configuration.Version)
+	return 0
+}
+
+// copyToBackup copies all files of the configuration next to the original
+// files and returns the names of the copies.
+func (configuration *Configuration) copyToBackup() ([]string, error) {
+	files := []string{configuration.ConfigurationFile}
+	if configuration.directory != nil {
+		files = configuration.directory.files
+	}
+
+	var backups []string
+	for _, file := range files {
+		raw, err := ioutil.ReadFile(file)
+		if err != nil {
+			return backups, err
+		}
+		backup := file + "_" + time.Now().Format("01022006")
+		err = ioutil.WriteFile(backup, raw, 0644)
+		if err != nil {
+			return backups, err
+		}
+		backups = append(backups, backup)
+	}
+	return backups, nil
+}
@@ -0,0 +1,63 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"math"
+	"time"
+)
+
+// synodicMonth is the average duration between two new moons in days.
+const synodicMonth = 29.530588853
+
+// knownNewMoon is the reference new moon of January 6th 2000.
+var knownNewMoon = time.Date(2000, 1, 6, 18, 14, 0, 0, time.UTC)
+
+// Moon phases in order of the lunar cycle
+var moonPhases = []string{"new", "waxingCrescent", "firstQuarter", "waxingGibbous", "full", "waningGibbous", "lastQuarter", "waningCrescent"}
+
+// moonAge returns the days since the last new moon at the given time.
+func moonAge(timestamp time.Time) float64 {
+	age := math.Mod(timestamp.Sub(knownNewMoon).Hours()/24, synodicMonth)
+	if age < 0 {
+		age += synodicMonth
+	}
+	return age
+}
+
+// moonPhase returns the name of the moon phase at the given time. Each
+// phase covers an eighth of the lunar cycle centered on its exact point.
+func moonPhase(timestamp time.Time) string {
+	index := int(math.Floor(moonAge(timestamp)/synodicMonth*8+0.5)) % len(moonPhases)
+	return moonPhases[index]
+}
+
+// moonPhaseMatches returns true if the moon is in one of the given phases
+// on the day of the given date. The phase at noon is used for the whole
+// day. Empty conditions always match.
+func moonPhaseMatches(phases []string, date time.Time) bool {
+	if len(phases) == 0 {
+		return true
+	}
+	yr, mth, dy := date.Date()
+	return containsString(phases, moonPhase(time.Date(yr, mth, dy, 12, 0, 0, 0, date.Location())))
+}
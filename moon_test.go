@@ -0,0 +1,58 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMoonPhases(t *testing.T) {
+	phases := map[string]string{"2021-06-10": "new", "2021-06-18": "firstQuarter", "2021-06-24": "full", "2021-07-01": "lastQuarter", "2021-06-14": "waxingCrescent"}
+	for day, expected := range phases {
+		date, _ := time.Parse("2006-01-02", day)
+		if phase := moonPhase(date.Add(12 * time.Hour)); phase != expected {
+			t.Errorf("Unexpected moon phase on %s: %s (expected %s)", day, phase, expected)
+		}
+	}
+
+	newMoon := time.Date(2021, 6, 10, 0, 0, 0, 0, time.UTC)
+	fullMoon := time.Date(2021, 6, 24, 0, 0, 0, 0, time.UTC)
+	c := Configuration{Schedules: []LightSchedule{
+		{Name: "garden", AssociatedDeviceIDs: []int{1}},
+		{Name: "dark nights", AssociatedDeviceIDs: []int{1}, Priority: 1, MoonPhases: []string{"new"}},
+	}}
+	if schedule, _ := c.scheduleForLightOnDay("", 1, newMoon); schedule.Name != "dark nights" {
+		t.Errorf("Schedule of the moon phase should be used, got %s", schedule.Name)
+	}
+	if schedule, _ := c.scheduleForLightOnDay("", 1, fullMoon); schedule.Name != "garden" {
+		t.Errorf("Schedule of other moon phases should be skipped, got %s", schedule.Name)
+	}
+
+	entries := []TimedColorTemperature{{Time: "+1h", ColorTemperature: 2700, Brightness: 80, MoonPhases: []string{"New"}}, {Time: "+1h", ColorTemperature: 2000, Brightness: 10}}
+	if timestamps, _ := parseTimestamps(entries, fullMoon.Add(20*time.Hour)); len(timestamps) != 1 || timestamps[0].Time != fullMoon.Add(22*time.Hour) {
+		t.Errorf("Entries of other moon phases should be skipped: %+v", timestamps)
+	}
+	if timestamps, _ := parseTimestamps(entries, newMoon.Add(20*time.Hour)); len(timestamps) != 2 {
+		t.Errorf("Entries of the moon phase should be used: %+v", timestamps)
+	}
+}
@@ -0,0 +1,278 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const mqttKeepAlive = 60 * time.Second
+const mqttTimeout = 10 * time.Second
+const mqttReconnectDelay = 10 * time.Second
+
+// mqttMaxPacketSize limits the memory a broker can make Kelvin allocate.
+// Commands and presence messages are much smaller.
+const mqttMaxPacketSize = 64 * 1024
+
+// Control packet types of MQTT 3.1.1
+const (
+	mqttConnect    = 1
+	mqttConnack    = 2
+	mqttPublish    = 3
+	mqttSubscribe  = 8
+	mqttPingreq    = 12
+	mqttDisconnect = 14
+)
+
+// mqttClient is a minimal MQTT 3.1.1 client. Messages are sent and
+// received with QoS 0 only.
+type mqttClient struct {
+	conn     net.Conn
+	reader   *bufio.Reader
+	lock     sync.Mutex
+	packetID uint16
+	closed   chan struct{}
+}
+
+// mqttMessage is a message received on a subscribed topic.
+type mqttMessage struct {
+	Topic   string
+	Payload []byte
+}
+
+// mqttAddress splits a broker URL like tcp://host:port or ssl://host into
+// the address to dial and whether TLS should be used.
+func mqttAddress(broker string) (string, bool) {
+	secure := false
+	for _, scheme := range []string{"ssl://", "tls://", "mqtts://"} {
+		if strings.HasPrefix(broker, scheme) {
+			broker = strings.TrimPrefix(broker, scheme)
+			secure = true
+		}
+	}
+	broker = strings.TrimPrefix(strings.TrimPrefix(broker, "tcp://"), "mqtt://")
+	if _, _, err := net.SplitHostPort(broker); err != nil {
+		if secure {
+			return net.JoinHostPort(broker, "8883"), true
+		}
+		return net.JoinHostPort(broker, "1883"), false
+	}
+	return broker, secure
+}
+
+// dialMQTT connects to the given broker and waits for it to accept the
+// connection.
+func dialMQTT(broker string, username string, password string) (*mqttClient, error) {
+	address, secure := mqttAddress(broker)
+	dialer := &net.Dialer{Timeout: mqttTimeout}
+	var conn net.Conn
+	var err error
+	if secure {
+		conn, err = tls.DialWithDialer(dialer, "tcp", address, &tls.Config{})
+	} else {
+		conn, err = dialer.Dial("tcp", address)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	client := &mqttClient{conn: conn, reader: bufio.NewReader(conn), closed: make(chan struct{})}
+	var body []byte
+	body = append(body, mqttString("MQTT")...)
+	flags := byte(0x02) // clean session
+	if username != "" {
+		flags |= 0x80
+		if password != "" {
+			flags |= 0x40
+		}
+	}
+	body = append(body, 4, flags, byte(mqttKeepAlive/time.Second>>8), byte(mqttKeepAlive/time.Second&0xff))
+	body = append(body, mqttString(fmt.Sprintf("kelvin-%d", os.Getpid()))...)
+	if username != "" {
+		body = append(body, mqttString(username)...)
+		if password != "" {
+			body = append(body, mqttString(password)...)
+		}
+	}
+
+	conn.SetDeadline(time.Now().Add(mqttTimeout))
+	err = client.writePacket(mqttConnect<<4, body)
+	if err == nil {
+		err = client.readConnack()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	go client.keepAlive()
+	return client, nil
+}
+
+func (client *mqttClient) readConnack() error {
+	packetType, body, err := client.readPacket()
+	if err != nil {
+		return err
+	}
+	if packetType != mqttConnack || len(body) != 2 {
+		return fmt.Errorf("Broker didn't acknowledge the connection")
+	}
+	switch body[1] {
+	case 0:
+		return nil
+	case 4, 5:
+		return fmt.Errorf("Broker rejected the credentials")
+	default:
+		return fmt.Errorf("Broker refused the connection (code %d)", body[1])
+	}
+}
+
+// mqttString encodes a string with its length prefix.
+func mqttString(value string) []byte {
+	encoded := make([]byte, 2, 2+len(value))
+	binary.BigEndian.PutUint16(encoded, uint16(len(value)))
+	return append(encoded, value...)
+}
+
+func (client *mqttClient) writePacket(header byte, body []byte) error {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		digit := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if length == 0 {
+			break
+		}
+	}
+	packet = append(packet, body...)
+
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	_, err := client.conn.Write(packet)
+	return err
+}
+
+func (client *mqttClient) readPacket() (byte, []byte, error) {
+	header, err := client.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		digit, err := client.reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(digit&0x7f) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, errors.New("Invalid packet length")
+		}
+	}
+	if length > mqttMaxPacketSize {
+		return 0, nil, fmt.Errorf("Packet of %d bytes exceeds the maximum size of %d bytes", length, mqttMaxPacketSize)
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(client.reader, body)
+	return header >> 4, body, err
+}
+
+// subscribe asks the broker to send all messages of the given topic.
+func (client *mqttClient) subscribe(topic string) error {
+	client.packetID++
+	body := []byte{byte(client.packetID >> 8), byte(client.packetID)}
+	body = append(body, mqttString(topic)...)
+	body = append(body, 0) // QoS 0
+	return client.writePacket(mqttSubscribe<<4|0x02, body)
+}
+
+// publish sends the payload to the given topic. Retained messages are
+// delivered to clients subscribing later on.
+func (client *mqttClient) publish(topic string, payload []byte, retain bool) error {
+	header := byte(mqttPublish << 4)
+	if retain {
+		header |= 0x01
+	}
+	return client.writePacket(header, append(mqttString(topic), payload...))
+}
+
+// receive passes every published message to the handler until the
+// connection is lost.
+func (client *mqttClient) receive(handler func(mqttMessage)) error {
+	for {
+		client.conn.SetReadDeadline(time.Now().Add(mqttKeepAlive * 3 / 2))
+		packetType, body, err := client.readPacket()
+		if err != nil {
+			return err
+		}
+		if packetType != mqttPublish {
+			continue // acknowledgements and ping responses
+		}
+		if len(body) < 2 {
+			return errors.New("Invalid message")
+		}
+		length := int(binary.BigEndian.Uint16(body))
+		if len(body) < 2+length {
+			return errors.New("Invalid message")
+		}
+		handler(mqttMessage{string(body[2 : 2+length]), body[2+length:]})
+	}
+}
+
+// keepAlive pings the broker until the client is closed.
+func (client *mqttClient) keepAlive() {
+	ticker := time.NewTicker(mqttKeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if client.writePacket(mqttPingreq<<4, nil) != nil {
+				return
+			}
+		case <-client.closed:
+			return
+		}
+	}
+}
+
+func (client *mqttClient) close() {
+	client.writePacket(mqttDisconnect<<4, nil)
+	close(client.closed)
+	client.conn.Close()
+}
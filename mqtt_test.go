@@ -0,0 +1,108 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMQTTClient(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan []byte, 2)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		broker := &mqttClient{conn: conn, reader: bufio.NewReader(conn)}
+		for {
+			packetType, body, err := broker.readPacket()
+			if err != nil {
+				return
+			}
+			received <- append([]byte{packetType}, body...)
+			switch packetType {
+			case mqttConnect:
+				broker.writePacket(mqttConnack<<4, []byte{0, 0})
+			case mqttSubscribe:
+				broker.publish("home/presence", []byte("home"), false)
+			}
+		}
+	}()
+
+	if address, secure := mqttAddress("ssl://broker.example.com"); address != "broker.example.com:8883" || !secure {
+		t.Errorf("Unexpected address %s (%v)", address, secure)
+	}
+	client, err := dialMQTT("tcp://"+listener.Addr().String(), "kelvin", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.close()
+	if connect := <-received; !strings.Contains(string(connect), "kelvin") || !strings.Contains(string(connect), "secret") || connect[8]&0xc0 != 0xc0 {
+		t.Errorf("Credentials should be sent on connect: %q", connect)
+	}
+
+	err = client.subscribe("home/presence")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subscribe := <-received; subscribe[0] != mqttSubscribe || !strings.Contains(string(subscribe), "home/presence") {
+		t.Errorf("Unexpected subscription: %q", subscribe)
+	}
+	messages := make(chan mqttMessage, 1)
+	go client.receive(func(message mqttMessage) { messages <- message })
+	select {
+	case message := <-messages:
+		if message.Topic != "home/presence" || string(message.Payload) != "home" {
+			t.Errorf("Unexpected message %+v", message)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("Published message wasn't received")
+	}
+}
+
+func TestMQTTPacketSize(t *testing.T) {
+	packet := func(length ...byte) *mqttClient {
+		data := append([]byte{mqttPublish << 4}, length...)
+		return &mqttClient{reader: bufio.NewReader(bytes.NewReader(append(data, make([]byte, mqttMaxPacketSize)...)))}
+	}
+	// 65536 bytes are accepted, 65537 bytes and more are rejected
+	if _, body, err := packet(0x80, 0x80, 0x04).readPacket(); err != nil || len(body) != mqttMaxPacketSize {
+		t.Errorf("Packets up to the maximum size should be read: %v", err)
+	}
+	if _, _, err := packet(0x81, 0x80, 0x04).readPacket(); err == nil {
+		t.Errorf("Packets exceeding the maximum size should be rejected")
+	}
+	if _, _, err := packet(0xff, 0xff, 0xff, 0x7f).readPacket(); err == nil {
+		t.Errorf("Packets of 256 MB should be rejected")
+	}
+}
@@ -0,0 +1,333 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultMQTTTopic = "kelvin"
+
+// mqttQueueSize limits the messages waiting for a slow broker. The main
+// loop never waits for the broker, retained states are sent again after a
+// reconnect anyway.
+const mqttQueueSize = 256
+
+// MQTT configures the broker Kelvin publishes the state of all lights to
+// and receives commands from.
+type MQTT struct {
+	Broker   string `json:"broker"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Topic    string `json:"topic,omitempty"`
+}
+
+func (configuration *MQTT) topic() string {
+	if configuration.Topic == "" {
+		return defaultMQTTTopic
+	}
+	return strings.TrimSuffix(configuration.Topic, "/")
+}
+
+// mqttLightState is published to <topic>/lights/<id>/state whenever the
+// target of a light, its override or its schedule change.
+type mqttLightState struct {
+	Name      string     `json:"name"`
+	Schedule  string     `json:"schedule,omitempty"`
+	Reachable bool       `json:"reachable"`
+	On        bool       `json:"on"`
+	Automatic bool       `json:"automatic"`
+	Target    LightState `json:"target"`
+	Override  *Override  `json:"override,omitempty"`
+	Sunrise   *time.Time `json:"sunrise,omitempty"`
+	Sunset    *time.Time `json:"sunset,omitempty"`
+}
+
+// mqttCommand is accepted on <topic>/lights/<id>/set and
+// <topic>/schedules/<name>/set. A plain payload like `resume` is short for
+// {"command": "resume"}.
+type mqttCommand struct {
+	Command          string `json:"command"`
+	ColorTemperature int    `json:"colorTemperature"`
+	Brightness       int    `json:"brightness"`
+	Duration         string `json:"duration,omitempty"`
+}
+
+const (
+	mqttCommandPause    = "pause"
+	mqttCommandOverride = "override"
+	mqttCommandResume   = "resume"
+)
+
+// mqttPublisher keeps the broker up to date with the lights. The last
+// payload of every topic is remembered, so unchanged states aren't sent
+// again and a new connection starts with the complete state.
+type mqttPublisher struct {
+	configuration *MQTT
+	retained      map[string][]byte
+	messages      chan mqttMessage
+	lock          sync.Mutex
+}
+
+// statePublisher is nil unless a broker is configured.
+var statePublisher *mqttPublisher
+
+func startMQTT(configuration *MQTT) {
+	if configuration == nil || configuration.Broker == "" {
+		return
+	}
+	statePublisher = &mqttPublisher{configuration: configuration, retained: make(map[string][]byte), messages: make(chan mqttMessage, mqttQueueSize)}
+	log.Printf("🤖 Publishing light states to %s/lights on %s", configuration.topic(), configuration.Broker)
+	go supervise("MQTT publisher", statePublisher.run)
+}
+
+func (publisher *mqttPublisher) run() {
+	for {
+		err := publisher.connect()
+		log.Warningf("🤖 MQTT broker %s disconnected: %v. Reconnecting in %v...", publisher.configuration.Broker, err, mqttReconnectDelay)
+		time.Sleep(mqttReconnectDelay)
+	}
+}
+
+// connect sends all retained states and handles commands until the
+// connection is lost.
+func (publisher *mqttPublisher) connect() error {
+	client, err := dialMQTT(publisher.configuration.Broker, publisher.configuration.Username, publisher.configuration.Password)
+	if err != nil {
+		return err
+	}
+	defer client.close()
+	topic := publisher.configuration.topic()
+	for _, filter := range []string{topic + "/lights/#", topic + "/schedules/+/set"} {
+		err = client.subscribe(filter)
+		if err != nil {
+			return err
+		}
+	}
+	log.Debugf("🤖 Connected to MQTT broker %s", publisher.configuration.Broker)
+
+	publisher.lock.Lock()
+	for topic, payload := range publisher.retained {
+		err = client.publish(topic, payload, true)
+		if err != nil {
+			break
+		}
+	}
+	publisher.lock.Unlock()
+	if err != nil {
+		return err
+	}
+
+	sending := make(chan error, 1)
+	go func() {
+		for {
+			select {
+			case message := <-publisher.messages:
+				if err := client.publish(message.Topic, message.Payload, true); err != nil {
+					sending <- err
+					return
+				}
+			case <-client.closed:
+				return
+			}
+		}
+	}()
+	received := make(chan error, 1)
+	go func() {
+		received <- client.receive(func(message mqttMessage) {
+			inMainLoop(func() {
+				safely("MQTT command "+message.Topic, func() { publisher.handle(message, time.Now()) })
+			})
+		})
+	}()
+	select {
+	case err = <-sending:
+	case err = <-received:
+	}
+	return err
+}
+
+// publish queues the payload for the given topic unless it was sent
+// already.
+func (publisher *mqttPublisher) publish(topic string, payload []byte) {
+	if publisher == nil {
+		return
+	}
+	publisher.lock.Lock()
+	changed := string(publisher.retained[topic]) != string(payload)
+	publisher.retained[topic] = payload
+	publisher.lock.Unlock()
+	if !changed {
+		return
+	}
+	select {
+	case publisher.messages <- mqttMessage{topic, payload}:
+	default:
+		// The broker is too slow or unreachable, the next connection
+		// sends the retained state
+	}
+}
+
+// publishLights publishes the state of all given lights.
+func (publisher *mqttPublisher) publishLights(lights []*Light) {
+	if publisher == nil {
+		return
+	}
+	now := time.Now()
+	for _, light := range lights {
+		payload, err := json.Marshal(light.mqttState(now))
+		if err != nil {
+			continue
+		}
+		publisher.publish(publisher.lightTopic(light, "state"), payload)
+	}
+}
+
+// lightTopic returns the topic of a light. Lights of additional bridges
+// are prefixed with the name of their bridge.
+func (publisher *mqttPublisher) lightTopic(light *Light, suffix string) string {
+	id := strconv.Itoa(light.ID)
+	if light.Bridge != "" {
+		id = light.Bridge + "/" + id
+	}
+	return fmt.Sprintf("%s/lights/%s/%s", publisher.configuration.topic(), id, suffix)
+}
+
+func (light *Light) mqttState(now time.Time) mqttLightState {
+	state := mqttLightState{Name: light.Name, Reachable: light.Reachable, On: light.On, Automatic: light.Automatic, Target: light.TargetLightState}
+	if light.Scheduled {
+		state.Schedule = light.Schedule.name
+		if !light.Schedule.sunrise.Time.IsZero() {
+			sunrise, sunset := light.Schedule.sunrise.Time, light.Schedule.sunset.Time
+			state.Sunrise, state.Sunset = &sunrise, &sunset
+		}
+	}
+	if light.overridden(now) {
+		override := light.activeOverride
+		state.Override = &override
+	}
+	return state
+}
+
+func parseMQTTCommand(payload []byte) (mqttCommand, error) {
+	var command mqttCommand
+	trimmed := strings.TrimSpace(string(payload))
+	if !strings.HasPrefix(trimmed, "{") {
+		command.Command = trimmed
+		return command, nil
+	}
+	err := json.Unmarshal([]byte(trimmed), &command)
+	return command, err
+}
+
+// handle executes a command received on one of the set topics. States
+// published by Kelvin itself are ignored. It must be called in the main
+// loop.
+func (publisher *mqttPublisher) handle(message mqttMessage, now time.Time) {
+	prefix := publisher.configuration.topic() + "/"
+	if !strings.HasPrefix(message.Topic, prefix) || !strings.HasSuffix(message.Topic, "/set") {
+		return
+	}
+	path := strings.TrimSuffix(strings.TrimPrefix(message.Topic, prefix), "/set")
+	command, err := parseMQTTCommand(message.Payload)
+	if err == nil {
+		switch {
+		case strings.HasPrefix(path, "lights/"):
+			err = publisher.handleLightCommand(strings.TrimPrefix(path, "lights/"), command, now)
+		case strings.HasPrefix(path, "schedules/"):
+			err = handleScheduleCommand(strings.TrimPrefix(path, "schedules/"), command, now)
+		}
+	}
+	if err != nil {
+		log.Warningf("🤖 Ignoring MQTT command on %s: %v", message.Topic, err)
+		return
+	}
+	publisher.publishLights(lights)
+}
+
+func (publisher *mqttPublisher) handleLightCommand(id string, command mqttCommand, now time.Time) error {
+	bridge := ""
+	if parts := strings.SplitN(id, "/", 2); len(parts) == 2 {
+		bridge, id = parts[0], parts[1]
+	}
+	number, err := strconv.Atoi(id)
+	if err != nil {
+		return fmt.Errorf("Invalid light ID %s", id)
+	}
+	light := findLight(bridge, number)
+	if light == nil {
+		return fmt.Errorf("Light %s not found", id)
+	}
+	duration, err := parsePositiveDuration(command.Duration, defaultManualOverrideDuration)
+	if err != nil {
+		return err
+	}
+
+	switch command.Command {
+	case mqttCommandPause:
+		scheduleLog.Printf("💡 Light %s - Pausing for %v as requested via MQTT", light.Name, duration)
+		light.override(Override{Until: now.Add(duration), Reason: overrideReasonPause})
+		return nil
+	case mqttCommandOverride:
+		state := LightState{command.ColorTemperature, command.Brightness}
+		if !state.isValid() {
+			return errors.New("Invalid light state")
+		}
+		scheduleLog.Printf("💡 Light %s - Activating light state %+v for %v as requested via MQTT", light.Name, state, duration)
+		return light.overrideState(state, now.Add(duration))
+	case mqttCommandResume:
+		scheduleLog.Printf("💡 Light %s - Ending override as requested via MQTT", light.Name)
+		light.endOverride(now)
+		return nil
+	}
+	return fmt.Errorf("Unknown command %q (must be one of %s, %s or %s)", command.Command, mqttCommandPause, mqttCommandOverride, mqttCommandResume)
+}
+
+func handleScheduleCommand(name string, command mqttCommand, now time.Time) error {
+	if scheduleIndex(name) == -1 {
+		return fmt.Errorf("Schedule %s not found", name)
+	}
+	switch command.Command {
+	case mqttCommandPause:
+		duration, err := parsePositiveDuration(command.Duration, defaultManualOverrideDuration)
+		if err != nil {
+			return err
+		}
+		until := now.Add(duration)
+		log.Printf("🤖 Pausing schedule %s for %v as requested via MQTT", name, duration)
+		pauseScheduleUntil(name, until, now)
+		return nil
+	case mqttCommandResume:
+		log.Printf("🤖 Resuming schedule %s as requested via MQTT", name)
+		resumePausedSchedule(name, now)
+		return nil
+	}
+	return fmt.Errorf("Unknown command %q (must be %s or %s)", command.Command, mqttCommandPause, mqttCommandResume)
+}
@@ -0,0 +1,69 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestMQTTState(t *testing.T) {
+	light := &Light{ID: 3, Name: "Desk", Reachable: true, On: true, Scheduled: true, TargetLightState: LightState{2700, 80}}
+	light.Schedule.name = "Office"
+	useLights(t, light)
+
+	publisher := &mqttPublisher{configuration: &MQTT{Broker: "tcp://localhost"}, retained: make(map[string][]byte), messages: make(chan mqttMessage, 4)}
+	publisher.publishLights(lights)
+	publisher.publishLights(lights)
+	if len(publisher.messages) != 1 {
+		t.Fatalf("Unchanged states should be published once, got %d messages", len(publisher.messages))
+	}
+	message := <-publisher.messages
+	var state mqttLightState
+	if err := json.Unmarshal(message.Payload, &state); err != nil || message.Topic != "kelvin/lights/3/state" || state.Schedule != "Office" || state.Target.ColorTemperature != 2700 || state.Override != nil {
+		t.Errorf("Unexpected state %s on %s (%v)", message.Payload, message.Topic, err)
+	}
+
+	now := time.Now()
+	publisher.handle(mqttMessage{"kelvin/lights/3/state", []byte("pause")}, now)
+	if light.overridden(now) {
+		t.Errorf("States published by Kelvin must not be handled as commands")
+	}
+	publisher.handle(mqttMessage{"kelvin/lights/3/set", []byte(`{"command": "pause", "duration": "1h"}`)}, now)
+	if !light.overridden(now) || light.activeOverride.Reason != overrideReasonPause || !light.activeOverride.Until.Equal(now.Add(time.Hour)) {
+		t.Errorf("Light should be paused for an hour, got %+v", light.activeOverride)
+	}
+	message = <-publisher.messages
+	if err := json.Unmarshal(message.Payload, &state); err != nil || state.Override == nil || state.Override.Reason != overrideReasonPause {
+		t.Errorf("Override should be published, got %s (%v)", message.Payload, err)
+	}
+	publisher.handle(mqttMessage{"kelvin/lights/3/set", []byte("dim")}, now)
+	publisher.handle(mqttMessage{"kelvin/lights/4/set", []byte("resume")}, now)
+	if !light.overridden(now) {
+		t.Errorf("Invalid commands should be ignored")
+	}
+	publisher.handle(mqttMessage{"kelvin/lights/3/set", []byte("resume")}, now)
+	if light.overridden(now) {
+		t.Errorf("Override should end on resume")
+	}
+}
@@ -0,0 +1,278 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// Nanoleaf controllers serve their OpenAPI on this port.
+// See https://forum.nanoleaf.me/docs/openapi
+const nanoleafPort = 16021
+
+var errNanoleafNotPairing = errors.New("Controller is not in pairing mode. Hold the power button for 5-7 seconds until the LED flashes")
+
+type nanoleafOn struct {
+	Value bool `json:"value"`
+}
+
+type nanoleafValue struct {
+	Value    int  `json:"value"`
+	Min      int  `json:"min,omitempty"`
+	Max      int  `json:"max,omitempty"`
+	Duration *int `json:"duration,omitempty"`
+}
+
+// nanoleafState represents the state resource of the Nanoleaf OpenAPI.
+type nanoleafState struct {
+	On               *nanoleafOn    `json:"on,omitempty"`
+	Brightness       *nanoleafValue `json:"brightness,omitempty"`
+	ColorTemperature *nanoleafValue `json:"ct,omitempty"`
+	ColorMode        string         `json:"colorMode,omitempty"`
+}
+
+func init() {
+	registerLightProvider("nanoleaf", &nanoleafProvider{backends: make(map[string]*nanoleafBackend)})
+}
+
+// nanoleafProvider controls the paired Nanoleaf controllers of all
+// schedules.
+type nanoleafProvider struct {
+	backends map[string]*nanoleafBackend
+}
+
+// Discover returns the Nanoleaf controllers of all schedules. Controllers
+// without a token are ignored until they are paired.
+func (provider *nanoleafProvider) Discover(configuration *Configuration) ([]ProviderLight, error) {
+	var lights []ProviderLight
+	for _, lightSchedule := range configuration.Schedules {
+		for _, host := range lightSchedule.Nanoleaf {
+			token := configuration.NanoleafTokens[host]
+			if token == "" {
+				continue
+			}
+			if backend, found := provider.backends[host]; !found || backend.token != token {
+				provider.backends[host] = &nanoleafBackend{host: host, token: token}
+			}
+			lights = append(lights, ProviderLight{Provider: "nanoleaf", ID: host, Name: "Nanoleaf " + host, Schedule: lightSchedule.Name})
+		}
+	}
+	return lights, nil
+}
+
+func (provider *nanoleafProvider) GetState(light ProviderLight) (ProviderState, error) {
+	backend, found := provider.backends[light.ID]
+	if !found {
+		return ProviderState{}, fmt.Errorf("Unknown Nanoleaf controller %s", light.ID)
+	}
+	on, unchanged, err := backend.readState()
+	if err != nil {
+		return ProviderState{}, err
+	}
+	if !on {
+		backend.sent = nil
+	}
+	return ProviderState{Reachable: true, On: on, Changed: !unchanged}, nil
+}
+
+func (provider *nanoleafProvider) SetState(light ProviderLight, state LightState, transitionTime time.Duration) (bool, error) {
+	backend, found := provider.backends[light.ID]
+	if !found {
+		return false, fmt.Errorf("Unknown Nanoleaf controller %s", light.ID)
+	}
+	return backend.setState(state, transitionTime)
+}
+
+// Subscribe returns false as Nanoleaf controllers are polled.
+func (provider *nanoleafProvider) Subscribe(events chan<- ProviderLight) bool {
+	return false
+}
+
+// nanoleafBackend controls Nanoleaf panels via their local OpenAPI.
+type nanoleafBackend struct {
+	host                    string
+	token                   string
+	minimumColorTemperature int
+	maximumColorTemperature int
+	sent                    *nanoleafState
+}
+
+func nanoleafURL(host string, path string) string {
+	return fmt.Sprintf("http://%s:%d/api/v1/%s", host, nanoleafPort, path)
+}
+
+func (backend *nanoleafBackend) request(method string, request interface{}, result interface{}) error {
+	body := bytes.NewReader(nil)
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	httpRequest, err := http.NewRequest(method, nanoleafURL(backend.host, backend.token+"/state"), body)
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	response, err := localDeviceClient.Do(httpRequest)
+	if response != nil {
+		defer response.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if response.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("Controller rejected the token. Pair again with kelvin pair -nanoleaf %s", backend.host)
+	}
+	if response.StatusCode != http.StatusOK && response.StatusCode != http.StatusNoContent {
+		return fmt.Errorf("Nanoleaf returned HTTP %d", response.StatusCode)
+	}
+	if result == nil {
+		return nil
+	}
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+func (backend *nanoleafBackend) readState() (bool, bool, error) {
+	var current nanoleafState
+	err := backend.request("GET", nil, &current)
+	if err != nil {
+		return false, false, err
+	}
+	if current.ColorTemperature != nil {
+		backend.minimumColorTemperature = current.ColorTemperature.Min
+		backend.maximumColorTemperature = current.ColorTemperature.Max
+	}
+	on := current.On != nil && current.On.Value
+	return on, backend.sent == nil || current.matches(*backend.sent), nil
+}
+
+func (backend *nanoleafBackend) setState(target LightState, transitionTime time.Duration) (bool, error) {
+	state := backend.stateFor(target, transitionTime)
+	if backend.sent != nil && reflect.DeepEqual(state, *backend.sent) {
+		return false, nil
+	}
+	err := backend.request("PUT", state, nil)
+	if err != nil {
+		return false, err
+	}
+	backend.sent = &state
+	return true, nil
+}
+
+// stateFor converts the given light state for the panels. The color
+// temperature is limited to the range reported by the controller.
+func (backend *nanoleafBackend) stateFor(target LightState, transitionTime time.Duration) nanoleafState {
+	var state nanoleafState
+	if target.Brightness == 0 {
+		state.On = &nanoleafOn{false}
+	} else if target.Brightness != -1 {
+		// The transition is given in seconds
+		duration := int(math.Round(transitionTime.Seconds()))
+		state.Brightness = &nanoleafValue{Value: target.Brightness, Duration: &duration}
+	}
+
+	if target.ColorTemperature != -1 {
+		ct := target.ColorTemperature
+		if backend.minimumColorTemperature > 0 && ct < backend.minimumColorTemperature {
+			ct = backend.minimumColorTemperature
+		}
+		if backend.maximumColorTemperature > 0 && ct > backend.maximumColorTemperature {
+			ct = backend.maximumColorTemperature
+		}
+		state.ColorTemperature = &nanoleafValue{Value: ct}
+	}
+	return state
+}
+
+// matches returns true if the current state still shows the sent state.
+func (state nanoleafState) matches(sent nanoleafState) bool {
+	if sent.Brightness != nil && (state.Brightness == nil || state.Brightness.Value != sent.Brightness.Value) {
+		return false
+	}
+	if sent.ColorTemperature != nil {
+		// Effects and colors set in the app switch the color mode
+		if state.ColorMode != "ct" || state.ColorTemperature == nil || state.ColorTemperature.Value != sent.ColorTemperature.Value {
+			return false
+		}
+	}
+	return true
+}
+
+// pairNanoleaf requests a new token from the controller at the given host
+// until the user enables the pairing mode or the timeout has passed.
+func pairNanoleaf(host string, timeout time.Duration) (string, error) {
+	deadline := time.Now().Add(timeout)
+	for {
+		token, err := requestNanoleafToken(host)
+		if err == nil {
+			return token, nil
+		}
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("Pairing with Nanoleaf controller %s failed: %v", host, err)
+		}
+		time.Sleep(pairingRetryInterval)
+	}
+}
+
+func requestNanoleafToken(host string) (string, error) {
+	response, err := localDeviceClient.Post(nanoleafURL(host, "new"), "application/json", nil)
+	if response != nil {
+		defer response.Body.Close()
+	}
+	if err != nil {
+		return "", err
+	}
+	if response.StatusCode == http.StatusForbidden {
+		return "", errNanoleafNotPairing
+	}
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Nanoleaf returned HTTP %d", response.StatusCode)
+	}
+
+	var result struct {
+		Token string `json:"auth_token"`
+	}
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return "", err
+	}
+	if result.Token == "" {
+		return "", errors.New("Nanoleaf returned an empty token")
+	}
+	return result.Token, nil
+}
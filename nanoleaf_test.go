@@ -0,0 +1,54 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNanoleaf(t *testing.T) {
+	backend := &nanoleafBackend{host: "nanoleaf.local", token: "secret", minimumColorTemperature: 1200, maximumColorTemperature: 6500}
+	state := backend.stateFor(LightState{ColorTemperature: 7000, Brightness: 60}, 2*time.Second)
+	if state.On != nil || state.Brightness.Value != 60 || *state.Brightness.Duration != 2 || state.ColorTemperature.Value != 6500 {
+		t.Errorf("Unexpected state %+v", state)
+	}
+	if off := backend.stateFor(LightState{ColorTemperature: -1, Brightness: 0}, 0); off.On == nil || off.On.Value || off.ColorTemperature != nil {
+		t.Errorf("Brightness 0 should turn the panels off, got %+v", off)
+	}
+
+	current := nanoleafState{On: &nanoleafOn{true}, Brightness: &nanoleafValue{Value: 60}, ColorTemperature: &nanoleafValue{Value: 6500}, ColorMode: "ct"}
+	if !current.matches(state) {
+		t.Errorf("Panels should match the sent state")
+	}
+	current.ColorMode = "effect"
+	if current.matches(state) {
+		t.Errorf("Effects should be detected as manual change")
+	}
+
+	c := Configuration{NanoleafTokens: map[string]string{"nanoleaf.local": "secret"}, Schedules: []LightSchedule{{Name: "office", Nanoleaf: []string{"nanoleaf.local", "unpaired.local"}}}}
+	provider := &nanoleafProvider{backends: make(map[string]*nanoleafBackend)}
+	discovered, _ := provider.Discover(&c)
+	if len(discovered) != 1 || discovered[0].ID != "nanoleaf.local" || provider.backends["nanoleaf.local"].token != "secret" {
+		t.Errorf("Expected only the paired controller, got %+v", discovered)
+	}
+}
@@ -0,0 +1,119 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultNightlightColorTemperature = 2000
+const defaultNightlightBrightness = 5
+
+// nightlight is the parsed version of a configured Nightlight. Start and
+// end are given as offsets from midnight.
+type nightlight struct {
+	start time.Duration
+	end   time.Duration
+	state LightState
+}
+
+// parseClockTime parses a time of day in the format hh:mm and returns it as
+// offset from midnight.
+func parseClockTime(value string) (time.Duration, error) {
+	t, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid time %q (expected hh:mm)", value)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+// parse validates the configured nightlight and fills in the defaults.
+func (configured *Nightlight) parse() (*nightlight, error) {
+	start, err := parseClockTime(configured.Start)
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseClockTime(configured.End)
+	if err != nil {
+		return nil, err
+	}
+	if start == end {
+		return nil, fmt.Errorf("Start and end of the nightlight must differ")
+	}
+	state := LightState{configured.ColorTemperature, configured.Brightness}
+	if state.ColorTemperature == 0 {
+		state.ColorTemperature = defaultNightlightColorTemperature
+	}
+	if state.Brightness == 0 {
+		state.Brightness = defaultNightlightBrightness
+	}
+	return &nightlight{start, end, state}, nil
+}
+
+// activeUntil returns the end of the nightlight if it is active at the given
+// time. Nightlights may span midnight.
+func (n *nightlight) activeUntil(now time.Time) (time.Time, bool) {
+	if n == nil {
+		return time.Time{}, false
+	}
+	clock := func(offset time.Duration, days int) time.Time {
+		return atClockTime(now, days, offset)
+	}
+
+	if n.start < n.end {
+		if !now.Before(clock(n.start, 0)) && now.Before(clock(n.end, 0)) {
+			return clock(n.end, 0), true
+		}
+		return time.Time{}, false
+	}
+	if now.Before(clock(n.end, 0)) {
+		return clock(n.end, 0), true
+	}
+	if !now.Before(clock(n.start, 0)) {
+		return clock(n.end, 1), true
+	}
+	return time.Time{}, false
+}
+
+// applyNightlight dims a light which was turned on during the nightlight
+// and leaves it alone until the nightlight ends. It returns false if the
+// nightlight isn't active.
+func (light *Light) applyNightlight(now time.Time, transitionTime time.Duration) (bool, error) {
+	until, active := light.Schedule.nightlight.activeUntil(now)
+	if !active || (light.overridden(now) && light.activeOverride.Reason != overrideReasonNightlight) {
+		return false, nil
+	}
+
+	state := light.adaptToCapabilities(light.Schedule.nightlight.state)
+	scheduleLog.Printf("💡 Light %s - Nightlight is active. Setting light to %vK at %v%% brightness until %v...", light.Name, state.ColorTemperature, state.Brightness, until.Format("15:04"))
+	err := light.HueLight.setLightState(state.ColorTemperature, state.Brightness, transitionTime)
+	if err != nil {
+		// Try again with the next update
+		light.Tracking = false
+		return true, err
+	}
+	light.Automatic = false
+	light.snapshot = nil
+	light.override(Override{Until: until, Reason: overrideReasonNightlight})
+	return true, nil
+}
@@ -0,0 +1,76 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNightlight(t *testing.T) {
+	night, err := (&Nightlight{Start: "23:00", End: "06:00"}).parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if night.state != (LightState{defaultNightlightColorTemperature, defaultNightlightBrightness}) {
+		t.Errorf("Nightlight should use the default light state, got %+v", night.state)
+	}
+	evening, err := (&Nightlight{Start: "19:00", End: "21:30", ColorTemperature: 2200, Brightness: 10}).parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		nightlight *nightlight
+		now        time.Time
+		until      time.Time
+		active     bool
+	}{
+		{night, day.Add(23 * time.Hour), day.Add(30 * time.Hour), true},
+		{night, day.Add(2 * time.Hour), day.Add(6 * time.Hour), true},
+		{night, day.Add(6 * time.Hour), time.Time{}, false},
+		{night, day.Add(12 * time.Hour), time.Time{}, false},
+		{evening, day.Add(20 * time.Hour), day.Add(21*time.Hour + 30*time.Minute), true},
+		{evening, day.Add(22 * time.Hour), time.Time{}, false},
+		{nil, day.Add(23 * time.Hour), time.Time{}, false},
+	}
+	for _, test := range tests {
+		until, active := test.nightlight.activeUntil(test.now)
+		if active != test.active || !until.Equal(test.until) {
+			t.Errorf("Nightlight at %v: expected %v until %v, got %v until %v", test.now.Format("15:04"), test.active, test.until, active, until)
+		}
+	}
+
+	for _, invalid := range []Nightlight{{Start: "23:00"}, {Start: "25:00", End: "06:00"}, {Start: "06:00", End: "06:00"}} {
+		if _, err := invalid.parse(); err == nil {
+			t.Errorf("Nightlight %+v should be invalid", invalid)
+		}
+	}
+
+	// Lights overridden for another reason are left alone
+	light := &Light{Name: "Hallway", Schedule: Schedule{nightlight: &nightlight{start: 0, end: 24*time.Hour - time.Minute, state: LightState{2000, 5}}}}
+	light.override(Override{Until: time.Now().Add(time.Hour), Reason: overrideReasonScene})
+	if applied, _ := light.applyNightlight(time.Now(), 0); applied {
+		t.Errorf("Nightlight should not replace an active scene")
+	}
+}
@@ -0,0 +1,268 @@
+// MIT License
+//
+// Copyright (c) 2018 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"net/http"
+)
+
+func reference(name string) schema {
+	return schema{"$ref": "#/components/schemas/" + name}
+}
+
+func jsonContent(content schema) schema {
+	return schema{"application/json": schema{"schema": content}}
+}
+
+func jsonResponse(description string, content schema) schema {
+	return schema{"description": description, "content": jsonContent(content)}
+}
+
+func textResponse(description string) schema {
+	return schema{"description": description, "content": schema{"text/plain": schema{"schema": schema{"type": "string"}}}}
+}
+
+func jsonBody(content schema) schema {
+	return schema{"required": true, "content": jsonContent(content)}
+}
+
+func parameter(name string, in string, description string) schema {
+	return schema{"name": name, "in": in, "required": in == "path", "description": description, "schema": schema{"type": "string"}}
+}
+
+func operation(summary string, parameters []schema, body schema, responses schema) schema {
+	result := schema{"summary": summary, "responses": responses}
+	if len(parameters) > 0 {
+		result["parameters"] = parameters
+	}
+	if body != nil {
+		result["requestBody"] = body
+	}
+	return result
+}
+
+func lightStateSchema(description string) schema {
+	return objectSchema(description, schema{
+		"colorTemperature": colorTemperatureSchema("Color temperature in Kelvin or -1 if unknown or ignored."),
+		"brightness":       brightnessSchema("Brightness in percent or -1 if unknown or ignored."),
+	})
+}
+
+// OpenAPISpecification describes all endpoints of the web interface.
+func OpenAPISpecification() schema {
+	configurationSchema := ConfigurationSchema()
+	delete(configurationSchema, "$schema")
+	lightScheduleSchema := configurationSchema["properties"].(schema)["schedules"].(schema)["items"].(schema)
+
+	scheduleName := parameter("name", "path", "Name of the schedule.")
+	lightID := parameter("id", "path", "ID of the light.")
+	bridgeName := parameter("bridge", "query", "Name of the bridge of the light. Empty for the default bridge.")
+	date := parameter("date", "query", "Day to calculate (YYYY-MM-DD). Defaults to today.")
+	invalid := jsonResponse("The change was rejected.", reference("ValidationReport"))
+	notFound := textResponse("Not found.")
+
+	paths := schema{
+		"/healthz": schema{"get": operation("Check that Kelvin is running", nil, nil, schema{"200": textResponse("Kelvin is running.")})},
+		"/readyz": schema{"get": operation("Check that Kelvin is able to control the lights", nil, nil, schema{
+			"200": textResponse("Kelvin is ready."),
+			"503": textResponse("The reasons why Kelvin is not ready."),
+		})},
+		"/api/schema":       schema{"get": operation("Get the JSON schema of the configuration", nil, nil, schema{"200": schema{"description": "JSON schema of the configuration.", "content": schema{"application/schema+json": schema{"schema": schema{"type": "object"}}}}})},
+		"/api/openapi.json": schema{"get": operation("Get this specification", nil, nil, schema{"200": jsonResponse("OpenAPI specification.", schema{"type": "object"})})},
+		"/api/config": schema{
+			"get": operation("Export the configuration with all credentials redacted", nil, nil, schema{"200": jsonResponse("The configuration.", reference("Configuration"))}),
+			"put": operation("Validate, back up and apply a new configuration", nil, jsonBody(reference("Configuration")), schema{
+				"200": jsonResponse("The configuration was applied.", reference("ConfigurationImport")),
+				"400": jsonResponse("The configuration was rejected.", reference("ConfigurationImport")),
+			}),
+		},
+		"/api/bridges": schema{"get": operation("Get the availability of all bridges", nil, nil, schema{"200": jsonResponse("All bridges.", arraySchema("", reference("BridgeStatus")))})},
+		"/api/lights":  schema{"get": operation("Get the target and current state of all lights", nil, nil, schema{"200": jsonResponse("All lights.", arraySchema("", reference("LightStatus")))})},
+		"/api/lights/{id}/override": schema{
+			"put": operation("Set a light state and pause Kelvin for the light", []schema{lightID, bridgeName}, jsonBody(reference("LightOverride")), schema{
+				"200": jsonResponse("The light is overridden.", reference("LightStatus")),
+				"400": textResponse("Invalid light state or duration."),
+				"404": notFound,
+			}),
+			"delete": operation("Hand the light back to Kelvin", []schema{lightID, bridgeName}, nil, schema{
+				"200": jsonResponse("The override has ended.", reference("LightStatus")),
+				"404": notFound,
+			}),
+		},
+		"/api/away": schema{
+			"get": operation("Get the away mode", nil, nil, schema{"200": jsonResponse("The current away mode.", reference("Away"))}),
+			"post": operation("Tell Kelvin whether the house is empty", nil, jsonBody(reference("Away")), schema{
+				"200": jsonResponse("The away mode was switched.", reference("Away")),
+				"400": textResponse("Invalid away mode."),
+			}),
+		},
+		"/api/awaysimulation":       schema{"get": operation("Get the state of the away simulation", nil, nil, schema{"200": jsonResponse("The state of the simulation.", reference("AwaySimulation"))})},
+		"/api/awaysimulation/start": schema{"post": operation("Simulate presence by turning lights on and off in the evening", nil, nil, schema{"200": jsonResponse("The simulation is active.", reference("AwaySimulation"))})},
+		"/api/awaysimulation/stop":  schema{"post": operation("Stop the away simulation and turn its lights off", nil, nil, schema{"200": jsonResponse("The simulation is stopped.", reference("AwaySimulation"))})},
+		"/api/scenes":               schema{"get": operation("Get the scenes of all bridges", nil, nil, schema{"200": jsonResponse("All scenes.", arraySchema("", reference("Scene")))})},
+		"/api/scenes/{name}/activate": schema{"post": operation("Activate a scene for a while and return to the schedule afterwards", []schema{parameter("name", "path", "Name of the scene."), parameter("bridge", "query", "Name of the bridge of the scene. Empty for the default bridge."), parameter("duration", "query", "Duration of the scene, e.g. 45m (default 30m).")}, nil, schema{
+			"200": jsonResponse("The scene is active.", reference("SceneOverride")),
+			"400": textResponse("Invalid duration."),
+			"404": notFound,
+			"502": textResponse("The bridge could not activate the scene."),
+		})},
+		"/api/update": schema{"post": operation("Recalculate all schedules and update all lights", nil, nil, schema{"202": textResponse("The update was scheduled.")})},
+		"/api/schedules": schema{
+			"get": operation("Get all schedules", nil, nil, schema{"200": jsonResponse("All schedules.", arraySchema("", reference("LightSchedule")))}),
+			"post": operation("Add a schedule", nil, jsonBody(reference("LightSchedule")), schema{
+				"201": jsonResponse("The schedule was added.", reference("ValidationReport")),
+				"400": invalid,
+				"409": textResponse("A schedule with this name already exists."),
+			}),
+		},
+		"/api/schedules/validate": schema{"post": operation("Validate schedules without saving them", nil, jsonBody(arraySchema("", reference("LightSchedule"))), schema{"200": jsonResponse("The validation result.", reference("ValidationReport"))})},
+		"/api/schedules/{name}": schema{
+			"get":    operation("Get a schedule", []schema{scheduleName}, nil, schema{"200": jsonResponse("The schedule.", reference("LightSchedule")), "404": notFound}),
+			"put":    operation("Replace a schedule", []schema{scheduleName}, jsonBody(reference("LightSchedule")), schema{"200": jsonResponse("The schedule was replaced.", reference("ValidationReport")), "400": invalid, "404": notFound}),
+			"delete": operation("Remove a schedule", []schema{scheduleName}, nil, schema{"200": jsonResponse("The schedule was removed.", reference("ValidationReport")), "400": invalid, "404": notFound}),
+		},
+		"/api/schedules/{name}/simulate": schema{"get": operation("Calculate a schedule for any day", []schema{scheduleName, date}, nil, schema{"200": jsonResponse("The calculated schedule.", reference("Simulation")), "400": textResponse("Invalid date."), "404": notFound})},
+		"/api/schedules/{name}/pause":    schema{"post": operation("Pause a schedule and leave its lights alone", []schema{scheduleName, parameter("duration", "query", "Duration of the pause, e.g. 2h (default 1h).")}, nil, schema{"200": jsonResponse("The schedule is paused.", reference("SchedulePause")), "400": textResponse("Invalid duration."), "404": notFound})},
+		"/api/schedules/{name}/resume":   schema{"post": operation("Resume a paused schedule", []schema{scheduleName}, nil, schema{"200": jsonResponse("The schedule is active.", reference("SchedulePause")), "404": notFound})},
+		"/api/timeline":                  schema{"get": operation("Sample the course of a schedule over a day", []schema{parameter("schedule", "query", "Name of the schedule. Defaults to the first schedule."), date}, nil, schema{"200": jsonResponse("The timeline.", reference("Timeline")), "400": textResponse("Invalid date."), "404": notFound})},
+		"/api/logs":                      schema{"get": operation("Get the latest log messages", []schema{parameter("level", "query", "Minimum level, e.g. warning."), parameter("limit", "query", "Maximum number of messages.")}, nil, schema{"200": jsonResponse("The log messages, oldest first.", arraySchema("", reference("LogEntry")))})},
+		"/api/events":                    schema{"get": operation("Subscribe to live updates via WebSocket", nil, nil, schema{"101": schema{"description": "Switches to the WebSocket protocol. Every message is a DashboardEvent.", "content": jsonContent(reference("DashboardEvent"))}})},
+	}
+
+	timestamp := schema{"type": "string", "format": "date-time"}
+	sunTime := objectSchema("Real and adjusted time of a sunrise or sunset. The real time is zero during polar day and polar night.", schema{"real": timestamp, "adjusted": timestamp})
+	components := schema{
+		"Configuration": configurationSchema,
+		"LightSchedule": lightScheduleSchema,
+		"LightState":    lightStateSchema("A light state."),
+		"LightOverride": objectSchema("A temporary light state.", schema{"colorTemperature": colorTemperatureSchema("Color temperature in Kelvin or -1 to ignore."), "brightness": brightnessSchema("Brightness in percent or -1 to ignore."), "duration": simpleSchema("string", "Duration of the override, e.g. 30m (default 1h).")}),
+		"LightStatus": objectSchema("Target and current state of a light.", schema{
+			"id":            simpleSchema("integer", "ID of the light."),
+			"name":          simpleSchema("string", "Name of the light."),
+			"bridge":        simpleSchema("string", "Name of the bridge. Empty for the default bridge."),
+			"schedule":      simpleSchema("string", "Name of the schedule managing the light."),
+			"reachable":     simpleSchema("boolean", "The bridge can reach the light."),
+			"on":            simpleSchema("boolean", "The light is turned on."),
+			"automatic":     simpleSchema("boolean", "Kelvin controls the light."),
+			"target":        reference("LightState"),
+			"current":       reference("LightState"),
+			"overrideUntil": schema{"type": "string", "format": "date-time", "description": "End of the active override."},
+			"override":      reference("Override"),
+		}),
+		"Override": objectSchema("Kelvin leaves the light alone until the override expires.", schema{
+			"until":  timestamp,
+			"reason": schema{"type": "string", "enum": []string{overrideReasonSwitch, overrideReasonManual, overrideReasonAPI, overrideReasonPause, overrideReasonScene, overrideReasonNightlight, overrideReasonWakeup, overrideReasonSimulation}},
+			"scene":  simpleSchema("string", "Name of the activated scene."),
+		}),
+		"Scene": objectSchema("A scene of a bridge.", schema{
+			"name":   simpleSchema("string", "Name of the scene."),
+			"bridge": simpleSchema("string", "Name of the bridge. Empty for the default bridge."),
+			"lights": arraySchema("IDs of the lights of the scene.", schema{"type": "integer"}),
+		}),
+		"SceneOverride": objectSchema("An activated scene.", schema{
+			"scene":  simpleSchema("string", "Name of the scene."),
+			"bridge": simpleSchema("string", "Name of the bridge. Empty for the default bridge."),
+			"until":  timestamp,
+			"lights": arraySchema("All lights of the scene.", reference("LightStatus")),
+		}),
+		"BridgeStatus": objectSchema("Availability of a bridge.", schema{
+			"name":             simpleSchema("string", "Name of the bridge. Empty for the default bridge."),
+			"ip":               simpleSchema("string", "IP address of the bridge."),
+			"available":        simpleSchema("boolean", "The bridge is reachable."),
+			"unavailableSince": timestamp,
+		}),
+		"Away":           objectSchema("The away mode. In mode off all scheduled lights are kept off, in mode simulation the away simulation switches them.", schema{"mode": schema{"type": "string", "enum": awayModes}}),
+		"AwaySimulation": objectSchema("The state of the away simulation.", schema{"active": simpleSchema("boolean", "Lights are switched to simulate presence.")}),
+		"ValidationReport": objectSchema("Problems found in a configuration.", schema{
+			"errors":   arraySchema("Problems which prevent Kelvin from working as configured.", schema{"type": "string"}),
+			"warnings": arraySchema("Entries which will probably not behave as intended.", schema{"type": "string"}),
+		}),
+		"ConfigurationImport": objectSchema("Result of an imported configuration.", schema{
+			"errors":          arraySchema("Problems which prevent Kelvin from working as configured.", schema{"type": "string"}),
+			"warnings":        arraySchema("Entries which will probably not behave as intended.", schema{"type": "string"}),
+			"backups":         arraySchema("Backups of the previous configuration files.", schema{"type": "string"}),
+			"restartRequired": simpleSchema("boolean", "Some changes take effect after a restart."),
+		}),
+		"ScheduleEntry": objectSchema("A calculated entry of a schedule.", schema{
+			"time":             timestamp,
+			"type":             schema{"type": "string", "enum": []string{"beforeSunrise", "sunrise", "sunset", "afterSunset"}},
+			"colorTemperature": colorTemperatureSchema("Color temperature in Kelvin or -1 to ignore."),
+			"brightness":       brightnessSchema("Brightness in percent or -1 to ignore."),
+			"active":           simpleSchema("boolean", "The entry is used on this day."),
+		}),
+		"SchedulePause": objectSchema("The pause of a schedule.", schema{
+			"schedule":    simpleSchema("string", "Name of the schedule."),
+			"paused":      simpleSchema("boolean", "The schedule is paused."),
+			"pausedUntil": schema{"type": "string", "format": "date-time", "description": "End of the pause."},
+		}),
+		"Simulation": objectSchema("A schedule calculated for one day.", schema{
+			"schedule": simpleSchema("string", "Name of the schedule."),
+			"date":     simpleSchema("string", "The calculated day (YYYY-MM-DD)."),
+			"sunrise":  sunTime,
+			"sunset":   sunTime,
+			"entries":  arraySchema("All entries ordered by time.", reference("ScheduleEntry")),
+		}),
+		"Timeline": objectSchema("The course of a schedule over a day.", schema{
+			"schedule": simpleSchema("string", "Name of the schedule."),
+			"date":     simpleSchema("string", "The calculated day (YYYY-MM-DD)."),
+			"points": arraySchema("Calculated light states.", objectSchema("The light state at a point in time.", schema{
+				"time":             timestamp,
+				"colorTemperature": colorTemperatureSchema("Color temperature in Kelvin or -1 if ignored."),
+				"brightness":       brightnessSchema("Brightness in percent or -1 if ignored."),
+			})),
+			"markers": arraySchema("Sunrise, sunset and schedule entries.", objectSchema("A notable point in time.", schema{
+				"time": timestamp,
+				"type": schema{"type": "string", "enum": []string{"sunrise", "sunset", "adjustedSunrise", "adjustedSunset", "beforeSunrise", "afterSunset"}},
+			})),
+		}),
+		"LogEntry": objectSchema("A logged message.", schema{
+			"time":    timestamp,
+			"level":   simpleSchema("string", "Level of the message, e.g. info or warning."),
+			"message": simpleSchema("string", "The message."),
+		}),
+		"DashboardEvent": objectSchema("A live update of Kelvin.", schema{
+			"type":      schema{"type": "string", "enum": []string{"light", "schedule", "warning"}},
+			"light":     schema{"type": "object", "description": "The changed light."},
+			"canEnable": simpleSchema("boolean", "Kelvin can be enabled for the light."),
+			"message":   simpleSchema("string", "The logged warning."),
+		}),
+	}
+
+	return schema{
+		"openapi":  "3.1.0",
+		"info":     schema{"title": "Kelvin", "version": version, "description": "HTTP API of the Kelvin web interface."},
+		"paths":    paths,
+		"security": []schema{{"token": []string{}}, {"basic": []string{}}, {}},
+		"components": schema{
+			"schemas": components,
+			"securitySchemes": schema{
+				"token": schema{"type": "http", "scheme": "bearer", "description": "The configured webinterface.token."},
+				"basic": schema{"type": "http", "scheme": "basic", "description": "The configured webinterface.username and password."},
+			},
+		},
+	}
+}
+
+func openAPIHandler(w http.ResponseWriter, r *http.Request) {
+	webLog.Debugf("Serving OpenAPI specification to %s", r.RemoteAddr)
+	writeJSON(w, http.StatusOK, OpenAPISpecification())
+}
@@ -0,0 +1,168 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultSceneOverrideDuration = 30 * time.Minute
+
+// Reasons why Kelvin doesn't control a light.
+const (
+	overrideReasonSwitch     = "switch"
+	overrideReasonManual     = "manual"
+	overrideReasonAPI        = "api"
+	overrideReasonPause      = "pause"
+	overrideReasonScene      = "scene"
+	overrideReasonNightlight = "nightlight"
+	overrideReasonWakeup     = "wakeup"
+	overrideReasonSimulation = "simulation"
+)
+
+// Override hands a light over to the user or a scene until it expires.
+// Afterwards the light returns to its schedule.
+type Override struct {
+	Until  time.Time `json:"until"`
+	Reason string    `json:"reason"`
+	Scene  string    `json:"scene,omitempty"`
+}
+
+// sceneInfo describes a scene of a bridge.
+type sceneInfo struct {
+	Name   string `json:"name"`
+	Bridge string `json:"bridge,omitempty"`
+	Lights []int  `json:"lights"`
+}
+
+// sceneOverride is the answer to a scene activation.
+type sceneOverride struct {
+	Scene  string        `json:"scene"`
+	Bridge string        `json:"bridge,omitempty"`
+	Until  time.Time     `json:"until"`
+	Lights []lightStatus `json:"lights"`
+}
+
+func findBridge(name string) *HueBridge {
+	for _, b := range bridges {
+		if b.Name == name {
+			return b
+		}
+	}
+	return nil
+}
+
+// overrideScene hands the given lights over to a scene until the given
+// time.
+func overrideScene(bridge string, scene string, lightIDs []int, until time.Time) []*Light {
+	var overridden []*Light
+	for _, id := range lightIDs {
+		light := findLight(bridge, id)
+		if light == nil {
+			continue
+		}
+		scheduleLog.Printf("💡 Light %s - Activating scene %s until %v", light.Name, scene, until.Format("15:04"))
+		light.override(Override{Until: until, Reason: overrideReasonScene, Scene: scene})
+		overridden = append(overridden, light)
+	}
+	return overridden
+}
+
+func sceneLightIDs(ids []string) []int {
+	var result []int
+	for _, id := range ids {
+		if value, err := strconv.Atoi(id); err == nil {
+			result = append(result, value)
+		}
+	}
+	return result
+}
+
+func scenesHandler(w http.ResponseWriter, r *http.Request) {
+	webLog.Debugf("Serving scenes to %s", r.RemoteAddr)
+	scenes := []sceneInfo{}
+	for _, b := range bridges {
+		if !b.available() {
+			continue
+		}
+		b.throttle(1)
+		all, err := b.bridge.AllScenes()
+		if err != nil {
+			log.Warningf("🎨 Could not read scenes of bridge %s: %v", b.Name, err)
+			continue
+		}
+		for _, scene := range all {
+			scenes = append(scenes, sceneInfo{scene.Name, b.Name, sceneLightIDs(scene.Lights)})
+		}
+	}
+	writeJSON(w, http.StatusOK, scenes)
+}
+
+// activateSceneHandler activates a scene of the bridge and returns its
+// lights to their schedule once the duration has passed.
+func activateSceneHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	b := findBridge(r.URL.Query().Get("bridge"))
+	if b == nil {
+		http.Error(w, "Bridge not found", http.StatusNotFound)
+		return
+	}
+	duration, err := parsePositiveDuration(r.URL.Query().Get("duration"), defaultSceneOverrideDuration)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	b.throttle(1)
+	scene, err := b.bridge.SceneByName(name)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+
+	log.Printf("🎨 Activating scene %s for %v as requested by %s", scene.Name, duration, r.RemoteAddr)
+	now := time.Now()
+	until := now.Add(duration)
+	// Take the lights over before activating the scene so the change isn't
+	// mistaken for a manual one
+	overridden := overrideScene(b.Name, scene.Name, sceneLightIDs(scene.Lights), until)
+	b.throttle(groupRequestCost)
+	_, err = scene.Activate()
+	if err != nil {
+		for _, light := range overridden {
+			light.endOverride(now)
+		}
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+
+	result := sceneOverride{Scene: scene.Name, Bridge: b.Name, Until: until, Lights: []lightStatus{}}
+	for _, light := range overridden {
+		result.Lights = append(result.Lights, light.status(now))
+	}
+	writeJSON(w, http.StatusOK, result)
+}
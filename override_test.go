@@ -0,0 +1,64 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSceneOverride(t *testing.T) {
+	useConfiguration(t, &Configuration{})
+	couch := &Light{ID: 1, Name: "Couch", Scheduled: true, Tracking: true, Reachable: true, On: true, Automatic: true}
+	upstairs := &Light{ID: 2, Name: "Hallway", Bridge: "upstairs", Scheduled: true, Tracking: true, Reachable: true, On: true, Automatic: true}
+	useLights(t, couch, upstairs)
+
+	ids := sceneLightIDs([]string{"1", "2", "sensor"})
+	if !reflect.DeepEqual(ids, []int{1, 2}) {
+		t.Errorf("Unexpected light IDs %v", ids)
+	}
+
+	now := time.Now()
+	overridden := overrideScene("", "Movie", ids, now.Add(30*time.Minute))
+	if len(overridden) != 1 || overridden[0] != couch {
+		t.Fatalf("Only the lights of the bridge of the scene should be overridden: %v", overridden)
+	}
+	if couch.Automatic || !couch.overridden(now) || !upstairs.Automatic {
+		t.Errorf("Light should be handed over to the scene")
+	}
+	status := couch.status(now)
+	if status.Override == nil || status.Override.Reason != overrideReasonScene || status.Override.Scene != "Movie" {
+		t.Errorf("Status should report the scene override: %+v", status.Override)
+	}
+
+	// Manual changes made by the scene are ignored until the override expires
+	if updated, _ := couch.update(0); updated || couch.Automatic {
+		t.Errorf("Kelvin should leave the light alone while the scene is active")
+	}
+	if !couch.expireOverride(now.Add(31 * time.Minute)) {
+		t.Fatalf("Scene override should expire")
+	}
+	if !couch.Automatic || couch.overridden(now.Add(31*time.Minute)) || couch.activeOverride != (Override{}) {
+		t.Errorf("Light should return to its schedule after the scene")
+	}
+}
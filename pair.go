@@ -0,0 +1,212 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	hue "github.com/stefanwichmann/go.hue"
+)
+
+const pairingRetryInterval = 2 * time.Second
+
+// pairCommand discovers the bridges in the local network, registers Kelvin
+// at the selected bridge and saves the username in the configuration. It
+// returns the exit code for the process.
+func pairCommand(configurationFile string, args []string) int {
+	flags := commandFlags("pair")
+	flagIP := flags.String("ip", "", "IP of the bridge to pair with. Skips the discovery")
+	flagName := flags.String("name", "", "Save the bridge as additional bridge with the given name")
+	flagTimeout := flags.Duration("timeout", 60*time.Second, "Time to wait for the link button to be pressed")
+	flagNanoleaf := flags.String("nanoleaf", "", "Pair with the Nanoleaf controller at the given host instead of a bridge")
+	err := flags.Parse(args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+
+	if !*flagDebug {
+		setLogLevel(log.ErrorLevel)
+	}
+
+	var configuration Configuration
+	configuration.ConfigurationFile = configurationFile
+	if configuration.Exists() {
+		err = configuration.load()
+		if err != nil {
+			fmt.Printf("Could not read configuration %s: %v\n", configurationFile, err)
+			return 1
+		}
+		configuration.migrateToLatestVersion()
+	} else {
+		configuration.initializeDefaults()
+	}
+
+	input := bufio.NewReader(os.Stdin)
+	if *flagNanoleaf != "" {
+		return pairNanoleafCommand(&configuration, input, *flagNanoleaf, *flagTimeout)
+	}
+
+	ip := *flagIP
+	if ip == "" {
+		ip, err = discoverBridgeForPairing(input)
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+	}
+
+	bridge := &HueBridge{Name: *flagName, BridgeIP: ip}
+	err = bridge.validateBridge()
+	if err != nil {
+		fmt.Printf("No Hue bridge found at %s: %v\n", ip, err)
+		return 1
+	}
+
+	fmt.Printf("Press the link button on your Hue bridge at %s and hit Enter to continue...", ip)
+	input.ReadString('\n')
+	fmt.Println("Waiting for the bridge to confirm the registration...")
+	err = bridge.pair(*flagTimeout)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	configuration.saveBridge(*flagName, bridge.BridgeIP, bridge.Username)
+	err = configuration.Write()
+	if err != nil {
+		fmt.Printf("Could not write configuration %s: %v\n", configurationFile, err)
+		return 1
+	}
+	fmt.Printf("Paired with bridge %s. Configuration %s updated.\n", bridge.BridgeIP, configurationFile)
+	return 0
+}
+
+// pairNanoleafCommand obtains a token from the Nanoleaf controller at
+// the given host and saves it in the configuration.
+func pairNanoleafCommand(configuration *Configuration, input *bufio.Reader, host string, timeout time.Duration) int {
+	fmt.Printf("Hold the power button of your Nanoleaf controller at %s for 5-7 seconds until the LED flashes and hit Enter to continue...", host)
+	input.ReadString('\n')
+	fmt.Println("Waiting for the controller to confirm the pairing...")
+	token, err := pairNanoleaf(host, timeout)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+
+	if configuration.NanoleafTokens == nil {
+		configuration.NanoleafTokens = make(map[string]string)
+	}
+	configuration.NanoleafTokens[host] = token
+	err = configuration.Write()
+	if err != nil {
+		fmt.Printf("Could not write configuration %s: %v\n", configuration.ConfigurationFile, err)
+		return 1
+	}
+	fmt.Printf("Paired with Nanoleaf controller %s. Add it to the nanoleaf list of a schedule. Configuration %s updated.\n", host, configuration.ConfigurationFile)
+	return 0
+}
+
+// discoverBridgeForPairing returns the IP of the only bridge found in the
+// local network or lets the user select one of multiple bridges.
+func discoverBridgeForPairing(input *bufio.Reader) (string, error) {
+	fmt.Println("Searching for Hue bridges in your network...")
+	candidates, err := hue.DiscoverBridges(false)
+	if err != nil {
+		return "", fmt.Errorf("Bridge discovery failed: %v. Use -ip to pair with a known bridge", err)
+	}
+
+	var ips []string
+	for _, candidate := range candidates {
+		b := HueBridge{BridgeIP: candidate.IpAddr}
+		if b.validateBridge() == nil {
+			ips = append(ips, candidate.IpAddr)
+		}
+	}
+	if len(ips) == 0 {
+		return "", errors.New("No Hue bridge found in your network. Use -ip to pair with a known bridge")
+	}
+	if len(ips) == 1 {
+		fmt.Printf("Found bridge at %s\n", ips[0])
+		return ips[0], nil
+	}
+
+	fmt.Println("Found multiple bridges:")
+	for i, ip := range ips {
+		fmt.Printf("  [%d] %s\n", i+1, ip)
+	}
+	fmt.Printf("Select a bridge [1-%d]: ", len(ips))
+	return selectBridge(input, ips)
+}
+
+// selectBridge reads the number of the selected bridge from the given input.
+func selectBridge(input *bufio.Reader, ips []string) (string, error) {
+	line, err := input.ReadString('\n')
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	selection, err := strconv.Atoi(strings.TrimSpace(line))
+	if err != nil || selection < 1 || selection > len(ips) {
+		return "", fmt.Errorf("Invalid selection \"%s\"", strings.TrimSpace(line))
+	}
+	return ips[selection-1], nil
+}
+
+// pair tries to register Kelvin at the bridge until the link button was
+// pressed or the timeout has passed.
+func (bridge *HueBridge) pair(timeout time.Duration) error {
+	bridge.bridge = *hue.NewBridge(bridge.BridgeIP, "")
+	deadline := time.Now().Add(timeout)
+	for {
+		err := bridge.createUser()
+		if err == nil {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("Registration at bridge %s failed: %v", bridge.BridgeIP, err)
+		}
+		time.Sleep(pairingRetryInterval)
+	}
+}
+
+// saveBridge stores the given bridge in the configuration. Without a name
+// the default bridge will be updated.
+func (configuration *Configuration) saveBridge(name string, ip string, username string) {
+	if name == "" {
+		configuration.Bridge.IP = ip
+		configuration.Bridge.Username = username
+		return
+	}
+	if bridgeConfiguration := configuration.bridgeConfiguration(name); bridgeConfiguration != nil {
+		bridgeConfiguration.IP = ip
+		bridgeConfiguration.Username = username
+		return
+	}
+	configuration.Bridges = append(configuration.Bridges, Bridge{Name: name, IP: ip, Username: username})
+}
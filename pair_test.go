@@ -0,0 +1,49 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+)
+
+func TestPairing(t *testing.T) {
+	ips := []string{"192.168.1.2", "192.168.1.3"}
+	if ip, err := selectBridge(bufio.NewReader(strings.NewReader("2\n")), ips); err != nil || ip != "192.168.1.3" {
+		t.Errorf("Expected second bridge, got %s (%v)", ip, err)
+	}
+	if _, err := selectBridge(bufio.NewReader(strings.NewReader("3\n")), ips); err == nil {
+		t.Errorf("Selection out of range should fail")
+	}
+
+	c := Configuration{}
+	c.saveBridge("", "192.168.1.2", "user1")
+	c.saveBridge("upstairs", "192.168.1.3", "user2")
+	c.saveBridge("upstairs", "192.168.1.4", "user3")
+	if c.Bridge.IP != "192.168.1.2" || c.Bridge.Username != "user1" {
+		t.Errorf("Default bridge was not saved: %+v", c.Bridge)
+	}
+	if len(c.Bridges) != 1 || c.Bridges[0].IP != "192.168.1.4" || c.Bridges[0].Username != "user3" {
+		t.Errorf("Additional bridge was not saved: %+v", c.Bridges)
+	}
+}
@@ -0,0 +1,86 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"time"
+)
+
+// pollingMargin defines how long before a transition or the end of an
+// override Kelvin returns to fast polling.
+const pollingMargin = 2 * time.Minute
+
+// parseIdlePollingInterval parses the configured idle polling interval.
+// Empty values disable adaptive polling.
+func parseIdlePollingInterval(value string) (time.Duration, error) {
+	return parsePositiveDuration(value, 0)
+}
+
+// idlePollingInterval returns the configured idle polling interval or zero
+// if adaptive polling is disabled.
+func (configuration *Configuration) idlePollingInterval() time.Duration {
+	idle, err := parseIdlePollingInterval(configuration.IdlePollingInterval)
+	if err != nil {
+		configLog.Warningf("⚙ Invalid idle polling interval \"%s\". Disabling adaptive polling...", configuration.IdlePollingInterval)
+	}
+	return idle
+}
+
+// adaptivePollingInterval returns the interval until the bridge should be polled
+// again. Lights are polled with the given interval while their light state
+// changes or is about to change. During long stretches without any change
+// the idle interval is used instead.
+func adaptivePollingInterval(lights []*Light, now time.Time, interval time.Duration, idle time.Duration) time.Duration {
+	if idle <= interval {
+		return interval
+	}
+	for _, light := range lights {
+		if light.needsFastPolling(now) {
+			return interval
+		}
+	}
+	return idle
+}
+
+// needsFastPolling returns true if the light state of the light changes or
+// will change within the polling margin.
+func (light *Light) needsFastPolling(now time.Time) bool {
+	if !light.Scheduled || !light.Tracking {
+		return false
+	}
+	if light.Initializing || now.Before(light.Appearance.Add(pollingMargin)) {
+		return true
+	}
+	if until := light.activeOverride.Until; !until.IsZero() && now.Add(pollingMargin).After(until) {
+		return true
+	}
+	if now.Before(light.boostUntil.Add(pollingMargin)) {
+		return true
+	}
+
+	// Is the light in a transition or will the next one start soon?
+	interval := light.Interval
+	if now.Add(pollingMargin).After(interval.End.Time) {
+		return true
+	}
+	return interval.Start.ColorTemperature != interval.End.ColorTemperature || interval.Start.Brightness != interval.End.Brightness
+}
@@ -0,0 +1,63 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAdaptivePolling(t *testing.T) {
+	now := time.Now()
+	flat := Interval{TimeStamp{Time: now.Add(-time.Hour), ColorTemperature: 5000, Brightness: 100}, TimeStamp{Time: now.Add(time.Hour), ColorTemperature: 5000, Brightness: 100}}
+	transition := Interval{TimeStamp{Time: now.Add(-time.Hour), ColorTemperature: 5000, Brightness: 100}, TimeStamp{Time: now.Add(time.Hour), ColorTemperature: 2700, Brightness: 60}}
+	idle := &Light{Scheduled: true, Tracking: true, Interval: flat, Appearance: now.Add(-time.Hour)}
+	off := &Light{Scheduled: true, Interval: transition}
+
+	tests := []struct {
+		light    *Light
+		expected time.Duration
+	}{
+		{idle, 30 * time.Second},
+		{off, 30 * time.Second},
+		{&Light{Scheduled: true, Tracking: true, Interval: transition, Appearance: now.Add(-time.Hour)}, time.Second},
+		{&Light{Scheduled: true, Tracking: true, Interval: Interval{flat.Start, TimeStamp{Time: now.Add(time.Minute), ColorTemperature: 5000, Brightness: 100}}, Appearance: now.Add(-time.Hour)}, time.Second},
+		{&Light{Scheduled: true, Tracking: true, Interval: flat, Appearance: now.Add(-time.Minute)}, time.Second},
+		{&Light{Scheduled: true, Tracking: true, Interval: flat, Appearance: now.Add(-time.Hour), activeOverride: Override{Until: now.Add(time.Minute)}}, time.Second},
+		{&Light{Scheduled: true, Tracking: true, Interval: flat, Appearance: now.Add(-time.Hour), activeOverride: Override{Until: now.Add(time.Hour)}}, 30 * time.Second},
+	}
+	for i, test := range tests {
+		if interval := adaptivePollingInterval([]*Light{idle, test.light}, now, time.Second, 30*time.Second); interval != test.expected {
+			t.Errorf("Test %d: Expected polling interval %v, got %v", i, test.expected, interval)
+		}
+	}
+
+	if interval := adaptivePollingInterval([]*Light{idle}, now, time.Second, 0); interval != time.Second {
+		t.Errorf("Adaptive polling should be disabled without idle interval, got %v", interval)
+	}
+	if interval := adaptivePollingInterval([]*Light{idle}, now, 10*time.Second, 5*time.Second); interval != 10*time.Second {
+		t.Errorf("Idle polling interval should never be shorter than the regular interval, got %v", interval)
+	}
+	if _, err := parseIdlePollingInterval("-5s"); err == nil {
+		t.Errorf("Negative idle polling interval should be rejected")
+	}
+}
@@ -0,0 +1,127 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// powerOnConfigurationInterval limits how often the power on behavior of a
+// bulb is written. Every write is stored in the flash memory of the bulb.
+const powerOnConfigurationInterval = 15 * time.Minute
+
+// hueStartupSettings represents the light state a bulb restores on its own
+// when it regains power.
+type hueStartupSettings struct {
+	Brightness       int       `json:"bri,omitempty"`
+	ColorTemperature int       `json:"ct,omitempty"`
+	Color            []float32 `json:"xy,omitempty"`
+}
+
+type hueStartup struct {
+	Mode           string              `json:"mode"`
+	CustomSettings *hueStartupSettings `json:"customsettings,omitempty"`
+}
+
+type hueLightConfig struct {
+	Startup hueStartup `json:"startup"`
+}
+
+// startupSettings converts the given light state into the startup settings
+// of the light. It returns nil if the state doesn't define anything the light
+// could show.
+func (light *HueLight) startupSettings(state LightState) *hueStartupSettings {
+	settings := hueStartupSettings{}
+	if state.ColorTemperature != -1 && state.ColorTemperature != 0 {
+		colorTemperature := light.clampColorTemperature(state.ColorTemperature)
+		if light.SupportsColorTemperature {
+			settings.ColorTemperature = mapColorTemperature(colorTemperature)
+		} else if light.SupportsXYColor {
+			settings.Color = colorTemperatureToXYColor(colorTemperature)
+		}
+	}
+	if light.Dimmable && state.Brightness > 0 {
+		settings.Brightness = mapBrightness(state.Brightness)
+		if settings.Brightness < 1 {
+			settings.Brightness = 1
+		}
+	}
+	if settings.Brightness == 0 && settings.ColorTemperature == 0 && len(settings.Color) == 0 {
+		return nil
+	}
+	return &settings
+}
+
+// configureStartup tells the light to power on with the given settings
+// instead of its factory default.
+func (light *HueLight) configureStartup(settings *hueStartupSettings) error {
+	if light.bridge == nil {
+		return fmt.Errorf("Light is not connected to a bridge")
+	}
+	config := hueLightConfig{hueStartup{Mode: "custom", CustomSettings: settings}}
+	return light.bridge.apiRequest("PUT", fmt.Sprintf("/lights/%s/config", light.HueLight.Id), config, nil)
+}
+
+// powerOnConfigurationDue returns true if the power on behavior of the light
+// should be updated to the current target light state.
+func (light *Light) powerOnConfigurationDue(now time.Time) bool {
+	if powerOn := light.Schedule.powerOn; powerOn == nil || !powerOn.ConfigureBulb {
+		return false
+	}
+	if !light.Scheduled || !light.Reachable || light.HueLight.OnOffOnly {
+		return false
+	}
+	if light.powerOnState != nil && light.powerOnState.equals(light.TargetLightState) {
+		return false
+	}
+	return light.powerOnConfigured.IsZero() || !now.Before(light.powerOnConfigured.Add(powerOnConfigurationInterval))
+}
+
+// updatePowerOnState keeps the power on behavior of the bulb close to the
+// schedule, so the light starts with the right state when it is switched on
+// at the wall.
+func (light *Light) updatePowerOnState(now time.Time) {
+	if !light.powerOnConfigurationDue(now) {
+		return
+	}
+	settings := light.HueLight.startupSettings(light.TargetLightState)
+	if settings == nil {
+		return
+	}
+
+	light.powerOnConfigured = now
+	err := light.HueLight.configureStartup(settings)
+	if err != nil {
+		// Older bulbs don't support startup settings. Report it once only.
+		if !light.powerOnFailureReported {
+			scheduleLog.Warningf("💡 Light %s - Could not configure the power on behavior: %v", light.Name, err)
+			light.powerOnFailureReported = true
+		} else {
+			scheduleLog.Debugf("💡 Light %s - Could not configure the power on behavior: %v", light.Name, err)
+		}
+		return
+	}
+	state := light.TargetLightState
+	light.powerOnState = &state
+	scheduleLog.Debugf("💡 Light %s - Configured the light to power on at %vK and %v%% brightness", light.Name, state.ColorTemperature, state.Brightness)
+}
@@ -0,0 +1,88 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPowerOn(t *testing.T) {
+	now := time.Now()
+	interval := Interval{TimeStamp{Time: now.Add(-time.Hour), ColorTemperature: 4000, Brightness: 100}, TimeStamp{Time: now.Add(time.Hour), ColorTemperature: 2000, Brightness: 50}}
+	light := &Light{Name: "Hallway", HueLight: HueLight{SupportsColorTemperature: true, Dimmable: true}, Scheduled: true, Tracking: true, On: true, Reachable: false, Interval: interval, TargetLightState: LightState{4000, 100}, Schedule: Schedule{powerOn: &PowerOn{Reapply: true}}}
+	light.update(0)
+	if light.Tracking || !light.unreachable {
+		t.Fatalf("Unreachable light should no longer be tracked")
+	}
+
+	// Keep the light from being taken over, no bridge is connected
+	light.override(Override{Until: now.Add(time.Hour), Reason: overrideReasonAPI})
+	light.Reachable = true
+	light.update(0)
+	if !light.Tracking || light.unreachable {
+		t.Errorf("Light should be tracked again once it is reachable")
+	}
+	if state := light.TargetLightState; !equalsInt(state.ColorTemperature, 3000, 10) || !equalsInt(state.Brightness, 75, 1) {
+		t.Errorf("Target light state should be recalculated when the light appears, got %+v", state)
+	}
+
+	var received []hueLightConfig
+	bridge := testBridge(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "PUT" || r.URL.Path != "/api/test/lights/7/config" {
+			t.Errorf("Unexpected request %s %s", r.Method, r.URL.Path)
+		}
+		var config hueLightConfig
+		json.NewDecoder(r.Body).Decode(&config)
+		received = append(received, config)
+		w.Write([]byte(`[{"success":{"/lights/7/config/startup/mode":"custom"}}]`))
+	})
+
+	light.Schedule.powerOn.ConfigureBulb = true
+	light.HueLight = HueLight{Name: "Hallway", SupportsColorTemperature: true, Dimmable: true, MinimumColorTemperature: 2000, MaximumColorTemperature: 6500, bridge: bridge}
+	light.HueLight.HueLight.Id = "7"
+	light.TargetLightState = LightState{2500, 50}
+	light.updatePowerOnState(now)
+	if len(received) != 1 {
+		t.Fatalf("Power on behavior should be configured, got %d requests", len(received))
+	}
+	if startup := received[0].Startup; startup.Mode != "custom" || startup.CustomSettings == nil || startup.CustomSettings.ColorTemperature != 400 || startup.CustomSettings.Brightness != 127 {
+		t.Errorf("Unexpected startup settings: %+v", startup.CustomSettings)
+	}
+
+	light.TargetLightState = LightState{2400, 45}
+	light.updatePowerOnState(now.Add(time.Minute))
+	if len(received) != 1 {
+		t.Errorf("Power on behavior should be written at most every %v", powerOnConfigurationInterval)
+	}
+	light.updatePowerOnState(now.Add(powerOnConfigurationInterval))
+	light.updatePowerOnState(now.Add(2 * powerOnConfigurationInterval))
+	if len(received) != 2 {
+		t.Errorf("Unchanged power on behavior should not be written again, got %d requests", len(received))
+	}
+
+	if settings := (&HueLight{OnOffOnly: true}).startupSettings(LightState{2700, 100}); settings != nil {
+		t.Errorf("On/off lights have no startup settings, got %+v", settings)
+	}
+}
@@ -0,0 +1,264 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const presenceCheckInterval = 30 * time.Second
+const defaultPresenceTimeout = 10 * time.Minute
+const defaultPresencePayload = "home"
+
+// Presence detects if someone is home by looking for phones on the
+// network or by listening to an MQTT topic. Schedules may require
+// presence to adjust their lights.
+type Presence struct {
+	Devices       []PresenceDevice `json:"devices,omitempty"`
+	MQTT          *PresenceMQTT    `json:"mqtt,omitempty"`
+	Timeout       string           `json:"timeout,omitempty"`
+	SnapOnArrival bool             `json:"snapOnArrival,omitempty"`
+}
+
+// PresenceDevice is a device which is only on the network while its owner
+// is home. It is detected by pinging the host or by finding the MAC
+// address in the ARP table.
+type PresenceDevice struct {
+	Name string `json:"name"`
+	Host string `json:"host,omitempty"`
+	MAC  string `json:"mac,omitempty"`
+}
+
+// PresenceMQTT is a topic which reports if someone is home, e.g. the
+// state of a home automation system.
+type PresenceMQTT struct {
+	Broker   string `json:"broker"`
+	Topic    string `json:"topic"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	Payload  string `json:"payload,omitempty"`
+}
+
+// presenceDetector combines all configured sources. Someone is considered
+// home if a device was seen within the timeout or the MQTT topic says so.
+type presenceDetector struct {
+	lock     sync.Mutex
+	timeout  time.Duration
+	lastSeen time.Time
+	mqttHome bool
+	home     bool
+}
+
+// presence is nil if presence detection isn't configured.
+var presence *presenceDetector
+
+func (p *Presence) timeout() (time.Duration, error) {
+	return parsePositiveDuration(p.Timeout, defaultPresenceTimeout)
+}
+
+// someoneHome returns true if presence detection is disabled or someone
+// was detected recently.
+func (detector *presenceDetector) someoneHome(now time.Time) bool {
+	if detector == nil {
+		return true
+	}
+	detector.lock.Lock()
+	defer detector.lock.Unlock()
+	return detector.mqttHome || now.Sub(detector.lastSeen) < detector.timeout
+}
+
+func (detector *presenceDetector) seen(now time.Time) {
+	detector.lock.Lock()
+	defer detector.lock.Unlock()
+	detector.lastSeen = now
+}
+
+func (detector *presenceDetector) setMQTT(home bool) {
+	detector.lock.Lock()
+	defer detector.lock.Unlock()
+	detector.mqttHome = home
+}
+
+// arrived reports if someone came home since the last call.
+func (detector *presenceDetector) arrived(now time.Time) bool {
+	home := detector.someoneHome(now)
+	detector.lock.Lock()
+	defer detector.lock.Unlock()
+	changed := home != detector.home
+	detector.home = home
+	if changed && home {
+		log.Printf("🤖 Someone came home")
+	} else if changed {
+		log.Printf("🤖 Nobody is home")
+	}
+	return changed && home
+}
+
+// startPresenceDetection watches all configured sources in the
+// background. Everyone is expected to be home when Kelvin starts.
+func startPresenceDetection(configuration *Presence) {
+	if configuration == nil {
+		return
+	}
+	timeout, err := configuration.timeout()
+	if err != nil {
+		configLog.Warningf("⚙ Invalid presence timeout %q. Using %v...", configuration.Timeout, defaultPresenceTimeout)
+		timeout = defaultPresenceTimeout
+	}
+	now := time.Now()
+	presence = &presenceDetector{timeout: timeout, lastSeen: now, home: true}
+
+	report := func() {
+		if presence.arrived(time.Now()) && configuration.SnapOnArrival {
+			requestUpdate()
+		}
+	}
+	// Keep checking without devices to notice the end of the timeout
+	go supervise("presence detection", func() {
+		for {
+			if presentDevice(configuration.Devices) != "" {
+				presence.seen(time.Now())
+			}
+			report()
+			time.Sleep(presenceCheckInterval)
+		}
+	})
+	if mqtt := configuration.MQTT; mqtt != nil {
+		go supervise("presence topic "+mqtt.Topic, func() {
+			mqtt.watch(func(home bool) {
+				presence.setMQTT(home)
+				report()
+			})
+		})
+	}
+}
+
+// presentDevice returns the name of the first device found on the network.
+func presentDevice(devices []PresenceDevice) string {
+	var table string
+	for _, device := range devices {
+		if device.Host != "" && ping(device.Host) {
+			log.Debugf("🤖 Device %s answered to ping", device.Name)
+			return device.Name
+		}
+		if device.MAC == "" {
+			continue
+		}
+		if table == "" {
+			var err error
+			table, err = arpTable()
+			if err != nil {
+				log.Debugf("🤖 Could not read ARP table: %v", err)
+				continue
+			}
+		}
+		if arpTableContains(table, device.MAC) {
+			log.Debugf("🤖 Device %s found in ARP table", device.Name)
+			return device.Name
+		}
+	}
+	return ""
+}
+
+func ping(host string) bool {
+	args := []string{"-c", "1", "-W", "1", host}
+	switch runtime.GOOS {
+	case "windows":
+		args = []string{"-n", "1", "-w", "1000", host}
+	case "darwin":
+		args = []string{"-c", "1", "-t", "1", host}
+	}
+	return exec.Command("ping", args...).Run() == nil
+}
+
+func arpTable() (string, error) {
+	if data, err := ioutil.ReadFile("/proc/net/arp"); err == nil {
+		return string(data), nil
+	}
+	output, err := exec.Command("arp", "-a").Output()
+	return string(output), err
+}
+
+// normalizeMAC accepts MAC addresses separated by colons or dashes with
+// or without leading zeros.
+func normalizeMAC(value string) (string, bool) {
+	parts := strings.FieldsFunc(value, func(r rune) bool { return r == ':' || r == '-' })
+	if len(parts) != 6 {
+		return "", false
+	}
+	for i, part := range parts {
+		octet, err := strconv.ParseUint(part, 16, 8)
+		if err != nil {
+			return "", false
+		}
+		parts[i] = fmt.Sprintf("%02x", octet)
+	}
+	return strings.Join(parts, ":"), true
+}
+
+// arpTableContains searches the output of /proc/net/arp or arp -a for
+// the given MAC address.
+func arpTableContains(table string, mac string) bool {
+	wanted, ok := normalizeMAC(mac)
+	if !ok {
+		return false
+	}
+	for _, field := range strings.Fields(table) {
+		if candidate, ok := normalizeMAC(field); ok && candidate == wanted {
+			return true
+		}
+	}
+	return false
+}
+
+// watch subscribes to the topic and reports every change of presence.
+// Lost connections will be reestablished.
+func (p *PresenceMQTT) watch(report func(home bool)) {
+	payload := p.Payload
+	if payload == "" {
+		payload = defaultPresencePayload
+	}
+	for {
+		client, err := dialMQTT(p.Broker, p.Username, p.Password)
+		if err == nil {
+			err = client.subscribe(p.Topic)
+			if err == nil {
+				log.Debugf("🤖 Subscribed to presence topic %s", p.Topic)
+				err = client.receive(func(message mqttMessage) {
+					report(strings.EqualFold(strings.TrimSpace(string(message.Payload)), payload))
+				})
+			}
+			client.close()
+		}
+		log.Warningf("🤖 Presence topic %s disconnected: %v. Reconnecting in %v...", p.Topic, err, mqttReconnectDelay)
+		time.Sleep(mqttReconnectDelay)
+	}
+}
@@ -0,0 +1,68 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPresence(t *testing.T) {
+	table := `IP address       HW type     Flags       HW address            Mask     Device
+192.168.1.23     0x1         0x2         a4:5e:60:12:34:56     *        eth0
+192.168.1.42     0x1         0x0         00:00:00:00:00:00     *        eth0`
+	if !arpTableContains(table, "A4-5E-60-12-34-56") {
+		t.Errorf("Device should be found in /proc/net/arp")
+	}
+	if !arpTableContains("? (192.168.1.23) at a4:5e:60:12:4:6 on en0 ifscope [ethernet]", "a4:5e:60:12:04:06") {
+		t.Errorf("Device should be found in the output of arp -a")
+	}
+	if arpTableContains(table, "a4:5e:60:12:34:57") || arpTableContains(table, "invalid") {
+		t.Errorf("Unknown devices should not be found")
+	}
+
+	now := time.Now()
+	var disabled *presenceDetector
+	if !disabled.someoneHome(now) {
+		t.Errorf("Everyone should be home without presence detection")
+	}
+	detector := &presenceDetector{timeout: 10 * time.Minute, lastSeen: now, home: true}
+	if !detector.someoneHome(now.Add(5*time.Minute)) || detector.someoneHome(now.Add(10*time.Minute)) {
+		t.Errorf("Devices should count as present until the timeout")
+	}
+	if detector.arrived(now.Add(time.Hour)) || detector.home {
+		t.Errorf("Leaving should not be reported as arrival")
+	}
+	detector.setMQTT(true)
+	if !detector.arrived(now.Add(time.Hour)) || detector.arrived(now.Add(time.Hour)) {
+		t.Errorf("Arrival should be reported once")
+	}
+
+	defer func(previous *presenceDetector) { presence = previous }(presence)
+	presence = &presenceDetector{timeout: time.Minute}
+	light := &Light{Name: "Hallway", Scheduled: true, Reachable: true, On: true, TargetLightState: LightState{2700, 80}}
+	light.Schedule.requirePresence = true
+	light.Schedule.enableWhenLightsAppear = true
+	if updated, err := light.update(0); updated || err != nil || light.Tracking {
+		t.Errorf("Light should be left alone while nobody is home (%v, %v)", updated, err)
+	}
+}
@@ -0,0 +1,121 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// previewCommand prints the calculated schedule of a light or schedule
+// for an arbitrary date and returns the exit code for the process.
+func previewCommand(configurationFile string, args []string) int {
+	flags := commandFlags("preview")
+	flagDate := flags.String("date", time.Now().Format("2006-01-02"), "Day to calculate the schedule for (YYYY-MM-DD)")
+	flagLight := flags.Int("light", 0, "ID of the light to preview")
+	flagSchedule := flags.String("schedule", "", "Name of the schedule to preview")
+	flagJSON := flags.Bool("json", false, "Print the schedule as JSON")
+	err := flags.Parse(args)
+	if err != nil {
+		return flagExitCode(err)
+	}
+
+	if !*flagDebug {
+		setLogLevel(log.ErrorLevel)
+	}
+
+	var configuration Configuration
+	configuration.ConfigurationFile = configurationFile
+	err = configuration.load()
+	if err != nil {
+		fmt.Printf("Could not read configuration %s: %v\n", configurationFile, err)
+		return 1
+	}
+	configuration.migrateToLatestVersion()
+	// Reuse the sun times precomputed by the running instance
+	sunTimeTable, _ = loadSunTable(configuration.secretsPath(sunTableFilename))
+
+	date, err := time.ParseInLocation("2006-01-02", *flagDate, time.Local)
+	if err != nil {
+		fmt.Printf("Invalid date %s: %v\n", *flagDate, err)
+		return 2
+	}
+
+	lightSchedule, err := configuration.previewSchedule(*flagLight, *flagSchedule)
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	schedule := configuration.scheduleForDay(lightSchedule, date)
+
+	if *flagJSON {
+		data, err := json.MarshalIndent(schedule.Entries(), "", "  ")
+		if err != nil {
+			fmt.Println(err)
+			return 1
+		}
+		fmt.Println(string(data))
+		return 0
+	}
+
+	location := configuration.locationForSchedule(lightSchedule)
+	fmt.Printf("Schedule %s on %s (Location: %v, %v)\n", lightSchedule.Name, date.Format("Jan 2 2006"), location.Latitude, location.Longitude)
+	fmt.Printf("| %-5s | %-13s | %-11s | %-10s | %-6s |\n", "Time", "Type", "Temperature", "Brightness", "Active")
+	for _, entry := range schedule.Entries() {
+		fmt.Printf("| %-5s | %-13s | %11s | %10s | %-6v |\n", entry.Time.Format("15:04"), entry.Type, formatPreviewValue(entry.ColorTemperature, "K"), formatPreviewValue(entry.Brightness, "%"), entry.Active)
+	}
+	return 0
+}
+
+func (configuration *Configuration) previewSchedule(light int, name string) (LightSchedule, error) {
+	if name != "" {
+		for _, candidate := range configuration.Schedules {
+			if candidate.Name == name {
+				return candidate, nil
+			}
+		}
+		return LightSchedule{}, fmt.Errorf("Schedule %s not found in configuration", name)
+	}
+	if light != 0 {
+		for _, candidate := range configuration.Schedules {
+			if containsInt(candidate.AssociatedDeviceIDs, light) {
+				return candidate, nil
+			}
+		}
+		return LightSchedule{}, fmt.Errorf("Light %d is not associated with any schedule in configuration", light)
+	}
+	if len(configuration.Schedules) == 0 {
+		return LightSchedule{}, errors.New("Configuration doesn't contain any schedules")
+	}
+	return configuration.Schedules[0], nil
+}
+
+func formatPreviewValue(value int, unit string) string {
+	if value == -1 {
+		return "ignored"
+	}
+	return fmt.Sprintf("%d%s", value, unit)
+}
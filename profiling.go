@@ -0,0 +1,53 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"net/http"
+	"net/http/pprof"
+
+	"github.com/gorilla/mux"
+)
+
+// addProfilingRoutes exposes the profiles of the Go runtime below
+// /debug/pprof/, e.g. `go tool pprof http://<host>/debug/pprof/heap`.
+// Profiles reveal internals of the process, they are only served if the
+// web interface requires authentication.
+func addProfilingRoutes(r *mux.Router) {
+	r.HandleFunc("/debug/pprof/cmdline", profilingHandler(pprof.Cmdline))
+	r.HandleFunc("/debug/pprof/profile", profilingHandler(pprof.Profile))
+	r.HandleFunc("/debug/pprof/symbol", profilingHandler(pprof.Symbol))
+	r.HandleFunc("/debug/pprof/trace", profilingHandler(pprof.Trace))
+	// The index serves all other profiles like heap or goroutine by name
+	r.PathPrefix("/debug/pprof/").HandlerFunc(profilingHandler(pprof.Index))
+}
+
+func profilingHandler(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !newAuthenticator(configuration.WebInterface).enabled() {
+			http.Error(w, "Profiling requires a token or password for the web interface", http.StatusForbidden)
+			return
+		}
+		webLog.Debugf("Serving profile %s to %s", r.URL.Path, r.RemoteAddr)
+		next(w, r)
+	}
+}
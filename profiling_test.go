@@ -0,0 +1,57 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestProfiling(t *testing.T) {
+	get := func(path string, token string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest("GET", path, nil)
+		if token != "" {
+			request.Header.Set("Authorization", "Bearer "+token)
+		}
+		webHandler().ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	useConfiguration(t, &Configuration{WebInterface: WebInterface{Enabled: true}})
+	if recorder := get("/debug/pprof/", ""); recorder.Code != http.StatusForbidden {
+		t.Errorf("Profiles must not be served without authentication, got HTTP %d", recorder.Code)
+	}
+
+	configuration = &Configuration{WebInterface: WebInterface{Enabled: true, Token: "secret"}}
+	if recorder := get("/debug/pprof/heap", ""); recorder.Code != http.StatusUnauthorized {
+		t.Errorf("Profiles require the token, got HTTP %d", recorder.Code)
+	}
+	if recorder := get("/debug/pprof/", "secret"); recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "goroutine") {
+		t.Errorf("Expected the profile index, got HTTP %d", recorder.Code)
+	}
+	if recorder := get("/debug/pprof/goroutine?debug=1", "secret"); recorder.Code != http.StatusOK || !strings.Contains(recorder.Body.String(), "TestProfiling") {
+		t.Errorf("Expected the goroutine profile, got HTTP %d", recorder.Code)
+	}
+}
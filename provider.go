@@ -0,0 +1,229 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// ProviderLight identifies a light of a provider and the schedule it
+// follows.
+type ProviderLight struct {
+	Provider string `json:"provider"`
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	Schedule string `json:"schedule"`
+}
+
+// ProviderState represents the current state of a light as reported by its
+// provider.
+type ProviderState struct {
+	Reachable bool
+	On        bool
+	// Changed is true if the light doesn't show the state set by Kelvin
+	// anymore.
+	Changed bool
+}
+
+// LightProvider is implemented by all light backends. Providers register
+// themselves by name and their lights follow the configured schedules
+// without any changes to the scheduling code.
+type LightProvider interface {
+	// Discover returns all lights of the provider which are associated
+	// with a schedule of the given configuration.
+	Discover(configuration *Configuration) ([]ProviderLight, error)
+	// GetState reads the current state of the given light. Providers
+	// forget the last state they sent when the light is turned off.
+	GetState(light ProviderLight) (ProviderState, error)
+	// SetState sends the given state to the light. It returns false if the
+	// light already shows this state.
+	SetState(light ProviderLight, state LightState, transitionTime time.Duration) (bool, error)
+	// Subscribe reports changed lights to the given channel. Providers
+	// without change notifications return false and will be polled.
+	Subscribe(events chan<- ProviderLight) bool
+}
+
+var lightProviders = make(map[string]LightProvider)
+
+// registerLightProvider makes the given provider available under the given
+// name. It is meant to be called from the init function of a provider.
+func registerLightProvider(name string, provider LightProvider) {
+	if _, found := lightProviders[name]; found {
+		panic(fmt.Sprintf("Light provider %s is registered twice", name))
+	}
+	lightProviders[name] = provider
+}
+
+// lightProviderNames returns the names of all registered providers in
+// lexical order.
+func lightProviderNames() []string {
+	var names []string
+	for name := range lightProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// subscribeLightProviders subscribes to the change notifications of all
+// providers. It returns which providers report their changes.
+func subscribeLightProviders(events chan<- ProviderLight) map[string]bool {
+	subscribed := make(map[string]bool)
+	for _, name := range lightProviderNames() {
+		subscribed[name] = lightProviders[name].Subscribe(events)
+	}
+	return subscribed
+}
+
+// providerUpdateInterval defines how often the lights of all providers
+// are polled.
+const providerUpdateInterval = 2 * time.Second
+
+var localDeviceClient = &http.Client{Timeout: hueAPITimeout, Transport: localTransport}
+
+// ProviderDevice represents a light which is controlled via the generic
+// interface of its provider. It follows the same rules as the lights of
+// the bridge: Kelvin takes over when the light is turned on and stops after
+// a manual change.
+type ProviderDevice struct {
+	ProviderLight
+	Reachable        bool       `json:"reachable"`
+	On               bool       `json:"on"`
+	Automatic        bool       `json:"automatic"`
+	TargetLightState LightState `json:"targetLightState"`
+	tracking         bool
+	lightSchedule    LightSchedule
+	schedule         Schedule
+}
+
+var providerDevices []*ProviderDevice
+
+// discoverProviderDevices returns the lights of all providers. Devices of
+// the given list will be reused to keep their state.
+func (configuration *Configuration) discoverProviderDevices(existing []*ProviderDevice) []*ProviderDevice {
+	var devices []*ProviderDevice
+	for _, name := range lightProviderNames() {
+		discovered, err := lightProviders[name].Discover(configuration)
+		if err != nil {
+			scheduleLog.Warningf("💡 Failed to discover %s lights: %v", name, err)
+		}
+		for _, light := range discovered {
+			device := &ProviderDevice{ProviderLight: light}
+			for _, candidate := range existing {
+				if candidate.ProviderLight == light {
+					device = candidate
+				}
+			}
+			devices = append(devices, device)
+		}
+	}
+	return devices
+}
+
+// updateProviderDevices reads the state of all provider lights and updates
+// them according to their schedules.
+func updateProviderDevices() {
+	providerDevices = configuration.discoverProviderDevices(providerDevices)
+	now := time.Now()
+	for _, device := range providerDevices {
+		device.update(now)
+	}
+}
+
+// updateSchedule calculates the schedule of the device for the given day.
+func (device *ProviderDevice) updateSchedule(now time.Time) bool {
+	for _, lightSchedule := range configuration.Schedules {
+		if lightSchedule.Name != device.Schedule {
+			continue
+		}
+		if !moonPhaseMatches(lightSchedule.MoonPhases, now) {
+			return false
+		}
+		if !reflect.DeepEqual(lightSchedule, device.lightSchedule) || now.After(device.schedule.endOfDay) {
+			device.lightSchedule = lightSchedule
+			device.schedule = configuration.scheduleForDay(lightSchedule, now)
+		}
+		return true
+	}
+	return false
+}
+
+func (device *ProviderDevice) update(now time.Time) {
+	provider, found := lightProviders[device.Provider]
+	if !found || !device.updateSchedule(now) {
+		return
+	}
+	target, err := device.schedule.lightStateAt(now)
+	if err != nil {
+		scheduleLog.Warningf("💡 Light %s - Could not determine interval for current schedule: %v", device.Name, err)
+		return
+	}
+	device.TargetLightState = target
+
+	state, err := provider.GetState(device.ProviderLight)
+	if err != nil {
+		if device.Reachable {
+			scheduleLog.Printf("💡 Light %s - Light is no longer reachable: %v", device.Name, err)
+		}
+		state = ProviderState{}
+	}
+	device.Reachable = state.Reachable
+	device.On = state.On
+
+	if !device.Reachable || !device.On {
+		if device.tracking {
+			scheduleLog.Printf("💡 Light %s - Light was turned off. Clearing state...", device.Name)
+		}
+		device.tracking = false
+		device.Automatic = false
+		return
+	}
+
+	if !device.tracking {
+		scheduleLog.Printf("💡 Light %s - Light just appeared.", device.Name)
+		device.tracking = true
+		device.Automatic = device.schedule.enableWhenLightsAppear
+	}
+	if !device.Automatic {
+		return
+	}
+
+	// Did the user change the light manually?
+	if state.Changed {
+		scheduleLog.Printf("💡 Light %s - Light state has been changed manually. Disabling Kelvin...", device.Name)
+		device.Automatic = false
+		return
+	}
+
+	updated, err := provider.SetState(device.ProviderLight, device.TargetLightState, device.schedule.transitionTime)
+	if err != nil {
+		scheduleLog.Warningf("💡 Light %s - Failed to update light: %v", device.Name, err)
+		return
+	}
+	if updated {
+		scheduleLog.Printf("💡 Light %s - Updated light state to %vK at %v%% brightness", device.Name, device.TargetLightState.ColorTemperature, device.TargetLightState.Brightness)
+	}
+}
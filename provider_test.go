@@ -0,0 +1,86 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+type testProvider struct {
+	state ProviderState
+	sent  []LightState
+}
+
+func (provider *testProvider) Discover(configuration *Configuration) ([]ProviderLight, error) {
+	return []ProviderLight{{Provider: "test", ID: "1", Name: "Test light", Schedule: "office"}}, nil
+}
+
+func (provider *testProvider) GetState(light ProviderLight) (ProviderState, error) {
+	return provider.state, nil
+}
+
+func (provider *testProvider) SetState(light ProviderLight, state LightState, transitionTime time.Duration) (bool, error) {
+	provider.sent = append(provider.sent, state)
+	return true, nil
+}
+
+func (provider *testProvider) Subscribe(events chan<- ProviderLight) bool {
+	return false
+}
+
+func TestLightProviders(t *testing.T) {
+	for _, name := range []string{"hue", "nanoleaf", "wled"} {
+		if _, found := lightProviders[name]; !found {
+			t.Errorf("Provider %s should be registered", name)
+		}
+	}
+
+	provider := &testProvider{state: ProviderState{Reachable: true, On: true}}
+	registerLightProvider("test", provider)
+	defer delete(lightProviders, "test")
+	useConfiguration(t, &Configuration{Schedules: []LightSchedule{{Name: "office", EnableWhenLightsAppear: true, DefaultColorTemperature: 4000, DefaultBrightness: 90}}})
+
+	devices := configuration.discoverProviderDevices(nil)
+	if len(devices) != 1 || devices[0].Name != "Test light" {
+		t.Fatalf("Expected the light of the test provider, got %+v", devices)
+	}
+	if reused := configuration.discoverProviderDevices(devices); reused[0] != devices[0] {
+		t.Errorf("Existing devices should be reused")
+	}
+
+	now := time.Now()
+	devices[0].update(now)
+	if !devices[0].Automatic || len(provider.sent) != 1 {
+		t.Fatalf("Appearing light should be taken over, sent %+v", provider.sent)
+	}
+	provider.state.Changed = true
+	devices[0].update(now)
+	if devices[0].Automatic || len(provider.sent) != 1 {
+		t.Errorf("Manual change should disable Kelvin")
+	}
+	provider.state = ProviderState{Reachable: true}
+	devices[0].update(now)
+	if devices[0].tracking {
+		t.Errorf("Light turned off should not be tracked")
+	}
+}
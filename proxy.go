@@ -0,0 +1,87 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+var proxySchemes = []string{"http", "https", "socks5"}
+
+// configuredProxy is the proxy for all requests to the internet. Without
+// one HTTP_PROXY, HTTPS_PROXY and NO_PROXY are honored.
+var configuredProxy *url.URL
+
+// internetTransport is used for all requests to the internet: the updater,
+// the geolocation and the weather.
+var internetTransport = newInternetTransport()
+
+// internetClient is the client for requests to services in the internet.
+var internetClient = &http.Client{Transport: internetTransport}
+
+// localTransport is used for bridges and other devices in the local
+// network. They must never be reached via a proxy, even if the
+// environment configures one.
+var localTransport = newLocalTransport()
+
+func newInternetTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = func(request *http.Request) (*url.URL, error) {
+		if configuredProxy != nil {
+			return configuredProxy, nil
+		}
+		return http.ProxyFromEnvironment(request)
+	}
+	return transport
+}
+
+func newLocalTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	return transport
+}
+
+// parseProxy parses the URL of a proxy like http://proxy.local:3128.
+func parseProxy(proxy string) (*url.URL, error) {
+	proxyURL, err := url.Parse(proxy)
+	if err != nil || !containsString(proxySchemes, proxyURL.Scheme) || proxyURL.Host == "" {
+		return nil, fmt.Errorf("Invalid proxy %s (expected e.g. http://proxy.local:3128)", proxy)
+	}
+	return proxyURL, nil
+}
+
+// configureProxy sets the proxy for all requests to the internet. An empty
+// proxy falls back to the environment.
+func configureProxy(proxy string) error {
+	if proxy == "" {
+		configuredProxy = nil
+		return nil
+	}
+	proxyURL, err := parseProxy(proxy)
+	if err != nil {
+		return err
+	}
+	configuredProxy = proxyURL
+	return nil
+}
@@ -0,0 +1,84 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+const defaultRequestsPerSecond = 10
+
+// Group commands are far more expensive for the bridge than light
+// commands. See https://developers.meethue.com/develop/application-design-guidance/hue-system-performance/
+const groupRequestCost = 10
+
+// requestQueue spaces out all requests to a bridge. Every caller reserves
+// the next free slot and waits for it, so bursts of light updates are
+// queued in order instead of overloading the bridge.
+type requestQueue struct {
+	interval time.Duration
+	lock     sync.Mutex
+	next     time.Time
+}
+
+func newRequestQueue(requestsPerSecond int) *requestQueue {
+	if requestsPerSecond <= 0 {
+		requestsPerSecond = defaultRequestsPerSecond
+	}
+	return &requestQueue{interval: time.Second / time.Duration(requestsPerSecond)}
+}
+
+// reserve returns the time the request of the given cost may be sent.
+func (queue *requestQueue) reserve(now time.Time, cost int) time.Time {
+	queue.lock.Lock()
+	defer queue.lock.Unlock()
+	slot := queue.next
+	if slot.Before(now) {
+		slot = now
+	}
+	queue.next = slot.Add(time.Duration(cost) * queue.interval)
+	return slot
+}
+
+// wait blocks until the request of the given cost may be sent.
+func (queue *requestQueue) wait(cost int) {
+	if queue == nil {
+		return
+	}
+	wait := time.Until(queue.reserve(time.Now(), cost))
+	if wait <= 0 {
+		return
+	}
+	if wait > time.Second {
+		hueLog.Debugf("⌘ Request queue is congested. Waiting %v...", wait)
+	}
+	time.Sleep(wait)
+}
+
+// throttle blocks until the next request to the bridge may be sent.
+func (bridge *HueBridge) throttle(cost int) {
+	if bridge == nil {
+		return
+	}
+	bridge.queue.wait(cost)
+}
@@ -0,0 +1,47 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestQueue(t *testing.T) {
+	queue := newRequestQueue(0)
+	if queue.interval != 100*time.Millisecond {
+		t.Fatalf("Expected default interval of 100ms, got %v", queue.interval)
+	}
+	now := time.Now()
+	expected := []time.Duration{0, 100 * time.Millisecond, 200 * time.Millisecond, 1200 * time.Millisecond}
+	costs := []int{1, 1, groupRequestCost, 1}
+	for i, cost := range costs {
+		if slot := queue.reserve(now, cost); !slot.Equal(now.Add(expected[i])) {
+			t.Errorf("Request %d was scheduled after %v; want %v", i, slot.Sub(now), expected[i])
+		}
+	}
+	if slot := queue.reserve(now.Add(time.Minute), 1); !slot.Equal(now.Add(time.Minute)) {
+		t.Errorf("Requests after an idle period should be sent immediately")
+	}
+	var disabled *requestQueue
+	disabled.wait(1)
+}
@@ -0,0 +1,105 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// reloadRequests asks the main loop to read the configuration again.
+var reloadRequests = make(chan bool, 1)
+
+// handleSIGHUP reloads the configuration whenever Kelvin receives SIGHUP,
+// e.g. by `systemctl reload kelvin`.
+func handleSIGHUP() {
+	sighup := make(chan os.Signal, 1)
+	signal.Notify(sighup, syscall.SIGHUP)
+	for range sighup {
+		log.Printf("🤖 Received signal SIGHUP. Reloading configuration...")
+		select {
+		case reloadRequests <- true:
+		default:
+		}
+	}
+}
+
+// requiresRestart returns true if the given configuration changes settings
+// which are only applied at startup.
+func (configuration *Configuration) requiresRestart(other *Configuration) bool {
+	return !reflect.DeepEqual(other.Bridge, configuration.Bridge) || !reflect.DeepEqual(other.Bridges, configuration.Bridges) || !reflect.DeepEqual(other.WebInterface, configuration.WebInterface) || !reflect.DeepEqual(other.Presence, configuration.Presence) || !reflect.DeepEqual(other.Weather, configuration.Weather) || !reflect.DeepEqual(other.Updates, configuration.Updates) || !reflect.DeepEqual(other.MQTT, configuration.MQTT) || !reflect.DeepEqual(other.HomeKit, configuration.HomeKit) || !reflect.DeepEqual(other.Calendar, configuration.Calendar)
+}
+
+// reloadConfiguration reads the configuration file again and applies it
+// to all lights. Invalid configurations are rejected and the current one
+// stays active. Overrides, paused schedules and lights changed manually
+// are kept.
+func reloadConfiguration() {
+	var reloaded Configuration
+	reloaded.ConfigurationFile = configuration.ConfigurationFile
+	err := reloaded.load()
+	if err != nil {
+		configLog.Warningf("⚙ Could not reload configuration: %v", err)
+		return
+	}
+	reloaded.Hash = reloaded.HashValue()
+	reloaded.migrateToLatestVersion()
+
+	report := reloaded.Validate()
+	if !report.Valid() {
+		for _, message := range report.Errors {
+			configLog.Warningf("⚙ %s", message)
+		}
+		configLog.Warningf("⚙ Configuration %s is invalid. Keeping the current configuration", reloaded.ConfigurationFile)
+		return
+	}
+	if configuration.requiresRestart(&reloaded) {
+		configLog.Warningf("⚙ Changes of the bridges, the web interface, the presence detection, the weather, the calendar, MQTT, HomeKit or the updates take effect after a restart")
+	}
+
+	*configuration = reloaded
+	err = configuration.Write()
+	if err != nil {
+		configLog.Warningf("⚙ Could not save migrated configuration: %v", err)
+	}
+	err = applyLogLevels(configuration.Logging)
+	if err != nil {
+		configLog.Warningf("⚙ Could not configure log levels: %v", err)
+	}
+	err = configureProxy(configuration.Proxy)
+	if err != nil {
+		configLog.Warningf("⚙ Could not configure proxy: %v", err)
+	}
+
+	configuration.resolveAssociations(lights, groups)
+	updateSunTable()
+	updateScenes()
+	for _, light := range lights {
+		updateScheduleForLight(light)
+	}
+	dashboardEvents.publish(dashboardEvent{Type: "schedule"})
+	configLog.Printf("⚙ Configuration %s reloaded", configuration.ConfigurationFile)
+}
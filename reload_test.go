@@ -0,0 +1,68 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestReloadConfiguration(t *testing.T) {
+	useBridges(t)
+
+	c := Configuration{}
+	c.ConfigurationFile = filepath.Join(t.TempDir(), "config.json")
+	c.initializeDefaults()
+	c.Location = Location{Latitude: 48.1, Longitude: 11.6}
+	err := c.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := c
+	useConfiguration(t, &current)
+
+	c.Schedules[0].Name = "reloaded"
+	c.Hash = ""
+	err = c.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloadConfiguration()
+	if configuration.Schedules[0].Name != "reloaded" {
+		t.Errorf("Expected reloaded schedule, got %s", configuration.Schedules[0].Name)
+	}
+	if configuration.requiresRestart(&c) {
+		t.Errorf("Changed schedules shouldn't require a restart")
+	}
+
+	c.Schedules[0].Name = "invalid"
+	c.Shutdown = &Shutdown{Timeout: "soon"}
+	c.Hash = ""
+	err = c.Write()
+	if err != nil {
+		t.Fatal(err)
+	}
+	reloadConfiguration()
+	if configuration.Schedules[0].Name != "reloaded" {
+		t.Errorf("Invalid configuration must not be applied")
+	}
+}
@@ -28,24 +28,41 @@ import "strings"
 
 func updateScenes() {
 	log.Debugf("🎨 Updating scenes...")
-	scenes, _ := bridge.bridge.AllScenes()
+	for _, b := range bridges {
+		updateScenesOfBridge(b)
+	}
+}
+
+func updateScenesOfBridge(b *HueBridge) {
+	if !b.available() {
+		log.Debugf("🎨 Bridge %s is unavailable. Skipping scenes...", b.Name)
+		return
+	}
+	b.throttle(1)
+	scenes, _ := b.bridge.AllScenes()
 	for _, scene := range scenes {
 		if strings.Contains(strings.ToLower(scene.Name), "kelvin") {
 			for _, schedule := range configuration.Schedules {
-				if strings.Contains(strings.ToLower(scene.Name), strings.ToLower(schedule.Name)) {
+				if schedule.Bridge == b.Name && strings.Contains(strings.ToLower(scene.Name), strings.ToLower(schedule.Name)) {
 					log.Debugf("🎨 Updating scene \"%s\" for schedule \"%s\"...", scene.Name, schedule.Name)
-					updateSceneForSchedule(scene, schedule)
+					updateSceneForSchedule(b, scene, schedule)
 				}
 			}
 		}
 	}
 }
 
-func updateSceneForSchedule(scene *hue.Scene, lightSchedule LightSchedule) {
+func updateSceneForSchedule(b *HueBridge, scene *hue.Scene, lightSchedule LightSchedule) {
 	// Updating lights
+	ids := lightSchedule.deviceIDs()
+	if len(ids) == 0 {
+		log.Debugf("🎨 Schedule \"%s\" has no associated lights. Skipping scene \"%s\"...", lightSchedule.Name, scene.Name)
+		return
+	}
 	var modifyScene hue.ModifyScene
-	modifyScene.Lights = toStringArray(lightSchedule.AssociatedDeviceIDs)
+	modifyScene.Lights = toStringArray(ids)
 
+	b.throttle(1)
 	_, err := scene.Modify(modifyScene)
 	if err != nil {
 		log.Warningf("🎨 %v", err)
@@ -53,21 +70,13 @@ func updateSceneForSchedule(scene *hue.Scene, lightSchedule LightSchedule) {
 	}
 
 	// Updating light states
-	light := lightSchedule.AssociatedDeviceIDs[0]
-	schedule, err := configuration.lightScheduleForDay(light, time.Now())
+	schedule := configuration.scheduleForDay(lightSchedule, time.Now())
+	state, err := schedule.lightStateAt(time.Now())
 	if err != nil {
 		log.Warningf("🎨 %v", err)
 		return
 	}
 
-	interval, err := schedule.currentInterval(time.Now())
-	if err != nil {
-		log.Warningf("🎨 %v", err)
-		return
-	}
-
-	state := interval.calculateLightStateInInterval(time.Now())
-
 	var modifyState hue.ModifyLightState
 	modifyState.On = true // turn lights on when the scene is activated
 
@@ -79,6 +88,7 @@ func updateSceneForSchedule(scene *hue.Scene, lightSchedule LightSchedule) {
 		modifyState.Brightness = uint8(mapBrightness(state.Brightness))
 	}
 
+	b.throttle(1)
 	_, err = scene.ModifyLightStates(modifyState)
 	if err != nil {
 		log.Warningf("🎨 %v", err)
@@ -23,6 +23,7 @@ package main
 
 import (
 	"fmt"
+	"sort"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -32,18 +33,98 @@ import (
 // Kelvin will calculate all light states based on the intervals
 // between this timestamps.
 type Schedule struct {
+	name                   string
 	endOfDay               time.Time
 	beforeSunrise          []TimeStamp
 	sunrise                TimeStamp
 	sunset                 TimeStamp
+	polar                  string
 	afterSunset            []TimeStamp
+	curve                  lightCurve
 	enableWhenLightsAppear bool
+	restoreOnStop          bool
+	restoreScene           string
+	requirePresence        bool
+	motionBoost            *motionBoost
+	switchOverride         *switchOverride
+	manualChange           *manualChange
+	deadBand               *DeadBand
+	nightlight             *nightlight
+	windDown               *windDown
+	powerOn                *PowerOn
+	luxCompensation        *LuxCompensation
+	weatherModifiers       []WeatherModifier
+	transitionTime         time.Duration
+	updateInterval         time.Duration
+	onOffThreshold         int
+	brightnessLimit        BrightnessLimit
+	lightBrightnessLimits  map[string]BrightnessLimit
+}
+
+// motionBoost is the parsed version of a configured MotionBoost.
+type motionBoost struct {
+	sensor     string
+	brightness int
+	duration   time.Duration
+}
+
+// manualChange is the parsed version of a configured ManualChange. The
+// tolerances are given in Kelvin and percent.
+type manualChange struct {
+	colorTemperature int
+	brightness       int
+	duration         time.Duration
+}
+
+// switchOverride is the parsed version of a configured SwitchOverride.
+type switchOverride struct {
+	switches []string
+	duration time.Duration
+}
+
+// ScheduleEntry represents a single point of a calculated schedule.
+// Inactive entries lay outside of their interval and are ignored.
+type ScheduleEntry struct {
+	Time             time.Time `json:"time"`
+	Type             string    `json:"type"`
+	ColorTemperature int       `json:"colorTemperature"`
+	Brightness       int       `json:"brightness"`
+	Active           bool      `json:"active"`
+}
+
+// Entries returns all points of the schedule ordered by time.
+func (schedule *Schedule) Entries() []ScheduleEntry {
+	var entries []ScheduleEntry
+	for _, timestamp := range schedule.beforeSunrise {
+		entries = append(entries, ScheduleEntry{timestamp.Time, "beforeSunrise", timestamp.ColorTemperature, timestamp.Brightness, timestamp.Time.Before(schedule.sunrise.Time)})
+	}
+	entries = append(entries, ScheduleEntry{schedule.sunrise.Time, "sunrise", schedule.sunrise.ColorTemperature, schedule.sunrise.Brightness, true})
+	entries = append(entries, ScheduleEntry{schedule.sunset.Time, "sunset", schedule.sunset.ColorTemperature, schedule.sunset.Brightness, true})
+	for _, timestamp := range schedule.afterSunset {
+		entries = append(entries, ScheduleEntry{timestamp.Time, "afterSunset", timestamp.ColorTemperature, timestamp.Brightness, timestamp.Time.After(schedule.sunset.Time)})
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+	return entries
+}
+
+// lightStateAt calculates the target light state of the schedule at the
+// given time. Schedules in elevation or auto mode follow the sun, all
+// others interpolate between their configured times.
+func (schedule *Schedule) lightStateAt(timestamp time.Time) (LightState, error) {
+	interval, err := schedule.currentInterval(timestamp)
+	if err != nil {
+		return LightState{}, err
+	}
+	if schedule.curve != nil {
+		return schedule.curve.stateAt(timestamp), nil
+	}
+	return interval.calculateLightStateInInterval(timestamp), nil
 }
 
 func (schedule *Schedule) currentInterval(timestamp time.Time) (Interval, error) {
 	// check if timestamp respresents the current day
 	if timestamp.After(schedule.endOfDay) {
-		return Interval{TimeStamp{time.Now(), 0, 0}, TimeStamp{time.Now(), 0, 0}}, fmt.Errorf("No current interval as the requested timestamp (%v) lays after the end of the current schedule (%v)", timestamp, schedule.endOfDay)
+		return Interval{TimeStamp{time.Now(), 0, 0, nil}, TimeStamp{time.Now(), 0, 0, nil}}, fmt.Errorf("No current interval as the requested timestamp (%v) lays after the end of the current schedule (%v)", timestamp, schedule.endOfDay)
 	}
 
 	// if we are between todays sunrise and sunset, return daylight interval
@@ -55,7 +136,7 @@ func (schedule *Schedule) currentInterval(timestamp time.Time) (Interval, error)
 	// Before sunrise
 	if timestamp.Before(schedule.sunrise.Time) {
 		yr, mth, dy := timestamp.Date()
-		startOfDay := TimeStamp{time.Date(yr, mth, dy, 0, 0, 0, 0, timestamp.Location()), -1, -1}
+		startOfDay := TimeStamp{time.Date(yr, mth, dy, 0, 0, 0, 0, timestamp.Location()), -1, -1, nil}
 		candidates := append(schedule.beforeSunrise, startOfDay, schedule.sunrise)
 
 		before, after = findTargetTimes(timestamp, candidates)
@@ -72,7 +153,7 @@ func (schedule *Schedule) currentInterval(timestamp time.Time) (Interval, error)
 	// After sunset
 	if timestamp.After(schedule.sunset.Time) {
 		yr, mth, dy := timestamp.Date()
-		endOfDay := TimeStamp{time.Date(yr, mth, dy, 23, 59, 59, 0, timestamp.Location()), -1, -1}
+		endOfDay := TimeStamp{time.Date(yr, mth, dy, 23, 59, 59, 0, timestamp.Location()), -1, -1, nil}
 		candidates := append(schedule.afterSunset, endOfDay, schedule.sunset)
 
 		before, after = findTargetTimes(timestamp, candidates)
@@ -88,11 +169,12 @@ func (schedule *Schedule) currentInterval(timestamp time.Time) (Interval, error)
 }
 
 func findTargetTimes(timestamp time.Time, candidates []TimeStamp) (TimeStamp, TimeStamp) {
-	beforeCandidate := TimeStamp{timestamp.AddDate(0, 0, -2), 0, 0}
-	afterCandidate := TimeStamp{timestamp.AddDate(0, 0, 2), 0, 0}
+	beforeCandidate := TimeStamp{timestamp.AddDate(0, 0, -2), 0, 0, nil}
+	afterCandidate := TimeStamp{timestamp.AddDate(0, 0, 2), 0, 0, nil}
 
 	for _, candidate := range candidates {
-		if candidate.Time.Before(timestamp) && candidate.Time.After(beforeCandidate.Time) {
+		// A candidate at exactly the given time starts the interval
+		if !candidate.Time.After(timestamp) && candidate.Time.After(beforeCandidate.Time) {
 			beforeCandidate = candidate
 			continue
 		}
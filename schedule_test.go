@@ -0,0 +1,54 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFindTargetTimesBoundaries(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2026, 3, 14, hour, minute, 0, 0, time.UTC)
+	}
+	candidates := []TimeStamp{
+		{at(0, 0), -1, -1, nil},
+		{at(6, 0), 2000, 40, nil},
+		{at(7, 0), 2700, 100, nil},
+	}
+
+	tests := []struct {
+		timestamp     time.Time
+		before, after time.Time
+	}{
+		{at(0, 0), at(0, 0), at(6, 0)},
+		{at(5, 59), at(0, 0), at(6, 0)},
+		{at(6, 0), at(6, 0), at(7, 0)},
+		{at(6, 30), at(6, 0), at(7, 0)},
+	}
+	for _, test := range tests {
+		before, after := findTargetTimes(test.timestamp, candidates)
+		if !before.Time.Equal(test.before) || !after.Time.Equal(test.after) {
+			t.Errorf("Interval for %v is %v - %v, expected %v - %v", test.timestamp, before.Time, after.Time, test.before, test.after)
+		}
+	}
+}
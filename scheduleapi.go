@@ -0,0 +1,276 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// applySchedules validates the given schedules and replaces the configured
+// ones if they are valid. The configuration is saved and all lights will
+// follow the new schedules. Otherwise the report contains all errors.
+// The schedules are applied in the main loop.
+func applySchedules(schedules []LightSchedule) (report ValidationReport, err error) {
+	inMainLoop(func() {
+		report, err = applySchedulesNow(schedules)
+	})
+	return report, err
+}
+
+func applySchedulesNow(schedules []LightSchedule) (ValidationReport, error) {
+	report := configuration.validateSchedules(schedules)
+	if !report.Valid() {
+		return report, nil
+	}
+
+	configuration.Schedules = schedules
+	configuration.resolveAssociations(lights, groups)
+	err := configuration.Write()
+	if err != nil {
+		return report, err
+	}
+
+	// Update scenes
+	updateScenes()
+
+	// Update lights
+	for _, light := range lights {
+		light := light
+		updateScheduleForLight(light)
+	}
+	dashboardEvents.publish(dashboardEvent{Type: "schedule"})
+	return report, nil
+}
+
+// writeSchedules applies the given schedules and reports the result. Invalid
+// schedules are rejected with the validation report.
+func writeSchedules(w http.ResponseWriter, schedules []LightSchedule, status int) {
+	report, err := applySchedules(schedules)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !report.Valid() {
+		status = http.StatusBadRequest
+	}
+	writeJSON(w, status, report)
+}
+
+func writeJSON(w http.ResponseWriter, status int, value interface{}) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(data)
+}
+
+func scheduleIndex(name string) int {
+	for index, lightSchedule := range configuration.Schedules {
+		if lightSchedule.Name == name {
+			return index
+		}
+	}
+	return -1
+}
+
+func decodeSchedule(r *http.Request) (LightSchedule, error) {
+	defer r.Body.Close()
+	var lightSchedule LightSchedule
+	err := json.NewDecoder(r.Body).Decode(&lightSchedule)
+	return lightSchedule, err
+}
+
+func listSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	webLog.Debugf("Serving schedules to %s", r.RemoteAddr)
+	writeJSON(w, http.StatusOK, configuration.Schedules)
+}
+
+func getScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	index := scheduleIndex(mux.Vars(r)["name"])
+	if index == -1 {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	writeJSON(w, http.StatusOK, configuration.Schedules[index])
+}
+
+func createScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	lightSchedule, err := decodeSchedule(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if scheduleIndex(lightSchedule.Name) != -1 {
+		http.Error(w, "Schedule "+lightSchedule.Name+" already exists", http.StatusConflict)
+		return
+	}
+	webLog.Printf("Adding schedule %s as requested by %s", lightSchedule.Name, r.RemoteAddr)
+	schedules := append(append([]LightSchedule{}, configuration.Schedules...), lightSchedule)
+	writeSchedules(w, schedules, http.StatusCreated)
+}
+
+func updateScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	index := scheduleIndex(name)
+	if index == -1 {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	lightSchedule, err := decodeSchedule(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if lightSchedule.Name == "" {
+		lightSchedule.Name = name
+	}
+	webLog.Printf("Updating schedule %s as requested by %s", name, r.RemoteAddr)
+	schedules := append([]LightSchedule{}, configuration.Schedules...)
+	schedules[index] = lightSchedule
+	writeSchedules(w, schedules, http.StatusOK)
+}
+
+func deleteScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	index := scheduleIndex(name)
+	if index == -1 {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	webLog.Printf("Removing schedule %s as requested by %s", name, r.RemoteAddr)
+	schedules := append(append([]LightSchedule{}, configuration.Schedules[:index]...), configuration.Schedules[index+1:]...)
+	writeSchedules(w, schedules, http.StatusOK)
+}
+
+// simulateScheduleHandler computes the schedule for the requested day.
+func simulateScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	index := scheduleIndex(mux.Vars(r)["name"])
+	if index == -1 {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	date, err := requestedDate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, configuration.simulate(configuration.Schedules[index], date))
+}
+
+// validateSchedulesHandler checks the given schedules without applying them.
+func validateSchedulesHandler(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	var schedules []LightSchedule
+	err := json.NewDecoder(r.Body).Decode(&schedules)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	writeJSON(w, http.StatusOK, configuration.validateSchedules(schedules))
+}
+
+// schedulePause is the answer to a pause or resume request.
+type schedulePause struct {
+	Schedule    string     `json:"schedule"`
+	Paused      bool       `json:"paused"`
+	PausedUntil *time.Time `json:"pausedUntil,omitempty"`
+}
+
+// pauseSchedule hands all lights of the given schedule over to the user
+// until the given time.
+func pauseSchedule(name string, until time.Time) {
+	for _, light := range lights {
+		if light.Scheduled && light.Schedule.name == name && until.After(light.activeOverride.Until) {
+			light.override(Override{Until: until, Reason: overrideReasonPause})
+		}
+	}
+}
+
+// resumeSchedule hands all lights of the given schedule back to Kelvin.
+func resumeSchedule(name string, now time.Time) {
+	for _, light := range lights {
+		if !light.Scheduled || light.Schedule.name != name {
+			continue
+		}
+		light.endOverride(now)
+	}
+}
+
+// pauseScheduleUntil persists the pause of a schedule, so it survives a
+// restart, and hands its lights over immediately.
+func pauseScheduleUntil(name string, until time.Time, now time.Time) {
+	err := runtimeState.pause(name, until, now)
+	if err != nil {
+		configLog.Warningf("⚙ Could not save state: %v", err)
+	}
+	pauseSchedule(name, until)
+}
+
+// resumePausedSchedule ends the pause of a schedule early.
+func resumePausedSchedule(name string, now time.Time) {
+	_, err := runtimeState.resume(name, now)
+	if err != nil {
+		configLog.Warningf("⚙ Could not save state: %v", err)
+	}
+	resumeSchedule(name, now)
+}
+
+// pauseScheduleHandler disables a schedule for the given duration. The
+// pause survives a restart of Kelvin.
+func pauseScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if scheduleIndex(name) == -1 {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+	duration, err := parsePositiveDuration(r.URL.Query().Get("duration"), defaultManualOverrideDuration)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	until := now.Add(duration)
+	webLog.Printf("Pausing schedule %s for %v as requested by %s", name, duration, r.RemoteAddr)
+	inMainLoop(func() { pauseScheduleUntil(name, until, now) })
+	writeJSON(w, http.StatusOK, schedulePause{name, true, &until})
+}
+
+func resumeScheduleHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if scheduleIndex(name) == -1 {
+		http.Error(w, "Schedule not found", http.StatusNotFound)
+		return
+	}
+
+	now := time.Now()
+	webLog.Printf("Resuming schedule %s as requested by %s", name, r.RemoteAddr)
+	inMainLoop(func() { resumePausedSchedule(name, now) })
+	writeJSON(w, http.StatusOK, schedulePause{Schedule: name})
+}
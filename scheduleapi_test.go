@@ -0,0 +1,83 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestPauseSchedule(t *testing.T) {
+	filename := useRuntimeState(t)
+	useConfiguration(t, &Configuration{Schedules: []LightSchedule{{Name: "livingroom"}}})
+	light := &Light{Name: "Couch", Scheduled: true, Tracking: true, Reachable: true, On: true, Automatic: true, Schedule: Schedule{name: "livingroom"}}
+	other := &Light{Name: "Desk", Scheduled: true, Tracking: true, Reachable: true, On: true, Automatic: true, Schedule: Schedule{name: "office"}}
+	useLights(t, light, other)
+
+	router := newRouter()
+	recorder := serveRequest(router, "POST", "/api/schedules/livingroom/pause?duration=2h", nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Pause returned HTTP %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if light.Automatic || !light.overridden(time.Now().Add(119*time.Minute)) || light.overridden(time.Now().Add(121*time.Minute)) {
+		t.Errorf("Light of paused schedule should be left alone for 2h (until %v)", light.activeOverride.Until)
+	}
+	if !other.Automatic || other.overridden(time.Now()) {
+		t.Errorf("Light of another schedule should not be paused")
+	}
+
+	// The pause survives a restart and applies to the schedule of the next day
+	runtimeState.close()
+	restored, err := loadState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.close()
+	if _, paused := restored.pausedUntil("livingroom", time.Now()); !paused {
+		t.Errorf("Pause was not persisted: %+v", restored.PausedSchedules)
+	}
+	runtimeState = restored
+	restarted := &Light{Name: "Couch", Automatic: true}
+	restarted.updateSchedule(Schedule{name: "livingroom"})
+	if !restarted.overridden(time.Now()) {
+		t.Errorf("Pause should be restored after a restart")
+	}
+
+	recorder = serveRequest(router, "POST", "/api/schedules/livingroom/resume", nil)
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("Resume returned HTTP %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if !light.Automatic || light.overridden(time.Now()) {
+		t.Errorf("Light should be controlled by Kelvin after resuming the schedule")
+	}
+	if _, paused := runtimeState.pausedUntil("livingroom", time.Now()); paused {
+		t.Errorf("Schedule should not be paused after resuming")
+	}
+
+	for path, code := range map[string]int{"/api/schedules/office/pause": http.StatusNotFound, "/api/schedules/livingroom/pause?duration=-1h": http.StatusBadRequest} {
+		recorder = serveRequest(router, "POST", path, nil)
+		if recorder.Code != code {
+			t.Errorf("POST %s returned HTTP %d instead of %d", path, recorder.Code, code)
+		}
+	}
+}
@@ -0,0 +1,335 @@
+// MIT License
+//
+// Copyright (c) 2018 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// timePattern matches all valid values of TimedColorTemperature.Time:
+// absolute times (hh:mm) and times relative to the previous entry (+45m).
+const timePattern = `^(([01]?[0-9]|2[0-3]):[0-5][0-9]|\+([0-9]+(\.[0-9]+)?(h|m|s))+)$`
+
+// schema is a small helper to keep the schema definition readable.
+type schema map[string]interface{}
+
+func objectSchema(description string, properties schema) schema {
+	return schema{"type": "object", "description": description, "properties": properties, "additionalProperties": false}
+}
+
+func arraySchema(description string, items schema) schema {
+	return schema{"type": "array", "description": description, "items": items}
+}
+
+func mapSchema(description string, values schema) schema {
+	return schema{"type": "object", "description": description, "additionalProperties": values}
+}
+
+func locationSchema(description string) schema {
+	return objectSchema(description, schema{
+		"latitude":     schema{"type": "number", "minimum": -90, "maximum": 90},
+		"longitude":    schema{"type": "number", "minimum": -180, "maximum": 180},
+		"calculator":   schema{"type": "string", "enum": sunCalculators, "description": "Algorithm used to calculate sunrise and sunset: astrotime (default) or noaa for sub-minute accuracy."},
+		"refraction":   simpleSchema("boolean", "Correct the sun times for the atmospheric refraction. Requires the noaa calculator."),
+		"twilight":     simpleSchema("string", "Elevation of the sun defining sunrise and sunset: golden (default, 6°), official (-0.833°), civil (-6°), nautical (-12°), astronomical (-18°) or an angle in degrees."),
+		"elevation":    schema{"type": "number", "minimum": 0, "maximum": maxObserverElevation, "description": "Altitude of the observer in meters above sea level. The lower horizon delays the sunset and advances the sunrise."},
+		"polarSunrise": simpleSchema("string", "Sunrise in the format hh:mm on days without sunrise or sunset. Uses the times of the last regular day if empty."),
+		"polarSunset":  simpleSchema("string", "Sunset in the format hh:mm on days without sunrise or sunset. Uses the times of the last regular day if empty."),
+	})
+}
+
+func bridgeSchema(description string) schema {
+	return objectSchema(description, schema{
+		"name":                   simpleSchema("string", "Name of the bridge used to reference it in schedules. Empty for the default bridge."),
+		"ip":                     simpleSchema("string", "IP address of the bridge. Discovered automatically if empty."),
+		"username":               simpleSchema("string", "Username registered at the bridge. Obtained automatically if empty."),
+		"usernameFile":           simpleSchema("string", "File containing the username, relative to the configuration."),
+		"certificateFingerprint": simpleSchema("string", "SHA-256 fingerprint of the pinned bridge certificate. Managed by Kelvin."),
+		"requestsPerSecond":      schema{"type": "integer", "minimum": 1, "description": "Maximum number of requests sent to the bridge per second (default 10)."},
+	})
+}
+
+func simpleSchema(kind string, description string) schema {
+	return schema{"type": kind, "description": description}
+}
+
+func colorTemperatureSchema(description string) schema {
+	return schema{"description": description, "oneOf": []schema{
+		{"type": "integer", "minimum": 1000, "maximum": 6500},
+		{"const": -1},
+	}}
+}
+
+func brightnessSchema(description string) schema {
+	return schema{"description": description, "oneOf": []schema{
+		{"type": "integer", "minimum": 0, "maximum": 100},
+		{"const": -1},
+	}}
+}
+
+func timedColorTemperatureSchema() schema {
+	return objectSchema("A light state which will be reached at the given time.", schema{
+		"time":             schema{"type": "string", "description": "Absolute time (hh:mm) or time relative to the previous entry (e.g. +45m or +1h30m).", "pattern": timePattern},
+		"colorTemperature": colorTemperatureSchema("Color temperature in Kelvin or -1 to ignore."),
+		"brightness":       brightnessSchema("Brightness in percent or -1 to ignore."),
+		"gradient":         arraySchema("Color temperatures along gradient lightstrips from one end to the other. Other lights use colorTemperature.", schema{"type": "integer", "minimum": 1000, "maximum": 6500}),
+		"moonPhases":       arraySchema("Moon phases in which the entry is used. Every phase if empty.", schema{"type": "string", "enum": moonPhases}),
+	})
+}
+
+// ConfigurationSchema returns a JSON schema describing the configuration
+// file format.
+func ConfigurationSchema() schema {
+	root := objectSchema("Configuration of Kelvin.", schema{
+		"version":   simpleSchema("integer", "Version of the configuration format. Managed by Kelvin."),
+		"bridge":    bridgeSchema("The Philips Hue bridge to connect to."),
+		"bridges":   arraySchema("Additional bridges which can be referenced by schedules.", bridgeSchema("An additional Philips Hue bridge. Requires a name and an IP.")),
+		"location":  locationSchema("Position on earth used to calculate sunrise and sunset."),
+		"locations": mapSchema("Additional named locations which can be referenced by schedules.", locationSchema("Position on earth used to calculate sunrise and sunset.")),
+		"webinterface": objectSchema("The web interface of Kelvin.", schema{
+			"enabled":  simpleSchema("boolean", "Start the web interface."),
+			"port":     schema{"type": "integer", "minimum": 1, "maximum": 65535},
+			"token":    simpleSchema("string", "Require this token as bearer token or password to access the web interface."),
+			"username": simpleSchema("string", "Require basic authentication with this username and the password."),
+			"password": simpleSchema("string", "Password for basic authentication."),
+			"tls": objectSchema("Serve the web interface via HTTPS. Without certificate and key a self-signed certificate is generated.", schema{
+				"certificate": simpleSchema("string", "Path to the PEM encoded certificate (relative to the configuration)."),
+				"key":         simpleSchema("string", "Path to the PEM encoded private key (relative to the configuration)."),
+			}),
+			"corsOrigins": arraySchema("Origins allowed to call the API from the browser, e.g. https://dashboard.example.com. List every origin explicitly.", schema{"type": "string"}),
+		}),
+		"transitionTime":      simpleSchema("string", "Duration of the fade for every light update, e.g. 400ms (default) or 10s."),
+		"updateInterval":      simpleSchema("string", "Interval between two light state updates, e.g. 1m (default) or 10m."),
+		"idlePollingInterval": simpleSchema("string", "Interval between two polls of the bridge while no light state changes, e.g. 30s. Lights are polled every second if empty."),
+		"nanoleafTokens":      schema{"type": "object", "description": "Tokens of paired Nanoleaf controllers by host. Written by kelvin pair -nanoleaf.", "additionalProperties": schema{"type": "string"}},
+		"webhooks": arraySchema("URLs which are notified about events via HTTP POST.", objectSchema("A URL which is notified about events.", schema{
+			"url":    simpleSchema("string", "The URL to post the events to."),
+			"events": arraySchema("Events to report. All events are reported if empty.", schema{"type": "string", "enum": webhookEvents}),
+		})),
+		"wakeups": arraySchema("Alarms which turn lights on and slowly brighten them.", objectSchema("A wake-up alarm.", schema{
+			"name":             simpleSchema("string", "Name of the wake-up used in the log."),
+			"days":             arraySchema("Days of the week, e.g. mon-fri or sat. Every day if empty.", schema{"type": "string"}),
+			"time":             simpleSchema("string", "Start of the wake-up in the format hh:mm."),
+			"duration":         simpleSchema("string", "Duration of the ramp, e.g. 20m (default)."),
+			"lights":           arraySchema("Names of the lights to wake up with.", schema{"type": "string"}),
+			"bridge":           simpleSchema("string", "Name of the bridge controlling the lights. Uses the default bridge if empty."),
+			"colorTemperature": schema{"type": "integer", "minimum": 1000, "maximum": 6500, "description": "Color temperature in Kelvin at the end of the ramp (default 5000)."},
+			"brightness":       schema{"type": "integer", "minimum": 0, "maximum": 100, "description": "Brightness in percent at the end of the ramp (default 100)."},
+		})),
+		"awaySimulation": objectSchema("Turns lights on and off in the evening to make the house look occupied.", schema{
+			"enabled":       simpleSchema("boolean", "Simulate presence. Can also be started and stopped via the API."),
+			"lights":        arraySchema("Names of the lights to switch. All scheduled lights if empty.", schema{"type": "string"}),
+			"bridge":        simpleSchema("string", "Name of the bridge controlling the lights. Uses the default bridge if empty."),
+			"bedtime":       simpleSchema("string", "Time to turn the lights off in the format hh:mm (default 23:00)."),
+			"randomization": simpleSchema("string", "Maximum random offset of every switch, e.g. 30m (default)."),
+		}),
+		"presence": objectSchema("Detects if someone is home.", schema{
+			"devices": arraySchema("Phones or other devices which are only on the network while their owner is home.", objectSchema("A device on the network.", schema{
+				"name": simpleSchema("string", "Name of the device used in the log."),
+				"host": simpleSchema("string", "Hostname or IP address to ping."),
+				"mac":  simpleSchema("string", "MAC address to look up in the ARP table."),
+			})),
+			"mqtt": objectSchema("A topic which reports if someone is home.", schema{
+				"broker":   simpleSchema("string", "Address of the MQTT broker, e.g. tcp://192.168.1.2:1883 or ssl://broker.example.com."),
+				"topic":    simpleSchema("string", "Topic to subscribe to."),
+				"username": simpleSchema("string", "Username for the broker."),
+				"password": simpleSchema("string", "Password for the broker."),
+				"payload":  simpleSchema("string", "Payload signaling that someone is home (default home). Every other payload means nobody is home."),
+			}),
+			"timeout":       simpleSchema("string", "Duration after the last device was seen until nobody is considered home, e.g. 10m (default)."),
+			"snapOnArrival": simpleSchema("boolean", "Update all lights to their schedule right away when someone comes home."),
+		}),
+		"weather": objectSchema("Provider of the current cloud cover at the configured location. Used by the weather modifiers of schedules.", schema{
+			"provider":       schema{"type": "string", "enum": weatherProviders, "description": "metno (default, no API key required) or openweathermap."},
+			"apiKey":         simpleSchema("string", "API key of OpenWeatherMap."),
+			"updateInterval": simpleSchema("string", "Interval between two weather updates, e.g. 30m (default). At least 10m."),
+		}),
+		"logging": objectSchema("Destination of the log messages of Kelvin.", schema{
+			"output":  schema{"type": "string", "enum": logOutputs, "description": "stdout (default), syslog or journald."},
+			"address": simpleSchema("string", "Address of a remote syslog server, e.g. udp://192.168.1.5:514. Uses the local syslog daemon if empty."),
+			"tag":     simpleSchema("string", "Name Kelvin reports to syslog and journald (default kelvin)."),
+			"level":   schema{"type": "string", "enum": logLevels, "description": "Default log level (default info)."},
+			"levels": objectSchema("Log levels of individual modules overriding the default level.", schema{
+				logModuleConfig:   schema{"type": "string", "enum": logLevels},
+				logModuleSchedule: schema{"type": "string", "enum": logLevels},
+				logModuleHue:      schema{"type": "string", "enum": logLevels},
+				logModuleWeb:      schema{"type": "string", "enum": logLevels},
+				logModuleUpdater:  schema{"type": "string", "enum": logLevels},
+			}),
+			"crashReports": simpleSchema("string", "Directory for a report of every crash Kelvin recovered from, relative to the configuration. No reports are written if empty."),
+		}),
+		"tracing": objectSchema("Export of the update cycles as OpenTelemetry traces.", schema{
+			"endpoint":    simpleSchema("string", "URL of the OTLP/HTTP endpoint of the collector, e.g. http://localhost:4318."),
+			"serviceName": simpleSchema("string", "Service name of the exported traces (default kelvin)."),
+			"headers":     mapSchema("HTTP headers sent with every export, e.g. for authentication.", schema{"type": "string"}),
+		}),
+		"statsd": objectSchema("StatsD server the metrics of Kelvin are pushed to.", schema{
+			"address": simpleSchema("string", "Address of the server in the format host:port (default localhost:8125)."),
+			"prefix":  simpleSchema("string", "Prefix of all metric names (default kelvin)."),
+			"format":  schema{"type": "string", "enum": statsDFormats, "description": "statsd (default) or datadog to add tags to the metrics."},
+			"tags":    arraySchema("Tags added to all metrics in the datadog format, e.g. env:home.", schema{"type": "string"}),
+		}),
+		"shutdown": objectSchema("What happens to the lights controlled by Kelvin when it stops.", schema{
+			"restore": simpleSchema("boolean", "Restore the state of all lights from before Kelvin took control."),
+			"scene":   simpleSchema("string", "Name of a scene on every bridge which is activated instead."),
+			"timeout": simpleSchema("string", "Maximum duration of the shutdown (default 15s)."),
+		}),
+		"proxy": simpleSchema("string", "Proxy for all requests to the internet, e.g. http://proxy.local:3128. HTTP_PROXY and HTTPS_PROXY are used if empty."),
+		"updates": objectSchema("Source of the automatic updates.", schema{
+			"repository": simpleSchema("string", "GitHub repository releases are installed from in the format owner/name."),
+			"url":        simpleSchema("string", "API URL of the repository, e.g. for GitHub Enterprise. Takes precedence over repository."),
+			"enabled":    simpleSchema("boolean", "Set to false to never look for updates or replace the binary (default true)."),
+			"publicKey":  simpleSchema("string", "Minisign public key the checksums of every release have to be signed with."),
+			"window":     simpleSchema("string", "Time of day updates may be installed, e.g. 03:00-05:00. Any time if empty."),
+			"channel":    schema{"type": "string", "enum": updateChannels, "description": "stable (default) or beta to include pre-releases."},
+		}),
+		"mqtt": objectSchema("MQTT broker Kelvin publishes the state of all lights to and receives commands from.", schema{
+			"broker":   simpleSchema("string", "Address of the MQTT broker, e.g. tcp://192.168.1.2:1883 or ssl://broker.example.com."),
+			"username": simpleSchema("string", "Username for the broker."),
+			"password": simpleSchema("string", "Password for the broker."),
+			"topic":    simpleSchema("string", "Prefix of all topics (default kelvin)."),
+		}),
+		"homekit": objectSchema("HomeKit accessory with a switch for every schedule.", schema{
+			"name":          simpleSchema("string", "Name of the accessory in the Home app (default Kelvin)."),
+			"pin":           simpleSchema("string", "8 digit setup code for pairing (default 00102003)."),
+			"port":          simpleSchema("integer", "TCP port of the accessory. A random port is used if empty."),
+			"pauseDuration": simpleSchema("string", "How long a schedule stays paused after its switch was turned off (default 12h)."),
+		}),
+		"calendar": objectSchema("iCalendar whose events change the behavior of Kelvin while they last.", schema{
+			"url":            simpleSchema("string", "URL (http, https or webcal) or path of the .ics file."),
+			"updateInterval": simpleSchema("string", "How often the calendar is read (default 1h, at least 5m)."),
+			"rules": arraySchema("Actions for events with matching summaries.", objectSchema("Action for all events whose summary contains the given text.", schema{
+				"summary":   simpleSchema("string", "Text the summary of the event has to contain, e.g. Vacation. Case is ignored."),
+				"action":    schema{"type": "string", "enum": calendarActions, "description": "disable pauses schedules, schedule activates an alternate schedule and awaySimulation starts the away simulation."},
+				"schedules": arraySchema("Schedules paused by action disable (all if empty).", schema{"type": "string"}),
+				"schedule":  simpleSchema("string", "Alternate schedule of action schedule. It is only used during matching events."),
+			})),
+		}),
+		"schedules": arraySchema("All configured schedules.", objectSchema("The daily schedule for the associated lights.", schema{
+			"name":                   simpleSchema("string", "Unique name of the schedule."),
+			"associatedDeviceIDs":    arraySchema("IDs of all lights managed by this schedule.", schema{"type": "integer"}),
+			"associatedDeviceNames":  arraySchema("Names of all lights managed by this schedule.", schema{"type": "string"}),
+			"associatedGroups":       arraySchema("Names of all rooms, zones and groups managed by this schedule.", schema{"type": "string"}),
+			"wled":                   arraySchema("Hostnames or IP addresses of WLED controllers managed by this schedule.", schema{"type": "string"}),
+			"nanoleaf":               arraySchema("Hostnames or IP addresses of Nanoleaf controllers managed by this schedule. Pair them with kelvin pair -nanoleaf first.", schema{"type": "string"}),
+			"default":                simpleSchema("boolean", "Manage all lights not associated with any other schedule."),
+			"bridge":                 simpleSchema("string", "Name of the bridge controlling the lights of this schedule. Uses the default bridge if empty."),
+			"location":               simpleSchema("string", "Name of the location used for this schedule. Uses the default location if empty."),
+			"twilight":               simpleSchema("string", "Elevation of the sun defining sunrise and sunset for this schedule. Uses the twilight of the location if empty."),
+			"moonPhases":             arraySchema("Moon phases in which the schedule manages its lights. Every phase if empty.", schema{"type": "string", "enum": moonPhases}),
+			"priority":               simpleSchema("integer", "If a light is associated with multiple schedules the one with the highest priority is used."),
+			"enableWhenLightsAppear": simpleSchema("boolean", "Take over lights automatically when they are turned on."),
+			"restoreOnStop":          simpleSchema("boolean", "Restore the light state from before Kelvin took control when Kelvin stops managing a light."),
+			"restoreScene":           simpleSchema("string", "Scene to activate instead of restoring the previous light state."),
+			"requirePresence":        simpleSchema("boolean", "Only adjust the lights while someone is home. Requires presence detection."),
+			"motionBoost": objectSchema("Raise the brightness while a motion sensor detects presence.", schema{
+				"sensor":     simpleSchema("string", "Name of the motion sensor as shown in the Hue app."),
+				"brightness": schema{"type": "integer", "minimum": 0, "maximum": 100, "description": "Brightness in percent while motion is detected."},
+				"duration":   simpleSchema("string", "Duration to keep the brightness after the last motion, e.g. 5m (default)."),
+			}),
+			"switchOverride": objectSchema("Pause Kelvin for the lights of this schedule whenever a switch is used.", schema{
+				"switches": arraySchema("Names of the switches as shown in the Hue app.", schema{"type": "string"}),
+				"duration": simpleSchema("string", "Duration until Kelvin resumes after the last button press, e.g. 1h (default)."),
+			}),
+			"manualChange": objectSchema("Tune when a changed light state counts as a manual change.", schema{
+				"colorTemperature": schema{"type": "integer", "minimum": 0, "maximum": 5500, "description": "Tolerated deviation of the color temperature in Kelvin."},
+				"brightness":       schema{"type": "integer", "minimum": 0, "maximum": 100, "description": "Tolerated deviation of the brightness in percent."},
+				"duration":         simpleSchema("string", "Duration until Kelvin resumes after a manual change, e.g. 2h. Kelvin waits until the light is turned off if empty."),
+			}),
+			"nightlight": objectSchema("Dim lights which are turned on at night and leave them alone until the morning.", schema{
+				"start":            simpleSchema("string", "Start of the nightlight in the format hh:mm, e.g. 23:00."),
+				"end":              simpleSchema("string", "End of the nightlight in the format hh:mm, e.g. 06:00."),
+				"colorTemperature": schema{"type": "integer", "minimum": 1000, "maximum": 6500, "description": "Color temperature of the nightlight in Kelvin (default 2000)."},
+				"brightness":       schema{"type": "integer", "minimum": 0, "maximum": 100, "description": "Brightness of the nightlight in percent (default 5)."},
+			}),
+			"windDown": objectSchema("Dim and warm the lights progressively at bedtime.", schema{
+				"days":             arraySchema("Days of the week, e.g. sun-thu or fri. Every day if empty.", schema{"type": "string"}),
+				"time":             simpleSchema("string", "Start of the wind-down in the format hh:mm, e.g. 22:00."),
+				"duration":         simpleSchema("string", "Duration of the wind-down, e.g. 30m (default). It must end before midnight."),
+				"colorTemperature": schema{"type": "integer", "minimum": 1000, "maximum": 6500, "description": "Color temperature in Kelvin at the end of the wind-down (default 2000)."},
+				"brightness":       schema{"type": "integer", "minimum": 0, "maximum": 100, "description": "Brightness in percent at the end of the wind-down (default 10)."},
+				"turnOff":          simpleSchema("boolean", "Turn the lights off at the end of the wind-down."),
+			}),
+			"deadBand": objectSchema("Skip light updates which change the light state only slightly.", schema{
+				"colorTemperature": schema{"type": "integer", "minimum": 0, "maximum": 5500, "description": "Smallest change of the color temperature in Kelvin which is sent to the lights."},
+				"brightness":       schema{"type": "integer", "minimum": 0, "maximum": 100, "description": "Smallest change of the brightness in percent which is sent to the lights."},
+			}),
+			"powerOn": objectSchema("Handle lights which are powered on at the wall after they were unreachable.", schema{
+				"reapply":       simpleSchema("boolean", "Take over lights immediately when they become reachable again, even if enableWhenLightsAppear is disabled."),
+				"configureBulb": simpleSchema("boolean", "Configure the power on behavior of Hue bulbs to follow the schedule."),
+			}),
+			"luxCompensation": objectSchema("Scale the brightness depending on the ambient light level.", schema{
+				"sensor": simpleSchema("string", "Name of the motion or light level sensor as shown in the Hue app."),
+				"ranges": arraySchema("Lux ranges and their brightness multipliers. The first matching range is used.", objectSchema("A range of ambient light levels.", schema{
+					"minLux":     schema{"type": "number", "minimum": 0, "description": "Lower bound of the range (inclusive)."},
+					"maxLux":     schema{"type": "number", "minimum": 0, "description": "Upper bound of the range (exclusive). 0 leaves the range open ended."},
+					"multiplier": schema{"type": "number", "exclusiveMinimum": 0, "description": "Factor applied to the scheduled brightness."},
+				})),
+			}),
+			"weatherModifiers": arraySchema("Adjustments of the light state during daylight depending on the cloud cover. The modifier with the highest exceeded cloud cover is used.", objectSchema("An adjustment for cloudy weather.", schema{
+				"cloudCover":       schema{"type": "integer", "minimum": 0, "maximum": 100, "description": "The modifier applies while the cloud cover in percent exceeds this value."},
+				"colorTemperature": schema{"type": "integer", "minimum": -5500, "maximum": 5500, "description": "Kelvin added to the scheduled color temperature."},
+				"brightness":       schema{"type": "integer", "minimum": -100, "maximum": 100, "description": "Percent added to the scheduled brightness."},
+			})),
+			"mode": schema{"type": "string", "enum": scheduleModes, "description": "times (default) follows the entries before sunrise and after sunset. elevation follows the elevation of the sun with the elevation curve. auto derives a curve from the location."},
+			"auto": objectSchema("Settings of the curve in mode auto.", schema{
+				"maxColorTemperature":     schema{"type": "integer", "minimum": 1000, "maximum": 6500, "description": "Color temperature in Kelvin when the sun is at its highest (default 5500)."},
+				"eveningColorTemperature": schema{"type": "integer", "minimum": 1000, "maximum": 6500, "description": "Color temperature in Kelvin after dusk and at night (default 2200)."},
+				"bedtime":                 simpleSchema("string", "Time in the format hh:mm when the lights reach their night state, e.g. 23:00 (default)."),
+			}),
+			"elevationCurve": arraySchema("Light states by elevation of the sun in degrees for mode elevation. States in between are interpolated. A default curve is used if empty.", objectSchema("The light state at an elevation of the sun.", schema{
+				"elevation":        schema{"type": "number", "minimum": -90, "maximum": 90, "description": "Elevation of the sun above the horizon in degrees. Negative values lie below the horizon."},
+				"colorTemperature": colorTemperatureSchema("Color temperature at this elevation."),
+				"brightness":       brightnessSchema("Brightness at this elevation."),
+			})),
+			"brightnessLimits": mapSchema("Brightness limits of single lights by name. They take precedence over the limits of the schedule.", objectSchema("The brightness limits of a light.", schema{
+				"minBrightness": schema{"type": "integer", "minimum": 0, "maximum": 100, "description": "Lowest brightness in percent."},
+				"maxBrightness": schema{"type": "integer", "minimum": 0, "maximum": 100, "description": "Highest brightness in percent."},
+			})),
+			"transitionTime":          simpleSchema("string", "Duration of the fade for every light update of this schedule. Uses the global transition time if empty."),
+			"updateInterval":          simpleSchema("string", "Interval between two light state updates of this schedule. Uses the global update interval if empty."),
+			"onOffThreshold":          schema{"type": "integer", "minimum": 0, "maximum": 100, "description": "Plugs and on/off lights are turned off when the scheduled brightness is at or below this value (default 0)."},
+			"minBrightness":           schema{"type": "integer", "minimum": 0, "maximum": 100, "description": "Lowest brightness in percent the lights of this schedule are dimmed to. 0 leaves the brightness unlimited."},
+			"maxBrightness":           schema{"type": "integer", "minimum": 0, "maximum": 100, "description": "Highest brightness in percent the lights of this schedule are set to. 0 leaves the brightness unlimited."},
+			"defaultColorTemperature": colorTemperatureSchema("Color temperature between sunrise and sunset."),
+			"defaultBrightness":       brightnessSchema("Brightness between sunrise and sunset."),
+			"beforeSunrise":           arraySchema("Entries between midnight and sunrise.", timedColorTemperatureSchema()),
+			"afterSunset":             arraySchema("Entries between sunset and midnight.", timedColorTemperatureSchema()),
+		})),
+	})
+	root["$schema"] = "http://json-schema.org/draft-07/schema#"
+	root["title"] = "Kelvin configuration"
+	return root
+}
+
+// schemaCommand prints the configuration schema and returns the exit code
+// for the process.
+func schemaCommand() int {
+	data, err := json.MarshalIndent(ConfigurationSchema(), "", "  ")
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	fmt.Println(string(data))
+	return 0
+}
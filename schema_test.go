@@ -0,0 +1,78 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestSchemaCoversConfiguration(t *testing.T) {
+	var check func(path string, typ reflect.Type, s schema)
+	check = func(path string, typ reflect.Type, s schema) {
+		switch typ.Kind() {
+		case reflect.Struct:
+			properties, ok := s["properties"].(schema)
+			if !ok {
+				t.Errorf("Schema for %s has no properties", path)
+				return
+			}
+			for i := 0; i < typ.NumField(); i++ {
+				name := strings.Split(typ.Field(i).Tag.Get("json"), ",")[0]
+				if name == "" || name == "-" {
+					continue
+				}
+				property, found := properties[name].(schema)
+				if !found {
+					t.Errorf("Schema is missing property %s.%s", path, name)
+					continue
+				}
+				check(path+"."+name, typ.Field(i).Type, property)
+			}
+		case reflect.Slice:
+			if items, ok := s["items"].(schema); ok {
+				check(path+"[]", typ.Elem(), items)
+			}
+		case reflect.Map:
+			if values, ok := s["additionalProperties"].(schema); ok {
+				check(path+"{}", typ.Elem(), values)
+			}
+		}
+	}
+	check("configuration", reflect.TypeOf(Configuration{}), ConfigurationSchema())
+}
+
+func TestTimePattern(t *testing.T) {
+	pattern := regexp.MustCompile(timePattern)
+	for _, value := range []string{"4:00", "04:00", "23:59", "+45m", "+1h30m", "+90s"} {
+		if !pattern.MatchString(value) {
+			t.Errorf("timePattern should match %q", value)
+		}
+	}
+	for _, value := range []string{"24:00", "4:00PM", "+", "45m", "+-5m"} {
+		if pattern.MatchString(value) {
+			t.Errorf("timePattern should not match %q", value)
+		}
+	}
+}
@@ -0,0 +1,261 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const sensorUpdateInterval = 1 * time.Second
+const hueTimestampFormat = "2006-01-02T15:04:05"
+const defaultMotionBoostDuration = 5 * time.Minute
+const defaultSwitchOverrideDuration = 1 * time.Hour
+
+// HueSensor represents a sensor or switch connected to the bridge.
+type HueSensor struct {
+	Bridge      string    `json:"bridge,omitempty"`
+	ID          int       `json:"id"`
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	UniqueID    string    `json:"uniqueID"`
+	Presence    bool      `json:"presence"`
+	LightLevel  int       `json:"lightLevel"`
+	ButtonEvent int       `json:"buttonEvent"`
+	LastUpdated time.Time `json:"lastUpdated"`
+}
+
+type hueSensorAttributes struct {
+	Name     string `json:"name"`
+	Type     string `json:"type"`
+	UniqueID string `json:"uniqueid"`
+	State    struct {
+		Presence    bool   `json:"presence"`
+		LightLevel  int    `json:"lightlevel"`
+		ButtonEvent int    `json:"buttonevent"`
+		LastUpdated string `json:"lastupdated"`
+	} `json:"state"`
+}
+
+var sensors []HueSensor
+
+// Sensors returns all sensors configured on the bridge ordered by ID.
+func (bridge *HueBridge) Sensors() ([]HueSensor, error) {
+	var attributes map[string]hueSensorAttributes
+	err := bridge.apiRequest("GET", "/sensors", nil, &attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	var sensors []HueSensor
+	for id, attr := range attributes {
+		sensorID, err := strconv.Atoi(id)
+		if err != nil {
+			return nil, err
+		}
+		sensor := HueSensor{Bridge: bridge.Name, ID: sensorID, Name: attr.Name, Type: attr.Type, UniqueID: attr.UniqueID}
+		sensor.Presence = attr.State.Presence
+		sensor.LightLevel = attr.State.LightLevel
+		sensor.ButtonEvent = attr.State.ButtonEvent
+		// The bridge reports "none" if the sensor never sent an update
+		if lastUpdated, err := time.ParseInLocation(hueTimestampFormat, attr.State.LastUpdated, time.UTC); err == nil {
+			sensor.LastUpdated = lastUpdated
+		}
+		sensors = append(sensors, sensor)
+	}
+
+	sort.Slice(sensors, func(i, j int) bool { return sensors[i].ID < sensors[j].ID })
+	return sensors, nil
+}
+
+// allSensors returns the sensors of all bridges.
+func allSensors() ([]HueSensor, error) {
+	var s []HueSensor
+	for _, b := range bridges {
+		bridgeSensors, err := b.Sensors()
+		if err != nil {
+			return s, err
+		}
+		s = append(s, bridgeSensors...)
+	}
+	return s, nil
+}
+
+// parsePositiveDuration parses the given duration. If the value is empty
+// or invalid the fallback is returned along with the error.
+func parsePositiveDuration(value string, fallback time.Duration) (time.Duration, error) {
+	if value == "" {
+		return fallback, nil
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		return fallback, err
+	}
+	if duration <= 0 {
+		return fallback, fmt.Errorf("Duration must be positive")
+	}
+	return duration, nil
+}
+
+// lux converts the light level reported by the sensor to lux. The bridge
+// reports 10000 * log10(lux) + 1.
+func (sensor HueSensor) lux() float64 {
+	if sensor.LightLevel <= 0 {
+		return 0
+	}
+	return math.Pow(10, float64(sensor.LightLevel-1)/10000)
+}
+
+// multiplier returns the brightness multiplier for the given light level.
+// Light levels outside of all ranges are not compensated.
+func (compensation *LuxCompensation) multiplier(lux float64) float64 {
+	for _, r := range compensation.Ranges {
+		if lux >= r.MinLux && (r.MaxLux == 0 || lux < r.MaxLux) {
+			return r.Multiplier
+		}
+	}
+	return 1
+}
+
+// duration returns the configured duration of the boost. If the duration
+// is invalid the default duration is returned along with the error.
+func (boost *MotionBoost) duration() (time.Duration, error) {
+	return parsePositiveDuration(boost.Duration, defaultMotionBoostDuration)
+}
+
+// duration returns the configured duration of the override. If the
+// duration is invalid the default duration is returned along with the error.
+func (override *SwitchOverride) duration() (time.Duration, error) {
+	return parsePositiveDuration(override.Duration, defaultSwitchOverrideDuration)
+}
+
+// duration returns the duration of the override after a manual change or
+// zero if Kelvin should wait until the light is turned off.
+func (change *ManualChange) duration() (time.Duration, error) {
+	return parsePositiveDuration(change.Duration, 0)
+}
+
+// usesSensors returns true if any schedule reacts to sensors.
+func (configuration *Configuration) usesSensors() bool {
+	for _, lightSchedule := range configuration.Schedules {
+		if lightSchedule.MotionBoost != nil || lightSchedule.SwitchOverride != nil || lightSchedule.LuxCompensation != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// updateSensors reads the state of all sensors, starts or ends the motion
+// boost of the affected lights and pauses Kelvin for lights controlled
+// by a switch.
+func updateSensors() {
+	if !configuration.usesSensors() {
+		return
+	}
+
+	s, err := allSensors()
+	if errors.Is(err, errBridgeUnavailable) {
+		return
+	}
+	if err != nil {
+		log.Warningf("🤖 Failed to update sensors: %v", err)
+		return
+	}
+	pressed := pressedSwitches(sensors, s)
+	sensors = s
+
+	changed := false
+	now := time.Now()
+	for _, light := range lights {
+		if light.updateSwitchOverride(pressed, now) {
+			changed = true
+		}
+		boostChanged := light.updateMotionBoost(sensors, now)
+		compensationChanged := light.updateLuxCompensation(sensors)
+		if (boostChanged || compensationChanged) && light.updateTargetLightState() {
+			changed = true
+		}
+	}
+	if changed {
+		updateLights(nil)
+	}
+}
+
+// findPresenceSensor returns the motion sensor with the given name on the
+// given bridge.
+func findPresenceSensor(sensors []HueSensor, bridge string, name string) (HueSensor, bool) {
+	for _, sensor := range sensors {
+		if sensor.Bridge == bridge && sensor.Type == "ZLLPresence" && strings.EqualFold(sensor.Name, strings.TrimSpace(name)) {
+			return sensor, true
+		}
+	}
+	return HueSensor{}, false
+}
+
+// pressedSwitches returns all switches which reported a new button event
+// since the previous update.
+func pressedSwitches(previous []HueSensor, current []HueSensor) []HueSensor {
+	var pressed []HueSensor
+	for _, sensor := range current {
+		if !strings.HasSuffix(sensor.Type, "Switch") {
+			continue
+		}
+		for _, p := range previous {
+			if p.Bridge == sensor.Bridge && p.ID == sensor.ID && (!p.LastUpdated.Equal(sensor.LastUpdated) || p.ButtonEvent != sensor.ButtonEvent) {
+				pressed = append(pressed, sensor)
+			}
+		}
+	}
+	return pressed
+}
+
+// findLightLevelSensor returns the light level sensor with the given name on
+// the given bridge. As the Hue app only shows the name of the motion
+// sensor, the light level sensor of a motion sensor with the given name
+// will be returned as well.
+func findLightLevelSensor(sensors []HueSensor, bridge string, name string) (HueSensor, bool) {
+	for _, sensor := range sensors {
+		if sensor.Bridge == bridge && sensor.Type == "ZLLLightLevel" && strings.EqualFold(sensor.Name, strings.TrimSpace(name)) {
+			return sensor, true
+		}
+	}
+
+	presence, found := findPresenceSensor(sensors, bridge, name)
+	if !found || presence.UniqueID == "" {
+		return HueSensor{}, false
+	}
+	// All sensors of a device share the MAC address in their unique ID
+	device := strings.Split(presence.UniqueID, "-")[0]
+	for _, sensor := range sensors {
+		if sensor.Bridge == bridge && sensor.Type == "ZLLLightLevel" && strings.Split(sensor.UniqueID, "-")[0] == device {
+			return sensor, true
+		}
+	}
+	return HueSensor{}, false
+}
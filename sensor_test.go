@@ -0,0 +1,59 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestLuxCompensation(t *testing.T) {
+	compensation := &LuxCompensation{Sensor: "Hallway sensor", Ranges: []LuxRange{{MinLux: 0, MaxLux: 50, Multiplier: 1.5}, {MinLux: 500, Multiplier: 0.5}}}
+	sensors := []HueSensor{
+		{ID: 4, Name: "Hallway sensor", Type: "ZLLPresence", UniqueID: "00:17:88:01:02:00:af:28-02-0406"},
+		{ID: 5, Name: "Hue ambient light sensor 1", Type: "ZLLLightLevel", UniqueID: "00:17:88:01:02:00:af:28-02-0400", LightLevel: 10001},
+	}
+	sensor, found := findLightLevelSensor(sensors, "", "Hallway sensor")
+	if !found || sensor.ID != 5 {
+		t.Fatalf("Light level sensor of the motion sensor was not found")
+	}
+	if lux := sensor.lux(); math.Abs(lux-10) > 0.001 {
+		t.Errorf("Light level 10001 should be 10 lux, got %v", lux)
+	}
+
+	for lux, expected := range map[float64]float64{10: 1.5, 100: 1, 1000: 0.5} {
+		if multiplier := compensation.multiplier(lux); multiplier != expected {
+			t.Errorf("Multiplier for %v lux is %v; want %v", lux, multiplier, expected)
+		}
+	}
+
+	c := Configuration{}
+	lightSchedule := LightSchedule{Name: "hallway", DefaultColorTemperature: 2700, DefaultBrightness: 80, LuxCompensation: compensation}
+	light := &Light{Name: "Hallway", Scheduled: true, Schedule: c.scheduleForDay(lightSchedule, time.Now())}
+	if !light.updateLuxCompensation(sensors) || light.luxMultiplier != 1.5 {
+		t.Errorf("Expected multiplier 1.5, got %v", light.luxMultiplier)
+	}
+	if light.updateLuxCompensation(sensors) {
+		t.Errorf("Unchanged light level should not change the multiplier")
+	}
+}
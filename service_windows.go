@@ -0,0 +1,154 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/sys/windows/svc"
+	"golang.org/x/sys/windows/svc/mgr"
+)
+
+const serviceName = "kelvin"
+
+// serviceCommand installs or uninstalls the Windows service of Kelvin.
+func serviceCommand(command string) int {
+	var err error
+	switch command {
+	case "install":
+		err = installService()
+	case "uninstall":
+		err = uninstallService()
+	default:
+		fmt.Printf("Unknown service command %s (must be install or uninstall)\n", command)
+		return 2
+	}
+	if err != nil {
+		fmt.Println(err)
+		return 1
+	}
+	return 0
+}
+
+// installService registers Kelvin as a service started automatically at
+// boot. The service uses the current configuration and logs to a file next
+// to it as services don't have a console.
+func installService() error {
+	executable, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	manager, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("Could not connect to the service manager (are you running as administrator?): %v", err)
+	}
+	defer manager.Disconnect()
+	if service, err := manager.OpenService(serviceName); err == nil {
+		service.Close()
+		return fmt.Errorf("Service %s is already installed", serviceName)
+	}
+
+	logfile := *flagLogfile
+	if logfile == "" {
+		logfile = filepath.Join(filepath.Dir(*flagConfigurationFile), "kelvin.log")
+	}
+	args := []string{"-configuration", *flagConfigurationFile, "-log", absolutePath(logfile)}
+	config := mgr.Config{DisplayName: "Kelvin", Description: "Kelvin - The hue bot", StartType: mgr.StartAutomatic}
+	service, err := manager.CreateService(serviceName, executable, config, args...)
+	if err != nil {
+		return err
+	}
+	defer service.Close()
+	fmt.Printf("Installed service %s. Start it with \"sc start %s\". The log is written to %s\n", serviceName, serviceName, absolutePath(logfile))
+	return nil
+}
+
+func uninstallService() error {
+	manager, err := mgr.Connect()
+	if err != nil {
+		return fmt.Errorf("Could not connect to the service manager (are you running as administrator?): %v", err)
+	}
+	defer manager.Disconnect()
+	service, err := manager.OpenService(serviceName)
+	if err != nil {
+		return fmt.Errorf("Service %s is not installed", serviceName)
+	}
+	defer service.Close()
+	_, err = service.Control(svc.Stop)
+	if err == nil {
+		log.Printf("🤖 Stopped service %s", serviceName)
+	}
+	err = service.Delete()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Uninstalled service %s\n", serviceName)
+	return nil
+}
+
+// runningAsService returns true if Kelvin was started by the service
+// manager.
+func runningAsService() bool {
+	service, err := svc.IsWindowsService()
+	return err == nil && service
+}
+
+// serviceHandler reports the state of Kelvin to the service manager.
+type serviceHandler struct{}
+
+// Execute implements svc.Handler. It returns once Kelvin was stopped.
+func (serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (bool, uint32) {
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+	for request := range requests {
+		switch request.Cmd {
+		case svc.Interrogate:
+			status <- request.CurrentStatus
+		case svc.Stop, svc.Shutdown:
+			log.Printf("🤖 Service stop requested. Shutting down...")
+			status <- svc.Status{State: svc.StopPending, WaitHint: uint32((30 * time.Second) / time.Millisecond)}
+			stop()
+			return false, 0
+		}
+	}
+	return false, 0
+}
+
+// runService connects Kelvin to the service manager. Kelvin exits once
+// the service is stopped.
+func runService() {
+	// Services start in the system directory
+	err := os.Chdir(workingDirectory())
+	if err != nil {
+		log.Warningf("🤖 Could not change working directory: %v", err)
+	}
+	err = svc.Run(serviceName, serviceHandler{})
+	releaseLocks()
+	if err != nil {
+		log.Errorf("🤖 Service failed: %v", err)
+		os.Exit(1)
+	}
+	os.Exit(0)
+}
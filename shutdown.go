@@ -0,0 +1,125 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"sync/atomic"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const defaultShutdownTimeout = 15 * time.Second
+
+// Shutdown configures what Kelvin does with the lights it controls when it
+// is stopped. Lights whose schedule restores them on stop are always
+// restored. All other lights show the exit scene, their state from before
+// Kelvin took control or their final target light state.
+type Shutdown struct {
+	Restore bool   `json:"restore,omitempty"`
+	Scene   string `json:"scene,omitempty"`
+	Timeout string `json:"timeout,omitempty"`
+}
+
+func (s *Shutdown) timeout() (time.Duration, error) {
+	if s == nil {
+		return defaultShutdownTimeout, nil
+	}
+	return parsePositiveDuration(s.Timeout, defaultShutdownTimeout)
+}
+
+// stopRequests asks the main loop or the startup to shut Kelvin down. They
+// close the given channel once the lights were restored.
+var stopRequests = make(chan chan bool)
+
+// mainLoopRunning is set once the main loop handles requests.
+var mainLoopRunning int32
+
+// lightsInitialized is set once the startup initializes the lights. Kelvin
+// exits right away if it is stopped before.
+var lightsInitialized int32
+
+// stop shuts Kelvin down and returns once it is safe to exit. The main
+// loop is stopped first so no update interferes with the restored lights.
+// While the lights are initialized, the startup shuts down once it is
+// done. It gives up after the configured shutdown timeout.
+func stop() {
+	settings := shutdownSettings()
+	timeout, err := settings.timeout()
+	if err != nil {
+		timeout = defaultShutdownTimeout
+	}
+
+	done := make(chan bool)
+	go func() {
+		if atomic.LoadInt32(&lightsInitialized) == 0 {
+			// No light was touched and the saved state must be kept
+			close(done)
+			return
+		}
+		stopRequests <- done
+	}()
+
+	select {
+	case <-done:
+		log.Debugf("🤖 Shutdown completed")
+	case <-time.After(timeout):
+		log.Warningf("🤖 Shutdown didn't complete within %v. Exiting anyway...", timeout)
+	}
+}
+
+// stoppedDuringStartup returns true if Kelvin was stopped while the lights
+// were initialized. The startup shuts down itself then, so the lights are
+// never restored while they are still initialized.
+func stoppedDuringStartup() bool {
+	select {
+	case done := <-stopRequests:
+		log.Printf("🤖 Stopped while starting up")
+		shutdown()
+		close(done)
+		return true
+	default:
+		return false
+	}
+}
+
+// shutdown saves the state and restores the lights before Kelvin exits.
+func shutdown() {
+	notifySystemd("STOPPING=1")
+	// Save the state first, restoring releases the lights
+	persistState()
+	runtimeState.close()
+	restoreLights(shutdownSettings())
+	if activeTracer != nil {
+		err := activeTracer.export()
+		if err != nil {
+			log.Debugf("🤖 Could not export traces: %v", err)
+		}
+	}
+}
+
+func shutdownSettings() *Shutdown {
+	if configuration == nil {
+		return nil
+	}
+	return configuration.Shutdown
+}
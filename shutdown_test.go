@@ -0,0 +1,88 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestShutdownAction(t *testing.T) {
+	automatic := func(schedule Schedule) *Light {
+		return &Light{Name: "Desk", On: true, Automatic: true, Schedule: schedule}
+	}
+	cases := []struct {
+		light    *Light
+		settings *Shutdown
+		action   string
+	}{
+		{&Light{Name: "Manual", On: true}, &Shutdown{Restore: true}, ""},
+		{&Light{Name: "Off", Automatic: true}, &Shutdown{Restore: true}, ""},
+		{automatic(Schedule{}), nil, "finish"},
+		{automatic(Schedule{}), &Shutdown{Restore: true}, "snapshot"},
+		{automatic(Schedule{}), &Shutdown{Restore: true, Scene: "Goodbye"}, "scene"},
+		{automatic(Schedule{restoreOnStop: true}), &Shutdown{Scene: "Goodbye"}, "schedule"},
+	}
+	for _, c := range cases {
+		if action := c.light.shutdownAction(c.settings); action != c.action {
+			t.Errorf("Expected action %q for light %s with %+v, got %q", c.action, c.light.Name, c.settings, action)
+		}
+	}
+
+	if timeout, err := (*Shutdown)(nil).timeout(); err != nil || timeout != defaultShutdownTimeout {
+		t.Errorf("Expected default timeout, got %v (%v)", timeout, err)
+	}
+	c := Configuration{Shutdown: &Shutdown{Timeout: "soon"}}
+	if !strings.Contains(strings.Join(c.Validate().Errors, "\n"), "Invalid shutdown timeout") {
+		t.Errorf("Expected invalid shutdown timeout to be reported")
+	}
+}
+
+func TestStopDuringStartup(t *testing.T) {
+	useRuntimeState(t)
+	useLights(t)
+	defer atomic.StoreInt32(&lightsInitialized, 0)
+
+	start := time.Now()
+	stop()
+	if time.Since(start) > time.Second || stoppedDuringStartup() {
+		t.Errorf("Kelvin should exit right away before the lights are initialized")
+	}
+
+	atomic.StoreInt32(&lightsInitialized, 1)
+	stopped := make(chan bool)
+	go func() {
+		stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatalf("Stop should wait for the startup")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if !stoppedDuringStartup() {
+		t.Fatalf("The startup should handle the stop request")
+	}
+	<-stopped
+}
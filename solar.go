@@ -0,0 +1,163 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Schedule modes
+const (
+	scheduleModeTimes     = "times"
+	scheduleModeElevation = "elevation"
+	scheduleModeAuto      = "auto"
+)
+
+var scheduleModes = []string{scheduleModeTimes, scheduleModeElevation, scheduleModeAuto}
+
+// lightCurve calculates the light state of schedules which don't follow
+// their configured times.
+type lightCurve interface {
+	stateAt(timestamp time.Time) LightState
+}
+
+// ElevationPoint maps the elevation of the sun (in degrees above the
+// horizon) to a light state. States between two points are interpolated.
+type ElevationPoint struct {
+	Elevation        float64 `json:"elevation"`
+	ColorTemperature int     `json:"colorTemperature"`
+	Brightness       int     `json:"brightness"`
+}
+
+// defaultElevationCurve is used by schedules in elevation mode which don't
+// define their own curve.
+var defaultElevationCurve = []ElevationPoint{
+	{-6, 2000, 60},
+	{0, 2700, 80},
+	{15, 4000, 100},
+	{40, 5500, 100},
+}
+
+// elevationCurve is the parsed version of a configured curve for the
+// location of a schedule. The points are sorted by elevation.
+type elevationCurve struct {
+	points    []ElevationPoint
+	latitude  float64
+	longitude float64
+}
+
+func newElevationCurve(points []ElevationPoint, latitude float64, longitude float64) *elevationCurve {
+	if len(points) == 0 {
+		points = defaultElevationCurve
+	}
+	sorted := append([]ElevationPoint{}, points...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Elevation < sorted[j].Elevation })
+	return &elevationCurve{sorted, latitude, longitude}
+}
+
+// stateAt returns the light state for the elevation of the sun at the
+// given time.
+func (curve *elevationCurve) stateAt(timestamp time.Time) LightState {
+	return curve.stateForElevation(solarElevation(timestamp, curve.latitude, curve.longitude))
+}
+
+// stateForElevation interpolates linearly between the surrounding points
+// of the curve. Elevations outside of the curve use the first or last
+// point.
+func (curve *elevationCurve) stateForElevation(elevation float64) LightState {
+	points := curve.points
+	if elevation <= points[0].Elevation {
+		return LightState{points[0].ColorTemperature, points[0].Brightness}
+	}
+	for i := 1; i < len(points); i++ {
+		upper := points[i]
+		if elevation > upper.Elevation {
+			continue
+		}
+		lower := points[i-1]
+		progress := (elevation - lower.Elevation) / (upper.Elevation - lower.Elevation)
+		state := LightState{upper.ColorTemperature, upper.Brightness}
+		if lower.ColorTemperature != -1 && upper.ColorTemperature != -1 {
+			state.ColorTemperature = lower.ColorTemperature + int(progress*float64(upper.ColorTemperature-lower.ColorTemperature))
+		}
+		if lower.Brightness != -1 && upper.Brightness != -1 {
+			state.Brightness = lower.Brightness + int(progress*float64(upper.Brightness-lower.Brightness))
+		}
+		return state
+	}
+	last := points[len(points)-1]
+	return LightState{last.ColorTemperature, last.Brightness}
+}
+
+// solarElevation calculates the geometric elevation of the center of the
+// sun in degrees for the given time and position based on the equations
+// of the NOAA solar calculator. Atmospheric refraction is ignored.
+func solarElevation(timestamp time.Time, latitude float64, longitude float64) float64 {
+	declination, equationOfTime := solarPosition(timestamp)
+	utc := timestamp.UTC()
+	minutes := float64(utc.Hour()*60+utc.Minute()) + float64(utc.Second())/60
+	trueSolarTime := math.Mod(minutes+equationOfTime+4*longitude, 1440)
+	if trueSolarTime < 0 {
+		trueSolarTime += 1440
+	}
+	hourAngle := radians(trueSolarTime/4 - 180)
+
+	lat := radians(latitude)
+	cosZenith := math.Sin(lat)*math.Sin(declination) + math.Cos(lat)*math.Cos(declination)*math.Cos(hourAngle)
+	cosZenith = math.Max(-1, math.Min(1, cosZenith))
+	return 90 - degrees(math.Acos(cosZenith))
+}
+
+// solarPosition returns the declination of the sun in radians and the
+// equation of time in minutes at the given time.
+func solarPosition(timestamp time.Time) (float64, float64) {
+	julianDay := float64(timestamp.UnixNano())/float64(24*time.Hour) + 2440587.5
+	t := (julianDay - 2451545) / 36525
+
+	// Position of the sun
+	meanLongitude := math.Mod(280.46646+t*(36000.76983+t*0.0003032), 360)
+	meanAnomaly := 357.52911 + t*(35999.05029-0.0001537*t)
+	eccentricity := 0.016708634 - t*(0.000042037+0.0000001267*t)
+	m := radians(meanAnomaly)
+	center := math.Sin(m)*(1.914602-t*(0.004817+0.000014*t)) + math.Sin(2*m)*(0.019993-0.000101*t) + math.Sin(3*m)*0.000289
+	omega := radians(125.04 - 1934.136*t)
+	apparentLongitude := meanLongitude + center - 0.00569 - 0.00478*math.Sin(omega)
+	meanObliquity := 23 + (26+(21.448-t*(46.815+t*(0.00059-t*0.001813)))/60)/60
+	obliquity := radians(meanObliquity + 0.00256*math.Cos(omega))
+	declination := math.Asin(math.Sin(obliquity) * math.Sin(radians(apparentLongitude)))
+
+	// Equation of time in minutes
+	y := math.Pow(math.Tan(obliquity/2), 2)
+	l0 := radians(meanLongitude)
+	equationOfTime := 4 * degrees(y*math.Sin(2*l0)-2*eccentricity*math.Sin(m)+4*eccentricity*y*math.Sin(m)*math.Cos(2*l0)-0.5*y*y*math.Sin(4*l0)-1.25*eccentricity*eccentricity*math.Sin(2*m))
+	return declination, equationOfTime
+}
+
+func radians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+func degrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
@@ -0,0 +1,72 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSolarElevation(t *testing.T) {
+	tests := []struct {
+		timestamp time.Time
+		expected  float64
+	}{
+		{time.Date(2021, 6, 21, 11, 8, 0, 0, time.UTC), 60.9},  // solar noon in Berlin
+		{time.Date(2021, 6, 21, 23, 8, 0, 0, time.UTC), -13.9}, // solar midnight in Berlin
+		{time.Date(2021, 12, 21, 11, 5, 0, 0, time.UTC), 14.0}, // winter solstice
+		{time.Date(2021, 3, 20, 5, 0, 0, 0, time.UTC), -2.2},   // shortly before sunrise at the equinox
+	}
+	for _, test := range tests {
+		if elevation := solarElevation(test.timestamp, 52.52, 13.405); math.Abs(elevation-test.expected) > 0.5 {
+			t.Errorf("Unexpected elevation at %v: %.2f (expected %.1f)", test.timestamp, elevation, test.expected)
+		}
+	}
+
+	curve := newElevationCurve([]ElevationPoint{{10, 4000, 100}, {-6, 2000, 40}, {0, 3000, -1}}, 52.52, 13.405)
+	if state := curve.stateForElevation(-20); state != (LightState{2000, 40}) {
+		t.Errorf("Elevations below the curve should use the lowest point: %+v", state)
+	}
+	if state := curve.stateForElevation(-3); state != (LightState{2500, -1}) {
+		t.Errorf("Unexpected interpolation: %+v", state)
+	}
+	if state := curve.stateForElevation(5); state != (LightState{3500, 100}) {
+		t.Errorf("Unexpected interpolation: %+v", state)
+	}
+	if state := curve.stateForElevation(50); state != (LightState{4000, 100}) {
+		t.Errorf("Elevations above the curve should use the highest point: %+v", state)
+	}
+
+	c := Configuration{Location: Location{Latitude: 52.52, Longitude: 13.405}}
+	lightSchedule := LightSchedule{Name: "Sun", Mode: scheduleModeElevation, DefaultColorTemperature: 2750, DefaultBrightness: 100}
+	noon := time.Date(2021, 6, 21, 11, 8, 0, 0, time.UTC)
+	schedule := c.scheduleForDay(lightSchedule, noon)
+	if state, err := schedule.lightStateAt(noon); err != nil || state != (LightState{5500, 100}) {
+		t.Errorf("Elevation mode should follow the default curve at noon: %+v (%v)", state, err)
+	}
+	lightSchedule.Mode = ""
+	schedule = c.scheduleForDay(lightSchedule, noon)
+	if state, err := schedule.lightStateAt(noon); err != nil || state != (LightState{2750, 100}) {
+		t.Errorf("Schedules without mode should use their times: %+v (%v)", state, err)
+	}
+}
@@ -0,0 +1,422 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// stateFilename is resolved relative to the configuration. It doesn't end
+// with .json so it is never read as part of a configuration directory.
+const stateFilename = "kelvin.db"
+
+// legacyStateFilename is the JSON file which held the state before the
+// state database. It is imported once and removed afterwards.
+const legacyStateFilename = "kelvin.state"
+
+// The database is locked by the running instance. Don't wait for it
+// forever if another process holds it.
+const stateOpenTimeout = 2 * time.Second
+
+// seenLightRetention is the time after which removed lights are forgotten.
+// The time a light was seen is only updated once per resolution to keep
+// writes to SD cards low.
+const (
+	seenLightRetention  = 90 * 24 * time.Hour
+	seenLightResolution = time.Hour
+)
+
+var (
+	pausedSchedulesBucket = []byte("pausedSchedules")
+	lightsBucket          = []byte("lights")
+	seenLightsBucket      = []byte("seenLights")
+	settingsBucket        = []byte("settings")
+	awayModeKey           = []byte("awayMode")
+)
+
+// State contains runtime data which has to survive a restart of Kelvin.
+// It is kept separate from the user-editable configuration in a small
+// embedded database.
+type State struct {
+	PausedSchedules map[string]time.Time   `json:"pausedSchedules,omitempty"`
+	Lights          map[string]*savedLight `json:"lights,omitempty"`
+	SeenLights      map[string]seenLight   `json:"seenLights,omitempty"`
+	AwayMode        string                 `json:"awayMode,omitempty"`
+	db              *bolt.DB
+	written         []byte
+	lock            sync.Mutex
+}
+
+// savedLight is the automation state of a light which was turned on when
+// Kelvin stopped.
+type savedLight struct {
+	Automatic   bool        `json:"automatic"`
+	Override    *Override   `json:"override,omitempty"`
+	LastApplied *LightState `json:"lastApplied,omitempty"`
+}
+
+// seenLight records when a light was reachable for the last time.
+type seenLight struct {
+	Name     string    `json:"name"`
+	LastSeen time.Time `json:"lastSeen"`
+}
+
+var runtimeState = &State{}
+
+// loadState opens the state database with the given filename. A missing
+// database will be created and filled with the legacy state file next to
+// it. The database stays open until the state is closed.
+func loadState(filename string) (*State, error) {
+	state := &State{}
+	db, err := bolt.Open(filename, 0600, &bolt.Options{Timeout: stateOpenTimeout})
+	if err != nil {
+		return state, err
+	}
+	state.db = db
+	err = state.read()
+	if err != nil {
+		return state, err
+	}
+	configLog.Debugf("⚙ Loaded state from %s", filename)
+
+	legacyFilename := filepath.Join(filepath.Dir(filename), legacyStateFilename)
+	err = state.importLegacyState(legacyFilename)
+	if err != nil {
+		configLog.Warningf("⚙ Could not import state from %s: %v", legacyFilename, err)
+	}
+	return state, nil
+}
+
+// read loads the content of all buckets.
+func (state *State) read() error {
+	err := state.db.View(func(tx *bolt.Tx) error {
+		if bucket := tx.Bucket(pausedSchedulesBucket); bucket != nil {
+			state.PausedSchedules = make(map[string]time.Time)
+			err := bucket.ForEach(func(key, value []byte) error {
+				var until time.Time
+				err := until.UnmarshalText(value)
+				state.PausedSchedules[string(key)] = until
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if bucket := tx.Bucket(lightsBucket); bucket != nil {
+			state.Lights = make(map[string]*savedLight)
+			err := bucket.ForEach(func(key, value []byte) error {
+				saved := &savedLight{}
+				state.Lights[string(key)] = saved
+				return json.Unmarshal(value, saved)
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if bucket := tx.Bucket(seenLightsBucket); bucket != nil {
+			state.SeenLights = make(map[string]seenLight)
+			err := bucket.ForEach(func(key, value []byte) error {
+				var seen seenLight
+				err := json.Unmarshal(value, &seen)
+				state.SeenLights[string(key)] = seen
+				return err
+			})
+			if err != nil {
+				return err
+			}
+		}
+		if bucket := tx.Bucket(settingsBucket); bucket != nil {
+			state.AwayMode = string(bucket.Get(awayModeKey))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	state.written, err = json.Marshal(state)
+	return err
+}
+
+// importLegacyState moves the content of the JSON state file used by
+// previous versions into the database.
+func (state *State) importLegacyState(filename string) error {
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var legacy State
+	err = json.Unmarshal(data, &legacy)
+	if err != nil {
+		return err
+	}
+
+	state.PausedSchedules = legacy.PausedSchedules
+	state.Lights = legacy.Lights
+	state.AwayMode = legacy.AwayMode
+	err = state.save(time.Now())
+	if err != nil {
+		return err
+	}
+	configLog.Printf("⚙ Imported state from %s", filename)
+	return os.Remove(filename)
+}
+
+// save writes the state to the database. Expired entries are dropped.
+func (state *State) save(now time.Time) error {
+	for name, until := range state.PausedSchedules {
+		if !now.Before(until) {
+			delete(state.PausedSchedules, name)
+		}
+	}
+	for key, seen := range state.SeenLights {
+		if now.Sub(seen.LastSeen) > seenLightRetention {
+			delete(state.SeenLights, key)
+		}
+	}
+	if state.db == nil {
+		return nil
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(data, state.written) {
+		return nil
+	}
+
+	err = state.db.Update(func(tx *bolt.Tx) error {
+		paused, err := replaceBucket(tx, pausedSchedulesBucket)
+		if err != nil {
+			return err
+		}
+		for name, until := range state.PausedSchedules {
+			value, err := until.MarshalText()
+			if err != nil {
+				return err
+			}
+			if err := paused.Put([]byte(name), value); err != nil {
+				return err
+			}
+		}
+		saved, err := replaceBucket(tx, lightsBucket)
+		if err != nil {
+			return err
+		}
+		for key, light := range state.Lights {
+			if err := putJSON(saved, key, light); err != nil {
+				return err
+			}
+		}
+		seen, err := replaceBucket(tx, seenLightsBucket)
+		if err != nil {
+			return err
+		}
+		for key, light := range state.SeenLights {
+			if err := putJSON(seen, key, light); err != nil {
+				return err
+			}
+		}
+		settings, err := tx.CreateBucketIfNotExists(settingsBucket)
+		if err != nil {
+			return err
+		}
+		return settings.Put(awayModeKey, []byte(state.AwayMode))
+	})
+	if err == nil {
+		state.written = data
+	}
+	return err
+}
+
+// replaceBucket returns an empty bucket with the given name. The state is
+// small, so every bucket is rewritten as a whole.
+func replaceBucket(tx *bolt.Tx, name []byte) (*bolt.Bucket, error) {
+	if tx.Bucket(name) != nil {
+		if err := tx.DeleteBucket(name); err != nil {
+			return nil, err
+		}
+	}
+	return tx.CreateBucket(name)
+}
+
+func putJSON(bucket *bolt.Bucket, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(key), data)
+}
+
+// close releases the database so another instance can open it.
+func (state *State) close() error {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if state.db == nil {
+		return nil
+	}
+	err := state.db.Close()
+	state.db = nil
+	return err
+}
+
+func lightKey(light *Light) string {
+	return fmt.Sprintf("%s/%d", light.Bridge, light.ID)
+}
+
+// saveLights remembers which lights are controlled by Kelvin and which
+// ones were taken over by the user.
+func (state *State) saveLights(lights []*Light, now time.Time) error {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	state.Lights = make(map[string]*savedLight)
+	if state.SeenLights == nil {
+		state.SeenLights = make(map[string]seenLight)
+	}
+	for _, light := range lights {
+		if light.Reachable {
+			state.SeenLights[lightKey(light)] = seenLight{light.Name, now.Truncate(seenLightResolution)}
+		}
+		if light.restored != nil {
+			// The light didn't appear since the restart
+			state.Lights[lightKey(light)] = light.restored
+			continue
+		}
+		if !light.Scheduled || !light.Tracking {
+			continue
+		}
+		saved := &savedLight{Automatic: light.Automatic}
+		if light.overridden(now) {
+			override := light.activeOverride
+			saved.Override = &override
+		}
+		if light.Automatic {
+			applied := light.TargetLightState
+			saved.LastApplied = &applied
+		}
+		state.Lights[lightKey(light)] = saved
+	}
+	return state.save(now)
+}
+
+// restoreLightStates hands the saved state to the lights. Active overrides are
+// resumed right away, everything else is decided once a light appears.
+func (state *State) restoreLightStates(lights []*Light, now time.Time) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	for _, light := range lights {
+		saved, found := state.Lights[lightKey(light)]
+		if !found {
+			continue
+		}
+		if saved.Override != nil && now.Before(saved.Override.Until) {
+			scheduleLog.Debugf("💡 Light %s - Restoring override until %v", light.Name, saved.Override.Until.Format("15:04"))
+			light.override(*saved.Override)
+		}
+		light.restored = saved
+	}
+}
+
+// reportMissingLights warns about lights which were seen before but are
+// unknown to the bridges now.
+func (state *State) reportMissingLights(lights []*Light) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	known := make(map[string]bool)
+	for _, light := range lights {
+		known[lightKey(light)] = true
+	}
+	for key, seen := range state.SeenLights {
+		if !known[key] {
+			scheduleLog.Warningf("💡 Light %s - Missing (%s, last seen %s)", seen.Name, key, seen.LastSeen.Format("Jan 2 15:04"))
+		}
+	}
+}
+
+// persistState saves the state of all lights before Kelvin stops.
+func persistState() {
+	err := runtimeState.saveLights(lights, time.Now())
+	if err != nil {
+		configLog.Warningf("⚙ Could not save state: %v", err)
+	}
+}
+
+// pause disables the given schedule until the given time.
+func (state *State) pause(name string, until time.Time, now time.Time) error {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	if state.PausedSchedules == nil {
+		state.PausedSchedules = make(map[string]time.Time)
+	}
+	state.PausedSchedules[name] = until
+	return state.save(now)
+}
+
+// resume enables the given schedule again. It returns false if the schedule
+// wasn't paused.
+func (state *State) resume(name string, now time.Time) (bool, error) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	until, found := state.PausedSchedules[name]
+	if !found || !now.Before(until) {
+		return false, nil
+	}
+	delete(state.PausedSchedules, name)
+	return true, state.save(now)
+}
+
+// setAwayMode persists the away mode. An empty mode defers to the
+// configuration.
+func (state *State) setAwayMode(mode string, now time.Time) error {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	state.AwayMode = mode
+	return state.save(now)
+}
+
+func (state *State) awayMode() string {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	return state.AwayMode
+}
+
+// pausedUntil returns the end of the pause of the given schedule.
+func (state *State) pausedUntil(name string, now time.Time) (time.Time, bool) {
+	state.lock.Lock()
+	defer state.lock.Unlock()
+	until, found := state.PausedSchedules[name]
+	if !found || !now.Before(until) {
+		return time.Time{}, false
+	}
+	return until, true
+}
@@ -0,0 +1,126 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPersistLightStates(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), stateFilename)
+
+	now := time.Now()
+	state, _ := loadState(filename)
+	automatic := &Light{ID: 1, Scheduled: true, Tracking: true, On: true, Reachable: true, Automatic: true, TargetLightState: LightState{2700, 60}}
+	manual := &Light{ID: 2, Bridge: "upstairs", Scheduled: true, Tracking: true, On: true, Reachable: true}
+	overridden := &Light{ID: 3, Scheduled: true, Tracking: true, On: true, Reachable: true}
+	overridden.override(Override{Until: now.Add(time.Hour), Reason: overrideReasonScene, Scene: "Movie"})
+	off := &Light{ID: 4, Scheduled: true}
+	err := state.saveLights([]*Light{automatic, manual, overridden, off}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.close()
+
+	restored, err := loadState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.close()
+	if len(restored.Lights) != 3 {
+		t.Fatalf("Only lights which are turned on should be saved: %v", restored.Lights)
+	}
+	if saved := restored.Lights["/1"]; !saved.Automatic || saved.LastApplied == nil || *saved.LastApplied != (LightState{2700, 60}) {
+		t.Errorf("Unexpected state of automatic light: %+v", saved)
+	}
+
+	// Lights after the restart
+	manual = &Light{ID: 2, Bridge: "upstairs", Scheduled: true, On: true, Reachable: true, TargetLightState: LightState{2700, 60}, Schedule: Schedule{enableWhenLightsAppear: true}}
+	overridden = &Light{ID: 3, Scheduled: true, On: true, Reachable: true}
+	turnedOff := &Light{ID: 1, Scheduled: true, Reachable: true}
+	restored.restoreLightStates([]*Light{manual, overridden, turnedOff}, now)
+	if !overridden.overridden(now) || overridden.activeOverride.Scene != "Movie" {
+		t.Errorf("Override should be restored: %+v", overridden.activeOverride)
+	}
+
+	manual.update(0)
+	if manual.Automatic || !manual.Tracking || manual.restored != nil {
+		t.Errorf("Manually changed light should not be enabled after a restart")
+	}
+	turnedOff.update(0)
+	if turnedOff.restored != nil {
+		t.Errorf("Saved state should be dropped once the light is turned off")
+	}
+
+	// Lights which didn't appear yet keep their saved state
+	err = restored.saveLights([]*Light{manual, overridden, {ID: 5, Scheduled: true, restored: &savedLight{Automatic: false}}}, now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, found := restored.Lights["/5"]; !found {
+		t.Errorf("Saved state of a light which didn't appear yet should be kept")
+	}
+	if seen, found := restored.SeenLights["upstairs/2"]; !found || seen.LastSeen.After(now) {
+		t.Errorf("Reachable lights should be remembered as seen: %v", restored.SeenLights)
+	}
+}
+
+func TestLegacyState(t *testing.T) {
+	directory := t.TempDir()
+	until := time.Now().Add(time.Hour).Round(time.Second)
+	legacy := []byte(`{"pausedSchedules": {"livingroom": "` + until.Format(time.RFC3339) + `"}, "lights": {"/1": {"automatic": true}}, "awayMode": "off"}`)
+	err := ioutil.WriteFile(filepath.Join(directory, legacyStateFilename), legacy, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	filename := filepath.Join(directory, stateFilename)
+	state, err := loadState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	state.close()
+	if _, err := os.Stat(filepath.Join(directory, legacyStateFilename)); !os.IsNotExist(err) {
+		t.Errorf("Legacy state file should be removed after the import")
+	}
+
+	state, err = loadState(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer state.close()
+	if paused, found := state.pausedUntil("livingroom", time.Now()); !found || !paused.Equal(until) {
+		t.Errorf("Paused schedule should be imported, got %v", state.PausedSchedules)
+	}
+	if saved := state.Lights["/1"]; saved == nil || !saved.Automatic || state.awayMode() != awayModeOff {
+		t.Errorf("Lights and away mode should be imported, got %+v", state)
+	}
+
+	// Another instance must not wait for the database forever
+	if _, err := loadState(filename); err == nil {
+		t.Errorf("Database should be locked by the open state")
+	}
+}
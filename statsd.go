@@ -0,0 +1,183 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// Supported formats of the StatsD sink
+const (
+	statsDFormatStatsD  = "statsd"
+	statsDFormatDatadog = "datadog"
+)
+
+var statsDFormats = []string{statsDFormatStatsD, statsDFormatDatadog}
+
+const defaultStatsDAddress = "localhost:8125"
+const defaultStatsDPrefix = "kelvin"
+
+// StatsD configures a server metrics are pushed to. The datadog format
+// adds tags to the metrics. Otherwise the values of the tags become a part
+// of the metric names.
+type StatsD struct {
+	Address string   `json:"address,omitempty"`
+	Prefix  string   `json:"prefix,omitempty"`
+	Format  string   `json:"format,omitempty"`
+	Tags    []string `json:"tags,omitempty"`
+}
+
+func (statsD *StatsD) address() string {
+	if statsD.Address == "" {
+		return defaultStatsDAddress
+	}
+	return statsD.Address
+}
+
+func (statsD *StatsD) prefix() string {
+	if statsD.Prefix == "" {
+		return defaultStatsDPrefix
+	}
+	return strings.TrimSuffix(statsD.Prefix, ".")
+}
+
+func (statsD *StatsD) format() string {
+	if statsD.Format == "" {
+		return statsDFormatStatsD
+	}
+	return statsD.Format
+}
+
+// statsDClient sends metrics via UDP. Metrics are lost if nobody listens,
+// Kelvin is never slowed down by the metrics server. All methods can be
+// called on a nil client, which is used while no server is configured.
+type statsDClient struct {
+	configuration *StatsD
+	connection    net.Conn
+	lock          sync.Mutex
+}
+
+var metrics *statsDClient
+
+// startStatsD sends all metrics to the configured server.
+func startStatsD(statsD *StatsD) error {
+	if statsD == nil {
+		return nil
+	}
+	connection, err := net.Dial("udp", statsD.address())
+	if err != nil {
+		return err
+	}
+	metrics = &statsDClient{configuration: statsD, connection: connection}
+	log.Printf("🤖 Sending metrics to %s", statsD.address())
+	return nil
+}
+
+// metricName keeps names of lights and bridges from breaking the format.
+func metricName(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == ':' || r == '|' || r == '@' || r == '#' || r == ',' || r == '.' || r == ' ' {
+			return '_'
+		}
+		return r
+	}, strings.ToLower(name))
+}
+
+// line formats a single metric. Tags are given as name:value.
+func (client *statsDClient) line(name string, value string, kind string, tags []string) string {
+	if client.configuration.format() != statsDFormatDatadog {
+		for _, tag := range tags {
+			if index := strings.Index(tag, ":"); index != -1 && index < len(tag)-1 {
+				name += "." + tag[index+1:]
+			}
+		}
+		return fmt.Sprintf("%s.%s:%s|%s", client.configuration.prefix(), name, value, kind)
+	}
+
+	line := fmt.Sprintf("%s.%s:%s|%s", client.configuration.prefix(), name, value, kind)
+	tags = append(append([]string{}, client.configuration.Tags...), tags...)
+	if len(tags) > 0 {
+		line += "|#" + strings.Join(tags, ",")
+	}
+	return line
+}
+
+func (client *statsDClient) send(name string, value string, kind string, tags []string) {
+	if client == nil {
+		return
+	}
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	_, err := client.connection.Write([]byte(client.line(name, value, kind, tags)))
+	if err != nil {
+		log.Debugf("🤖 Could not send metric %s: %v", name, err)
+	}
+}
+
+func (client *statsDClient) count(name string, value int, tags ...string) {
+	client.send(name, fmt.Sprint(value), "c", tags)
+}
+
+func (client *statsDClient) gauge(name string, value int, tags ...string) {
+	client.send(name, fmt.Sprint(value), "g", tags)
+}
+
+func (client *statsDClient) timing(name string, duration time.Duration, tags ...string) {
+	client.send(name, fmt.Sprint(duration.Milliseconds()), "ms", tags)
+}
+
+// reportLights sends the number of lights by state and the current light
+// state of every light.
+func (client *statsDClient) reportLights(lights []*Light) {
+	if client == nil {
+		return
+	}
+	var reachable, on, automatic int
+	for _, light := range lights {
+		tags := []string{"light:" + metricName(light.Name), "bridge:" + metricName(light.Bridge)}
+		if light.Reachable {
+			reachable++
+		}
+		if light.On {
+			on++
+			if colorTemperature, err := light.HueLight.getCurrentColorTemperature(); err == nil {
+				client.gauge("light.color_temperature", colorTemperature, tags...)
+			}
+			if brightness, err := light.HueLight.getCurrentBrightness(); err == nil {
+				client.gauge("light.brightness", brightness, tags...)
+			}
+		}
+		if light.Scheduled && light.Automatic {
+			automatic++
+		}
+	}
+	client.gauge("lights.total", len(lights))
+	client.gauge("lights.reachable", reachable)
+	client.gauge("lights.on", on)
+	client.gauge("lights.automatic", automatic)
+}
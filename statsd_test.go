@@ -0,0 +1,62 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"net"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatsD(t *testing.T) {
+	server, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	defer server.Close()
+
+	metrics.count("ignored", 1)
+	err = startStatsD(&StatsD{Address: server.LocalAddr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { metrics = nil }()
+
+	metrics.count("light.updates", 1, "light:"+metricName("Living Room.1"), "bridge:")
+	buffer := make([]byte, 1024)
+	server.SetReadDeadline(time.Now().Add(time.Second))
+	n, _, err := server.ReadFrom(buffer)
+	if err != nil || string(buffer[:n]) != "kelvin.light.updates.living_room_1:1|c" {
+		t.Errorf("Unexpected metric: %q (%v)", buffer[:n], err)
+	}
+
+	metrics.configuration = &StatsD{Prefix: "home.", Format: statsDFormatDatadog, Tags: []string{"env:test"}}
+	if line := metrics.line("bridge.request_time", "42", "ms", []string{"bridge:upstairs"}); line != "home.bridge.request_time:42|ms|#env:test,bridge:upstairs" {
+		t.Errorf("Unexpected datadog metric: %s", line)
+	}
+
+	c := Configuration{StatsD: &StatsD{Address: "localhost", Format: "graphite"}}
+	if messages := strings.Join(c.Validate().Errors, "\n"); !strings.Contains(messages, "StatsD address") || !strings.Contains(messages, "StatsD format") {
+		t.Errorf("Invalid StatsD settings should fail validation: %v", messages)
+	}
+}
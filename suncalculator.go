@@ -0,0 +1,188 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/btittelbach/astrotime"
+)
+
+// Supported calculators for sunrise and sunset
+const (
+	sunCalculatorAstrotime = "astrotime"
+	sunCalculatorNOAA      = "noaa"
+)
+
+var sunCalculators = []string{sunCalculatorAstrotime, sunCalculatorNOAA}
+
+// sunEventElevation is the elevation of the sun in degrees which defines
+// sunrise and sunset for Kelvin by default: the start and the end of the
+// golden hour.
+const sunEventElevation = astrotime.GOLDEN_HOUR
+
+// twilights maps the names of common twilight definitions to the elevation
+// of the sun in degrees.
+var twilights = map[string]float64{
+	"golden":       sunEventElevation,
+	"official":     -0.833,
+	"civil":        astrotime.CIVIL_DAWN,
+	"nautical":     astrotime.NAUTICAL_DAWN,
+	"astronomical": astrotime.ASTRONOMICAL_DAWN,
+}
+
+// parseTwilight returns the elevation of the sun for the given twilight
+// definition. It is either the name of a definition or an angle in degrees.
+func parseTwilight(value string) (float64, error) {
+	if value == "" {
+		return sunEventElevation, nil
+	}
+	if elevation, found := twilights[value]; found {
+		return elevation, nil
+	}
+	elevation, err := strconv.ParseFloat(value, 64)
+	if err != nil || elevation < -18 || elevation > 18 {
+		return sunEventElevation, fmt.Errorf("Invalid twilight %q (must be golden, official, civil, nautical, astronomical or an angle between -18 and 18 degrees)", value)
+	}
+	return elevation, nil
+}
+
+// sunCalculator calculates when the center of the sun passes the given
+// elevation in the morning and in the evening of the given day. On days the
+// sun doesn't reach the elevation the returned times are invalid.
+type sunCalculator interface {
+	dawn(date time.Time, latitude float64, longitude float64, elevation float64) time.Time
+	dusk(date time.Time, latitude float64, longitude float64, elevation float64) time.Time
+}
+
+// astrotimeCalculator uses the astrotime library. Its results are rounded
+// down to the minute.
+type astrotimeCalculator struct{}
+
+func (astrotimeCalculator) dawn(date time.Time, latitude float64, longitude float64, elevation float64) time.Time {
+	// calculate start of day
+	yr, mth, day := date.Date()
+	startOfDay := time.Date(yr, mth, day, 0, 0, 0, 0, date.Location())
+
+	return astrotime.CalcDawn(startOfDay, latitude, longitude, elevation)
+}
+
+func (astrotimeCalculator) dusk(date time.Time, latitude float64, longitude float64, elevation float64) time.Time {
+	// calculate start of day
+	yr, mth, day := date.Date()
+	startOfDay := time.Date(yr, mth, day, 0, 0, 0, 0, date.Location())
+
+	return astrotime.CalcDusk(startOfDay, latitude, longitude, elevation)
+}
+
+// noaaCalculator implements the algorithm of the NOAA solar calculator. The
+// position of the sun is recalculated for the estimated time of the event
+// which gives results accurate to less than a minute. With refraction the
+// elevation is treated as the apparent elevation of the sun, which is
+// raised by the atmosphere close to the horizon.
+type noaaCalculator struct {
+	refraction bool
+}
+
+func (calculator noaaCalculator) dawn(date time.Time, latitude float64, longitude float64, elevation float64) time.Time {
+	return calculator.event(date, latitude, longitude, elevation, -1)
+}
+
+func (calculator noaaCalculator) dusk(date time.Time, latitude float64, longitude float64, elevation float64) time.Time {
+	return calculator.event(date, latitude, longitude, elevation, 1)
+}
+
+// event calculates the time before (direction -1) or after (direction 1)
+// solar noon when the sun is at the given elevation. It returns the zero
+// time if the sun doesn't reach the elevation on that day.
+func (calculator noaaCalculator) event(date time.Time, latitude float64, longitude float64, elevation float64, direction float64) time.Time {
+	if calculator.refraction {
+		elevation -= atmosphericRefraction(elevation)
+	}
+	yr, mth, day := date.Date()
+	midnight := time.Date(yr, mth, day, 0, 0, 0, 0, time.UTC)
+	lat := radians(latitude)
+
+	event := midnight.Add(12 * time.Hour)
+	for i := 0; i < 3; i++ {
+		declination, equationOfTime := solarPosition(event)
+		cosHourAngle := (math.Sin(radians(elevation)) - math.Sin(lat)*math.Sin(declination)) / (math.Cos(lat) * math.Cos(declination))
+		if cosHourAngle < -1 || cosHourAngle > 1 {
+			return time.Time{}
+		}
+		hourAngle := degrees(math.Acos(cosHourAngle))
+		minutes := 720 - 4*longitude - equationOfTime + direction*4*hourAngle
+		event = midnight.Add(time.Duration(minutes * float64(time.Minute)))
+	}
+	return event.Round(time.Second).In(date.Location())
+}
+
+// atmosphericRefraction returns how many degrees the atmosphere raises the
+// sun at the given apparent elevation (Bennett's formula).
+func atmosphericRefraction(elevation float64) float64 {
+	if elevation < -2 {
+		return 0 // no refraction for the sun far below the horizon
+	}
+	return 1 / math.Tan(radians(elevation+7.31/(elevation+4.4))) / 60
+}
+
+// calculator returns the calculator for sunrise and sunset configured for
+// the location.
+func (location Location) calculator() sunCalculator {
+	if location.Calculator == sunCalculatorNOAA {
+		return noaaCalculator{location.Refraction}
+	}
+	return astrotimeCalculator{}
+}
+
+// maxObserverElevation is a little above the highest mountain.
+const maxObserverElevation = 9000
+
+// horizonDip returns how many degrees the visible horizon lies below the
+// astronomical horizon for an observer at the given altitude in meters.
+func horizonDip(altitude float64) float64 {
+	if altitude <= 0 {
+		return 0
+	}
+	return 2.076 * math.Sqrt(altitude) / 60
+}
+
+// twilightElevation returns the elevation of the sun which defines sunrise
+// and sunset at the location. Invalid definitions fall back to the default.
+// Observers above sea level see the sun longer.
+func (location Location) twilightElevation() float64 {
+	elevation, _ := parseTwilight(location.Twilight)
+	return elevation - horizonDip(location.Elevation)
+}
+
+// sunrise calculates the sunrise for the given day.
+func (location Location) sunrise(date time.Time) time.Time {
+	return location.calculator().dawn(date, location.Latitude, location.Longitude, location.twilightElevation())
+}
+
+// sunset calculates the sunset for the given day.
+func (location Location) sunset(date time.Time) time.Time {
+	return location.calculator().dusk(date, location.Latitude, location.Longitude, location.twilightElevation())
+}
@@ -0,0 +1,109 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSunCalculators(t *testing.T) {
+	date := time.Date(2021, 6, 21, 0, 0, 0, 0, time.UTC)
+	noaa := noaaCalculator{}
+	// Official sunrise and sunset in Berlin: 02:43 and 19:33 UTC
+	if sunrise := noaa.dawn(date, 52.52, 13.405, -0.833); math.Abs(sunrise.Sub(time.Date(2021, 6, 21, 2, 43, 0, 0, time.UTC)).Minutes()) > 1 {
+		t.Errorf("Unexpected sunrise: %v", sunrise)
+	}
+	if sunset := noaa.dusk(date, 52.52, 13.405, -0.833); math.Abs(sunset.Sub(time.Date(2021, 6, 21, 19, 33, 0, 0, time.UTC)).Minutes()) > 1 {
+		t.Errorf("Unexpected sunset: %v", sunset)
+	}
+	if elevation := solarElevation(noaa.dusk(date, 52.52, 13.405, sunEventElevation), 52.52, 13.405); math.Abs(elevation-sunEventElevation) > 0.01 {
+		t.Errorf("Sun should be at the event elevation: %.3f", elevation)
+	}
+
+	berlin := Location{Latitude: 52.52, Longitude: 13.405}
+	astro := berlin.sunrise(date)
+	berlin.Calculator = sunCalculatorNOAA
+	precise := berlin.sunrise(date)
+	if difference := precise.Sub(astro); difference < 0 || difference > 2*time.Minute {
+		t.Errorf("Calculators should agree: %v and %v", astro, precise)
+	}
+	berlin.Refraction = true
+	if refracted := berlin.sunrise(date); !refracted.Before(precise) {
+		t.Errorf("Refraction should make the sun rise earlier: %v and %v", refracted, precise)
+	}
+	if sunrise := noaa.dawn(time.Date(2021, 12, 21, 0, 0, 0, 0, time.UTC), 78.22, 15.65, sunEventElevation); !sunrise.IsZero() {
+		t.Errorf("There is no sunrise during polar night: %v", sunrise)
+	}
+}
+
+func TestTwilight(t *testing.T) {
+	for value, expected := range map[string]float64{"": sunEventElevation, "official": -0.833, "civil": -6, "2.5": 2.5} {
+		if elevation, err := parseTwilight(value); err != nil || elevation != expected {
+			t.Errorf("Unexpected elevation for twilight %q: %v (%v)", value, elevation, err)
+		}
+	}
+	for _, value := range []string{"dusk", "-40"} {
+		if _, err := parseTwilight(value); err == nil {
+			t.Errorf("Twilight %q should be rejected", value)
+		}
+	}
+
+	c := Configuration{Location: Location{Latitude: 52.52, Longitude: 13.405, Twilight: "official"}}
+	date := time.Date(2021, 6, 21, 0, 0, 0, 0, time.UTC)
+	golden := Location{Latitude: 52.52, Longitude: 13.405}.sunrise(date)
+	official := c.locationForSchedule(LightSchedule{Name: "Official"}).sunrise(date)
+	civil := c.locationForSchedule(LightSchedule{Name: "Civil", Twilight: "civil"}).sunrise(date)
+	if !civil.Before(official) || !official.Before(golden) {
+		t.Errorf("Lower twilights should start earlier: %v, %v, %v", civil, official, golden)
+	}
+	c.Schedules = []LightSchedule{{Name: "Invalid", Default: true, Twilight: "dusk"}}
+	if report := c.Validate(); len(report.Errors) == 0 {
+		t.Errorf("Invalid twilight should fail validation")
+	}
+}
+
+func TestObserverElevation(t *testing.T) {
+	if dip := horizonDip(1600); math.Abs(dip-1.384) > 0.001 {
+		t.Errorf("Unexpected horizon dip at 1600m: %v", dip)
+	}
+	if dip := horizonDip(0); dip != 0 {
+		t.Errorf("There is no horizon dip at sea level: %v", dip)
+	}
+
+	date := time.Date(2021, 6, 21, 0, 0, 0, 0, time.UTC)
+	valley := Location{Latitude: 47.27, Longitude: 11.39, Calculator: sunCalculatorNOAA, Twilight: "official"}
+	mountain := valley
+	mountain.Elevation = 1600
+	if difference := mountain.sunset(date).Sub(valley.sunset(date)); difference < 5*time.Minute || difference > 15*time.Minute {
+		t.Errorf("Sunset at 1600m should be several minutes later: %v", difference)
+	}
+	if !mountain.sunrise(date).Before(valley.sunrise(date)) {
+		t.Errorf("Sunrise at 1600m should be earlier")
+	}
+
+	c := Configuration{Location: Location{Latitude: 47.27, Longitude: 11.39, Elevation: -10}}
+	if report := c.Validate(); len(report.Errors) == 0 {
+		t.Errorf("Negative elevation should fail validation")
+	}
+}
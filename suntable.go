@@ -0,0 +1,189 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sunTableFilename is resolved relative to the configuration just like
+// the state file.
+const sunTableFilename = "kelvin.suntimes"
+
+// sunTableDays is the number of days precomputed for every location.
+const sunTableDays = 366
+
+const sunTableDateFormat = "2006-01-02"
+
+// sunTableEntry contains the sun times of a single day.
+type sunTableEntry struct {
+	Sunrise time.Time `json:"sunrise"`
+	Sunset  time.Time `json:"sunset"`
+	Polar   string    `json:"polar,omitempty"`
+}
+
+// sunTable caches the sun times of every location by day. Calculating the
+// sun times is expensive during polar day and polar night, so the table is
+// precomputed for a year and kept on disk.
+type sunTable struct {
+	Locations map[string]map[string]sunTableEntry `json:"locations"`
+	filename  string
+	written   []byte
+	lock      sync.Mutex
+}
+
+var sunTimeTable = &sunTable{}
+
+// loadSunTable reads the table from the given file. A missing or invalid
+// file results in an empty table.
+func loadSunTable(filename string) (*sunTable, error) {
+	table := &sunTable{filename: filename}
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return table, nil
+	}
+	if err != nil {
+		return table, err
+	}
+	err = json.Unmarshal(data, table)
+	if err != nil {
+		return &sunTable{filename: filename}, err
+	}
+	table.written = data
+	log.Debugf("🌍 Loaded sun times from %s", filename)
+	return table, nil
+}
+
+// key identifies everything the sun times of a location depend on,
+// including the time zone of the calculated days.
+func (location Location) key(zone *time.Location) string {
+	return fmt.Sprintf("%f,%f,%s,%t,%s,%f,%s,%s,%s", location.Latitude, location.Longitude, location.Calculator, location.Refraction, location.Twilight, location.Elevation, location.PolarSunrise, location.PolarSunset, zone)
+}
+
+// sunTimes returns the sun times of the location for the given day.
+// Missing days are calculated and added to the table.
+func (table *sunTable) sunTimes(location Location, date time.Time) sunTableEntry {
+	key := location.key(date.Location())
+	day := date.Format(sunTableDateFormat)
+
+	table.lock.Lock()
+	entry, found := table.Locations[key][day]
+	table.lock.Unlock()
+	if found {
+		return sunTableEntry{entry.Sunrise.In(date.Location()), entry.Sunset.In(date.Location()), entry.Polar}
+	}
+
+	sunrise, sunset, polar := location.calculateSunTimes(date)
+	entry = sunTableEntry{sunrise, sunset, polar}
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	if table.Locations == nil {
+		table.Locations = make(map[string]map[string]sunTableEntry)
+	}
+	if table.Locations[key] == nil {
+		table.Locations[key] = make(map[string]sunTableEntry)
+	}
+	table.Locations[key][day] = entry
+	return entry
+}
+
+// precompute calculates the sun times of the given locations for a year
+// starting at the given day. Days before it are dropped from the table.
+func (table *sunTable) precompute(locations []Location, start time.Time) {
+	begin := time.Now()
+	yr, mth, day := start.Date()
+	for _, location := range locations {
+		for days := 0; days < sunTableDays; days++ {
+			table.sunTimes(location, time.Date(yr, mth, day+days, 12, 0, 0, 0, start.Location()))
+		}
+	}
+
+	first := start.Format(sunTableDateFormat)
+	table.lock.Lock()
+	for _, days := range table.Locations {
+		for date := range days {
+			// The date format sorts lexically
+			if date < first {
+				delete(days, date)
+			}
+		}
+	}
+	table.lock.Unlock()
+	log.Debugf("🌍 Precomputed sun times for %d locations in %v", len(locations), time.Since(begin).Round(time.Millisecond))
+}
+
+// save writes the table to disk if it changed.
+func (table *sunTable) save() error {
+	table.lock.Lock()
+	defer table.lock.Unlock()
+	if table.filename == "" {
+		return nil
+	}
+	data, err := json.Marshal(table)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(data, table.written) {
+		return nil
+	}
+	err = ioutil.WriteFile(table.filename, data, 0600)
+	if err == nil {
+		table.written = data
+	}
+	return err
+}
+
+// sunLocations returns all distinct locations used by the schedules of
+// the configuration.
+func (configuration *Configuration) sunLocations() []Location {
+	var locations []Location
+	seen := make(map[Location]bool)
+	add := func(location Location) {
+		if !seen[location] {
+			seen[location] = true
+			locations = append(locations, location)
+		}
+	}
+	add(configuration.Location)
+	for _, lightSchedule := range configuration.Schedules {
+		add(configuration.locationForSchedule(lightSchedule))
+	}
+	return locations
+}
+
+// updateSunTable precomputes the sun times of all configured locations
+// and persists them.
+func updateSunTable() {
+	sunTimeTable.precompute(configuration.sunLocations(), time.Now())
+	err := sunTimeTable.save()
+	if err != nil {
+		log.Warningf("🌍 Could not save sun times: %v", err)
+	}
+}
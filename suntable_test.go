@@ -0,0 +1,71 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestSunTable(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), sunTableFilename)
+	table, err := loadSunTable(filename)
+	if err != nil || len(table.Locations) != 0 {
+		t.Fatalf("A missing sun table should be empty: %v", err)
+	}
+
+	berlin := Location{Latitude: 52.52, Longitude: 13.40}
+	tromso := Location{Latitude: 69.65, Longitude: 18.96}
+	start := time.Date(2021, 12, 1, 12, 0, 0, 0, time.UTC)
+	table.precompute([]Location{berlin, tromso}, start)
+	if len(table.Locations) != 2 || len(table.Locations[berlin.key(time.UTC)]) != sunTableDays {
+		t.Fatalf("Expected %d days for 2 locations, got %d locations", sunTableDays, len(table.Locations))
+	}
+
+	night := time.Date(2021, 12, 21, 0, 0, 0, 0, time.UTC)
+	sunrise, sunset, polar := tromso.calculateSunTimes(night)
+	if entry := table.sunTimes(tromso, night); !entry.Sunrise.Equal(sunrise) || !entry.Sunset.Equal(sunset) || entry.Polar != polar {
+		t.Errorf("Cached sun times differ: %v - %v (%s)", entry.Sunrise, entry.Sunset, entry.Polar)
+	}
+
+	err = table.save()
+	if err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := loadSunTable(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entry := loaded.sunTimes(tromso, night); !entry.Sunrise.Equal(sunrise) || entry.Polar != polar {
+		t.Errorf("Sun times were not persisted: %v (%s)", entry.Sunrise, entry.Polar)
+	}
+
+	// Past days are dropped and the table grows by one day
+	loaded.precompute([]Location{berlin}, start.AddDate(0, 0, 1))
+	if _, found := loaded.Locations[berlin.key(time.UTC)][start.Format(sunTableDateFormat)]; found {
+		t.Errorf("Past days should be dropped")
+	}
+	if days := len(loaded.Locations[berlin.key(time.UTC)]); days != sunTableDays {
+		t.Errorf("Expected %d days, got %d", sunTableDays, days)
+	}
+}
@@ -0,0 +1,87 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// sdNotify sends the given state to systemd if Kelvin runs as a service
+// of Type=notify. It returns false if systemd doesn't expect any
+// notifications.
+func sdNotify(state string) (bool, error) {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return false, nil
+	}
+	connection, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return false, err
+	}
+	defer connection.Close()
+	_, err = connection.Write([]byte(state))
+	if err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// notifySystemd sends the given state and logs failures.
+func notifySystemd(state string) {
+	sent, err := sdNotify(state)
+	if err != nil {
+		log.Warningf("🤖 Could not notify systemd: %v", err)
+	} else if sent {
+		log.Debugf("🤖 Notified systemd: %s", state)
+	}
+}
+
+// watchdogInterval returns how often the watchdog of systemd has to be
+// notified. Notifications are sent twice per configured interval. It
+// returns 0 if the watchdog is disabled.
+func watchdogInterval() time.Duration {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0 // the watchdog supervises a different process
+	}
+	return time.Duration(usec) * time.Microsecond / 2
+}
+
+// watchdogTicker returns a channel receiving a tick whenever the watchdog
+// has to be notified. The channel never receives anything if the watchdog
+// is disabled.
+func watchdogTicker() <-chan time.Time {
+	interval := watchdogInterval()
+	if interval == 0 {
+		return nil
+	}
+	log.Debugf("🤖 Notifying the systemd watchdog every %v", interval)
+	return time.Tick(interval)
+}
@@ -46,3 +46,17 @@ func IsLocalTimeValid() (bool, error) {
 	}
 	return false, nil
 }
+
+// atClockTime returns the given time of day on the day of the given date,
+// shifted by the given number of days. Unlike adding the offset to midnight
+// it keeps the wall clock time on days with a DST transition. Times skipped
+// when the clocks are put forward are moved to the end of the gap.
+func atClockTime(date time.Time, days int, offset time.Duration) time.Time {
+	year, month, day := date.Date()
+	hour, minute := int(offset/time.Hour), int(offset%time.Hour/time.Minute)
+	t := time.Date(year, month, day+days, hour, minute, 0, 0, date.Location())
+	if t.Hour() != hour%24 || t.Minute() != minute {
+		t = time.Date(year, month, day+days, hour+1, 0, 0, 0, date.Location())
+	}
+	return t
+}
@@ -0,0 +1,73 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestDaylightSavingTime(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Skipf("Time zone data not available: %v", err)
+	}
+	springForward := time.Date(2021, 3, 28, 12, 0, 0, 0, berlin)
+	fallBack := time.Date(2021, 10, 31, 12, 0, 0, 0, berlin)
+
+	if skipped := atClockTime(springForward, 0, 2*time.Hour+30*time.Minute); skipped.Hour() != 3 || skipped.Minute() != 0 {
+		t.Errorf("Skipped times should move to the end of the gap: %v", skipped)
+	}
+	for _, date := range []time.Time{springForward, fallBack} {
+		if evening := atClockTime(date, 0, 22*time.Hour); evening.Hour() != 22 || evening.Day() != date.Day() {
+			t.Errorf("Clock times should keep the wall clock on %v: %v", date, evening)
+		}
+		w := windDown{days: map[time.Weekday]bool{time.Sunday: true}, start: 22 * time.Hour, duration: 30 * time.Minute, target: LightState{2000, 10}}
+		if start, _, active := w.times(atClockTime(date, 0, 22*time.Hour+10*time.Minute)); !active || start.Hour() != 22 {
+			t.Errorf("Wind-down should start at 22:00 on %v: %v", date, start)
+		}
+		n := nightlight{start: 23 * time.Hour, end: 6 * time.Hour, state: LightState{2000, 5}}
+		if until, active := n.activeUntil(atClockTime(date, 0, 5*time.Hour)); !active || until.Hour() != 6 {
+			t.Errorf("Nightlight should end at 06:00 on %v: %v", date, until)
+		}
+	}
+
+	c := Configuration{Location: Location{Latitude: 52.52, Longitude: 13.405}}
+	lightSchedule := LightSchedule{Name: "DST", DefaultColorTemperature: 5000, DefaultBrightness: 100,
+		BeforeSunrise: []TimedColorTemperature{{Time: "01:30", ColorTemperature: 2000, Brightness: 10}, {Time: "02:30", ColorTemperature: 2200, Brightness: 20}, {Time: "03:00", ColorTemperature: 2400, Brightness: 30}},
+		AfterSunset:   []TimedColorTemperature{{Time: "22:00", ColorTemperature: 2000, Brightness: 40}}}
+	for date, hours := range map[time.Time]int{springForward: 23, fallBack: 25} {
+		schedule := c.scheduleForDay(lightSchedule, date)
+		for i := 1; i < len(schedule.beforeSunrise); i++ {
+			if schedule.beforeSunrise[i].Time.Before(schedule.beforeSunrise[i-1].Time) {
+				t.Errorf("Entries should keep their order on %v: %v", date, schedule.beforeSunrise)
+			}
+		}
+		timeline := c.timeline(lightSchedule, date, time.Hour)
+		if len(timeline.Points) != hours {
+			t.Errorf("Timeline of %v should cover %d hours without gaps: %d points", date, hours, len(timeline.Points))
+		}
+		if last := timeline.Points[len(timeline.Points)-1]; last.Time.Hour() != 23 || last.Brightness != 40 {
+			t.Errorf("Timeline of %v should end with the evening entry: %+v", date, last)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import "time"
+
+const timelineStep = 10 * time.Minute
+
+// TimelinePoint represents the calculated light state at a point in time.
+type TimelinePoint struct {
+	Time             time.Time `json:"time"`
+	ColorTemperature int       `json:"colorTemperature"`
+	Brightness       int       `json:"brightness"`
+}
+
+// TimelineMarker highlights a notable point in time of a timeline.
+type TimelineMarker struct {
+	Time time.Time `json:"time"`
+	Type string    `json:"type"`
+}
+
+// Timeline describes the course of a schedule over a whole day.
+type Timeline struct {
+	Schedule string           `json:"schedule"`
+	Date     string           `json:"date"`
+	Points   []TimelinePoint  `json:"points"`
+	Markers  []TimelineMarker `json:"markers"`
+}
+
+// SunTime compares the astronomical time of a sunrise or sunset with the
+// time used by the schedule.
+type SunTime struct {
+	Real     time.Time `json:"real"`
+	Adjusted time.Time `json:"adjusted"`
+}
+
+// Simulation contains the computed entries of a schedule for one day.
+type Simulation struct {
+	Schedule string          `json:"schedule"`
+	Date     string          `json:"date"`
+	Sunrise  SunTime         `json:"sunrise"`
+	Sunset   SunTime         `json:"sunset"`
+	Entries  []ScheduleEntry `json:"entries"`
+}
+
+// simulate computes the schedule for the given day.
+func (configuration *Configuration) simulate(lightSchedule LightSchedule, date time.Time) Simulation {
+	schedule := configuration.scheduleForDay(lightSchedule, date)
+	sunrise, sunset, _ := configuration.locationForSchedule(lightSchedule).sunTimes(date)
+	simulation := Simulation{
+		Schedule: lightSchedule.Name,
+		Date:     date.Format("2006-01-02"),
+		Sunrise:  SunTime{sunrise, schedule.sunrise.Time},
+		Sunset:   SunTime{sunset, schedule.sunset.Time},
+		Entries:  schedule.Entries(),
+	}
+	// There is no real sunrise or sunset during polar day and night
+	if schedule.polar != "" {
+		simulation.Sunrise.Real = time.Time{}
+		simulation.Sunset.Real = time.Time{}
+	}
+	return simulation
+}
+
+// timeline samples the schedule for the given day in the given steps.
+// Next to the configured entries the markers contain the real sunrise and
+// sunset and, if the schedule uses different times, the adjusted ones.
+func (configuration *Configuration) timeline(lightSchedule LightSchedule, date time.Time, step time.Duration) Timeline {
+	schedule := configuration.scheduleForDay(lightSchedule, date)
+	yr, mth, dy := date.Date()
+	start := time.Date(yr, mth, dy, 0, 0, 0, 0, date.Location())
+	timeline := Timeline{Schedule: lightSchedule.Name, Date: start.Format("2006-01-02"), Points: []TimelinePoint{}}
+
+	for timestamp := start; !timestamp.After(schedule.endOfDay); timestamp = timestamp.Add(step) {
+		state, err := schedule.lightStateAt(timestamp)
+		if err != nil {
+			break
+		}
+		timeline.Points = append(timeline.Points, TimelinePoint{timestamp, state.ColorTemperature, state.Brightness})
+	}
+
+	sunrise, sunset, _ := configuration.locationForSchedule(lightSchedule).sunTimes(date)
+	if schedule.polar == "" {
+		timeline.Markers = append(timeline.Markers, TimelineMarker{sunrise, "sunrise"}, TimelineMarker{sunset, "sunset"})
+	}
+	if !schedule.sunrise.Time.Equal(sunrise) {
+		timeline.Markers = append(timeline.Markers, TimelineMarker{schedule.sunrise.Time, "adjustedSunrise"})
+	}
+	if !schedule.sunset.Time.Equal(sunset) {
+		timeline.Markers = append(timeline.Markers, TimelineMarker{schedule.sunset.Time, "adjustedSunset"})
+	}
+	for _, entry := range schedule.Entries() {
+		if entry.Active && (entry.Type == "beforeSunrise" || entry.Type == "afterSunset") {
+			timeline.Markers = append(timeline.Markers, TimelineMarker{entry.Time, entry.Type})
+		}
+	}
+	return timeline
+}
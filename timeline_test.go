@@ -0,0 +1,72 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestTimeline(t *testing.T) {
+	c := Configuration{Location: Location{Latitude: 53.5, Longitude: 10.0}}
+	lightSchedule := LightSchedule{Name: "home", DefaultColorTemperature: 5000, DefaultBrightness: 100}
+	lightSchedule.AfterSunset = []TimedColorTemperature{{Time: "22:00", ColorTemperature: 2000, Brightness: 40}}
+	date := time.Date(2019, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	timeline := c.timeline(lightSchedule, date, time.Hour)
+	if timeline.Date != "2019-03-01" || len(timeline.Points) != 24 {
+		t.Fatalf("Timeline should contain one point per hour of %s, got %d points for %s", "2019-03-01", len(timeline.Points), timeline.Date)
+	}
+	if noon := timeline.Points[12]; noon.ColorTemperature != 5000 || noon.Brightness != 100 {
+		t.Errorf("Timeline should use the default values at noon, got %+v", noon)
+	}
+	if late := timeline.Points[23]; late.ColorTemperature != 2000 || late.Brightness != 40 {
+		t.Errorf("Timeline should use the last entry before midnight, got %+v", late)
+	}
+
+	types := []string{}
+	for _, marker := range timeline.Markers {
+		types = append(types, marker.Type)
+	}
+	if !reflect.DeepEqual(types, []string{"sunrise", "sunset", "afterSunset"}) {
+		t.Errorf("Timeline should mark sunrise, sunset and the schedule entry, got %v", types)
+	}
+}
+
+func TestSimulateSchedule(t *testing.T) {
+	c := Configuration{Location: Location{Latitude: 53.5, Longitude: 10.0}}
+	lightSchedule := LightSchedule{Name: "home", DefaultColorTemperature: 5000, DefaultBrightness: 100}
+	lightSchedule.AfterSunset = []TimedColorTemperature{{Time: "22:00", ColorTemperature: 2000, Brightness: 40}}
+	winter := c.simulate(lightSchedule, time.Date(2024, time.December, 21, 12, 0, 0, 0, time.UTC))
+	summer := c.simulate(lightSchedule, time.Date(2024, time.June, 21, 12, 0, 0, 0, time.UTC))
+
+	if winter.Date != "2024-12-21" || len(winter.Entries) != 3 {
+		t.Fatalf("Simulation should contain sunrise, sunset and the entry for the requested day, got %+v", winter)
+	}
+	if !winter.Sunrise.Real.Equal(winter.Sunrise.Adjusted) || !winter.Sunset.Real.Equal(winter.Sunset.Adjusted) {
+		t.Errorf("Schedule without adjustments should use the real sun times, got %+v and %+v", winter.Sunrise, winter.Sunset)
+	}
+	if winterDay, summerDay := winter.Sunset.Real.Sub(winter.Sunrise.Real), summer.Sunset.Real.Sub(summer.Sunrise.Real); winterDay >= summerDay {
+		t.Errorf("Winter days should be shorter than summer days, got %v and %v", winterDay, summerDay)
+	}
+}
@@ -0,0 +1,312 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const tracingExportInterval = 5 * time.Second
+const tracingTimeout = 10 * time.Second
+
+// maxPendingSpans limits the memory used while the collector is
+// unreachable. The oldest spans are dropped first.
+const maxPendingSpans = 2048
+
+// Status codes of OTLP
+const (
+	spanStatusUnset = 0
+	spanStatusError = 2
+)
+
+// spanKindInternal and spanKindClient are the OTLP kinds of an update step
+// and of a request to the bridge.
+const (
+	spanKindInternal = 1
+	spanKindClient   = 3
+)
+
+// Tracing configures the export of traces of all update cycles to an
+// OpenTelemetry collector via OTLP/HTTP.
+type Tracing struct {
+	Endpoint    string            `json:"endpoint"`
+	ServiceName string            `json:"serviceName,omitempty"`
+	Headers     map[string]string `json:"headers,omitempty"`
+}
+
+func (tracing *Tracing) serviceName() string {
+	if tracing.ServiceName == "" {
+		return "kelvin"
+	}
+	return tracing.ServiceName
+}
+
+// url returns the URL traces are sent to. The path of the OTLP/HTTP
+// trace endpoint is added if the endpoint doesn't contain one.
+func (tracing *Tracing) url() string {
+	endpoint := strings.TrimSuffix(tracing.Endpoint, "/")
+	if strings.HasSuffix(endpoint, "/v1/traces") {
+		return endpoint
+	}
+	return endpoint + "/v1/traces"
+}
+
+// span is a single timed operation of an update cycle. All methods can be
+// called on nil spans, which are returned while tracing is disabled.
+type span struct {
+	traceID    string
+	spanID     string
+	parentID   string
+	name       string
+	kind       int
+	start      time.Time
+	end        time.Time
+	attributes map[string]interface{}
+	status     int
+	message    string
+}
+
+// tracer collects the finished spans and exports them in batches.
+type tracer struct {
+	configuration *Tracing
+	client        *http.Client
+	pending       []*span
+	lock          sync.Mutex
+}
+
+var activeTracer *tracer
+
+// startTracing exports the traces of all update cycles to the configured
+// collector.
+func startTracing(tracing *Tracing) {
+	if tracing == nil || tracing.Endpoint == "" {
+		return
+	}
+	activeTracer = &tracer{configuration: tracing, client: &http.Client{Timeout: tracingTimeout}}
+	log.Printf("🤖 Exporting traces to %s", tracing.url())
+	go supervise("trace export", func() {
+		for range time.Tick(tracingExportInterval) {
+			err := activeTracer.export()
+			if err != nil {
+				log.Debugf("🤖 Could not export traces: %v", err)
+			}
+		}
+	})
+}
+
+func randomID(length int) string {
+	id := make([]byte, length)
+	rand.Read(id)
+	return hex.EncodeToString(id)
+}
+
+func newSpan(name string, kind int) *span {
+	return &span{spanID: randomID(8), name: name, kind: kind, start: time.Now(), attributes: make(map[string]interface{})}
+}
+
+// startTrace starts the root span of an update cycle.
+func startTrace(name string) *span {
+	if activeTracer == nil {
+		return nil
+	}
+	s := newSpan(name, spanKindInternal)
+	s.traceID = randomID(16)
+	return s
+}
+
+// continueTrace starts a step of the given cycle or a new cycle if there
+// is no parent.
+func continueTrace(parent *span, name string) *span {
+	if parent == nil {
+		return startTrace(name)
+	}
+	return parent.child(name, spanKindInternal)
+}
+
+// child starts a step of the span. Steps of nil spans aren't traced, so
+// work outside of an update cycle is never recorded.
+func (s *span) child(name string, kind int) *span {
+	if s == nil {
+		return nil
+	}
+	child := newSpan(name, kind)
+	child.traceID = s.traceID
+	child.parentID = s.spanID
+	return child
+}
+
+func (s *span) setAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	activeTracer.lock.Lock()
+	defer activeTracer.lock.Unlock()
+	s.attributes[key] = value
+}
+
+// setError marks the span as failed. Nil errors are ignored.
+func (s *span) setError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	activeTracer.lock.Lock()
+	defer activeTracer.lock.Unlock()
+	s.status = spanStatusError
+	s.message = err.Error()
+}
+
+// finish ends the span and queues it for the export.
+func (s *span) finish() {
+	if s == nil {
+		return
+	}
+	activeTracer.lock.Lock()
+	defer activeTracer.lock.Unlock()
+	s.end = time.Now()
+	activeTracer.queue(s)
+}
+
+// queue adds the spans to the next export. The caller must hold the lock.
+func (tracer *tracer) queue(spans ...*span) {
+	tracer.pending = append(tracer.pending, spans...)
+	if len(tracer.pending) > maxPendingSpans {
+		tracer.pending = tracer.pending[len(tracer.pending)-maxPendingSpans:]
+	}
+}
+
+// otlpAttribute is a key value pair in the JSON encoding of OTLP.
+type otlpAttribute struct {
+	Key   string                 `json:"key"`
+	Value map[string]interface{} `json:"value"`
+}
+
+func otlpAttributes(attributes map[string]interface{}) []otlpAttribute {
+	result := []otlpAttribute{}
+	for key, value := range attributes {
+		var encoded map[string]interface{}
+		switch v := value.(type) {
+		case bool:
+			encoded = map[string]interface{}{"boolValue": v}
+		case int:
+			// 64 bit integers are encoded as strings
+			encoded = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case float64:
+			encoded = map[string]interface{}{"doubleValue": v}
+		default:
+			encoded = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		result = append(result, otlpAttribute{key, encoded})
+	}
+	return result
+}
+
+// encode returns the spans as OTLP/JSON request.
+func (tracer *tracer) encode(spans []*span) ([]byte, error) {
+	encoded := []map[string]interface{}{}
+	for _, s := range spans {
+		entry := map[string]interface{}{
+			"traceId":           s.traceID,
+			"spanId":            s.spanID,
+			"name":              s.name,
+			"kind":              s.kind,
+			"startTimeUnixNano": strconv.FormatInt(s.start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(s.end.UnixNano(), 10),
+			"attributes":        otlpAttributes(s.attributes),
+			"status":            map[string]interface{}{"code": s.status, "message": s.message},
+		}
+		if s.parentID != "" {
+			entry["parentSpanId"] = s.parentID
+		}
+		encoded = append(encoded, entry)
+	}
+	request := map[string]interface{}{
+		"resourceSpans": []interface{}{map[string]interface{}{
+			"resource": map[string]interface{}{"attributes": otlpAttributes(map[string]interface{}{"service.name": tracer.configuration.serviceName(), "service.version": version})},
+			"scopeSpans": []interface{}{map[string]interface{}{
+				"scope": map[string]interface{}{"name": "kelvin"},
+				"spans": encoded,
+			}},
+		}},
+	}
+	return json.Marshal(request)
+}
+
+// export sends all finished spans to the collector. If the export fails,
+// the spans are kept for the next attempt.
+func (tracer *tracer) export() error {
+	tracer.lock.Lock()
+	spans := tracer.pending
+	tracer.pending = nil
+	tracer.lock.Unlock()
+	if len(spans) == 0 {
+		return nil
+	}
+	err := tracer.send(spans)
+	if err != nil {
+		tracer.lock.Lock()
+		// Spans finished in the meantime are newer
+		tracer.pending = append(spans, tracer.pending...)
+		tracer.queue()
+		tracer.lock.Unlock()
+		return err
+	}
+	log.Debugf("🤖 Exported %d spans", len(spans))
+	return nil
+}
+
+func (tracer *tracer) send(spans []*span) error {
+	data, err := tracer.encode(spans)
+	if err != nil {
+		return err
+	}
+
+	request, err := http.NewRequest("POST", tracer.configuration.url(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	for name, value := range tracer.configuration.Headers {
+		request.Header.Set(name, value)
+	}
+	response, err := tracer.client.Do(request)
+	if response != nil {
+		defer response.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("Collector returned HTTP %d", response.StatusCode)
+	}
+	return nil
+}
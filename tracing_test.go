@@ -0,0 +1,96 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestTracing(t *testing.T) {
+	var received map[string]interface{}
+	reject := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if reject || r.URL.Path != "/v1/traces" || r.Header.Get("Authorization") != "secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	if s := startTrace("disabled"); s != nil {
+		t.Errorf("Nothing should be traced while tracing is disabled")
+	}
+	activeTracer = &tracer{configuration: &Tracing{Endpoint: server.URL, Headers: map[string]string{"Authorization": "secret"}}, client: server.Client()}
+	defer func() { activeTracer = nil }()
+
+	var outside *span
+	if s := outside.child("outside", spanKindInternal); s != nil {
+		t.Errorf("Spans outside of a cycle should not be traced")
+	}
+	trace := startTrace("update lights")
+	light := trace.child("update light", spanKindInternal)
+	light.setAttribute("light", "Kitchen")
+	request := light.child("PUT /lights/1/state", spanKindClient)
+	request.setError(errBridgeBusy)
+	request.finish()
+	light.finish()
+	trace.finish()
+	if request.parentID != light.spanID || light.parentID != trace.spanID || request.traceID != trace.traceID || len(trace.traceID) != 32 {
+		t.Errorf("Unexpected span hierarchy")
+	}
+	if s := continueTrace(trace, "update lights"); s.traceID != trace.traceID {
+		t.Errorf("Continued traces should join the cycle")
+	}
+	if s := continueTrace(nil, "update lights"); s.traceID == trace.traceID || s.parentID != "" {
+		t.Errorf("Traces without parent should start a new cycle")
+	}
+
+	err := activeTracer.export()
+	if err == nil || len(activeTracer.pending) != 3 {
+		t.Fatalf("Rejected spans should be kept for the next export: %v", err)
+	}
+	reject = false
+	err = activeTracer.export()
+	if err != nil {
+		t.Fatal(err)
+	}
+	spans := received["resourceSpans"].([]interface{})[0].(map[string]interface{})["scopeSpans"].([]interface{})[0].(map[string]interface{})["spans"].([]interface{})
+	if len(spans) != 3 {
+		t.Fatalf("Expected 3 spans, got %d", len(spans))
+	}
+	if status := spans[0].(map[string]interface{})["status"].(map[string]interface{}); status["code"] != float64(spanStatusError) {
+		t.Errorf("Failed requests should have an error status: %v", status)
+	}
+	if len(activeTracer.pending) != 0 {
+		t.Errorf("Exported spans should be removed")
+	}
+
+	c := Configuration{Tracing: &Tracing{Endpoint: "localhost:4318"}}
+	if messages := strings.Join(c.Validate().Errors, "\n"); !strings.Contains(messages, "tracing endpoint") {
+		t.Errorf("Invalid tracing endpoint should fail validation: %v", messages)
+	}
+}
@@ -21,38 +21,170 @@
 // SOFTWARE.
 package main
 
-import log "github.com/sirupsen/logrus"
 import "runtime"
 import "path/filepath"
 import "github.com/Masterminds/semver"
 import "time"
 import "fmt"
 import "os"
+import "strings"
+import "errors"
 
-const upgradeURL = "https://api.github.com/repos/stefanwichmann/kelvin/releases/latest"
+const githubAPIURL = "https://api.github.com/repos/"
 const updateCheckInterval = 12 * time.Hour
 
-// CheckForUpdate will get the latest release information of Kelvin
-// from github and compare it to the given version. If a newer version
-// is found it will try to replace the running binary and restart.
-func CheckForUpdate(currentVersion string, forceUpdate bool) {
+// updateRepository is the GitHub repository (owner/name) Kelvin installs
+// its updates from. Builds of other forks set it with
+// -ldflags "-X main.updateRepository=owner/name".
+var updateRepository = "RaphaelMarinier/kelvin"
+
+// updatePublicKey is the minisign public key the checksums of all releases
+// have to be signed with. It can be set at build time like the repository.
+var updatePublicKey = ""
+
+const updateChannelStable = "stable"
+const updateChannelBeta = "beta"
+
+var updateChannels = []string{updateChannelStable, updateChannelBeta}
+
+// Updates configures where Kelvin looks for new releases. The beta channel
+// includes pre-releases.
+type Updates struct {
+	Repository string `json:"repository,omitempty"`
+	URL        string `json:"url,omitempty"`
+	Channel    string `json:"channel,omitempty"`
+	Enabled    *bool  `json:"enabled,omitempty"`
+	PublicKey  string `json:"publicKey,omitempty"`
+	Window     string `json:"window,omitempty"`
+}
+
+// updateWindow is the time of day the updater may restart Kelvin. It may
+// span midnight, e.g. 23:00-01:00.
+type updateWindow struct {
+	start time.Duration
+	end   time.Duration
+}
+
+func (updates *Updates) window() (*updateWindow, error) {
+	if updates == nil || updates.Window == "" {
+		return nil, nil
+	}
+	parts := strings.Split(updates.Window, "-")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("Invalid update window %q (expected e.g. 03:00-05:00)", updates.Window)
+	}
+	start, err := parseClockTime(strings.TrimSpace(parts[0]))
+	if err != nil {
+		return nil, err
+	}
+	end, err := parseClockTime(strings.TrimSpace(parts[1]))
+	if err != nil {
+		return nil, err
+	}
+	if start == end {
+		return nil, fmt.Errorf("Update window %q is empty", updates.Window)
+	}
+	return &updateWindow{start, end}, nil
+}
+
+// wait returns the duration until the window opens. It is zero within the
+// window or if no window is configured.
+func (window *updateWindow) wait(now time.Time) time.Duration {
+	if window == nil {
+		return 0
+	}
+	start := atClockTime(now, 0, window.start)
+	end := atClockTime(now, 0, window.end)
+	if window.end < window.start {
+		if now.Before(end) || !now.Before(start) {
+			return 0
+		}
+		return start.Sub(now)
+	}
+	if now.Before(start) {
+		return start.Sub(now)
+	}
+	if now.Before(end) {
+		return 0
+	}
+	return atClockTime(now, 1, window.start).Sub(now)
+}
+
+func (updates *Updates) publicKey() string {
+	if updates == nil || updates.PublicKey == "" {
+		return updatePublicKey
+	}
+	return updates.PublicKey
+}
+
+// enabled returns false if automatic updates were turned off, e.g. because
+// Kelvin is installed by a package manager.
+func (updates *Updates) enabled() bool {
+	return updates == nil || updates.Enabled == nil || *updates.Enabled
+}
+
+func (updates *Updates) channel() string {
+	if updates == nil || updates.Channel == "" {
+		return updateChannelStable
+	}
+	return updates.Channel
+}
+
+func (updates *Updates) repository() string {
+	if updates == nil || updates.Repository == "" {
+		return updateRepository
+	}
+	return updates.Repository
+}
+
+// repositoryURL returns the API URL of the repository releases are read
+// from. URL allows mirrors and GitHub Enterprise instances.
+func (updates *Updates) repositoryURL() string {
+	if updates != nil && updates.URL != "" {
+		return strings.TrimSuffix(updates.URL, "/")
+	}
+	return githubAPIURL + updates.repository()
+}
+
+// validRepository returns true if the given repository has the format
+// owner/name.
+func validRepository(repository string) bool {
+	parts := strings.Split(repository, "/")
+	return len(parts) == 2 && parts[0] != "" && parts[1] != ""
+}
+
+// CheckForUpdate will get the latest release information of Kelvin from
+// the configured repository and compare it to the given version. If a
+// newer version is found it will try to replace the running binary and
+// restart.
+func CheckForUpdate(currentVersion string, forceUpdate bool, updates *Updates) {
 	// only look for update if version string matches a valid release version
 	version, err := semver.NewVersion(currentVersion)
 	if err != nil {
 		return
 	}
 
+	window, err := updates.window()
+	if err != nil {
+		updaterLog.Warningf("Ignoring update window: %v", err)
+	}
+
 	for {
-		log.Printf("Looking for updates...")
-		avail, url, err := updateAvailable(version, upgradeURL, forceUpdate)
+		// Restarting interrupts transitions, so only update while nobody watches
+		if wait := window.wait(time.Now()); wait > 0 {
+			updaterLog.Debugf("Waiting %v for the update window %s", wait.Round(time.Minute), updates.Window)
+			time.Sleep(wait)
+		}
+		updaterLog.Printf("Looking for updates...")
+		avail, release, err := updateAvailable(version, updates.repositoryURL(), updates.channel(), forceUpdate)
 		if err != nil {
-			log.Warningf("Error looking for update: %v", err)
+			updaterLog.Warningf("Error looking for update: %v", err)
 		} else if avail {
-			err = updateBinary(url)
+			err = updateBinary(release, updates.publicKey())
 			if err != nil {
-				log.Warningf("Error updating binary: %v.", err)
+				updaterLog.Warningf("Error updating binary: %v.", err)
 			} else {
-				log.Printf("Restarting...")
+				updaterLog.Printf("Restarting...")
 				Restart()
 			}
 		}
@@ -61,49 +193,94 @@ func CheckForUpdate(currentVersion string, forceUpdate bool) {
 	}
 }
 
-func updateAvailable(currentVersion *semver.Version, url string, forceUpdate bool) (bool, string, error) {
-	releaseName, assetURL, err := downloadLatestReleaseInfo(url)
+func updateAvailable(currentVersion *semver.Version, url string, channel string, forceUpdate bool) (bool, *releaseInfo, error) {
+	releases, err := downloadReleases(url)
 	if err != nil {
-		return false, "", err
+		return false, nil, err
 	}
 
-	// parse name and compare
-	version, err := semver.NewVersion(releaseName)
-	if err != nil {
-		log.Debugf("Could not parse release name: %s", releaseName)
-		return false, "", err
+	version, release := latestRelease(releases, channel)
+	if version == nil {
+		return false, nil, errors.New("No matching release found")
 	}
 
 	if !version.GreaterThan(currentVersion) {
-		return false, "", nil
+		return false, nil, nil
 	}
 
 	// Found new version. Exlude major upgrades with breaking changes.
-	c, err := semver.NewConstraint(fmt.Sprintf("^%s", currentVersion.String()))
+	c, err := semver.NewConstraint(fmt.Sprintf("^%s", withoutPrerelease(currentVersion).String()))
 	if err != nil {
-		log.Debugf("Could not parse constraint: %v", err)
-		return false, "", nil
+		updaterLog.Debugf("Could not parse constraint: %v", err)
+		return false, nil, nil
 	}
 
-	if c.Check(version) || forceUpdate {
-		log.Printf("Found new release version %s.", version)
-		return true, assetURL, nil
+	if c.Check(withoutPrerelease(version)) || forceUpdate {
+		updaterLog.Printf("Found new release version %s.", version)
+		return true, release, nil
 	}
 
-	log.Warningf("Found new major release %s which might break your existing configuration file. Please upgrade by running Kelvin with parameter '-forceUpdate'.", version)
-	return false, "", nil
+	updaterLog.Warningf("Found new major release %s which might break your existing configuration file. Please upgrade by running Kelvin with parameter '-forceUpdate'.", version)
+	return false, nil, nil
 }
 
-func updateBinary(assetURL string) error {
+// latestRelease returns the highest version of the given releases which
+// belongs to the channel and provides an archive for this platform. Only
+// the beta channel accepts releases marked as pre-release or tagged with a
+// pre-release version like v2.0.0-beta.1.
+func latestRelease(releases []releaseInfo, channel string) (*semver.Version, *releaseInfo) {
+	var latest *semver.Version
+	var latestRelease *releaseInfo
+	for i, release := range releases {
+		if release.Draft {
+			continue
+		}
+		version, err := release.version()
+		if err != nil {
+			updaterLog.Debugf("Could not parse release name: %s", release.TagName)
+			continue
+		}
+		if channel != updateChannelBeta && (release.Prerelease || version.Prerelease() != "") {
+			continue
+		}
+		if _, _, found := release.archive(); !found {
+			continue
+		}
+		if latest == nil || version.GreaterThan(latest) {
+			latest, latestRelease = version, &releases[i]
+		}
+	}
+	return latest, latestRelease
+}
+
+// withoutPrerelease returns the release version a pre-release leads to.
+// Constraints never match pre-releases otherwise.
+func withoutPrerelease(version *semver.Version) *semver.Version {
+	release, err := version.SetPrerelease("")
+	if err != nil {
+		return version
+	}
+	return &release
+}
+
+func updateBinary(release *releaseInfo, publicKey string) error {
 	currentBinary := os.Args[0]
-	log.Printf("Downloading update archive %s", assetURL)
+	assetName, assetURL, _ := release.archive()
+	updaterLog.Printf("Downloading update archive %s", assetURL)
 	archive, err := downloadReleaseArchive(assetURL)
 	if err != nil {
 		os.Remove(archive)
 		return err
 	}
 	defer os.Remove(archive)
-	log.Debugf("Update archive downloaded to %v", archive)
+	updaterLog.Debugf("Update archive downloaded to %v", archive)
+
+	// Never execute a binary which wasn't published with the release
+	err = verifyArchive(release, archive, assetName, publicKey)
+	if err != nil {
+		return err
+	}
+	updaterLog.Debugf("Verified checksum of update archive %s", assetName)
 
 	// Find and extract binary
 	var tempBinary string
@@ -127,13 +304,13 @@ func updateBinary(assetURL string) error {
 	}
 
 	// Replace binary
-	log.Debugf("Replacing current binary %v with %v", currentBinary, tempBinary)
+	updaterLog.Debugf("Replacing current binary %v with %v", currentBinary, tempBinary)
 	err = replaceBinary(currentBinary, tempBinary)
 	if err != nil {
 		return err
 	}
 
-	log.Printf("Update successful")
+	updaterLog.Printf("Update successful")
 	return nil
 }
 
@@ -0,0 +1,106 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUpdateRepository(t *testing.T) {
+	var updates *Updates
+	if url := updates.repositoryURL(); url != "https://api.github.com/repos/"+updateRepository {
+		t.Errorf("Unexpected default repository URL %s", url)
+	}
+	updates = &Updates{Repository: "someone/kelvin"}
+	if url := updates.repositoryURL(); url != "https://api.github.com/repos/someone/kelvin" {
+		t.Errorf("Unexpected repository URL %s", url)
+	}
+	updates.URL = "https://github.example.com/api/v3/repos/someone/kelvin/"
+	if url := updates.repositoryURL(); url != "https://github.example.com/api/v3/repos/someone/kelvin" {
+		t.Errorf("Expected configured URL, got %s", url)
+	}
+
+	c := Configuration{Updates: &Updates{Repository: "kelvin", URL: "github.com"}}
+	if messages := strings.Join(c.Validate().Errors, "\n"); !strings.Contains(messages, "update repository") || !strings.Contains(messages, "update URL") {
+		t.Errorf("Invalid update settings should fail validation: %v", messages)
+	}
+}
+
+func TestUpdatesEnabled(t *testing.T) {
+	disabled := false
+	for _, c := range []struct {
+		updates *Updates
+		enabled bool
+	}{
+		{nil, true},
+		{&Updates{Channel: updateChannelBeta}, true},
+		{&Updates{Enabled: &disabled}, false},
+	} {
+		if c.updates.enabled() != c.enabled {
+			t.Errorf("Expected updates enabled to be %v for %+v", c.enabled, c.updates)
+		}
+	}
+
+	var c Configuration
+	err := json.Unmarshal([]byte(`{"updates": {"enabled": false}}`), &c)
+	if err != nil || c.Updates.enabled() {
+		t.Errorf("Updates should be disabled by the configuration (%v)", err)
+	}
+}
+
+func TestUpdateWindow(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 3, 1, hour, minute, 0, 0, time.UTC)
+	}
+	for _, c := range []struct {
+		window string
+		now    time.Time
+		wait   time.Duration
+	}{
+		{"", at(19, 0), 0},
+		{"03:00-05:00", at(4, 0), 0},
+		{"03:00-05:00", at(1, 30), 90 * time.Minute},
+		{"03:00-05:00", at(5, 0), 22 * time.Hour},
+		{"23:00-01:00", at(0, 30), 0},
+		{"23:00-01:00", at(23, 0), 0},
+		{"23:00-01:00", at(20, 0), 3 * time.Hour},
+	} {
+		window, err := (&Updates{Window: c.window}).window()
+		if err != nil {
+			t.Fatalf("Unexpected error for window %q: %v", c.window, err)
+		}
+		if wait := window.wait(c.now); wait != c.wait {
+			t.Errorf("Expected to wait %v for window %q at %v, got %v", c.wait, c.window, c.now, wait)
+		}
+	}
+
+	for _, invalid := range []string{"03:00", "03:00-25:00", "03:00-03:00"} {
+		c := Configuration{Updates: &Updates{Window: invalid}}
+		report := c.Validate()
+		if _, err := c.Updates.window(); err == nil || report.Valid() {
+			t.Errorf("Expected update window %q to be invalid", invalid)
+		}
+	}
+}
@@ -102,6 +102,10 @@ func equalsInt(a int, b int, maxDiff int) bool {
 // All arguments, pipes and environment variables will
 // be preserved.
 func Restart() {
+	// Keep overrides and manually changed lights across the restart
+	persistState()
+	runtimeState.close()
+
 	binary := os.Args[0]
 	args := []string{}
 	if len(os.Args) > 1 {
@@ -111,9 +115,20 @@ func Restart() {
 	cmd := exec.Command(binary, args...)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
-	cmd.Env = os.Environ()
+	// The new process takes over the watchdog of systemd
+	for _, variable := range os.Environ() {
+		if !strings.HasPrefix(variable, "WATCHDOG_PID=") {
+			cmd.Env = append(cmd.Env, variable)
+		}
+	}
 
-	cmd.Start()
+	// The new process has to acquire the locks
+	releaseLocks()
+	err := cmd.Start()
+	if err == nil {
+		// Hand the supervision by systemd over to the new process
+		notifySystemd(fmt.Sprintf("MAINPID=%d", cmd.Process.Pid))
+	}
 	os.Exit(0)
 }
 
@@ -147,3 +162,11 @@ func isYAMLFile(filename string) bool {
 	}
 	return false
 }
+
+func isDirectory(filename string) bool {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return false
+	}
+	return info.IsDir()
+}
@@ -0,0 +1,728 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// ValidationReport collects all problems found in a configuration.
+// Errors will prevent Kelvin from working as configured, warnings
+// point to entries which will probably not behave as intended.
+type ValidationReport struct {
+	Errors   []string `json:"errors"`
+	Warnings []string `json:"warnings"`
+}
+
+func (report *ValidationReport) errorf(format string, a ...interface{}) {
+	report.Errors = append(report.Errors, fmt.Sprintf(format, a...))
+}
+
+func (report *ValidationReport) warningf(format string, a ...interface{}) {
+	report.Warnings = append(report.Warnings, fmt.Sprintf(format, a...))
+}
+
+// Valid returns true if the report doesn't contain any errors.
+func (report *ValidationReport) Valid() bool {
+	return len(report.Errors) == 0
+}
+
+// validationDates returns the days of the given year used to test the
+// schedules: both solstices and both equinoxes.
+func validationDates(year int) []time.Time {
+	return []time.Time{
+		time.Date(year, time.March, 20, 12, 0, 0, 0, time.Local),
+		time.Date(year, time.June, 21, 12, 0, 0, 0, time.Local),
+		time.Date(year, time.September, 22, 12, 0, 0, 0, time.Local),
+		time.Date(year, time.December, 21, 12, 0, 0, 0, time.Local),
+	}
+}
+
+// Validate checks the configuration and all of its schedules without
+// contacting the bridge.
+func (configuration *Configuration) Validate() ValidationReport {
+	var report ValidationReport
+
+	if configuration.Bridge.IP == "" {
+		report.warningf("No bridge IP configured. Kelvin will start a bridge discovery.")
+	}
+	if configuration.Bridge.Username == "" {
+		report.warningf("No bridge username configured. Kelvin will start a user registration.")
+	}
+	// Locations on the equator or the prime meridian are valid, only both
+	// coordinates being zero means no location
+	if configuration.Location.Latitude == 0 && configuration.Location.Longitude == 0 {
+		report.warningf("No location configured. Configure it manually or start Kelvin with -detectLocation to detect it by IP.")
+	}
+	if !validLocation(configuration.Location) {
+		report.errorf("Invalid location %v, %v", configuration.Location.Latitude, configuration.Location.Longitude)
+	}
+	for name, location := range configuration.Locations {
+		if !validLocation(location) || (location.Latitude == 0 && location.Longitude == 0) {
+			report.errorf("Invalid location %s: %v, %v", name, location.Latitude, location.Longitude)
+		}
+		validateSunSettings(&report, fmt.Sprintf("Location %s", name), location)
+	}
+	validateSunSettings(&report, "Location", configuration.Location)
+	if configuration.WebInterface.Enabled && (configuration.WebInterface.Port <= 0 || configuration.WebInterface.Port > 65535) {
+		report.errorf("Invalid web interface port %d", configuration.WebInterface.Port)
+	}
+	if (configuration.WebInterface.Username == "") != (configuration.WebInterface.Password == "") {
+		report.errorf("Web interface authentication requires both a username and a password")
+	}
+	if tls := configuration.WebInterface.TLS; tls != nil && (tls.Certificate == "") != (tls.Key == "") {
+		report.errorf("Web interface TLS requires both a certificate and a key")
+	}
+	for _, origin := range configuration.WebInterface.CORSOrigins {
+		if origin == corsWildcard {
+			report.errorf("CORS origin %q is not allowed as requests carry credentials. List every origin explicitly, e.g. https://dashboard.example.com", origin)
+		} else if !validateCORSOrigin(origin) {
+			report.errorf("Invalid CORS origin %q. Use scheme and host only, e.g. https://dashboard.example.com", origin)
+		}
+	}
+	if configuration.WebInterface.Enabled && configuration.WebInterface.Token == "" && configuration.WebInterface.Password == "" {
+		report.warningf("The web interface is not protected. Configure a token or a username and password to restrict access.")
+	}
+
+	if _, err := parseTransitionTime(configuration.TransitionTime, lightTransistionTime); err != nil {
+		report.errorf("Invalid transition time \"%s\": %v", configuration.TransitionTime, err)
+	}
+	if _, err := parseUpdateInterval(configuration.UpdateInterval, stateUpdateInterval); err != nil {
+		report.errorf("Invalid update interval \"%s\": %v", configuration.UpdateInterval, err)
+	}
+	if _, err := parseIdlePollingInterval(configuration.IdlePollingInterval); err != nil {
+		report.errorf("Invalid idle polling interval \"%s\": %v", configuration.IdlePollingInterval, err)
+	}
+
+	for _, webhook := range configuration.Webhooks {
+		if err := webhook.validate(); err != nil {
+			report.errorf("Invalid webhook %q: %v", webhook.URL, err)
+		}
+	}
+
+	bridgeNames := make(map[string]bool)
+	for _, b := range configuration.Bridges {
+		if b.Name == "" || b.IP == "" {
+			report.errorf("Additional bridges require a name and an IP (found %q with IP %q)", b.Name, b.IP)
+		} else if bridgeNames[b.Name] {
+			report.errorf("Bridge %s is configured multiple times", b.Name)
+		}
+		bridgeNames[b.Name] = true
+	}
+
+	for _, wakeup := range configuration.Wakeups {
+		if _, err := wakeup.parse(); err != nil {
+			report.errorf("Invalid wake-up at %q: %v", wakeup.Time, err)
+		}
+		if wakeup.Bridge != "" && !bridgeNames[wakeup.Bridge] {
+			report.errorf("Wake-up at %q: Unknown bridge %s", wakeup.Time, wakeup.Bridge)
+		}
+		if wakeup.ColorTemperature != 0 && (wakeup.ColorTemperature < 1000 || wakeup.ColorTemperature > 6500) {
+			report.errorf("Wake-up at %q: Invalid color temperature %d (must be between 1000 and 6500)", wakeup.Time, wakeup.ColorTemperature)
+		}
+		if wakeup.Brightness < 0 || wakeup.Brightness > 100 {
+			report.errorf("Wake-up at %q: Invalid brightness %d (must be between 0 and 100)", wakeup.Time, wakeup.Brightness)
+		}
+	}
+
+	if simulation := configuration.AwaySimulation; simulation != nil {
+		if _, err := simulation.parse(); err != nil {
+			report.errorf("Invalid away simulation: %v", err)
+		}
+		if simulation.Bridge != "" && !bridgeNames[simulation.Bridge] {
+			report.errorf("Away simulation: Unknown bridge %s", simulation.Bridge)
+		}
+	}
+
+	if weather := configuration.Weather; weather != nil {
+		if !containsString(weatherProviders, weather.provider()) {
+			report.errorf("Unknown weather provider %s (must be one of %v)", weather.Provider, weatherProviders)
+		}
+		if weather.provider() == weatherProviderOpenWeatherMap && weather.APIKey == "" {
+			report.errorf("Weather provider %s requires an API key", weather.Provider)
+		}
+		if _, err := weather.updateInterval(); err != nil {
+			report.errorf("Invalid weather update interval %q: %v", weather.UpdateInterval, err)
+		}
+		if configuration.Location == (Location{}) {
+			report.warningf("Weather requires a configured location and will be ignored")
+		}
+	}
+
+	if logging := configuration.Logging; logging != nil {
+		if !containsString(logOutputs, logging.output()) {
+			report.errorf("Unknown log output %s (must be one of %v)", logging.Output, logOutputs)
+		}
+		if _, err := parseLogLevel(logging.Level, log.InfoLevel); err != nil {
+			report.errorf("%v", err)
+		}
+		for module, level := range logging.Levels {
+			if !containsString(logModules, module) {
+				report.errorf("Unknown log module %s (must be one of %v)", module, logModules)
+			} else if _, err := parseLogLevel(level, log.InfoLevel); err != nil {
+				report.errorf("Module %s: %v", module, err)
+			}
+		}
+		if logging.Address != "" {
+			if logging.output() != logOutputSyslog {
+				report.warningf("Log address is only used by output %s and will be ignored", logOutputSyslog)
+			} else if _, _, err := parseSyslogAddress(logging.Address); err != nil {
+				report.errorf("%v", err)
+			}
+		}
+	}
+
+	if tracing := configuration.Tracing; tracing != nil && tracing.Endpoint != "" {
+		if endpoint, err := url.Parse(tracing.Endpoint); err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+			report.errorf("Invalid tracing endpoint %s (expected e.g. http://localhost:4318)", tracing.Endpoint)
+		}
+	}
+
+	if statsD := configuration.StatsD; statsD != nil {
+		if _, _, err := net.SplitHostPort(statsD.address()); err != nil {
+			report.errorf("Invalid StatsD address %s: %v", statsD.Address, err)
+		}
+		if !containsString(statsDFormats, statsD.format()) {
+			report.errorf("Unknown StatsD format %s (must be one of %v)", statsD.Format, statsDFormats)
+		}
+		if len(statsD.Tags) > 0 && statsD.format() != statsDFormatDatadog {
+			report.warningf("StatsD tags are only supported by format %s and will be ignored", statsDFormatDatadog)
+		}
+	}
+
+	if configuration.Proxy != "" {
+		if _, err := parseProxy(configuration.Proxy); err != nil {
+			report.errorf("%v", err)
+		}
+	}
+
+	if updates := configuration.Updates; updates != nil {
+		if updates.Repository != "" && !validRepository(updates.Repository) {
+			report.errorf("Invalid update repository %s (expected owner/name)", updates.Repository)
+		}
+		if updates.PublicKey != "" {
+			if _, err := parseMinisignPublicKey(updates.PublicKey); err != nil {
+				report.errorf("%v", err)
+			}
+		}
+		if _, err := updates.window(); err != nil {
+			report.errorf("%v", err)
+		}
+		if !containsString(updateChannels, updates.channel()) {
+			report.errorf("Unknown update channel %s (must be one of %v)", updates.Channel, updateChannels)
+		}
+		if updates.URL != "" {
+			if u, err := url.Parse(updates.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				report.errorf("Invalid update URL %s (expected e.g. https://api.github.com/repos/owner/name)", updates.URL)
+			}
+		}
+	}
+
+	if m := configuration.MQTT; m != nil {
+		if m.Broker == "" {
+			report.errorf("MQTT requires a broker")
+		}
+		if strings.ContainsAny(m.Topic, "#+") {
+			report.errorf("MQTT topic %s must not contain wildcards", m.Topic)
+		}
+	}
+
+	if h := configuration.HomeKit; h != nil {
+		if !homeKitPinPattern.MatchString(h.pin()) {
+			report.errorf("Invalid HomeKit PIN %s (expected 8 digits)", h.Pin)
+		}
+		if h.Port < 0 || h.Port > 65535 {
+			report.errorf("Invalid HomeKit port %d", h.Port)
+		}
+		if _, err := h.pauseDuration(); err != nil {
+			report.errorf("Invalid HomeKit pause duration %q: %v", h.PauseDuration, err)
+		}
+	}
+
+	if c := configuration.Calendar; c != nil {
+		if c.URL == "" {
+			report.errorf("Calendar requires the URL or path of an .ics file")
+		}
+		if _, err := c.updateInterval(); err != nil {
+			report.errorf("Invalid calendar update interval %q: %v", c.UpdateInterval, err)
+		}
+		schedules := make(map[string]bool)
+		for _, lightSchedule := range configuration.Schedules {
+			schedules[lightSchedule.Name] = true
+		}
+		for _, rule := range c.Rules {
+			if rule.Summary == "" {
+				report.errorf("Calendar rules require a summary")
+			}
+			switch rule.Action {
+			case calendarActionDisable:
+				for _, name := range rule.Schedules {
+					if !schedules[name] {
+						report.errorf("Calendar rule %q: Unknown schedule %s", rule.Summary, name)
+					}
+				}
+			case calendarActionSchedule:
+				if !schedules[rule.Schedule] {
+					report.errorf("Calendar rule %q: Unknown alternate schedule %q", rule.Summary, rule.Schedule)
+				}
+			case calendarActionAwaySimulation:
+			default:
+				report.errorf("Calendar rule %q: Unknown action %s (must be one of %v)", rule.Summary, rule.Action, calendarActions)
+			}
+		}
+	}
+
+	if s := configuration.Shutdown; s != nil {
+		if _, err := s.timeout(); err != nil {
+			report.errorf("Invalid shutdown timeout %q: %v", s.Timeout, err)
+		}
+		if s.Scene != "" && s.Restore {
+			report.warningf("Shutdown scene %s takes precedence, restore will be ignored", s.Scene)
+		}
+	}
+
+	if p := configuration.Presence; p != nil {
+		if _, err := p.timeout(); err != nil {
+			report.errorf("Invalid presence timeout %q: %v", p.Timeout, err)
+		}
+		for _, device := range p.Devices {
+			if device.Host == "" && device.MAC == "" {
+				report.errorf("Presence device %q requires a host or a MAC address", device.Name)
+			}
+			if _, ok := normalizeMAC(device.MAC); device.MAC != "" && !ok {
+				report.errorf("Presence device %q: Invalid MAC address %s", device.Name, device.MAC)
+			}
+		}
+		if p.MQTT != nil && (p.MQTT.Broker == "" || p.MQTT.Topic == "") {
+			report.errorf("Presence via MQTT requires a broker and a topic")
+		}
+		if len(p.Devices) == 0 && p.MQTT == nil {
+			report.warningf("Presence detection is configured without devices or MQTT topic. Everyone is considered away after the timeout")
+		}
+	}
+
+	if len(configuration.Schedules) == 0 {
+		report.errorf("Configuration doesn't contain any schedules")
+	}
+
+	for _, conflict := range configuration.scheduleConflicts() {
+		report.warningf("%s", conflict)
+	}
+
+	deviceNames := make(map[string]LightSchedule)
+	defaultSchedule := ""
+	for _, lightSchedule := range configuration.Schedules {
+		name := lightSchedule.Name
+		if lightSchedule.Default {
+			if defaultSchedule != "" {
+				report.warningf("Schedule %s: Schedule %s is already marked as default. This flag will be ignored", name, defaultSchedule)
+			} else {
+				defaultSchedule = name
+			}
+		}
+		if len(lightSchedule.AssociatedDeviceIDs) == 0 && len(lightSchedule.AssociatedDeviceNames) == 0 && len(lightSchedule.AssociatedGroups) == 0 && len(lightSchedule.WLED) == 0 && len(lightSchedule.Nanoleaf) == 0 && !lightSchedule.Default {
+			report.warningf("Schedule %s: No associated devices", name)
+		}
+		for _, device := range lightSchedule.AssociatedDeviceNames {
+			if _, err := deviceNamePattern(device); err != nil {
+				report.errorf("Schedule %s: Invalid light name pattern \"%s\": %v", name, device, err)
+				continue
+			}
+			key := lightSchedule.Bridge + "/" + strings.ToLower(strings.TrimSpace(device))
+			if other, found := deviceNames[key]; found {
+				if other.Priority == lightSchedule.Priority {
+					report.warningf("Schedule %s: Device \"%s\" is already associated with schedule %s of the same priority and will be ignored here", name, device, other.Name)
+				}
+				continue
+			}
+			deviceNames[key] = lightSchedule
+		}
+		for _, group := range lightSchedule.AssociatedGroups {
+			if _, err := deviceNamePattern(group); err != nil {
+				report.errorf("Schedule %s: Invalid group name pattern \"%s\": %v", name, group, err)
+			}
+		}
+
+		if lightSchedule.Bridge != "" && configuration.bridgeConfiguration(lightSchedule.Bridge) == nil {
+			report.errorf("Schedule %s: Unknown bridge %s", name, lightSchedule.Bridge)
+		}
+		if _, found := configuration.Locations[lightSchedule.Location]; lightSchedule.Location != "" && !found {
+			report.errorf("Schedule %s: Unknown location %s", name, lightSchedule.Location)
+		}
+		if _, err := parseTwilight(lightSchedule.Twilight); err != nil {
+			report.errorf("Schedule %s: %v", name, err)
+		}
+		validateMoonPhases(&report, fmt.Sprintf("Schedule %s", name), lightSchedule.MoonPhases)
+
+		if boost := lightSchedule.MotionBoost; boost != nil {
+			if strings.TrimSpace(boost.Sensor) == "" {
+				report.errorf("Schedule %s: Motion boost requires a sensor", name)
+			}
+			if boost.Brightness < 1 || boost.Brightness > 100 {
+				report.errorf("Schedule %s: Invalid motion boost brightness %d%% (valid: 1%% - 100%%)", name, boost.Brightness)
+			}
+			if _, err := boost.duration(); err != nil {
+				report.errorf("Schedule %s: Invalid motion boost duration \"%s\": %v", name, boost.Duration, err)
+			}
+		}
+
+		if override := lightSchedule.SwitchOverride; override != nil {
+			if len(override.Switches) == 0 {
+				report.errorf("Schedule %s: Switch override requires at least one switch", name)
+			}
+			if _, err := override.duration(); err != nil {
+				report.errorf("Schedule %s: Invalid switch override duration \"%s\": %v", name, override.Duration, err)
+			}
+		}
+
+		if change := lightSchedule.ManualChange; change != nil {
+			if change.ColorTemperature < 0 || change.ColorTemperature > 5500 {
+				report.errorf("Schedule %s: Invalid manual change color temperature tolerance %d (must be between 0 and 5500)", name, change.ColorTemperature)
+			}
+			if change.Brightness < 0 || change.Brightness > 100 {
+				report.errorf("Schedule %s: Invalid manual change brightness tolerance %d (must be between 0 and 100)", name, change.Brightness)
+			}
+			if _, err := change.duration(); err != nil {
+				report.errorf("Schedule %s: Invalid manual change duration \"%s\": %v", name, change.Duration, err)
+			}
+		}
+
+		report.validateBrightnessLimit("Schedule "+name, BrightnessLimit{lightSchedule.MinBrightness, lightSchedule.MaxBrightness})
+		var limitedLights []string
+		for light := range lightSchedule.BrightnessLimits {
+			limitedLights = append(limitedLights, light)
+		}
+		sort.Strings(limitedLights)
+		for _, light := range limitedLights {
+			report.validateBrightnessLimit(fmt.Sprintf("Schedule %s: Light %s", name, light), lightSchedule.BrightnessLimits[light])
+		}
+
+		if configured := lightSchedule.Nightlight; configured != nil {
+			if _, err := configured.parse(); err != nil {
+				report.errorf("Schedule %s: Invalid nightlight: %v", name, err)
+			}
+			if configured.ColorTemperature != 0 && (configured.ColorTemperature < 1000 || configured.ColorTemperature > 6500) {
+				report.errorf("Schedule %s: Invalid nightlight color temperature %d (must be between 1000 and 6500)", name, configured.ColorTemperature)
+			}
+			if configured.Brightness < 0 || configured.Brightness > 100 {
+				report.errorf("Schedule %s: Invalid nightlight brightness %d (must be between 0 and 100)", name, configured.Brightness)
+			}
+		}
+
+		if configured := lightSchedule.WindDown; configured != nil {
+			if _, err := configured.parse(); err != nil {
+				report.errorf("Schedule %s: Invalid wind-down: %v", name, err)
+			}
+			if configured.ColorTemperature != 0 && (configured.ColorTemperature < 1000 || configured.ColorTemperature > 6500) {
+				report.errorf("Schedule %s: Invalid wind-down color temperature %d (must be between 1000 and 6500)", name, configured.ColorTemperature)
+			}
+			if configured.Brightness < 0 || configured.Brightness > 100 {
+				report.errorf("Schedule %s: Invalid wind-down brightness %d (must be between 0 and 100)", name, configured.Brightness)
+			}
+		}
+
+		if band := lightSchedule.DeadBand; band != nil {
+			if band.ColorTemperature < 0 || band.ColorTemperature > 5500 {
+				report.errorf("Schedule %s: Invalid dead band color temperature %d (must be between 0 and 5500)", name, band.ColorTemperature)
+			}
+			if band.Brightness < 0 || band.Brightness > 100 {
+				report.errorf("Schedule %s: Invalid dead band brightness %d (must be between 0 and 100)", name, band.Brightness)
+			}
+		}
+
+		if compensation := lightSchedule.LuxCompensation; compensation != nil {
+			if strings.TrimSpace(compensation.Sensor) == "" {
+				report.errorf("Schedule %s: Lux compensation requires a sensor", name)
+			}
+			if len(compensation.Ranges) == 0 {
+				report.warningf("Schedule %s: Lux compensation doesn't define any ranges and will be ignored", name)
+			}
+			for _, r := range compensation.Ranges {
+				if r.Multiplier <= 0 {
+					report.errorf("Schedule %s: Invalid lux compensation multiplier %v (must be positive)", name, r.Multiplier)
+				}
+				if r.MinLux < 0 || (r.MaxLux != 0 && r.MaxLux <= r.MinLux) {
+					report.errorf("Schedule %s: Invalid lux range %v - %v", name, r.MinLux, r.MaxLux)
+				}
+			}
+		}
+
+		for _, modifier := range lightSchedule.WeatherModifiers {
+			if modifier.CloudCover < 0 || modifier.CloudCover > 100 {
+				report.errorf("Schedule %s: Invalid weather modifier cloud cover %d (must be between 0 and 100)", name, modifier.CloudCover)
+			}
+			if modifier.ColorTemperature < -5500 || modifier.ColorTemperature > 5500 {
+				report.errorf("Schedule %s: Invalid weather modifier color temperature %d (must be between -5500 and 5500)", name, modifier.ColorTemperature)
+			}
+			if modifier.Brightness < -100 || modifier.Brightness > 100 {
+				report.errorf("Schedule %s: Invalid weather modifier brightness %d (must be between -100 and 100)", name, modifier.Brightness)
+			}
+		}
+		if len(lightSchedule.WeatherModifiers) > 0 && configuration.Weather == nil {
+			report.warningf("Schedule %s: Weather modifiers require a weather provider and will be ignored", name)
+		}
+
+		for _, host := range lightSchedule.WLED {
+			if strings.TrimSpace(host) == "" || strings.ContainsAny(host, "/ ") {
+				report.errorf("Schedule %s: Invalid WLED host \"%s\"", name, host)
+			}
+		}
+		for _, host := range lightSchedule.Nanoleaf {
+			if configuration.NanoleafTokens[host] == "" {
+				report.warningf("Schedule %s: Nanoleaf controller %s is not paired and will be ignored. Run kelvin pair -nanoleaf %s", name, host, host)
+			}
+		}
+
+		if _, err := parseTransitionTime(lightSchedule.TransitionTime, lightTransistionTime); err != nil {
+			report.errorf("Schedule %s: Invalid transition time \"%s\": %v", name, lightSchedule.TransitionTime, err)
+		}
+		if _, err := parseUpdateInterval(lightSchedule.UpdateInterval, stateUpdateInterval); err != nil {
+			report.errorf("Schedule %s: Invalid update interval \"%s\": %v", name, lightSchedule.UpdateInterval, err)
+		}
+		if lightSchedule.OnOffThreshold < 0 || lightSchedule.OnOffThreshold > 100 {
+			report.errorf("Schedule %s: Invalid on/off threshold %d (must be between 0 and 100)", name, lightSchedule.OnOffThreshold)
+		}
+
+		if lightSchedule.Mode != "" && !containsString(scheduleModes, lightSchedule.Mode) {
+			report.errorf("Schedule %s: Unknown mode %s (must be one of %v)", name, lightSchedule.Mode, scheduleModes)
+		}
+		elevations := make(map[float64]bool)
+		for _, point := range lightSchedule.ElevationCurve {
+			prefix := fmt.Sprintf("Schedule %s: Elevation %v°", name, point.Elevation)
+			if point.Elevation < -90 || point.Elevation > 90 {
+				report.errorf("%s: Invalid elevation (must be between -90 and 90)", prefix)
+			}
+			if elevations[point.Elevation] {
+				report.errorf("%s: Elevation is defined multiple times", prefix)
+			}
+			elevations[point.Elevation] = true
+			validateLightState(&report, prefix, point.ColorTemperature, point.Brightness)
+		}
+		if len(lightSchedule.ElevationCurve) > 0 && lightSchedule.Mode != scheduleModeElevation {
+			report.warningf("Schedule %s: The elevation curve is only used in mode %s and will be ignored", name, scheduleModeElevation)
+		}
+		if auto := lightSchedule.Auto; auto != nil {
+			if auto.MaxColorTemperature != 0 && (auto.MaxColorTemperature < 1000 || auto.MaxColorTemperature > 6500) {
+				report.errorf("Schedule %s: Invalid maximum color temperature %d of auto mode (must be between 1000 and 6500)", name, auto.MaxColorTemperature)
+			}
+			if auto.EveningColorTemperature != 0 && (auto.EveningColorTemperature < 1000 || auto.EveningColorTemperature > 6500) {
+				report.errorf("Schedule %s: Invalid evening color temperature %d of auto mode (must be between 1000 and 6500)", name, auto.EveningColorTemperature)
+			}
+			if auto.Bedtime != "" {
+				if _, err := parseClockTime(auto.Bedtime); err != nil {
+					report.errorf("Schedule %s: Invalid bedtime of auto mode: %v", name, err)
+				}
+			}
+			if lightSchedule.Mode != scheduleModeAuto {
+				report.warningf("Schedule %s: The auto settings are only used in mode %s and will be ignored", name, scheduleModeAuto)
+			}
+		}
+
+		validateLightState(&report, fmt.Sprintf("Schedule %s: Default", name), lightSchedule.DefaultColorTemperature, lightSchedule.DefaultBrightness)
+		for _, entry := range lightSchedule.BeforeSunrise {
+			validateLightState(&report, fmt.Sprintf("Schedule %s: Entry %s before sunrise", name, entry.Time), entry.ColorTemperature, entry.Brightness)
+			validateGradient(&report, fmt.Sprintf("Schedule %s: Entry %s before sunrise", name, entry.Time), entry.Gradient)
+			validateMoonPhases(&report, fmt.Sprintf("Schedule %s: Entry %s before sunrise", name, entry.Time), entry.MoonPhases)
+		}
+		for _, entry := range lightSchedule.AfterSunset {
+			validateLightState(&report, fmt.Sprintf("Schedule %s: Entry %s after sunset", name, entry.Time), entry.ColorTemperature, entry.Brightness)
+			validateGradient(&report, fmt.Sprintf("Schedule %s: Entry %s after sunset", name, entry.Time), entry.Gradient)
+			validateMoonPhases(&report, fmt.Sprintf("Schedule %s: Entry %s after sunset", name, entry.Time), entry.MoonPhases)
+		}
+
+		reported := make(map[string]bool)
+		for _, date := range validationDates(time.Now().Year()) {
+			validateScheduleForDay(&report, configuration, lightSchedule, date, reported)
+		}
+	}
+
+	return report
+}
+
+// validateSchedules checks the given schedules as if they replaced the
+// configured ones. Every schedule requires a unique name to be editable.
+func (configuration *Configuration) validateSchedules(schedules []LightSchedule) ValidationReport {
+	candidate := *configuration
+	candidate.Schedules = schedules
+	report := candidate.Validate()
+
+	names := make(map[string]bool)
+	for _, lightSchedule := range schedules {
+		if strings.TrimSpace(lightSchedule.Name) == "" {
+			report.errorf("Every schedule requires a name")
+		} else if names[lightSchedule.Name] {
+			report.errorf("Schedule %s is defined multiple times", lightSchedule.Name)
+		}
+		names[lightSchedule.Name] = true
+	}
+	return report
+}
+
+func validLocation(location Location) bool {
+	return location.Latitude >= -90 && location.Latitude <= 90 && location.Longitude >= -180 && location.Longitude <= 180
+}
+
+func validateSunSettings(report *ValidationReport, prefix string, location Location) {
+	if location.Calculator != "" && !containsString(sunCalculators, location.Calculator) {
+		report.errorf("%s: Unknown calculator %s (must be one of %v)", prefix, location.Calculator, sunCalculators)
+	}
+	if location.Refraction && location.Calculator != sunCalculatorNOAA {
+		report.warningf("%s: Refraction is only supported by calculator %s and will be ignored", prefix, sunCalculatorNOAA)
+	}
+	if _, err := parseTwilight(location.Twilight); err != nil {
+		report.errorf("%s: %v", prefix, err)
+	}
+	if location.Elevation < 0 || location.Elevation > maxObserverElevation {
+		report.errorf("%s: Invalid elevation %v (must be between 0 and %d meters)", prefix, location.Elevation, maxObserverElevation)
+	}
+	if location.PolarSunrise == "" && location.PolarSunset == "" {
+		return
+	}
+	sunrise, err := parseClockTime(location.PolarSunrise)
+	if err != nil {
+		report.errorf("%s: Invalid polar sunrise: %v", prefix, err)
+		return
+	}
+	sunset, err := parseClockTime(location.PolarSunset)
+	if err != nil {
+		report.errorf("%s: Invalid polar sunset: %v", prefix, err)
+		return
+	}
+	if sunrise >= sunset {
+		report.errorf("%s: Polar sunrise %s must be before polar sunset %s", prefix, location.PolarSunrise, location.PolarSunset)
+	}
+}
+
+func validateMoonPhases(report *ValidationReport, prefix string, phases []string) {
+	for _, phase := range phases {
+		if !containsString(moonPhases, phase) {
+			report.errorf("%s: Unknown moon phase %s (must be one of %v)", prefix, phase, moonPhases)
+		}
+	}
+}
+
+func validateLightState(report *ValidationReport, prefix string, colorTemperature int, brightness int) {
+	if colorTemperature != -1 && (colorTemperature < 1000 || colorTemperature > 6500) {
+		report.errorf("%s: Invalid color temperature %dK (valid: 1000K - 6500K or -1)", prefix, colorTemperature)
+	}
+	if brightness != -1 && (brightness < 0 || brightness > 100) {
+		report.errorf("%s: Invalid brightness %d%% (valid: 0%% - 100%% or -1)", prefix, brightness)
+	}
+}
+
+func validateGradient(report *ValidationReport, prefix string, gradient []int) {
+	if len(gradient) == 1 {
+		report.warningf("%s: A gradient needs at least two color temperatures", prefix)
+	}
+	for _, colorTemperature := range gradient {
+		if colorTemperature < 1000 || colorTemperature > 6500 {
+			report.errorf("%s: Invalid gradient color temperature %d (must be between 1000 and 6500)", prefix, colorTemperature)
+		}
+	}
+}
+
+func validateScheduleForDay(report *ValidationReport, configuration *Configuration, lightSchedule LightSchedule, date time.Time, reported map[string]bool) {
+	name := lightSchedule.Name
+	day := date.Format("Jan 2")
+
+	// Report every distinct parse error only once
+	yr, mth, dy := date.Date()
+	location := configuration.locationForSchedule(lightSchedule)
+	_, sunset, _ := location.sunTimes(date)
+	_, errs := parseTimestamps(lightSchedule.BeforeSunrise, time.Date(yr, mth, dy, 0, 0, 0, 0, date.Location()))
+	for _, err := range errs {
+		if message := fmt.Sprintf("Schedule %s: Invalid entry before sunrise: %v", name, err); !reported[message] {
+			reported[message] = true
+			report.errorf("%s", message)
+		}
+	}
+	_, errs = parseTimestamps(lightSchedule.AfterSunset, sunset)
+	for _, err := range errs {
+		if message := fmt.Sprintf("Schedule %s: Invalid entry after sunset: %v", name, err); !reported[message] {
+			reported[message] = true
+			report.errorf("%s", message)
+		}
+	}
+
+	schedule := configuration.scheduleForDay(lightSchedule, date)
+	if !schedule.sunrise.Time.Before(schedule.sunset.Time) {
+		report.errorf("Schedule %s: Sunrise (%s) is not before sunset (%s) on %s", name, schedule.sunrise.Time.Format("15:04"), schedule.sunset.Time.Format("15:04"), day)
+		return
+	}
+	for _, timestamp := range schedule.beforeSunrise {
+		if timestamp.Time.After(schedule.sunrise.Time) {
+			report.warningf("Schedule %s: Entry %s before sunrise lays after the sunrise (%s) on %s and will be ignored", name, timestamp.Time.Format("15:04"), schedule.sunrise.Time.Format("15:04"), day)
+		}
+	}
+	for _, timestamp := range schedule.afterSunset {
+		if timestamp.Time.Before(schedule.sunset.Time) {
+			report.warningf("Schedule %s: Entry %s after sunset lays before the sunset (%s) on %s and will be ignored", name, timestamp.Time.Format("15:04"), schedule.sunset.Time.Format("15:04"), day)
+		}
+	}
+}
+
+// validateCommand validates the given configuration file, prints all
+// findings and returns the exit code for the process.
+func validateCommand(configurationFile string) int {
+	var configuration Configuration
+	configuration.ConfigurationFile = configurationFile
+	err := configuration.load()
+	if err != nil {
+		fmt.Printf("Could not read configuration %s: %v\n", configurationFile, err)
+		return 1
+	}
+
+	if !*flagDebug {
+		// Findings are part of the report, skip the regular log output
+		setLogLevel(log.ErrorLevel)
+	}
+	configuration.migrateToLatestVersion()
+
+	report := configuration.Validate()
+	for _, message := range report.Errors {
+		fmt.Printf("ERROR:   %s\n", message)
+	}
+	for _, message := range report.Warnings {
+		fmt.Printf("WARNING: %s\n", message)
+	}
+	fmt.Printf("Configuration %s: %d error(s), %d warning(s)\n", configurationFile, len(report.Errors), len(report.Warnings))
+
+	if !report.Valid() {
+		return 1
+	}
+	return 0
+}
+
+func (report *ValidationReport) validateBrightnessLimit(subject string, limit BrightnessLimit) {
+	if limit.MinBrightness < 0 || limit.MinBrightness > 100 || limit.MaxBrightness < 0 || limit.MaxBrightness > 100 {
+		report.errorf("%s: Invalid brightness limits %d - %d (must be between 0 and 100)", subject, limit.MinBrightness, limit.MaxBrightness)
+	} else if limit.MinBrightness > 0 && limit.MaxBrightness > 0 && limit.MinBrightness > limit.MaxBrightness {
+		report.errorf("%s: Minimum brightness %d exceeds maximum brightness %d", subject, limit.MinBrightness, limit.MaxBrightness)
+	}
+}
@@ -0,0 +1,104 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	c := Configuration{}
+	c.ConfigurationFile = "testdata/config-example.json"
+	err := c.load()
+	if err != nil {
+		t.Fatalf("Could not load configuration: %v", err)
+	}
+	report := c.Validate()
+	if !report.Valid() {
+		t.Errorf("Validate() of %v reported errors: %v", c.ConfigurationFile, report.Errors)
+	}
+
+	c.Schedules[0].DefaultColorTemperature = 9000
+	c.Schedules[0].AfterSunset = append(c.Schedules[0].AfterSunset, TimedColorTemperature{Time: "25:00", ColorTemperature: 2000, Brightness: 60})
+	report = c.Validate()
+	if len(report.Errors) != 2 {
+		t.Errorf("Validate() reported %d errors; want 2 (%v)", len(report.Errors), report.Errors)
+	}
+}
+
+func TestValidateLocation(t *testing.T) {
+	tests := []struct {
+		location  Location
+		locations map[string]Location
+		valid     bool
+		warning   bool
+	}{
+		{Location{Latitude: 53.5, Longitude: 10.0}, nil, true, false},
+		{Location{}, nil, true, true},
+		{Location{Latitude: 0, Longitude: 32.6}, nil, true, false},  // Kampala
+		{Location{Latitude: 51.48, Longitude: 0}, nil, true, false}, // Greenwich
+		{Location{Latitude: 0, Longitude: 200}, nil, false, false},  // out of range
+		{Location{Latitude: 91, Longitude: 0}, nil, false, false},   // out of range
+		{Location{Latitude: 53.5, Longitude: 10.0}, map[string]Location{"office": {Latitude: 51.48, Longitude: 0}}, true, false},
+		{Location{Latitude: 53.5, Longitude: 10.0}, map[string]Location{"office": {}}, false, false},
+	}
+	for _, test := range tests {
+		c := Configuration{Location: test.location, Locations: test.locations}
+		report := c.Validate()
+		var errors []string
+		for _, message := range report.Errors {
+			if strings.Contains(message, "location") {
+				errors = append(errors, message)
+			}
+		}
+		warning := false
+		for _, message := range report.Warnings {
+			warning = warning || strings.Contains(message, "No location configured")
+		}
+		if (len(errors) == 0) != test.valid || warning != test.warning {
+			t.Errorf("Unexpected validation of %+v %v: %v (warning %v)", test.location, test.locations, errors, warning)
+		}
+	}
+}
+
+func TestValidateSchedules(t *testing.T) {
+	c := Configuration{Location: Location{Latitude: 53.5, Longitude: 10.0}}
+	valid := LightSchedule{Name: "home", AssociatedDeviceIDs: []int{1}, DefaultColorTemperature: 5000, DefaultBrightness: 100}
+	if report := c.validateSchedules([]LightSchedule{valid}); !report.Valid() {
+		t.Errorf("Schedule should be valid, got %v", report.Errors)
+	}
+
+	invalid := valid
+	invalid.AfterSunset = []TimedColorTemperature{{Time: "25:00", ColorTemperature: 2000, Brightness: 60}}
+	if report := c.validateSchedules([]LightSchedule{invalid}); report.Valid() {
+		t.Errorf("Schedule with an invalid entry should be rejected")
+	}
+	if report := c.validateSchedules([]LightSchedule{valid, valid}); report.Valid() {
+		t.Errorf("Schedules with the same name should be rejected")
+	}
+	unnamed := valid
+	unnamed.Name = ""
+	if report := c.validateSchedules([]LightSchedule{unnamed}); report.Valid() {
+		t.Errorf("Schedule without a name should be rejected")
+	}
+}
@@ -0,0 +1,159 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const checksumsAssetName = "checksums.txt"
+const signatureSuffix = ".minisig"
+const maxAssetSize = 1024 * 1024
+
+// minisignPublicKey is a decoded minisign public key.
+type minisignPublicKey struct {
+	id  []byte
+	key ed25519.PublicKey
+}
+
+// parseMinisignPublicKey decodes a public key like it is printed by
+// minisign. The comment line of the key file is optional.
+func parseMinisignPublicKey(value string) (minisignPublicKey, error) {
+	lines := strings.Split(strings.TrimSpace(value), "\n")
+	data, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[len(lines)-1]))
+	if err != nil || len(data) != 2+8+ed25519.PublicKeySize || string(data[:2]) != "Ed" {
+		return minisignPublicKey{}, fmt.Errorf("Invalid minisign public key %s", value)
+	}
+	return minisignPublicKey{data[2:10], ed25519.PublicKey(data[10:])}, nil
+}
+
+// verifyMinisign checks the given minisign signature of the message. Only
+// signatures of minisign's legacy mode (-l) are supported, prehashed ones
+// would require BLAKE2b.
+func verifyMinisign(publicKey string, message []byte, signature []byte) error {
+	key, err := parseMinisignPublicKey(publicKey)
+	if err != nil {
+		return err
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(signature)), "\n")
+	if len(lines) != 4 || !strings.HasPrefix(lines[2], "trusted comment: ") {
+		return fmt.Errorf("Invalid minisign signature")
+	}
+	signatureData, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[1]))
+	if err != nil || len(signatureData) != 2+8+ed25519.SignatureSize {
+		return fmt.Errorf("Invalid minisign signature")
+	}
+	if string(signatureData[:2]) != "Ed" {
+		return fmt.Errorf("Unsupported minisign signature algorithm %q. Please sign with minisign -l", signatureData[:2])
+	}
+	if !bytes.Equal(signatureData[2:10], key.id) {
+		return fmt.Errorf("Signature was created with another key")
+	}
+	if !ed25519.Verify(key.key, message, signatureData[10:]) {
+		return fmt.Errorf("Invalid signature")
+	}
+
+	// The global signature covers the trusted comment
+	trustedComment := strings.TrimPrefix(strings.TrimRight(lines[2], "\r"), "trusted comment: ")
+	globalSignature, err := base64.StdEncoding.DecodeString(strings.TrimSpace(lines[3]))
+	if err != nil || !ed25519.Verify(key.key, append(signatureData[10:], trustedComment...), globalSignature) {
+		return fmt.Errorf("Invalid signature of the trusted comment")
+	}
+	return nil
+}
+
+// checksumFor returns the SHA256 checksum of the given file from a
+// checksum file in the format of sha256sum.
+func checksumFor(checksums []byte, name string) (string, error) {
+	for _, line := range strings.Split(string(checksums), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("No checksum published for %s", name)
+}
+
+func fileChecksum(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// verifyArchive compares the downloaded archive with the checksum
+// published with the release. With a public key the checksums have to be
+// signed by it, otherwise they only protect against corrupted downloads.
+func verifyArchive(release *releaseInfo, archive string, name string, publicKey string) error {
+	checksumsURL, found := release.asset(checksumsAssetName)
+	if !found {
+		return fmt.Errorf("Release %s doesn't publish %s. Refusing to install an unverified binary", release.TagName, checksumsAssetName)
+	}
+	checksums, err := downloadAsset(checksumsURL)
+	if err != nil {
+		return err
+	}
+
+	if publicKey != "" {
+		signatureURL, found := release.asset(checksumsAssetName + signatureSuffix)
+		if !found {
+			return fmt.Errorf("Release %s isn't signed. Refusing to install an unverified binary", release.TagName)
+		}
+		signature, err := downloadAsset(signatureURL)
+		if err != nil {
+			return err
+		}
+		err = verifyMinisign(publicKey, checksums, signature)
+		if err != nil {
+			return fmt.Errorf("Could not verify signature of release %s: %v", release.TagName, err)
+		}
+	}
+
+	expected, err := checksumFor(checksums, name)
+	if err != nil {
+		return err
+	}
+	actual, err := fileChecksum(archive)
+	if err != nil {
+		return err
+	}
+	if !strings.EqualFold(expected, actual) {
+		return fmt.Errorf("Checksum of %s doesn't match (expected %s, got %s)", name, expected, actual)
+	}
+	return nil
+}
@@ -0,0 +1,93 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestReleaseVerification(t *testing.T) {
+	publicKey, privateKey, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := []byte("kelvin42")
+	key := base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), id...), publicKey...))
+	sign := func(message []byte, comment string) []byte {
+		signature := ed25519.Sign(privateKey, message)
+		global := ed25519.Sign(privateKey, append(append([]byte{}, signature...), comment...))
+		return []byte("untrusted comment: signature\n" +
+			base64.StdEncoding.EncodeToString(append(append([]byte("Ed"), id...), signature...)) + "\n" +
+			"trusted comment: " + comment + "\n" +
+			base64.StdEncoding.EncodeToString(global) + "\n")
+	}
+
+	archive := filepath.Join(t.TempDir(), "kelvin.tar.gz")
+	ioutil.WriteFile(archive, []byte("binary"), 0644)
+	sum, _ := fileChecksum(archive)
+	checksums := []byte(sum + "  kelvin-linux-amd64.tar.gz\n")
+	signature := sign(checksums, "timestamp:1")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/checksums.txt":
+			w.Write(checksums)
+		case "/checksums.txt.minisig":
+			w.Write(signature)
+		}
+	}))
+	defer server.Close()
+	release := &releaseInfo{TagName: "v1.5.0", Assets: []map[string]interface{}{
+		{"name": "checksums.txt", "browser_download_url": server.URL + "/checksums.txt"},
+		{"name": "checksums.txt.minisig", "browser_download_url": server.URL + "/checksums.txt.minisig"},
+	}}
+
+	if err := verifyArchive(release, archive, "kelvin-linux-amd64.tar.gz", key); err != nil {
+		t.Errorf("Expected valid release: %v", err)
+	}
+	if err := verifyArchive(release, archive, "kelvin-linux-arm.tar.gz", ""); err == nil {
+		t.Errorf("Archives without checksum must be rejected")
+	}
+	ioutil.WriteFile(archive, []byte("tampered"), 0644)
+	if err := verifyArchive(release, archive, "kelvin-linux-amd64.tar.gz", ""); err == nil || !strings.Contains(err.Error(), "doesn't match") {
+		t.Errorf("Modified archives must be rejected: %v", err)
+	}
+
+	if err := verifyMinisign(key, []byte("other checksums"), signature); err == nil {
+		t.Errorf("Signature of other content must be rejected")
+	}
+	forged := bytes.Replace(signature, []byte("timestamp:1"), []byte("timestamp:2"), 1)
+	if err := verifyMinisign(key, checksums, forged); err == nil {
+		t.Errorf("Modified trusted comments must be rejected")
+	}
+	if err := verifyArchive(&releaseInfo{TagName: "v1.5.1"}, archive, "kelvin-linux-amd64.tar.gz", ""); err == nil {
+		t.Errorf("Releases without checksums must be rejected")
+	}
+}
@@ -0,0 +1,237 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const wakeupUpdateInterval = 10 * time.Second
+const defaultWakeupDuration = 20 * time.Minute
+const defaultWakeupColorTemperature = 5000
+const defaultWakeupBrightness = 100
+
+// Every wake-up starts with a warm light at the lowest brightness.
+const wakeupStartColorTemperature = 2000
+const wakeupStartBrightness = 1
+
+// Wakeup turns the given lights on at the configured time and raises the
+// brightness and color temperature over the duration of the ramp.
+type Wakeup struct {
+	Name             string   `json:"name,omitempty"`
+	Days             []string `json:"days,omitempty"`
+	Time             string   `json:"time"`
+	Duration         string   `json:"duration,omitempty"`
+	Lights           []string `json:"lights"`
+	Bridge           string   `json:"bridge,omitempty"`
+	ColorTemperature int      `json:"colorTemperature,omitempty"`
+	Brightness       int      `json:"brightness,omitempty"`
+}
+
+// wakeupProgress tracks the wake-up ramp of a single light.
+type wakeupProgress struct {
+	start     time.Time
+	seenOn    bool
+	cancelled bool
+	failed    bool
+}
+
+// wakeupRamp is the parsed version of a configured Wakeup.
+type wakeupRamp struct {
+	name     string
+	days     map[time.Weekday]bool
+	time     time.Duration
+	duration time.Duration
+	target   LightState
+}
+
+// parseWeekday accepts abbreviated and full names of weekdays.
+func parseWeekday(value string) (time.Weekday, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if len(value) >= 3 && strings.HasPrefix(strings.ToLower(day.String()), value) {
+			return day, nil
+		}
+	}
+	return 0, fmt.Errorf("Invalid weekday %q", value)
+}
+
+// parseWeekdays parses single days and ranges like mon-fri. Empty lists
+// include every day of the week.
+func parseWeekdays(values []string) (map[time.Weekday]bool, error) {
+	days := make(map[time.Weekday]bool)
+	if len(values) == 0 {
+		for day := time.Sunday; day <= time.Saturday; day++ {
+			days[day] = true
+		}
+		return days, nil
+	}
+	for _, value := range values {
+		bounds := strings.SplitN(value, "-", 2)
+		first, err := parseWeekday(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			last, err = parseWeekday(bounds[1])
+			if err != nil {
+				return nil, err
+			}
+		}
+		for day := first; ; day = (day + 1) % 7 {
+			days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+func (wakeup *Wakeup) parse() (*wakeupRamp, error) {
+	days, err := parseWeekdays(wakeup.Days)
+	if err != nil {
+		return nil, err
+	}
+	start, err := parseClockTime(wakeup.Time)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := parsePositiveDuration(wakeup.Duration, defaultWakeupDuration)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid duration %q: %v", wakeup.Duration, err)
+	}
+	if duration > 24*time.Hour {
+		return nil, fmt.Errorf("Duration %v exceeds one day", duration)
+	}
+	if len(wakeup.Lights) == 0 {
+		return nil, fmt.Errorf("No lights configured")
+	}
+	target := LightState{wakeup.ColorTemperature, wakeup.Brightness}
+	if target.ColorTemperature == 0 {
+		target.ColorTemperature = defaultWakeupColorTemperature
+	}
+	if target.Brightness == 0 {
+		target.Brightness = defaultWakeupBrightness
+	}
+	name := wakeup.Name
+	if name == "" {
+		name = wakeup.Time
+	}
+	return &wakeupRamp{name, days, start, duration, target}, nil
+}
+
+// activeSince returns the start of the ramp which is in progress at the
+// given time. Ramps may span midnight.
+func (ramp *wakeupRamp) activeSince(now time.Time) (time.Time, bool) {
+	for _, offset := range []int{0, -1} {
+		start := atClockTime(now, offset, ramp.time)
+		if ramp.days[start.Weekday()] && !now.Before(start) && now.Before(start.Add(ramp.duration)) {
+			return start, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// stateAt interpolates the light state of the ramp at the given time.
+func (ramp *wakeupRamp) stateAt(start time.Time, now time.Time) LightState {
+	progress := float64(now.Sub(start)) / float64(ramp.duration)
+	if progress > 1 {
+		progress = 1
+	}
+	return LightState{
+		wakeupStartColorTemperature + int(progress*float64(ramp.target.ColorTemperature-wakeupStartColorTemperature)),
+		wakeupStartBrightness + int(progress*float64(ramp.target.Brightness-wakeupStartBrightness)),
+	}
+}
+
+// updateWakeups advances all wake-up ramps in progress. Lights which are
+// turned off or changed during the ramp are left alone.
+func updateWakeups(lights []*Light, wakeups []Wakeup, now time.Time) {
+	active := make(map[*Light]bool)
+	for _, wakeup := range wakeups {
+		ramp, err := wakeup.parse()
+		if err != nil {
+			log.Debugf("🤖 Ignoring invalid wake-up %s: %v", wakeup.Time, err)
+			continue
+		}
+		start, running := ramp.activeSince(now)
+		if !running {
+			continue
+		}
+		for _, light := range lights {
+			if light.Bridge != wakeup.Bridge || !containsName(wakeup.Lights, light.Name) || active[light] {
+				continue
+			}
+			active[light] = true
+			light.advanceWakeup(ramp, start, now)
+		}
+	}
+
+	// Hand lights back to their schedule once the ramp has ended
+	for _, light := range lights {
+		if light.wakeup != nil && !active[light] {
+			if !light.wakeup.cancelled {
+				scheduleLog.Printf("💡 Light %s - Wake-up finished. Resuming schedule...", light.Name)
+				light.endOverride(now)
+			}
+			light.wakeup = nil
+		}
+	}
+}
+
+func (light *Light) advanceWakeup(ramp *wakeupRamp, start time.Time, now time.Time) {
+	if light.wakeup == nil || !light.wakeup.start.Equal(start) {
+		scheduleLog.Printf("💡 Light %s - Starting wake-up %s...", light.Name, ramp.name)
+		light.wakeup = &wakeupProgress{start: start}
+	}
+	progress := light.wakeup
+	if progress.cancelled {
+		return
+	}
+	if progress.seenOn && (!light.On || light.HueLight.hasChanged()) {
+		scheduleLog.Printf("💡 Light %s - Light was changed during the wake-up. Leaving it alone...", light.Name)
+		progress.cancelled = true
+		return
+	}
+	if light.On {
+		progress.seenOn = true
+	}
+
+	state := ramp.stateAt(start, now.Add(wakeupUpdateInterval))
+	light.override(Override{Until: start.Add(ramp.duration), Reason: overrideReasonWakeup})
+	err := light.HueLight.turnOn(state, wakeupUpdateInterval)
+	if err != nil {
+		// Lights switched off at the wall stay unreachable, report it once only
+		if !progress.failed {
+			scheduleLog.Warningf("💡 Light %s - Could not update the wake-up: %v", light.Name, err)
+			progress.failed = true
+		}
+		return
+	}
+	scheduleLog.Debugf("💡 Light %s - Wake-up at %vK and %v%% brightness", light.Name, state.ColorTemperature, state.Brightness)
+}
@@ -0,0 +1,103 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWakeup(t *testing.T) {
+	days, err := parseWeekdays([]string{"mon-wed", "Saturday"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(days) != 4 || !days[time.Monday] || !days[time.Wednesday] || !days[time.Saturday] || days[time.Sunday] {
+		t.Errorf("Unexpected weekdays: %v", days)
+	}
+	if days, _ := parseWeekdays([]string{"fri-mon"}); len(days) != 4 || !days[time.Sunday] {
+		t.Errorf("Ranges should wrap around the end of the week: %v", days)
+	}
+	for _, invalid := range [][]string{{"mo"}, {"holiday"}, {"mon-xyz"}} {
+		if _, err := parseWeekdays(invalid); err == nil {
+			t.Errorf("Weekdays %v should be invalid", invalid)
+		}
+	}
+	if _, err := (&Wakeup{Time: "06:45"}).parse(); err == nil {
+		t.Errorf("Wake-up without lights should be invalid")
+	}
+
+	wakeup := Wakeup{Days: []string{"fri"}, Time: "06:45", Duration: "20m", Lights: []string{"bedroom"}}
+	ramp, err := wakeup.parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	friday := time.Date(2024, 3, 1, 6, 45, 0, 0, time.UTC)
+	if _, active := ramp.activeSince(friday.Add(-time.Minute)); active {
+		t.Errorf("Wake-up should not be active before its start")
+	}
+	if start, active := ramp.activeSince(friday.Add(10 * time.Minute)); !active || !start.Equal(friday) {
+		t.Errorf("Wake-up should be active since %v, got %v (%v)", friday, start, active)
+	}
+	if _, active := ramp.activeSince(friday.Add(24 * time.Hour)); active {
+		t.Errorf("Wake-up should not be active on saturday")
+	}
+	if state := ramp.stateAt(friday, friday.Add(10*time.Minute)); state != (LightState{3500, 50}) {
+		t.Errorf("Unexpected state in the middle of the ramp: %+v", state)
+	}
+	late, _ := (&Wakeup{Time: "23:50", Lights: []string{"bedroom"}}).parse()
+	if start, active := late.activeSince(friday.Add(-6*time.Hour - 40*time.Minute)); !active || start.Day() != 29 {
+		t.Errorf("Wake-up should span midnight, got %v (%v)", start, active)
+	}
+
+	var requests []hueStateRequest
+	bridge := recordingBridge(t, &requests, `[{"success":{"/lights/3/state/on":true}}]`)
+	bedroom := &Light{Name: "Bedroom", Scheduled: true, HueLight: HueLight{SupportsColorTemperature: true, Dimmable: true, MinimumColorTemperature: 2000, MaximumColorTemperature: 6500, bridge: bridge}}
+	bedroom.HueLight.HueLight.Id = "3"
+	kitchen := &Light{Name: "Kitchen", HueLight: HueLight{bridge: bridge}}
+	lights := []*Light{bedroom, kitchen}
+	wakeups := []Wakeup{wakeup}
+
+	now := time.Date(2024, 3, 1, 6, 45, 0, 0, time.Local)
+	updateWakeups(lights, wakeups, now)
+	if len(requests) != 1 || !requests[0].On || requests[0].Brightness < 1 {
+		t.Fatalf("Wake-up should turn the light on, got %+v", requests)
+	}
+	if !bedroom.overridden(now) || bedroom.activeOverride.Reason != overrideReasonWakeup {
+		t.Errorf("Light should not follow its schedule during the wake-up: %+v", bedroom.activeOverride)
+	}
+
+	// The light turns on and is dimmed by hand
+	bedroom.On = true
+	updateWakeups(lights, wakeups, now.Add(wakeupUpdateInterval))
+	bedroom.HueLight.CurrentBrightness = 250
+	bedroom.HueLight.CurrentColorMode = "ct"
+	updateWakeups(lights, wakeups, now.Add(2*wakeupUpdateInterval))
+	if len(requests) != 2 || !bedroom.wakeup.cancelled {
+		t.Errorf("Wake-up should stop once the light was changed, got %d requests", len(requests))
+	}
+
+	updateWakeups(lights, wakeups, now.Add(time.Hour))
+	if bedroom.wakeup != nil {
+		t.Errorf("Wake-up should end after its duration")
+	}
+}
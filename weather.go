@@ -0,0 +1,256 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const weatherTimeout = 10 * time.Second
+const defaultWeatherUpdateInterval = 30 * time.Minute
+const minimumWeatherUpdateInterval = 10 * time.Minute
+
+// Supported weather providers
+const (
+	weatherProviderMetNo          = "metno"
+	weatherProviderOpenWeatherMap = "openweathermap"
+)
+
+var weatherProviders = []string{weatherProviderMetNo, weatherProviderOpenWeatherMap}
+
+var metNoURL = "https://api.met.no/weatherapi/locationforecast/2.0/compact"
+var openWeatherMapURL = "https://api.openweathermap.org/data/2.5/weather"
+
+var weatherClient = &http.Client{Timeout: weatherTimeout, Transport: internetTransport}
+
+// Weather configures the provider of the current cloud cover at the
+// configured location. Met.no doesn't require an API key.
+type Weather struct {
+	Provider       string `json:"provider,omitempty"`
+	APIKey         string `json:"apiKey,omitempty"`
+	UpdateInterval string `json:"updateInterval,omitempty"`
+}
+
+// WeatherModifier adjusts the light state of a schedule during daylight
+// while the cloud cover exceeds the given percentage, e.g. to brighten
+// the lights on dark and stormy days.
+type WeatherModifier struct {
+	CloudCover       int `json:"cloudCover"`
+	ColorTemperature int `json:"colorTemperature,omitempty"`
+	Brightness       int `json:"brightness,omitempty"`
+}
+
+// weatherReport is the last known weather at the configured location.
+type weatherReport struct {
+	lock       sync.Mutex
+	cloudCover int
+	updated    time.Time
+	maxAge     time.Duration
+}
+
+var currentWeather = &weatherReport{}
+
+func (weather *Weather) provider() string {
+	if weather.Provider == "" {
+		return weatherProviderMetNo
+	}
+	return weather.Provider
+}
+
+func (weather *Weather) updateInterval() (time.Duration, error) {
+	interval, err := parsePositiveDuration(weather.UpdateInterval, defaultWeatherUpdateInterval)
+	if err != nil {
+		return 0, err
+	}
+	if interval < minimumWeatherUpdateInterval {
+		return 0, fmt.Errorf("Update interval %v is shorter than %v", interval, minimumWeatherUpdateInterval)
+	}
+	return interval, nil
+}
+
+// update stores the given cloud cover. Reports older than three update
+// intervals are ignored.
+func (report *weatherReport) update(cloudCover int, now time.Time, interval time.Duration) {
+	report.lock.Lock()
+	defer report.lock.Unlock()
+	report.cloudCover = cloudCover
+	report.updated = now
+	report.maxAge = 3 * interval
+}
+
+// currentCloudCover returns the cloud cover in percent if it is known.
+func (report *weatherReport) currentCloudCover(now time.Time) (int, bool) {
+	report.lock.Lock()
+	defer report.lock.Unlock()
+	if report.updated.IsZero() || now.Sub(report.updated) > report.maxAge {
+		return 0, false
+	}
+	return report.cloudCover, true
+}
+
+type metNoResponse struct {
+	Properties struct {
+		Timeseries []struct {
+			Data struct {
+				Instant struct {
+					Details struct {
+						CloudAreaFraction float64 `json:"cloud_area_fraction"`
+					} `json:"details"`
+				} `json:"instant"`
+			} `json:"data"`
+		} `json:"timeseries"`
+	} `json:"properties"`
+}
+
+type openWeatherMapResponse struct {
+	Clouds struct {
+		All int `json:"all"`
+	} `json:"clouds"`
+}
+
+// cloudCover requests the current cloud cover in percent at the given
+// location.
+func (weather *Weather) cloudCover(location Location) (int, error) {
+	var url string
+	switch weather.provider() {
+	case weatherProviderMetNo:
+		url = fmt.Sprintf("%s?lat=%.4f&lon=%.4f", metNoURL, location.Latitude, location.Longitude)
+	case weatherProviderOpenWeatherMap:
+		url = fmt.Sprintf("%s?lat=%.4f&lon=%.4f&appid=%s", openWeatherMapURL, location.Latitude, location.Longitude, weather.APIKey)
+	default:
+		return 0, fmt.Errorf("Unknown weather provider %s", weather.Provider)
+	}
+
+	request, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return 0, err
+	}
+	// Met.no requires an identifying user agent
+	request.Header.Set("User-Agent", "kelvin/"+version+" github.com/stefanwichmann/kelvin")
+	response, err := weatherClient.Do(request)
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("Weather provider returned HTTP %d", response.StatusCode)
+	}
+
+	if weather.provider() == weatherProviderOpenWeatherMap {
+		var result openWeatherMapResponse
+		err = json.NewDecoder(response.Body).Decode(&result)
+		return result.Clouds.All, err
+	}
+	var result metNoResponse
+	err = json.NewDecoder(response.Body).Decode(&result)
+	if err != nil {
+		return 0, err
+	}
+	if len(result.Properties.Timeseries) == 0 {
+		return 0, fmt.Errorf("Weather provider didn't report the current weather")
+	}
+	return int(result.Properties.Timeseries[0].Data.Instant.Details.CloudAreaFraction + 0.5), nil
+}
+
+// startWeatherUpdates requests the weather in the background. Schedules
+// pick up changes with their next update.
+func startWeatherUpdates(weather *Weather, location Location) {
+	if weather == nil {
+		return
+	}
+	if location == (Location{}) {
+		log.Warningf("🌍 Weather requires a configured location. Ignoring weather...")
+		return
+	}
+	interval, err := weather.updateInterval()
+	if err != nil {
+		configLog.Warningf("⚙ Invalid weather update interval %q. Using %v...", weather.UpdateInterval, defaultWeatherUpdateInterval)
+		interval = defaultWeatherUpdateInterval
+	}
+	go supervise("weather updates", func() {
+		for {
+			cloudCover, err := weather.cloudCover(location)
+			if err != nil {
+				log.Warningf("🌍 Could not update the weather: %v", err)
+			} else {
+				log.Debugf("🌍 Current cloud cover is %d%%", cloudCover)
+				currentWeather.update(cloudCover, time.Now(), interval)
+			}
+			time.Sleep(interval)
+		}
+	})
+}
+
+// weatherModifier returns the modifier with the highest threshold below
+// the given cloud cover.
+func weatherModifier(modifiers []WeatherModifier, cloudCover int) (WeatherModifier, bool) {
+	var selected WeatherModifier
+	found := false
+	for _, modifier := range modifiers {
+		if cloudCover > modifier.CloudCover && (!found || modifier.CloudCover > selected.CloudCover) {
+			selected = modifier
+			found = true
+		}
+	}
+	return selected, found
+}
+
+// weatherState adjusts the given light state to the current weather.
+// Modifiers only apply between sunrise and sunset.
+func (light *Light) weatherState(state LightState, now time.Time) LightState {
+	modifiers := light.Schedule.weatherModifiers
+	if len(modifiers) == 0 || now.Before(light.Schedule.sunrise.Time) || !now.Before(light.Schedule.sunset.Time) {
+		return state
+	}
+	cloudCover, known := currentWeather.currentCloudCover(now)
+	if !known {
+		return state
+	}
+	modifier, found := weatherModifier(modifiers, cloudCover)
+	if !found {
+		return state
+	}
+
+	if state.ColorTemperature != -1 {
+		state.ColorTemperature += modifier.ColorTemperature
+		if state.ColorTemperature < 1000 {
+			state.ColorTemperature = 1000
+		} else if state.ColorTemperature > 6500 {
+			state.ColorTemperature = 6500
+		}
+	}
+	if state.Brightness > 0 {
+		state.Brightness += modifier.Brightness
+		if state.Brightness < 1 {
+			state.Brightness = 1
+		} else if state.Brightness > 100 {
+			state.Brightness = 100
+		}
+	}
+	return state
+}
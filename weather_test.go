@@ -0,0 +1,92 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWeather(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("lat") != "52.5200" || r.Header.Get("User-Agent") == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if r.URL.Path == "/owm" {
+			w.Write([]byte(`{"clouds": {"all": 40}}`))
+			return
+		}
+		w.Write([]byte(`{"properties": {"timeseries": [{"data": {"instant": {"details": {"cloud_area_fraction": 87.6}}}}]}}`))
+	}))
+	defer server.Close()
+	defer func(metNo string, owm string) { metNoURL, openWeatherMapURL = metNo, owm }(metNoURL, openWeatherMapURL)
+	metNoURL, openWeatherMapURL = server.URL+"/metno", server.URL+"/owm"
+
+	location := Location{Latitude: 52.52, Longitude: 13.405}
+	if cover, err := (&Weather{}).cloudCover(location); err != nil || cover != 88 {
+		t.Errorf("Unexpected cloud cover from Met.no: %d (%v)", cover, err)
+	}
+	if cover, err := (&Weather{Provider: weatherProviderOpenWeatherMap, APIKey: "key"}).cloudCover(location); err != nil || cover != 40 {
+		t.Errorf("Unexpected cloud cover from OpenWeatherMap: %d (%v)", cover, err)
+	}
+	if _, err := (&Weather{UpdateInterval: "1m"}).updateInterval(); err == nil {
+		t.Errorf("Short update intervals should be rejected")
+	}
+
+	modifiers := []WeatherModifier{{CloudCover: 50, Brightness: 5}, {CloudCover: 80, ColorTemperature: 300, Brightness: 10}}
+	if modifier, found := weatherModifier(modifiers, 85); !found || modifier.CloudCover != 80 {
+		t.Errorf("Modifier with the highest exceeded cloud cover should be used, got %+v", modifier)
+	}
+	if _, found := weatherModifier(modifiers, 50); found {
+		t.Errorf("Cloud cover must exceed the threshold")
+	}
+
+	defer func(previous *weatherReport) { currentWeather = previous }(currentWeather)
+	currentWeather = &weatherReport{}
+	now := time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+	light := &Light{Name: "Office"}
+	light.Schedule.weatherModifiers = modifiers
+	light.Schedule.sunrise.Time = now.Add(-4 * time.Hour)
+	light.Schedule.sunset.Time = now.Add(4 * time.Hour)
+	if state := light.weatherState(LightState{5000, 70}, now); state != (LightState{5000, 70}) {
+		t.Errorf("Unknown weather should not change the light state: %+v", state)
+	}
+	currentWeather.update(95, now, time.Hour)
+	if state := light.weatherState(LightState{6400, 95}, now); state != (LightState{6500, 100}) {
+		t.Errorf("Modifier should be applied and clamped: %+v", state)
+	}
+	if state := light.weatherState(LightState{2000, 40}, now.Add(5*time.Hour)); state != (LightState{2000, 40}) {
+		t.Errorf("Modifiers should not apply after sunset: %+v", state)
+	}
+	currentWeather.update(95, now.Add(-4*time.Hour), time.Hour)
+	if state := light.weatherState(LightState{5000, 70}, now); state != (LightState{5000, 70}) {
+		t.Errorf("Outdated weather should be ignored: %+v", state)
+	}
+
+	c := Configuration{Weather: &Weather{Provider: weatherProviderOpenWeatherMap, APIKey: "owm-secret"}}
+	if export := c.redacted(); export.Weather.APIKey != redactedValue || c.Weather.APIKey != "owm-secret" {
+		t.Errorf("API key should be redacted in exports")
+	}
+}
@@ -0,0 +1,156 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"crypto/subtle"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const maximumFailedLogins = 5
+const loginLockoutDuration = 5 * time.Minute
+
+// authenticator protects the web interface with a token or basic
+// authentication. Clients are locked out after repeated failures.
+type authenticator struct {
+	token    string
+	username string
+	password string
+	failures map[string]*loginFailures
+	lock     sync.Mutex
+}
+
+type loginFailures struct {
+	count       int
+	lockedUntil time.Time
+}
+
+func newAuthenticator(webInterface WebInterface) *authenticator {
+	return &authenticator{token: webInterface.Token, username: webInterface.Username, password: webInterface.Password, failures: make(map[string]*loginFailures)}
+}
+
+func (auth *authenticator) enabled() bool {
+	return auth.token != "" || auth.password != ""
+}
+
+func secureCompare(given string, expected string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
+
+// authorized checks the credentials of the given request. The token is
+// accepted as bearer token or as password of any user, so browsers can
+// use their login dialog.
+func (auth *authenticator) authorized(r *http.Request) bool {
+	if header := r.Header.Get("Authorization"); auth.token != "" && strings.HasPrefix(header, "Bearer ") {
+		return secureCompare(strings.TrimPrefix(header, "Bearer "), auth.token)
+	}
+	username, password, ok := r.BasicAuth()
+	if !ok {
+		return false
+	}
+	if auth.token != "" && secureCompare(password, auth.token) {
+		return true
+	}
+	if auth.password == "" {
+		return false
+	}
+	// Compare both values to not reveal which one was wrong
+	validUsername := secureCompare(username, auth.username)
+	validPassword := secureCompare(password, auth.password)
+	return validUsername && validPassword
+}
+
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func (auth *authenticator) lockedOut(client string, now time.Time) bool {
+	auth.lock.Lock()
+	defer auth.lock.Unlock()
+	failures, found := auth.failures[client]
+	return found && now.Before(failures.lockedUntil)
+}
+
+// recordFailure counts a failed login and returns true if the client is
+// locked out now.
+func (auth *authenticator) recordFailure(client string, now time.Time) bool {
+	auth.lock.Lock()
+	defer auth.lock.Unlock()
+	failures, found := auth.failures[client]
+	if !found {
+		failures = &loginFailures{}
+		auth.failures[client] = failures
+	}
+	failures.count++
+	if failures.count < maximumFailedLogins {
+		return false
+	}
+	failures.count = 0
+	failures.lockedUntil = now.Add(loginLockoutDuration)
+	return true
+}
+
+func (auth *authenticator) recordSuccess(client string) {
+	auth.lock.Lock()
+	defer auth.lock.Unlock()
+	delete(auth.failures, client)
+}
+
+// handler returns the given handler protected by the authenticator.
+func (auth *authenticator) handler(next http.Handler) http.Handler {
+	if !auth.enabled() {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Monitoring tools must be able to check the health without credentials
+		if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		client := clientAddress(r)
+		now := time.Now()
+		if auth.lockedOut(client, now) {
+			http.Error(w, "Too many failed login attempts", http.StatusTooManyRequests)
+			return
+		}
+		if !auth.authorized(r) {
+			if _, _, ok := r.BasicAuth(); ok || r.Header.Get("Authorization") != "" {
+				if auth.recordFailure(client, now) {
+					webLog.Warningf("Locking out %s for %v after %d failed login attempts", client, loginLockoutDuration, maximumFailedLogins)
+				}
+			}
+			w.Header().Set("WWW-Authenticate", `Basic realm="Kelvin", charset="UTF-8"`)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		auth.recordSuccess(client)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,68 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestWebInterfaceAuthentication(t *testing.T) {
+	auth := newAuthenticator(WebInterface{Token: "secret", Username: "admin", Password: "kelvin"})
+	handler := auth.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("success"))
+	}))
+	status := func(configure func(r *http.Request)) int {
+		request := httptest.NewRequest("GET", "/api/schedules", nil)
+		request.RemoteAddr = "192.168.1.10:5000"
+		configure(request)
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		return recorder.Code
+	}
+
+	if code := status(func(r *http.Request) {}); code != http.StatusUnauthorized {
+		t.Errorf("Request without credentials should be rejected, got %d", code)
+	}
+	if code := status(func(r *http.Request) { r.Header.Set("Authorization", "Bearer secret") }); code != http.StatusOK {
+		t.Errorf("Request with token should be accepted, got %d", code)
+	}
+	if code := status(func(r *http.Request) { r.SetBasicAuth("anyone", "secret") }); code != http.StatusOK {
+		t.Errorf("Token should be accepted as password, got %d", code)
+	}
+	if code := status(func(r *http.Request) { r.SetBasicAuth("admin", "kelvin") }); code != http.StatusOK {
+		t.Errorf("Request with basic authentication should be accepted, got %d", code)
+	}
+
+	for i := 0; i < maximumFailedLogins; i++ {
+		status(func(r *http.Request) { r.SetBasicAuth("admin", "wrong") })
+	}
+	if code := status(func(r *http.Request) { r.SetBasicAuth("admin", "kelvin") }); code != http.StatusTooManyRequests {
+		t.Errorf("Client should be locked out after %d failures, got %d", maximumFailedLogins, code)
+	}
+
+	open := newAuthenticator(WebInterface{Enabled: true, Port: 8080})
+	if open.enabled() {
+		t.Errorf("Authentication should be disabled without credentials")
+	}
+}
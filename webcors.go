@@ -0,0 +1,70 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/handlers"
+)
+
+// corsWildcard allows all origins, which must not be combined with
+// credentials.
+const corsWildcard = "*"
+
+// corsHandler allows browsers to call the JSON endpoints from the given
+// origins, e.g. from a separately hosted frontend. All other endpoints
+// are left untouched. Browsers send credentials along, so only explicitly
+// listed origins are allowed and the wildcard is ignored.
+func corsHandler(origins []string, next http.Handler) http.Handler {
+	var allowed []string
+	for _, origin := range origins {
+		if origin != corsWildcard {
+			allowed = append(allowed, origin)
+		}
+	}
+	if len(allowed) == 0 {
+		return next
+	}
+	cors := handlers.CORS(
+		handlers.AllowedOrigins(allowed),
+		handlers.AllowedMethods([]string{"GET", "POST", "PUT", "DELETE"}),
+		handlers.AllowedHeaders([]string{"Authorization", "Content-Type"}),
+		handlers.AllowCredentials(),
+	)(next)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/api/") {
+			cors.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// validateCORSOrigin checks that the origin consists of scheme and host
+// only, as sent by browsers.
+func validateCORSOrigin(origin string) bool {
+	parsed, err := url.Parse(origin)
+	return err == nil && (parsed.Scheme == "http" || parsed.Scheme == "https") && parsed.Host != "" && parsed.Path == "" && parsed.RawQuery == ""
+}
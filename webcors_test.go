@@ -0,0 +1,92 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCORS(t *testing.T) {
+	protected := newAuthenticator(WebInterface{Token: "secret"}).handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	handler := corsHandler([]string{"https://dashboard.example.com"}, protected)
+
+	// Preflight requests don't carry credentials
+	request := httptest.NewRequest("OPTIONS", "/api/lights", nil)
+	request.Header.Set("Origin", "https://dashboard.example.com")
+	request.Header.Set("Access-Control-Request-Method", "PUT")
+	request.Header.Set("Access-Control-Request-Headers", "Authorization")
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, request)
+	if recorder.Code != http.StatusOK || recorder.Header().Get("Access-Control-Allow-Origin") != "https://dashboard.example.com" || recorder.Header().Get("Access-Control-Allow-Headers") != "Authorization" {
+		t.Errorf("Preflight request failed with HTTP %d: %v", recorder.Code, recorder.Header())
+	}
+
+	tests := []struct {
+		path    string
+		origin  string
+		allowed bool
+	}{
+		{"/api/lights", "https://dashboard.example.com", true},
+		{"/api/lights", "https://evil.example.com", false},
+		{"/schedules.html", "https://dashboard.example.com", false},
+	}
+	for _, test := range tests {
+		request := httptest.NewRequest("GET", test.path, nil)
+		request.Header.Set("Origin", test.origin)
+		request.Header.Set("Authorization", "Bearer secret")
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		if recorder.Code != http.StatusOK {
+			t.Errorf("GET %s from %s returned HTTP %d", test.path, test.origin, recorder.Code)
+		}
+		if allowed := recorder.Header().Get("Access-Control-Allow-Origin") != ""; allowed != test.allowed {
+			t.Errorf("GET %s from %s: expected CORS %v, got %v", test.path, test.origin, test.allowed, allowed)
+		}
+	}
+
+	request = httptest.NewRequest("GET", "/api/lights", nil)
+	request.Header.Set("Origin", "https://dashboard.example.com")
+	recorder = httptest.NewRecorder()
+	corsHandler(nil, protected).ServeHTTP(recorder, request)
+	if recorder.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Errorf("CORS should be disabled without origins")
+	}
+	recorder = httptest.NewRecorder()
+	corsHandler([]string{"*"}, protected).ServeHTTP(recorder, request)
+	if recorder.Header().Get("Access-Control-Allow-Origin") != "" || recorder.Header().Get("Access-Control-Allow-Credentials") != "" {
+		t.Errorf("The wildcard must not allow requests with credentials")
+	}
+	c := Configuration{WebInterface: WebInterface{CORSOrigins: []string{"*"}}}
+	if messages := strings.Join(c.Validate().Errors, "\n"); !strings.Contains(messages, "CORS origin") {
+		t.Errorf("The wildcard origin should fail validation: %v", messages)
+	}
+	for origin, valid := range map[string]bool{"*": false, "http://localhost:8123": true, "https://example.com/": false, "example.com": false} {
+		if validateCORSOrigin(origin) != valid {
+			t.Errorf("Origin %s should be valid: %v", origin, valid)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const webhookTimeout = 10 * time.Second
+
+// Events reported to webhooks.
+const (
+	webhookScheduleActivated = "scheduleActivated"
+	webhookManualChange      = "manualChange"
+	webhookLightAppeared     = "lightAppeared"
+	webhookBridgeUnreachable = "bridgeUnreachable"
+	webhookBridgeReachable   = "bridgeReachable"
+)
+
+var webhookEvents = []string{webhookScheduleActivated, webhookManualChange, webhookLightAppeared, webhookBridgeUnreachable, webhookBridgeReachable}
+
+var webhookClient = &http.Client{Timeout: webhookTimeout}
+
+// Webhook represents a URL which is notified about events.
+type Webhook struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+}
+
+// webhookEvent is the JSON body posted to webhooks.
+type webhookEvent struct {
+	Event    string    `json:"event"`
+	Time     time.Time `json:"time"`
+	Light    string    `json:"light,omitempty"`
+	Bridge   string    `json:"bridge,omitempty"`
+	Schedule string    `json:"schedule,omitempty"`
+	Message  string    `json:"message,omitempty"`
+}
+
+func (webhook *Webhook) subscribed(event string) bool {
+	if len(webhook.Events) == 0 {
+		return true
+	}
+	for _, e := range webhook.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+func (webhook *Webhook) validate() error {
+	target, err := url.Parse(webhook.URL)
+	if err != nil {
+		return err
+	}
+	if (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		return fmt.Errorf("URL must start with http:// or https://")
+	}
+	for _, event := range webhook.Events {
+		if !containsString(webhookEvents, event) {
+			return fmt.Errorf("Unknown event %s", event)
+		}
+	}
+	return nil
+}
+
+// notifyWebhooks posts the event to all interested webhooks in the
+// background. Failures are logged and never retried.
+func notifyWebhooks(event webhookEvent) {
+	if configuration == nil {
+		return
+	}
+	event.Time = time.Now()
+	for _, webhook := range configuration.Webhooks {
+		if webhook.subscribed(event.Event) {
+			go sendWebhook(webhook.URL, event)
+		}
+	}
+}
+
+func sendWebhook(target string, event webhookEvent) error {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	response, err := webhookClient.Post(target, "application/json", bytes.NewReader(data))
+	if err != nil {
+		log.Warningf("🤖 Webhook %s failed: %v", target, err)
+		return err
+	}
+	defer response.Body.Close()
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		log.Warningf("🤖 Webhook %s returned HTTP %d", target, response.StatusCode)
+		return fmt.Errorf("Webhook returned HTTP %d", response.StatusCode)
+	}
+	return nil
+}
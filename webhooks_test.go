@@ -0,0 +1,76 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhooks(t *testing.T) {
+	received := make(chan webhookEvent, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event webhookEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("Invalid webhook body: %v", err)
+		}
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected webhook request %s with content type %s", r.Method, r.Header.Get("Content-Type"))
+		}
+		received <- event
+	}))
+	defer server.Close()
+
+	useConfiguration(t, &Configuration{Webhooks: []Webhook{
+		{URL: server.URL, Events: []string{webhookManualChange}},
+		{URL: server.URL + "/all"},
+	}})
+	for _, webhook := range configuration.Webhooks {
+		if err := webhook.validate(); err != nil {
+			t.Errorf("Webhook %s is invalid: %v", webhook.URL, err)
+		}
+	}
+
+	notifyWebhooks(webhookEvent{Event: webhookBridgeUnreachable, Bridge: "upstairs"})
+	select {
+	case event := <-received:
+		if event.Event != webhookBridgeUnreachable || event.Bridge != "upstairs" || event.Time.IsZero() {
+			t.Errorf("Unexpected webhook event %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Webhook was not called")
+	}
+	select {
+	case event := <-received:
+		t.Errorf("Webhook subscribed to %s received %s", webhookManualChange, event.Event)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	for _, webhook := range []Webhook{{URL: "ftp://example.com"}, {URL: "localhost:1880"}, {URL: "http://localhost:1880", Events: []string{"sunrise"}}} {
+		if webhook.validate() == nil {
+			t.Errorf("Webhook %+v should be invalid", webhook)
+		}
+	}
+}
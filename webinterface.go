@@ -21,7 +21,6 @@
 // SOFTWARE.
 package main
 
-import log "github.com/sirupsen/logrus"
 import "net/http"
 import "html/template"
 import "github.com/gorilla/mux"
@@ -29,18 +28,47 @@ import "github.com/gorilla/handlers"
 import "encoding/json"
 import "fmt"
 import "strings"
+import "sort"
 import "strconv"
+import "time"
 
 func startInterface() {
 	if !configuration.WebInterface.Enabled {
 		return
 	}
 
+	addLogHook(dashboardEvents)
+	// Don't serve the default mux, net/http/pprof registers itself there
+	// without authentication
+	handler := webHandler()
+	port := configuration.WebInterface.Port
+	if configuration.WebInterface.TLS != nil {
+		certificate, key, err := configuration.tlsFiles()
+		if err != nil {
+			webLog.Warningf("Could not start webinterface with TLS: %v", err)
+			return
+		}
+		webLog.Printf("Webinterface started on port %d (HTTPS)", port)
+		webLog.Warning(http.ListenAndServeTLS(fmt.Sprintf(":%d", port), certificate, key, handler))
+		return
+	}
+	webLog.Printf("Webinterface started on port %d", port)
+	webLog.Warning(http.ListenAndServe(fmt.Sprintf(":%d", port), handler))
+}
+
+// webHandler returns the router protected by the authentication and CORS
+// settings of the configuration.
+func webHandler() http.Handler {
+	return handlers.CompressHandler(corsHandler(configuration.WebInterface.CORSOrigins, newAuthenticator(configuration.WebInterface).handler(newRouter())))
+}
+
+func newRouter() *mux.Router {
 	r := mux.NewRouter()
 	// html endpoints
 	r.HandleFunc("/", dashboardHandler).Methods("GET")
 	r.HandleFunc("/schedules.html", schedulesHandler).Methods("GET")
 	r.HandleFunc("/configuration.html", configurationHandler).Methods("GET")
+	r.HandleFunc("/logs.html", logsPageHandler).Methods("GET")
 
 	// REST endpoints
 	r.HandleFunc("/restart", restartHandler).Methods("PUT", "POST")
@@ -49,27 +77,54 @@ func startInterface() {
 	r.HandleFunc("/lights", lightsHandler).Methods("GET")
 	r.HandleFunc("/lights/{id}/automatic", automateLightHandler).Methods("PUT", "POST")
 	r.HandleFunc("/lights/{id}/activate", activateLightHandler).Methods("PUT", "POST")
+	r.HandleFunc("/api/schema", schemaHandler).Methods("GET")
+	r.HandleFunc("/api/openapi.json", openAPIHandler).Methods("GET")
+	r.HandleFunc("/api/bridges", bridgesHandler).Methods("GET")
+	r.HandleFunc("/api/timeline", timelineHandler).Methods("GET")
+	r.HandleFunc("/api/events", eventsHandler).Methods("GET")
+	r.HandleFunc("/api/lights", lightStatusHandler).Methods("GET")
+	r.HandleFunc("/api/update", updateHandler).Methods("POST")
+	r.HandleFunc("/api/logs", logsHandler).Methods("GET")
+	r.HandleFunc("/api/config", exportConfigurationHandler).Methods("GET")
+	r.HandleFunc("/api/config", importConfigurationHandler).Methods("PUT")
+	r.HandleFunc("/healthz", healthHandler).Methods("GET")
+	r.HandleFunc("/readyz", readyHandler).Methods("GET")
+	r.HandleFunc("/api/lights/{id}/override", overrideLightHandler).Methods("PUT")
+	r.HandleFunc("/api/lights/{id}/override", endOverrideHandler).Methods("DELETE")
+	r.HandleFunc("/api/away", awayHandler).Methods("GET")
+	r.HandleFunc("/api/away", setAwayHandler).Methods("POST")
+	r.HandleFunc("/api/awaysimulation", awaySimulationHandler).Methods("GET")
+	r.HandleFunc("/api/awaysimulation/start", startAwaySimulationHandler).Methods("POST")
+	r.HandleFunc("/api/awaysimulation/stop", stopAwaySimulationHandler).Methods("POST")
+	r.HandleFunc("/api/scenes", scenesHandler).Methods("GET")
+	r.HandleFunc("/api/scenes/{name}/activate", activateSceneHandler).Methods("POST")
+	r.HandleFunc("/api/schedules", listSchedulesHandler).Methods("GET")
+	r.HandleFunc("/api/schedules", createScheduleHandler).Methods("POST")
+	r.HandleFunc("/api/schedules/validate", validateSchedulesHandler).Methods("POST")
+	r.HandleFunc("/api/schedules/{name}", getScheduleHandler).Methods("GET")
+	r.HandleFunc("/api/schedules/{name}", updateScheduleHandler).Methods("PUT")
+	r.HandleFunc("/api/schedules/{name}", deleteScheduleHandler).Methods("DELETE")
+	r.HandleFunc("/api/schedules/{name}/simulate", simulateScheduleHandler).Methods("GET")
+	r.HandleFunc("/api/schedules/{name}/pause", pauseScheduleHandler).Methods("POST")
+	r.HandleFunc("/api/schedules/{name}/resume", resumeScheduleHandler).Methods("POST")
+	addProfilingRoutes(r)
 
 	// static files
-	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", http.FileServer(http.Dir("gui/static"))))
-
-	http.Handle("/", handlers.CompressHandler(r))
-	port := configuration.WebInterface.Port
-	log.Printf("Webinterface started on port %d", port)
-	log.Warning(http.ListenAndServe(fmt.Sprintf(":%d", port), nil))
+	r.PathPrefix("/static/").Handler(http.StripPrefix("/static/", staticFiles()))
+	return r
 }
 
 func dashboardHandler(w http.ResponseWriter, r *http.Request) {
-	log.Debugf("Serving dashboard page to %s", r.RemoteAddr)
+	webLog.Debugf("Serving dashboard page to %s", r.RemoteAddr)
 	if configuration.Bridge.IP == "" || configuration.Bridge.Username == "" {
-		dashboardTemplate := template.Must(template.New("init.html").ParseGlob("gui/template/init.html"))
+		dashboardTemplate := parseTemplate("init.html", nil)
 		err := dashboardTemplate.Execute(w, bridge)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
 	} else {
-		dashboardTemplate := template.Must(template.New("dashboard.html").ParseGlob("gui/template/dashboard.html"))
+		dashboardTemplate := parseTemplate("dashboard.html", template.FuncMap{"scheduleNames": scheduleNames})
 		err := dashboardTemplate.Execute(w, lights)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -79,8 +134,8 @@ func dashboardHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 func configurationHandler(w http.ResponseWriter, r *http.Request) {
-	log.Debugf("Serving configuration page to %s", r.RemoteAddr)
-	configurationTemplate := template.Must(template.New("configuration.html").ParseGlob("gui/template/configuration.html"))
+	webLog.Debugf("Serving configuration page to %s", r.RemoteAddr)
+	configurationTemplate := parseTemplate("configuration.html", nil)
 	err := configurationTemplate.Execute(w, configuration)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -88,9 +143,19 @@ func configurationHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+func logsPageHandler(w http.ResponseWriter, r *http.Request) {
+	webLog.Debugf("Serving logs page to %s", r.RemoteAddr)
+	logsTemplate := parseTemplate("logs.html", nil)
+	err := logsTemplate.Execute(w, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+}
+
 func schedulesHandler(w http.ResponseWriter, r *http.Request) {
-	log.Debugf("Serving schedules page to %s", r.RemoteAddr)
-	schedulesTemplate := template.Must(template.New("schedules.html").Funcs(template.FuncMap{"lightsToString": lightsToString}).ParseGlob("gui/template/schedules.html"))
+	webLog.Debugf("Serving schedules page to %s", r.RemoteAddr)
+	schedulesTemplate := parseTemplate("schedules.html", template.FuncMap{"lightsToString": lightsToString, "namesToString": namesToString, "luxRangesToString": luxRangesToString, "brightnessLimitsToString": brightnessLimitsToString, "weatherModifiersToString": weatherModifiersToString, "elevationCurveToString": elevationCurveToString})
 	err := schedulesTemplate.Execute(w, configuration.Schedules)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -112,6 +177,76 @@ func lightsToString(args ...interface{}) (string, error) {
 	return strings.Trim(strings.Join(strings.Fields(fmt.Sprint(s)), ","), "[]"), nil
 }
 
+// scheduleNames returns the names of all configured schedules.
+func scheduleNames() []string {
+	names := []string{}
+	for _, schedule := range configuration.Schedules {
+		names = append(names, schedule.Name)
+	}
+	return names
+}
+
+func namesToString(names []string) string {
+	return strings.Join(names, ", ")
+}
+
+// luxRangesToString formats lux ranges as min-max:multiplier. Open ended
+// ranges omit the maximum.
+func luxRangesToString(ranges []LuxRange) string {
+	var parts []string
+	for _, r := range ranges {
+		max := ""
+		if r.MaxLux != 0 {
+			max = strconv.FormatFloat(r.MaxLux, 'f', -1, 64)
+		}
+		parts = append(parts, fmt.Sprintf("%s-%s:%s", strconv.FormatFloat(r.MinLux, 'f', -1, 64), max, strconv.FormatFloat(r.Multiplier, 'f', -1, 64)))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// brightnessLimitsToString formats brightness limits as name:min-max sorted
+// by name. Open limits are left empty.
+func brightnessLimitsToString(limits map[string]BrightnessLimit) string {
+	var names []string
+	for name := range limits {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var parts []string
+	for _, name := range names {
+		min, max := "", ""
+		if limit := limits[name]; limit.MinBrightness != 0 {
+			min = strconv.Itoa(limit.MinBrightness)
+		}
+		if limit := limits[name]; limit.MaxBrightness != 0 {
+			max = strconv.Itoa(limit.MaxBrightness)
+		}
+		parts = append(parts, fmt.Sprintf("%s:%s-%s", name, min, max))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// weatherModifiersToString formats weather modifiers as
+// cloudCover:colorTemperature:brightness.
+func weatherModifiersToString(modifiers []WeatherModifier) string {
+	var parts []string
+	for _, modifier := range modifiers {
+		parts = append(parts, fmt.Sprintf("%d:%d:%d", modifier.CloudCover, modifier.ColorTemperature, modifier.Brightness))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// elevationCurveToString formats the points of an elevation curve as
+// elevation:K:%.
+func elevationCurveToString(points []ElevationPoint) string {
+	var parts []string
+	for _, point := range points {
+		parts = append(parts, fmt.Sprintf("%v:%d:%d", point.Elevation, point.ColorTemperature, point.Brightness))
+	}
+	return strings.Join(parts, ", ")
+}
+
 func updateSchedulesHandler(w http.ResponseWriter, r *http.Request) {
 	decoder := json.NewDecoder(r.Body)
 	var t []LightSchedule
@@ -121,21 +256,15 @@ func updateSchedulesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer r.Body.Close()
-	log.Debugf("Received schedule update from %s: %+v", r.RemoteAddr, t)
-	configuration.Schedules = t
-	err = configuration.Write()
+	webLog.Debugf("Received schedule update from %s: %+v", r.RemoteAddr, t)
+	report, err := applySchedules(t)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-
-	// Update scenes
-	updateScenes()
-
-	// Update lights
-	for _, light := range lights {
-		light := light
-		updateScheduleForLight(light)
+	if !report.Valid() {
+		writeJSON(w, http.StatusBadRequest, report)
+		return
 	}
 	w.Write([]byte("success"))
 }
@@ -149,12 +278,30 @@ func updateConfigurationHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	defer r.Body.Close()
-	log.Debugf("Received configuration update from %s: %+v", r.RemoteAddr, t)
+	webLog.Debugf("Received configuration update from %s: %+v", r.RemoteAddr, t)
+	t.Bridge.UsernameFile = configuration.Bridge.UsernameFile
+	t.Bridge.CertificateFingerprint = configuration.Bridge.CertificateFingerprint
+	// Credentials are never sent to the browser, keep them
+	t.WebInterface.Token = configuration.WebInterface.Token
+	t.WebInterface.Username = configuration.WebInterface.Username
+	t.WebInterface.Password = configuration.WebInterface.Password
+	t.WebInterface.TLS = configuration.WebInterface.TLS
+	t.WebInterface.CORSOrigins = configuration.WebInterface.CORSOrigins
+	if t.Bridge.RequestsPerSecond == 0 {
+		t.Bridge.RequestsPerSecond = configuration.Bridge.RequestsPerSecond
+	}
+	if t.Bridges == nil {
+		t.Bridges = configuration.Bridges
+	}
 	configuration.Bridge = t.Bridge
+	configuration.Bridges = t.Bridges
 	configuration.Location = t.Location
+	if t.Locations != nil {
+		configuration.Locations = t.Locations
+	}
 	configuration.WebInterface = t.WebInterface
 	configuration.Write()
-	log.Debugf("Updated configuration to: %+v", configuration)
+	webLog.Debugf("Updated configuration to: %+v", configuration)
 	w.Write([]byte("success"))
 }
 
@@ -164,17 +311,20 @@ func automateLightHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	bridgeName := r.URL.Query().Get("bridge")
 	for _, l := range lights {
-		if l.ID == lightID {
-			log.Printf("💡 Light %s - Enabling automatic mode as requested by %s", l.Name, r.RemoteAddr)
+		if l.Bridge == bridgeName && l.ID == lightID {
+			scheduleLog.Printf("💡 Light %s - Enabling automatic mode as requested by %s", l.Name, r.RemoteAddr)
 			l.Tracking = false
 		}
 	}
 	w.Write([]byte("success"))
 }
 
+// activateLightHandler sets the requested light state and stops the
+// automatic updates of the light. The state is applied in the main loop.
 func activateLightHandler(w http.ResponseWriter, r *http.Request) {
-	log.Debugf("Received new light state by %s", r.RemoteAddr)
+	webLog.Debugf("Received new light state by %s", r.RemoteAddr)
 	defer r.Body.Close()
 	lightID, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
@@ -189,23 +339,27 @@ func activateLightHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if !t.isValid() {
-		log.Warningf("Received invalid light state from %s: %+v", r.RemoteAddr, t)
+		webLog.Warningf("Received invalid light state from %s: %+v", r.RemoteAddr, t)
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	for _, l := range lights {
-		if l.ID == lightID {
-			log.Printf("💡 Light %s - Activating light state %+v as requested by %s", l.Name, t, r.RemoteAddr)
-			l.Automatic = false
-			l.HueLight.setLightState(t.ColorTemperature, t.Brightness, 0)
+	bridgeName := r.URL.Query().Get("bridge")
+	inMainLoop(func() {
+		for _, l := range lights {
+			if l.Bridge == bridgeName && l.ID == lightID {
+				scheduleLog.Printf("💡 Light %s - Activating light state %+v as requested by %s", l.Name, t, r.RemoteAddr)
+				l.Automatic = false
+				l.HueLight.TargetGradient = nil
+				l.HueLight.setLightState(t.ColorTemperature, t.Brightness, 0)
+			}
 		}
-	}
+	})
 	w.Write([]byte("success"))
 }
 
 func lightsHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("Serving lights to %s", r.RemoteAddr)
+	webLog.Printf("Serving lights to %s", r.RemoteAddr)
 	ls := []Light{}
 	for _, l := range lights {
 		ls = append(ls, *l)
@@ -218,8 +372,89 @@ func lightsHandler(w http.ResponseWriter, r *http.Request) {
 	w.Write(data)
 }
 
+// bridgeStatus reports whether Kelvin can reach a bridge.
+type bridgeStatus struct {
+	Name             string     `json:"name"`
+	IP               string     `json:"ip"`
+	Available        bool       `json:"available"`
+	UnavailableSince *time.Time `json:"unavailableSince,omitempty"`
+}
+
+func bridgesHandler(w http.ResponseWriter, r *http.Request) {
+	webLog.Debugf("Serving bridge status to %s", r.RemoteAddr)
+	statuses := []bridgeStatus{}
+	for _, b := range bridges {
+		status := bridgeStatus{Name: b.Name, IP: b.BridgeIP, Available: true}
+		if since := b.breaker.unavailableSince(); !since.IsZero() {
+			status.Available = false
+			status.UnavailableSince = &since
+		}
+		statuses = append(statuses, status)
+	}
+	data, err := json.Marshal(statuses)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// requestedDate returns the day given as date parameter (YYYY-MM-DD) or
+// today.
+func requestedDate(r *http.Request) (time.Time, error) {
+	value := r.URL.Query().Get("date")
+	if value == "" {
+		return time.Now(), nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+// timelineHandler serves the calculated course of a schedule for one day.
+// Both the schedule (name) and the day (YYYY-MM-DD) are optional.
+func timelineHandler(w http.ResponseWriter, r *http.Request) {
+	webLog.Debugf("Serving timeline to %s", r.RemoteAddr)
+	date, err := requestedDate(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	lightSchedule, err := configuration.previewSchedule(0, r.URL.Query().Get("schedule"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	data, err := json.Marshal(configuration.timeline(lightSchedule, date, timelineStep))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+func schemaHandler(w http.ResponseWriter, r *http.Request) {
+	webLog.Debugf("Serving configuration schema to %s", r.RemoteAddr)
+	data, err := json.Marshal(ConfigurationSchema())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/schema+json")
+	w.Write(data)
+}
+
+// updateHandler triggers an immediate update cycle of the main loop.
+func updateHandler(w http.ResponseWriter, r *http.Request) {
+	webLog.Printf("Update of all lights requested by %s", r.RemoteAddr)
+	r.Body.Close()
+	requestUpdate()
+	w.WriteHeader(http.StatusAccepted)
+	w.Write([]byte("success"))
+}
+
 func restartHandler(w http.ResponseWriter, r *http.Request) {
-	log.Printf("Restart requested by %s", r.RemoteAddr)
+	webLog.Printf("Restart requested by %s", r.RemoteAddr)
 	r.Body.Close()
 	w.Write([]byte("success"))
 	Restart()
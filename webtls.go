@@ -0,0 +1,121 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"time"
+)
+
+const defaultTLSCertificate = "kelvin.crt"
+const defaultTLSKey = "kelvin.key"
+const selfSignedCertificateValidity = 10 * 365 * 24 * time.Hour
+
+// WebInterfaceTLS configures HTTPS for the web interface. Without a
+// certificate and key Kelvin generates a self-signed certificate.
+type WebInterfaceTLS struct {
+	Certificate string `json:"certificate,omitempty"`
+	Key         string `json:"key,omitempty"`
+}
+
+// tlsFiles returns the paths of the certificate and key of the web
+// interface. If none are configured a self-signed certificate will be
+// generated next to the configuration on first start.
+func (configuration *Configuration) tlsFiles() (string, string, error) {
+	tls := configuration.WebInterface.TLS
+	if tls.Certificate != "" || tls.Key != "" {
+		if tls.Certificate == "" || tls.Key == "" {
+			return "", "", fmt.Errorf("TLS requires both a certificate and a key")
+		}
+		return configuration.secretsPath(tls.Certificate), configuration.secretsPath(tls.Key), nil
+	}
+
+	certificate := configuration.secretsPath(defaultTLSCertificate)
+	key := configuration.secretsPath(defaultTLSKey)
+	_, certificateErr := os.Stat(certificate)
+	_, keyErr := os.Stat(key)
+	if certificateErr == nil && keyErr == nil {
+		return certificate, key, nil
+	}
+	configLog.Printf("⚙ Generating self-signed certificate %s for the web interface", certificate)
+	err := generateSelfSignedCertificate(certificate, key, time.Now())
+	return certificate, key, err
+}
+
+// generateSelfSignedCertificate creates a certificate for localhost, the
+// hostname and all local addresses of this machine.
+func generateSelfSignedCertificate(certificateFile string, keyFile string, now time.Time) error {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"Kelvin"}, CommonName: "Kelvin"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedCertificateValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+	}
+	if hostname, err := os.Hostname(); err == nil && hostname != "" {
+		template.DNSNames = append(template.DNSNames, hostname)
+	}
+	if addresses, err := net.InterfaceAddrs(); err == nil {
+		for _, address := range addresses {
+			if network, ok := address.(*net.IPNet); ok {
+				template.IPAddresses = append(template.IPAddresses, network.IP)
+			}
+		}
+	}
+
+	certificate, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return err
+	}
+	privateKey, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return err
+	}
+
+	err = ioutil.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: privateKey}), 0600)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(certificateFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: certificate}), 0644)
+}
@@ -0,0 +1,55 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"crypto/tls"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestWebInterfaceTLS(t *testing.T) {
+	directory := t.TempDir()
+
+	c := Configuration{ConfigurationFile: filepath.Join(directory, "config.json")}
+	c.WebInterface.TLS = &WebInterfaceTLS{}
+	certificate, key, err := c.tlsFiles()
+	if err != nil {
+		t.Fatalf("Could not generate certificate: %v", err)
+	}
+	if _, err := tls.LoadX509KeyPair(certificate, key); err != nil {
+		t.Errorf("Generated certificate should be usable: %v", err)
+	}
+	generated, _ := ioutil.ReadFile(certificate)
+	if _, _, err := c.tlsFiles(); err != nil {
+		t.Fatal(err)
+	}
+	if reused, _ := ioutil.ReadFile(certificate); string(reused) != string(generated) {
+		t.Errorf("Existing certificate should be reused")
+	}
+
+	c.WebInterface.TLS = &WebInterfaceTLS{Certificate: "custom.crt"}
+	if _, _, err := c.tlsFiles(); err == nil {
+		t.Errorf("Certificate without key should be rejected")
+	}
+}
@@ -0,0 +1,130 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+const defaultWindDownDuration = 30 * time.Minute
+const defaultWindDownColorTemperature = 2000
+const defaultWindDownBrightness = 10
+
+// WindDown dims and warms the lights of a schedule over the given duration
+// starting at the configured time. The final state is kept until midnight.
+type WindDown struct {
+	Days             []string `json:"days,omitempty"`
+	Time             string   `json:"time"`
+	Duration         string   `json:"duration,omitempty"`
+	ColorTemperature int      `json:"colorTemperature,omitempty"`
+	Brightness       int      `json:"brightness,omitempty"`
+	TurnOff          bool     `json:"turnOff,omitempty"`
+}
+
+// windDown is the parsed version of a configured WindDown.
+type windDown struct {
+	days     map[time.Weekday]bool
+	start    time.Duration
+	duration time.Duration
+	target   LightState
+	turnOff  bool
+}
+
+func (configured *WindDown) parse() (*windDown, error) {
+	days, err := parseWeekdays(configured.Days)
+	if err != nil {
+		return nil, err
+	}
+	start, err := parseClockTime(configured.Time)
+	if err != nil {
+		return nil, err
+	}
+	duration, err := parsePositiveDuration(configured.Duration, defaultWindDownDuration)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid duration %q: %v", configured.Duration, err)
+	}
+	if start+duration > 24*time.Hour {
+		return nil, fmt.Errorf("Wind-down must end before midnight")
+	}
+	target := LightState{configured.ColorTemperature, configured.Brightness}
+	if target.ColorTemperature == 0 {
+		target.ColorTemperature = defaultWindDownColorTemperature
+	}
+	if target.Brightness == 0 {
+		target.Brightness = defaultWindDownBrightness
+	}
+	return &windDown{days, start, duration, target, configured.TurnOff}, nil
+}
+
+// times returns the start and end of the wind-down on the day of the given
+// time. It returns false if there is no wind-down on that day.
+func (w *windDown) times(now time.Time) (time.Time, time.Time, bool) {
+	if w == nil {
+		return time.Time{}, time.Time{}, false
+	}
+	start := atClockTime(now, 0, w.start)
+	if !w.days[start.Weekday()] || now.Before(start) {
+		return time.Time{}, time.Time{}, false
+	}
+	return start, start.Add(w.duration), true
+}
+
+// stateAt moves the given scheduled state of the wind-down start towards the
+// target of the wind-down. Ignored values stay ignored.
+func (w *windDown) stateAt(start time.Time, from LightState, now time.Time) LightState {
+	progress := float64(now.Sub(start)) / float64(w.duration)
+	if progress > 1 {
+		progress = 1
+	}
+	state := from
+	if state.ColorTemperature != -1 && state.ColorTemperature > w.target.ColorTemperature {
+		state.ColorTemperature -= int(progress * float64(state.ColorTemperature-w.target.ColorTemperature))
+	}
+	if state.Brightness != -1 && state.Brightness > w.target.Brightness {
+		state.Brightness -= int(progress * float64(state.Brightness-w.target.Brightness))
+	}
+	return state
+}
+
+// windDownState applies an active wind-down of the schedule to the given
+// light state. Lights are turned off once when the wind-down ends if the
+// schedule asks for it.
+func (light *Light) windDownState(state LightState, now time.Time) LightState {
+	w := light.Schedule.windDown
+	start, end, active := w.times(now)
+	if !active {
+		return state
+	}
+	from, err := light.Schedule.lightStateAt(start)
+	if err != nil {
+		return state
+	}
+	state = w.stateAt(start, from, now)
+	if w.turnOff && !now.Before(end) && !light.windDownOff.Equal(end) {
+		light.windDownOff = end
+		if state.Brightness != -1 {
+			state.Brightness = 0
+		}
+	}
+	return state
+}
@@ -0,0 +1,75 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindDown(t *testing.T) {
+	w, err := (&WindDown{Time: "22:00", Duration: "40m", TurnOff: true}).parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, invalid := range []WindDown{{Time: "23:40", Duration: "30m"}, {Time: "22"}, {Time: "22:00", Days: []string{"someday"}}} {
+		if _, err := invalid.parse(); err == nil {
+			t.Errorf("Wind-down %+v should be invalid", invalid)
+		}
+	}
+
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	start := day.Add(22 * time.Hour)
+	if _, _, active := w.times(start.Add(-time.Minute)); active {
+		t.Errorf("Wind-down should not be active before its start")
+	}
+	if from, end, active := w.times(start.Add(time.Hour)); !active || !from.Equal(start) || !end.Equal(start.Add(40*time.Minute)) {
+		t.Errorf("Unexpected wind-down times %v - %v (%v)", from, end, active)
+	}
+
+	tests := []struct {
+		from     LightState
+		now      time.Time
+		expected LightState
+	}{
+		{LightState{3000, 90}, start, LightState{3000, 90}},
+		{LightState{3000, 90}, start.Add(20 * time.Minute), LightState{2500, 50}},
+		{LightState{3000, 90}, start.Add(time.Hour), LightState{2000, 10}},
+		{LightState{-1, 5}, start.Add(20 * time.Minute), LightState{-1, 5}},
+	}
+	for _, test := range tests {
+		if state := w.stateAt(start, test.from, test.now); state != test.expected {
+			t.Errorf("Wind-down from %+v at %v: expected %+v, got %+v", test.from, test.now.Format("15:04"), test.expected, state)
+		}
+	}
+
+	now := time.Now()
+	schedule := (&Configuration{}).scheduleForDay(LightSchedule{Name: "bedroom", DefaultColorTemperature: 3000, DefaultBrightness: 90}, now)
+	schedule.windDown = &windDown{days: w.days, start: 0, duration: time.Nanosecond, target: w.target, turnOff: true}
+	light := &Light{Name: "Bedroom", Schedule: schedule}
+	if state := light.windDownState(LightState{3000, 90}, now); state.Brightness != 0 {
+		t.Errorf("Lights should be turned off at the end of the wind-down, got %+v", state)
+	}
+	if state := light.windDownState(LightState{3000, 90}, now); state != (LightState{2000, 10}) {
+		t.Errorf("Lights should be turned off only once, got %+v", state)
+	}
+}
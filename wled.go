@@ -0,0 +1,242 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// WLED accepts color temperatures in Kelvin within this range for the
+// white channels of CCT strips. See https://kno.wled.ge/interfaces/json-api/
+const wledMinimumColorTemperature = 1900
+const wledMaximumColorTemperature = 10091
+
+// wledState represents the parts of the state of the WLED JSON API Kelvin
+// uses.
+type wledState struct {
+	On         *bool         `json:"on,omitempty"`
+	Brightness int           `json:"bri,omitempty"`
+	Transition *int          `json:"transition,omitempty"`
+	Segments   []wledSegment `json:"seg,omitempty"`
+}
+
+type wledSegment struct {
+	Colors [][]int `json:"col,omitempty"`
+	CCT    int     `json:"cct,omitempty"`
+}
+
+type wledInfo struct {
+	Leds struct {
+		RGBW bool `json:"rgbw"`
+	} `json:"leds"`
+}
+
+func init() {
+	registerLightProvider("wled", &wledProvider{backends: make(map[string]*wledBackend)})
+}
+
+// wledProvider controls the WLED controllers of all schedules.
+type wledProvider struct {
+	backends map[string]*wledBackend
+}
+
+// Discover returns the WLED controllers of all schedules.
+func (provider *wledProvider) Discover(configuration *Configuration) ([]ProviderLight, error) {
+	var lights []ProviderLight
+	for _, lightSchedule := range configuration.Schedules {
+		for _, host := range lightSchedule.WLED {
+			if _, found := provider.backends[host]; !found {
+				provider.backends[host] = &wledBackend{host: host}
+			}
+			lights = append(lights, ProviderLight{Provider: "wled", ID: host, Name: "WLED " + host, Schedule: lightSchedule.Name})
+		}
+	}
+	return lights, nil
+}
+
+func (provider *wledProvider) GetState(light ProviderLight) (ProviderState, error) {
+	backend, found := provider.backends[light.ID]
+	if !found {
+		return ProviderState{}, fmt.Errorf("Unknown WLED controller %s", light.ID)
+	}
+	on, unchanged, err := backend.readState()
+	if err != nil {
+		return ProviderState{}, err
+	}
+	if !on {
+		backend.sent = nil
+	}
+	return ProviderState{Reachable: true, On: on, Changed: !unchanged}, nil
+}
+
+func (provider *wledProvider) SetState(light ProviderLight, state LightState, transitionTime time.Duration) (bool, error) {
+	backend, found := provider.backends[light.ID]
+	if !found {
+		return false, fmt.Errorf("Unknown WLED controller %s", light.ID)
+	}
+	return backend.setState(state, transitionTime)
+}
+
+// Subscribe returns false as WLED controllers have to be polled.
+func (provider *wledProvider) Subscribe(events chan<- ProviderLight) bool {
+	return false
+}
+
+// wledBackend controls a WLED controller via its JSON API.
+type wledBackend struct {
+	host        string
+	initialized bool
+	rgbw        bool
+	sent        *wledState
+}
+
+func (backend *wledBackend) request(method string, path string, request interface{}, result interface{}) error {
+	var body *bytes.Reader
+	if request != nil {
+		data, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	} else {
+		body = bytes.NewReader(nil)
+	}
+
+	httpRequest, err := http.NewRequest(method, fmt.Sprintf("http://%s%s", backend.host, path), body)
+	if err != nil {
+		return err
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	response, err := localDeviceClient.Do(httpRequest)
+	if response != nil {
+		defer response.Body.Close()
+	}
+	if err != nil {
+		return err
+	}
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("WLED returned HTTP %d", response.StatusCode)
+	}
+	if result == nil {
+		return nil
+	}
+	data, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+func (backend *wledBackend) readState() (bool, bool, error) {
+	var current wledState
+	err := backend.request("GET", "/json/state", nil, &current)
+	if err != nil {
+		return false, false, err
+	}
+	if !backend.initialized {
+		var info wledInfo
+		if err := backend.request("GET", "/json/info", nil, &info); err == nil {
+			backend.rgbw = info.Leds.RGBW
+			backend.initialized = true
+		}
+	}
+	on := current.On != nil && *current.On
+	return on, backend.sent == nil || current.matches(*backend.sent), nil
+}
+
+func (backend *wledBackend) setState(target LightState, transitionTime time.Duration) (bool, error) {
+	state := backend.stateFor(target, transitionTime)
+	if backend.sent != nil && reflect.DeepEqual(state, *backend.sent) {
+		return false, nil
+	}
+	err := backend.request("POST", "/json/state", state, nil)
+	if err != nil {
+		return false, err
+	}
+	backend.sent = &state
+	return true, nil
+}
+
+// stateFor converts the given light state for the device. The color
+// temperature is approximated with RGB colors. RGBW strips use the white
+// channel for the common part of all colors.
+func (backend *wledBackend) stateFor(target LightState, transitionTime time.Duration) wledState {
+	transition := int(transitionTime / time.Millisecond / 100)
+	state := wledState{Transition: &transition}
+	if target.Brightness == 0 {
+		off := false
+		state.On = &off
+	} else if target.Brightness != -1 {
+		state.Brightness = int(math.Max(1, math.Round(float64(target.Brightness)*255/100)))
+	}
+
+	if target.ColorTemperature != -1 {
+		r, g, b := colorTemperatureToRGB(target.ColorTemperature)
+		color := []int{int(r), int(g), int(b)}
+		if backend.rgbw {
+			w := color[0]
+			for _, channel := range color {
+				if channel < w {
+					w = channel
+				}
+			}
+			color = []int{color[0] - w, color[1] - w, color[2] - w, w}
+		}
+		cct := target.ColorTemperature
+		if cct < wledMinimumColorTemperature {
+			cct = wledMinimumColorTemperature
+		} else if cct > wledMaximumColorTemperature {
+			cct = wledMaximumColorTemperature
+		}
+		state.Segments = []wledSegment{{Colors: [][]int{color}, CCT: cct}}
+	}
+	return state
+}
+
+// matches returns true if the current state still shows the sent state.
+func (state wledState) matches(sent wledState) bool {
+	if sent.Brightness != 0 && state.Brightness != sent.Brightness {
+		return false
+	}
+	if len(sent.Segments) == 0 || len(state.Segments) == 0 || len(state.Segments[0].Colors) == 0 {
+		return true
+	}
+	expected := sent.Segments[0].Colors[0]
+	current := state.Segments[0].Colors[0]
+	if len(current) < len(expected) {
+		return false
+	}
+	for i := range expected {
+		if current[i] != expected[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,71 @@
+// MIT License
+//
+// Copyright (c) 2019 Stefan Wichmann
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in all
+// copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+// SOFTWARE.
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWLED(t *testing.T) {
+	if r, g, b := colorTemperatureToRGB(6600); r != 255 || g < 250 || b < 250 {
+		t.Errorf("6600K should be close to white, got %d,%d,%d", r, g, b)
+	}
+	if r, g, b := colorTemperatureToRGB(2000); r != 255 || g >= 160 || b >= 40 {
+		t.Errorf("2000K should be a warm orange, got %d,%d,%d", r, g, b)
+	}
+
+	backend := &wledBackend{host: "wled.local"}
+	state := backend.stateFor(LightState{ColorTemperature: 2700, Brightness: 50}, 400*time.Millisecond)
+	if state.Brightness != 128 || *state.Transition != 4 || state.On != nil {
+		t.Errorf("Unexpected state %+v", state)
+	}
+	if len(state.Segments) != 1 || len(state.Segments[0].Colors[0]) != 3 || state.Segments[0].CCT != 2700 {
+		t.Fatalf("Expected RGB color and CCT, got %+v", state.Segments)
+	}
+
+	backend.rgbw = true
+	rgbw := backend.stateFor(LightState{ColorTemperature: 1000, Brightness: 0}, 0)
+	color := rgbw.Segments[0].Colors[0]
+	if rgbw.On == nil || *rgbw.On || len(color) != 4 || rgbw.Segments[0].CCT != wledMinimumColorTemperature {
+		t.Errorf("Unexpected RGBW state %+v", rgbw)
+	}
+	if color[0] != 255-color[3] || (color[1] != 0 && color[2] != 0) {
+		t.Errorf("White channel should take the common part of all colors, got %v", color)
+	}
+
+	current := wledState{Brightness: 128, Segments: []wledSegment{{Colors: [][]int{append([]int{}, state.Segments[0].Colors[0]...), {0, 0, 0}}}}}
+	if !current.matches(state) {
+		t.Errorf("Device should match the sent state")
+	}
+	current.Brightness = 200
+	if current.matches(state) {
+		t.Errorf("Changed brightness should be detected as manual change")
+	}
+
+	c := Configuration{Schedules: []LightSchedule{{Name: "kitchen", WLED: []string{"wled.local", "wled-2.local"}}}}
+	provider := &wledProvider{backends: make(map[string]*wledBackend)}
+	discovered, _ := provider.Discover(&c)
+	if len(discovered) != 2 || discovered[1].ID != "wled-2.local" || discovered[1].Schedule != "kitchen" {
+		t.Errorf("Expected two WLED controllers, got %+v", discovered)
+	}
+}